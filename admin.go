@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	bg "github.com/SSSOCPaulCote/blunderguard"
+)
+
+var (
+	ErrInvalidToken  = bg.Error("invalid admin token")
+	ErrAdminDisabled = bg.Error("admin access is disabled, set AdminToken to enable it")
+)
+
+// Admin gives access to the commands that change the instrument persistently or drive its outputs: calibration
+// writes, degas, source tuning and digital outputs. Routine scanning and tagging never need it
+type Admin struct {
+	e *MksRgaDatasource
+}
+
+// Admin returns the admin handle if the token matches AdminToken. Without an AdminToken admin access is disabled
+func (e *MksRgaDatasource) Admin(token string) (*Admin, error) {
+	if e.config.AdminToken == "" {
+		return nil, ErrAdminDisabled
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(e.config.AdminToken)) != 1 {
+		e.annotate("Admin access denied", "", "admin")
+		return nil, ErrInvalidToken
+	}
+	return &Admin{e: e}, nil
+}
+
+// SetInletFactor changes the pressure reduction factor of an inlet between scans
+func (a *Admin) SetInletFactor(index int, factor float64) error {
+	return a.e.inLoop(func() error {
+		return a.e.setInletFactor(index, factor)
+	})
+}
+
+// SetRollover changes the rollover variables of the running recording between scans
+func (a *Admin) SetRollover(r cfg.Rollover) error {
+	return a.e.inLoop(func() error {
+		return a.e.setRollover(r)
+	})
+}
+
+// SetRolloverCorrection enables or disables the rollover correction of a measurement of the running recording
+func (a *Admin) SetRolloverCorrection(name string, useCorrection bool) error {
+	return a.e.inLoop(func() error {
+		return a.e.setRolloverCorrection(name, useCorrection)
+	})
+}
+
+// ApplySourceProfile applies a configured source profile to the running recording between scans
+func (a *Admin) ApplySourceProfile(name string) error {
+	return a.e.inLoop(func() error {
+		return a.e.applySourceProfile(name)
+	})
+}
+
+// SetIonizationMode switches the running recording between Standard and Soft ionization between scans
+func (a *Admin) SetIonizationMode(mode string) error {
+	return a.e.inLoop(func() error {
+		return a.e.setIonizationMode(mode)
+	})
+}
+
+// SetDetectorFactor writes the sensitivity factor of a detector and, if save is set, saves it to the sensor's
+// non-volatile memory with SaveChanges
+func (a *Admin) SetDetectorFactor(sourceIndex, detectorIndex, filament int, factor float64, save bool) error {
+	return a.e.inLoop(func() error {
+		if _, err := a.e.connection.DetectorFactor(sourceIndex, detectorIndex, filament, factor); err != nil {
+			return err
+		}
+		a.e.annotate("Detector factor", fmt.Sprintf("source %d detector %d filament %d: %v", sourceIndex, detectorIndex, filament, factor), "calibration", "admin")
+		if !save {
+			return nil
+		}
+		return a.e.saveChanges()
+	})
+}
+
+// SaveChanges saves the current settings to the sensor's non-volatile memory
+func (a *Admin) SaveChanges() error {
+	return a.e.inLoop(a.e.saveChanges)
+}
+
+// saveChanges sends SaveChanges
+func (e *MksRgaDatasource) saveChanges() error {
+	if _, err := e.connection.SaveChanges(); err != nil {
+		return err
+	}
+	e.annotate("Settings saved", "", "calibration", "admin")
+	return nil
+}
+
+// SetDigitalOutput sets the value of a digital output port. Bits mapped to alarms are overwritten when the alarm changes
+func (a *Admin) SetDigitalOutput(port string, value int) error {
+	return a.e.inLoop(func() error {
+		if _, err := a.e.connection.DigitalOutput(port, value); err != nil {
+			return err
+		}
+		if a.e.digitalPorts == nil {
+			a.e.digitalPorts = make(map[string]int)
+		}
+		a.e.digitalPorts[port] = value
+		a.e.annotate("Digital output", fmt.Sprintf("port %s: %d", port, value), "admin")
+		return nil
+	})
+}
+
+// Degas runs a degas cycle on the next polling tick, with the configured powers and periods
+func (a *Admin) Degas() error {
+	return a.e.inLoop(func() error {
+		a.e.degasRequested = true
+		return nil
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+var (
+	alarmAirLeak = "AirLeak"
+	// airN2O2Ratio is the m28/m32 ratio of air and airArN2Ratio its m40/m28 ratio
+	airN2O2Ratio             = 3.7
+	airArN2Ratio             = 0.012
+	defaultAirLeakTolerance  = 0.3
+	defaultAirLeakConfidence = 0.6
+	defaultAirLeakScans      = 3
+)
+
+// validateAirLeakDetector checks the air leak detector configuration
+func validateAirLeakDetector(d *cfg.AirLeakDetector) error {
+	if d == nil {
+		return nil
+	}
+	if d.MinConfidence < 0 || d.MinConfidence > 1 {
+		return fmt.Errorf("Air leak minimum confidence must be between 0 and 1, got %v", d.MinConfidence)
+	}
+	if d.RatioTolerance < 0 || d.MinPressure < 0 || d.Scans < 0 {
+		return fmt.Errorf("Air leak ratio tolerance, minimum pressure and scans cannot be negative")
+	}
+	return nil
+}
+
+// airLeakConfidence scores how closely the masses of a scan match air, from 0 to 1, and returns the m28/m32 ratio. The
+// ratio counts for 70%, scoring 1 at 3.7 down to 0 at tolerance away from it, and the presence of argon in about the
+// proportion of air for the remaining 30%. It returns false if mass 28 and 32 aren't both above minPressure
+func airLeakConfidence(heights map[string]float64, minPressure, tolerance float64) (float64, float64, bool) {
+	n2, o2, ar := heights["28"], heights["32"], heights["40"]
+	if n2 <= minPressure || o2 <= minPressure {
+		return 0, 0, false
+	}
+	ratio := n2 / o2
+	ratioScore := math.Max(0, 1-math.Abs(ratio/airN2O2Ratio-1)/tolerance)
+	argonScore := math.Min(1, ar/n2/airArN2Ratio)
+	return 0.7*ratioScore + 0.3*argonScore, ratio, true
+}
+
+// confidenceLevel names a confidence for operators
+func confidenceLevel(c float64) string {
+	switch {
+	case c >= 0.85:
+		return "high"
+	case c >= 0.6:
+		return "medium"
+	}
+	return "low"
+}
+
+// detectAirLeak checks the scan for the air leak signature, m28/m32 close to 3.7 with argon at m40. Once Scans
+// consecutive scans reach MinConfidence the AirLeak alarm is raised and an "Air leak suspected" event with the
+// confidence is emitted. The alarm clears on the first scan below it
+func (e *MksRgaDatasource) detectAirLeak(frameChan chan *proto.Frame, scan *Scan) {
+	d := e.config.AirLeakDetector
+	if d == nil {
+		return
+	}
+	// absolute pressures are needed to apply MinPressure
+	heights := massHeights(scan.Readings, "")
+	tolerance := d.RatioTolerance
+	if tolerance == 0 {
+		tolerance = defaultAirLeakTolerance
+	}
+	minConfidence := d.MinConfidence
+	if minConfidence == 0 {
+		minConfidence = defaultAirLeakConfidence
+	}
+	scans := d.Scans
+	if scans == 0 {
+		scans = defaultAirLeakScans
+	}
+	confidence, ratio, ok := airLeakConfidence(heights, d.MinPressure, tolerance)
+	if !ok || confidence < minConfidence {
+		e.airLeakScans = 0
+		e.setAlarm(alarmAirLeak, false)
+		return
+	}
+	if e.airLeakScans++; e.airLeakScans != scans {
+		return
+	}
+	a := &Annotation{
+		Time:       scan.Time,
+		Title:      "Air leak suspected",
+		Text:       fmt.Sprintf("m28/m32 %.2f, m40/m28 %.4f, %s confidence", ratio, heights["40"]/heights["28"], confidenceLevel(confidence)),
+		Tags:       []string{"airleak"},
+		Confidence: confidence,
+	}
+	log.Printf("%s: %s (%.2f)", a.Title, a.Text, confidence)
+	e.setAlarm(alarmAirLeak, true)
+	e.writeAnnotation(a)
+	e.emitEvent(frameChan, a)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// alarm classes raised by the datasource
+var (
+	alarmStaleData = "StaleData"
+	alarmInterlock = "Interlock"
+)
+
+// alarmHandler is called when an alarm is raised or cleared
+type alarmHandler func(class string, active bool)
+
+// AlarmEvent is an alarm being raised or cleared
+type AlarmEvent struct {
+	Time   time.Time
+	Class  string
+	Active bool
+	Rig    string
+	Run    string
+	Serial string
+}
+
+// AlarmWriter is implemented by sinks notified of alarms
+type AlarmWriter interface {
+	WriteAlarm(a *AlarmEvent) error
+}
+
+// setAlarm raises or clears an alarm and notifies every handler of the change. Alarms only change between scans so
+// that handlers can send commands to the sensor
+func (e *MksRgaDatasource) setAlarm(class string, active bool) {
+	if e.alarms[class] == active {
+		return
+	}
+	if e.alarms == nil {
+		e.alarms = make(map[string]bool)
+	}
+	e.alarms[class] = active
+	if active {
+		log.Printf("Alarm %s raised", class)
+		e.annotate("Alarm raised", class, "alarm")
+	} else {
+		log.Printf("Alarm %s cleared", class)
+		e.annotate("Alarm cleared", class, "alarm")
+	}
+	for _, h := range e.alarmHandlers {
+		h(class, active)
+	}
+}
+
+// ActiveAlarms returns the classes of the alarms currently raised
+func (e *MksRgaDatasource) ActiveAlarms() (classes []string, err error) {
+	err = e.inLoop(func() error {
+		for class, active := range e.alarms {
+			if active {
+				classes = append(classes, class)
+			}
+		}
+		return nil
+	})
+	return classes, err
+}
+
+// writeAlarm queues the alarm for every sink supporting it. It is registered as an alarm handler
+func (e *MksRgaDatasource) writeAlarm(class string, active bool) {
+	a := &AlarmEvent{Time: e.now(), Class: class, Active: active, Rig: e.config.RigID, Run: e.runID(), Serial: e.serial}
+	for _, q := range e.sinkQueues {
+		if w, ok := q.sink.(AlarmWriter); ok {
+			q.call("alarm", func() error { return w.WriteAlarm(a) })
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+var (
+	grafanaTimeout   = 10 * time.Second
+	grafanaQueueSize = 64
+)
+
+// Annotation is an instrument state change displayed alongside the pressure traces
+type Annotation struct {
+	Time  time.Time `json:"time"`
+	Title string    `json:"title"`
+	Text  string    `json:"text,omitempty"`
+	Tags  []string  `json:"tags,omitempty"`
+	// Confidence of a detector event, from 0 to 1
+	Confidence float64 `json:"confidence,omitempty"`
+}
+
+// Annotator receives annotation events. Sinks implementing it are used automatically, from their queue
+type Annotator interface {
+	Annotate(a *Annotation) error
+}
+
+// grafanaAnnotator posts annotations to the Grafana HTTP API from its own goroutine, so a slow Grafana never delays
+// the recording
+type grafanaAnnotator struct {
+	config *cfg.Config
+	client *http.Client
+	queue  chan *Annotation
+}
+
+var _ Annotator = (*grafanaAnnotator)(nil)
+
+// grafanaAnnotation is the body of a POST /api/annotations request
+type grafanaAnnotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	Time         int64    `json:"time"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// newAnnotators returns the Grafana annotator and email notifier if configured. Sinks able to store annotations are
+// written from their queue instead
+func newAnnotators(config *cfg.Config) []Annotator {
+	var annotators []Annotator
+	if config.SMTP != nil {
+		n, err := newEmailNotifier(config.SMTP, config.RigID)
+		if err != nil {
+			log.Printf("%v, email notifications disabled", err)
+		} else {
+			annotators = append(annotators, n)
+		}
+	}
+	if config.GrafanaAnnotations {
+		if config.GrafanaURL == "" {
+			log.Println("GrafanaURL cannot be blank, Grafana annotations disabled")
+		} else {
+			annotators = append(annotators, newGrafanaAnnotator(config))
+		}
+	}
+	return annotators
+}
+
+// newGrafanaAnnotator starts the poster
+func newGrafanaAnnotator(config *cfg.Config) *grafanaAnnotator {
+	g := &grafanaAnnotator{config: config, client: &http.Client{Timeout: grafanaTimeout}, queue: make(chan *Annotation, grafanaQueueSize)}
+	go g.run()
+	return g
+}
+
+// Annotate implements the Annotator interface, queuing the annotation without blocking
+func (g *grafanaAnnotator) Annotate(a *Annotation) error {
+	select {
+	case g.queue <- a:
+		return nil
+	default:
+		return fmt.Errorf("grafana annotation queue full")
+	}
+}
+
+// run posts the queued annotations
+func (g *grafanaAnnotator) run() {
+	for a := range g.queue {
+		if err := g.post(a); err != nil {
+			log.Printf("Could not post annotation %q to Grafana: %v", a.Title, err)
+		}
+	}
+}
+
+// post posts the annotation
+func (g *grafanaAnnotator) post(a *Annotation) error {
+	text := a.Title
+	if a.Text != "" {
+		text += ": " + a.Text
+	}
+	b, err := json.Marshal(&grafanaAnnotation{
+		DashboardUID: g.config.GrafanaDashboardUID,
+		Time:         a.Time.UnixMilli(),
+		Tags:         append([]string{pluginName}, a.Tags...),
+		Text:         text,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(g.config.GrafanaURL, "/")+"/api/annotations", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.config.GrafanaAPIToken != "" {
+		req.Header.Set("Authorization", "Bearer "+g.config.GrafanaAPIToken)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("grafana annotation rejected: %s", resp.Status)
+	}
+	return nil
+}
+
+// annotate sends an annotation to every annotator. Failures are logged only
+func (e *MksRgaDatasource) annotate(title, text string, tags ...string) {
+	e.writeAnnotation(&Annotation{Time: e.now(), Title: title, Text: text, Tags: tags})
+}
+
+// writeAnnotation sends the annotation to every annotator and queues it for every sink able to store it
+func (e *MksRgaDatasource) writeAnnotation(a *Annotation) {
+	for _, an := range e.annotators {
+		if err := an.Annotate(a); err != nil {
+			log.Printf("Could not write annotation %q: %v", a.Title, err)
+		}
+	}
+	for _, q := range e.sinkQueues {
+		if an, ok := q.sink.(Annotator); ok {
+			q.call("annotation", func() error { return an.Annotate(a) })
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+var (
+	maxAPIRequest = int64(64 << 10)
+	// apiStatus is the HTTP status answered for the errors the caller can do something about, others answer 500
+	apiStatus = map[error]int{
+		ErrNotRecording:          http.StatusConflict,
+		ErrEditTimeout:           http.StatusServiceUnavailable,
+		ErrBakeOutDisabled:       http.StatusNotFound,
+		ErrUnknownMeasurement:    http.StatusNotFound,
+		ErrAdminDisabled:         http.StatusForbidden,
+		ErrInvalidToken:          http.StatusForbidden,
+		ErrUnknownSourceProfile:  http.StatusNotFound,
+		ErrUnknownIonizationMode: http.StatusBadRequest,
+		ErrFingerprintDisabled:   http.StatusNotFound,
+	}
+)
+
+// apiHandler handles an API request and returns the value answered as JSON, nil for 204 No Content
+type apiHandler func(r *http.Request) (interface{}, error)
+
+// apiMux returns the handler of the operator API: the commands and queries of the running recording, under /api/.
+// Every request must carry the APIToken as a bearer token, the admin commands under /api/admin/ also the AdminToken in
+// the X-Admin-Token header
+func (e *MksRgaDatasource) apiMux() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/api/bakeout/start", apiPost(func(r *http.Request) (interface{}, error) {
+		return nil, e.StartBakeOut()
+	}))
+	mux.Handle("/api/bakeout/stop", apiPost(func(r *http.Request) (interface{}, error) {
+		return nil, e.StopBakeOut()
+	}))
+	mux.Handle("/api/measurements/edit", apiPost(func(r *http.Request) (interface{}, error) {
+		var req measurementEditRequest
+		if err := decodeAPIRequest(r, &req); err != nil {
+			return nil, err
+		}
+		edits, err := req.edits()
+		if err != nil {
+			return nil, err
+		}
+		return nil, e.EditMeasurement(req.Name, edits...)
+	}))
+	mux.Handle("/api/runs/start", apiPost(func(r *http.Request) (interface{}, error) {
+		var req struct {
+			ID          string `json:"id"`
+			Description string `json:"description"`
+		}
+		if err := decodeAPIRequest(r, &req); err != nil {
+			return nil, err
+		}
+		return nil, e.StartRun(req.ID, req.Description)
+	}))
+	mux.Handle("/api/runs/end", apiPost(func(r *http.Request) (interface{}, error) {
+		return nil, e.EndRun()
+	}))
+	mux.Handle("/api/fingerprint/capture", apiPost(func(r *http.Request) (interface{}, error) {
+		return nil, e.CaptureFingerprint()
+	}))
+	mux.Handle("/api/inlet", apiGet(func(r *http.Request) (interface{}, error) {
+		inlet, err := e.ActiveInlet()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"inlet": inlet}, nil
+	}))
+	mux.Handle("/api/inlet/select", apiPost(func(r *http.Request) (interface{}, error) {
+		var req struct {
+			Index int `json:"index"`
+		}
+		if err := decodeAPIRequest(r, &req); err != nil {
+			return nil, err
+		}
+		return nil, e.SelectInlet(req.Index)
+	}))
+	mux.Handle("/api/rollover", apiGet(func(r *http.Request) (interface{}, error) {
+		return e.RolloverInfo()
+	}))
+	mux.Handle("/api/alarms", apiGet(func(r *http.Request) (interface{}, error) {
+		classes, err := e.ActiveAlarms()
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(classes)
+		return map[string][]string{"alarms": append([]string{}, classes...)}, nil
+	}))
+	mux.Handle("/api/admin/inlet-factor", e.apiAdmin(func(a *Admin, r *http.Request) error {
+		var req struct {
+			Index  int     `json:"index"`
+			Factor float64 `json:"factor"`
+		}
+		if err := decodeAPIRequest(r, &req); err != nil {
+			return err
+		}
+		return a.SetInletFactor(req.Index, req.Factor)
+	}))
+	mux.Handle("/api/admin/rollover", e.apiAdmin(func(a *Admin, r *http.Request) error {
+		var req cfg.Rollover
+		if err := decodeAPIRequest(r, &req); err != nil {
+			return err
+		}
+		return a.SetRollover(req)
+	}))
+	mux.Handle("/api/admin/rollover-correction", e.apiAdmin(func(a *Admin, r *http.Request) error {
+		var req struct {
+			Name          string `json:"name"`
+			UseCorrection bool   `json:"useCorrection"`
+		}
+		if err := decodeAPIRequest(r, &req); err != nil {
+			return err
+		}
+		return a.SetRolloverCorrection(req.Name, req.UseCorrection)
+	}))
+	mux.Handle("/api/admin/source-profile", e.apiAdmin(func(a *Admin, r *http.Request) error {
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := decodeAPIRequest(r, &req); err != nil {
+			return err
+		}
+		return a.ApplySourceProfile(req.Name)
+	}))
+	mux.Handle("/api/admin/ionization-mode", e.apiAdmin(func(a *Admin, r *http.Request) error {
+		var req struct {
+			Mode string `json:"mode"`
+		}
+		if err := decodeAPIRequest(r, &req); err != nil {
+			return err
+		}
+		return a.SetIonizationMode(req.Mode)
+	}))
+	mux.Handle("/api/admin/detector-factor", e.apiAdmin(func(a *Admin, r *http.Request) error {
+		var req struct {
+			SourceIndex   int     `json:"sourceIndex"`
+			DetectorIndex int     `json:"detectorIndex"`
+			Filament      int     `json:"filament"`
+			Factor        float64 `json:"factor"`
+			Save          bool    `json:"save"`
+		}
+		if err := decodeAPIRequest(r, &req); err != nil {
+			return err
+		}
+		return a.SetDetectorFactor(req.SourceIndex, req.DetectorIndex, req.Filament, req.Factor, req.Save)
+	}))
+	mux.Handle("/api/admin/save", e.apiAdmin(func(a *Admin, r *http.Request) error {
+		return a.SaveChanges()
+	}))
+	mux.Handle("/api/admin/digital-output", e.apiAdmin(func(a *Admin, r *http.Request) error {
+		var req struct {
+			Port  string `json:"port"`
+			Value int    `json:"value"`
+		}
+		if err := decodeAPIRequest(r, &req); err != nil {
+			return err
+		}
+		return a.SetDigitalOutput(req.Port, req.Value)
+	}))
+	mux.Handle("/api/admin/degas", e.apiAdmin(func(a *Admin, r *http.Request) error {
+		return a.Degas()
+	}))
+	return e.apiAuth(mux)
+}
+
+// apiAdmin serves an admin command, a POST carrying the AdminToken in the X-Admin-Token header
+func (e *MksRgaDatasource) apiAdmin(command func(a *Admin, r *http.Request) error) http.Handler {
+	return apiPost(func(r *http.Request) (interface{}, error) {
+		a, err := e.Admin(r.Header.Get("X-Admin-Token"))
+		if err != nil {
+			return nil, err
+		}
+		return nil, command(a, r)
+	})
+}
+
+// measurementEditRequest is the body of a POST /api/measurements/edit request, e.g.
+// {"name": "bar", "edits": [{"edit": "MeasurementEndMass", "value": 50}]}
+type measurementEditRequest struct {
+	Name  string `json:"name"`
+	Edits []struct {
+		Edit  mks.RGAMeasurementEdit `json:"edit"`
+		Value int                    `json:"value"`
+	} `json:"edits"`
+}
+
+// edits returns the requested edits, checking their names
+func (req *measurementEditRequest) edits() ([]mks.MeasurementEdit, error) {
+	edits := make([]mks.MeasurementEdit, len(req.Edits))
+	for i, edit := range req.Edits {
+		switch edit.Edit {
+		case mks.RGA_EDIT_ADD_MASS, mks.RGA_EDIT_REMOVE_MASS, mks.RGA_EDIT_START_MASS, mks.RGA_EDIT_END_MASS,
+			mks.RGA_EDIT_ACCURACY, mks.RGA_EDIT_EGAIN, mks.RGA_EDIT_DETECTOR:
+		default:
+			return nil, &apiBadRequest{err: fmt.Errorf("unknown measurement edit %q", edit.Edit)}
+		}
+		edits[i] = mks.MeasurementEdit{Edit: edit.Edit, Value: edit.Value}
+	}
+	return edits, nil
+}
+
+// serveAPI serves the operator API on the given address
+func (e *MksRgaDatasource) serveAPI(addr string) {
+	mux := e.apiMux()
+	go func() {
+		log.Printf("API listening on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("API stopped: %v", err)
+		}
+	}()
+}
+
+// apiAuth refuses the requests without the APIToken
+func (e *MksRgaDatasource) apiAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || e.config.APIToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(e.config.APIToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiPost serves a command, only accepted as a POST
+func apiPost(h apiHandler) http.Handler {
+	return apiMethod(http.MethodPost, h)
+}
+
+// apiGet serves a query, only accepted as a GET
+func apiGet(h apiHandler) http.Handler {
+	return apiMethod(http.MethodGet, h)
+}
+
+// apiMethod answers the result of the handler, or its error with the matching status
+func apiMethod(method string, h apiHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		v, err := h(r)
+		if err != nil {
+			http.Error(w, err.Error(), apiErrorStatus(err))
+			return
+		}
+		if v == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			log.Printf("Could not answer API request: %v", err)
+		}
+	})
+}
+
+// apiErrorStatus returns the HTTP status of the error
+func apiErrorStatus(err error) int {
+	var bad *apiBadRequest
+	if errors.As(err, &bad) {
+		return http.StatusBadRequest
+	}
+	for target, status := range apiStatus {
+		if errors.Is(err, target) {
+			return status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// apiBadRequest is a request body that can't be decoded
+type apiBadRequest struct {
+	err error
+}
+
+// Error implements the error interface
+func (e *apiBadRequest) Error() string {
+	return "invalid request: " + e.err.Error()
+}
+
+// decodeAPIRequest decodes the JSON body of the request into v
+func decodeAPIRequest(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxAPIRequest))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return &apiBadRequest{err: err}
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+const testAPIToken = "secret"
+
+// apiTest serves the API of a datasource whose recording loop only runs the requests between scans
+func apiTest(t *testing.T, config *cfg.Config) (*MksRgaDatasource, *httptest.Server) {
+	t.Helper()
+	config.APIToken = testAPIToken
+	e := newDatasource(config)
+	atomic.StoreInt32(&e.recording, 1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case req := <-e.loopChan:
+				req.errChan <- req.fn()
+			case <-done:
+				return
+			}
+		}
+	}()
+	srv := httptest.NewServer(e.apiMux())
+	t.Cleanup(func() {
+		srv.Close()
+		close(done)
+	})
+	return e, srv
+}
+
+// apiCall sends the request with the API token and returns the status and body of the answer
+func apiCall(t *testing.T, srv *httptest.Server, method, path, body string, header ...string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAPIToken)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+func TestAPIAuth(t *testing.T) {
+	_, srv := apiTest(t, &cfg.Config{BakeOut: &cfg.BakeOut{}})
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{name: "no token", status: http.StatusUnauthorized},
+		{name: "wrong token", header: "Bearer nope", status: http.StatusUnauthorized},
+		{name: "not bearer", header: testAPIToken, status: http.StatusUnauthorized},
+		{name: "token", header: "Bearer " + testAPIToken, status: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/bakeout/stop", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestAPIBakeOut(t *testing.T) {
+	e, srv := apiTest(t, &cfg.Config{BakeOut: &cfg.BakeOut{}})
+	if status, body := apiCall(t, srv, http.MethodGet, "/api/bakeout/start", ""); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET /api/bakeout/start = %d %s, want 405", status, body)
+	}
+	if status, body := apiCall(t, srv, http.MethodPost, "/api/bakeout/start", ""); status != http.StatusNoContent {
+		t.Fatalf("POST /api/bakeout/start = %d %s", status, body)
+	}
+	if e.bakeOut == nil {
+		t.Fatal("bake-out not started")
+	}
+	if status, body := apiCall(t, srv, http.MethodPost, "/api/bakeout/stop", ""); status != http.StatusNoContent {
+		t.Fatalf("POST /api/bakeout/stop = %d %s", status, body)
+	}
+	if e.bakeOut != nil {
+		t.Error("bake-out not stopped")
+	}
+
+	_, srv = apiTest(t, &cfg.Config{})
+	if status, body := apiCall(t, srv, http.MethodPost, "/api/bakeout/start", ""); status != http.StatusNotFound {
+		t.Errorf("POST /api/bakeout/start without BakeOut = %d %s, want 404", status, body)
+	}
+}
+
+func TestAPINotRecording(t *testing.T) {
+	e, srv := apiTest(t, &cfg.Config{BakeOut: &cfg.BakeOut{}})
+	atomic.StoreInt32(&e.recording, 0)
+	if status, body := apiCall(t, srv, http.MethodPost, "/api/bakeout/start", ""); status != http.StatusConflict {
+		t.Errorf("POST /api/bakeout/start while idle = %d %s, want 409", status, body)
+	}
+}
+
+func TestAPIEditMeasurement(t *testing.T) {
+	_, srv := apiTest(t, &cfg.Config{})
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "unknown measurement", body: `{"name": "bar", "edits": [{"edit": "MeasurementEndMass", "value": 50}]}`, status: http.StatusNotFound},
+		{name: "unknown edit", body: `{"name": "bar", "edits": [{"edit": "MeasurementColor", "value": 1}]}`, status: http.StatusBadRequest},
+		{name: "unknown field", body: `{"name": "bar", "edit": "MeasurementEndMass"}`, status: http.StatusBadRequest},
+		{name: "not JSON", body: `bar`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, body := apiCall(t, srv, http.MethodPost, "/api/measurements/edit", tt.body); status != tt.status {
+				t.Errorf("POST /api/measurements/edit = %d %s, want %d", status, body, tt.status)
+			}
+		})
+	}
+}
+
+func TestAPIAdmin(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminToken string // configured
+		header     string // sent
+		path       string
+		body       string
+		status     int
+		degas      bool
+	}{
+		{name: "disabled", header: "admin", path: "/api/admin/degas", status: http.StatusForbidden},
+		{name: "no token", adminToken: "admin", path: "/api/admin/degas", status: http.StatusForbidden},
+		{name: "wrong token", adminToken: "admin", header: "nope", path: "/api/admin/degas", status: http.StatusForbidden},
+		{name: "API token", adminToken: "admin", header: testAPIToken, path: "/api/admin/degas", status: http.StatusForbidden},
+		{name: "accepted", adminToken: "admin", header: "admin", path: "/api/admin/degas", status: http.StatusNoContent, degas: true},
+		{name: "unknown profile", adminToken: "admin", header: "admin", path: "/api/admin/source-profile", body: `{"name": "soft"}`, status: http.StatusNotFound},
+		{name: "bad body", adminToken: "admin", header: "admin", path: "/api/admin/inlet-factor", body: `{"index": "one"}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, srv := apiTest(t, &cfg.Config{AdminToken: tt.adminToken})
+			var header []string
+			if tt.header != "" {
+				header = []string{"X-Admin-Token", tt.header}
+			}
+			if status, body := apiCall(t, srv, http.MethodPost, tt.path, tt.body, header...); status != tt.status {
+				t.Errorf("POST %s = %d %s, want %d", tt.path, status, body, tt.status)
+			}
+			if e.degasRequested != tt.degas {
+				t.Errorf("degas requested = %v, want %v", e.degasRequested, tt.degas)
+			}
+		})
+	}
+}
+
+func TestAPIRuns(t *testing.T) {
+	e, srv := apiTest(t, &cfg.Config{StateFile: filepath.Join(t.TempDir(), "state.json")})
+	frameChan := make(chan *proto.Frame, 4)
+	e.setFrameChan(frameChan, false)
+	if status, body := apiCall(t, srv, http.MethodPost, "/api/runs/start", `{"id": "r1", "description": "pump down"}`); status != http.StatusNoContent {
+		t.Fatalf("POST /api/runs/start = %d %s", status, body)
+	}
+	if e.run == nil || e.run.ID != "r1" || e.run.Description != "pump down" {
+		t.Fatalf("open run = %+v, want r1", e.run)
+	}
+	if status, body := apiCall(t, srv, http.MethodPost, "/api/runs/start", `{}`); status != http.StatusNoContent {
+		t.Fatalf("POST /api/runs/start = %d %s", status, body)
+	}
+	if e.run == nil || e.run.ID == "" || e.run.ID == "r1" {
+		t.Fatalf("open run = %+v, want a generated ID", e.run)
+	}
+	if status, body := apiCall(t, srv, http.MethodPost, "/api/runs/end", ""); status != http.StatusNoContent {
+		t.Fatalf("POST /api/runs/end = %d %s", status, body)
+	}
+	if e.run != nil {
+		t.Errorf("open run = %+v after /api/runs/end", e.run)
+	}
+	if len(frameChan) != 2 {
+		t.Errorf("%d run summaries emitted, want 2", len(frameChan))
+	}
+}
+
+func TestAPIFingerprint(t *testing.T) {
+	e, srv := apiTest(t, &cfg.Config{Fingerprint: &cfg.Fingerprint{}})
+	if status, body := apiCall(t, srv, http.MethodPost, "/api/fingerprint/capture", ""); status != http.StatusNoContent {
+		t.Fatalf("POST /api/fingerprint/capture = %d %s", status, body)
+	}
+	if !e.captureRef {
+		t.Error("next scan not captured as the reference spectrum")
+	}
+
+	_, srv = apiTest(t, &cfg.Config{})
+	if status, body := apiCall(t, srv, http.MethodPost, "/api/fingerprint/capture", ""); status != http.StatusNotFound {
+		t.Errorf("POST /api/fingerprint/capture without Fingerprint = %d %s, want 404", status, body)
+	}
+}
+
+func TestAPIInlet(t *testing.T) {
+	_, srv := apiTest(t, &cfg.Config{Inlets: []cfg.Inlet{{Index: 1, Name: "chamber"}, {Index: 2, Name: "loadlock"}}})
+	if status, body := apiCall(t, srv, http.MethodPost, "/api/inlet/select", `{"index": 2}`); status != http.StatusNoContent {
+		t.Fatalf("POST /api/inlet/select = %d %s", status, body)
+	}
+	status, body := apiCall(t, srv, http.MethodGet, "/api/inlet", "")
+	if status != http.StatusOK {
+		t.Fatalf("GET /api/inlet = %d %s", status, body)
+	}
+	if want := `{"inlet":"loadlock"}` + "\n"; body != want {
+		t.Errorf("GET /api/inlet = %q, want %q", body, want)
+	}
+}
+
+func TestAPIRollover(t *testing.T) {
+	s := newFakeSensor(t)
+	s.respond("RolloverInfo", "RolloverInfo OK", "  M1 10", "  M2 30", "  B1 -0.5", "  B2 0.25", "  BP1 12.5", "  ScaleFactor18 1.2")
+	e, srv := apiTest(t, &cfg.Config{})
+	conn, err := ConnectToRGA(s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	e.connection = conn
+	status, body := apiCall(t, srv, http.MethodGet, "/api/rollover", "")
+	if status != http.StatusOK {
+		t.Fatalf("GET /api/rollover = %d %s", status, body)
+	}
+	if want := `{"M1":10,"M2":30,"B1":-0.5,"B2":0.25,"BP1":12.5,"ScaleFactors":{"18":1.2}}` + "\n"; body != want {
+		t.Errorf("GET /api/rollover = %s, want %s", body, want)
+	}
+}
+
+func TestAPIAlarms(t *testing.T) {
+	e, srv := apiTest(t, &cfg.Config{})
+	if status, body := apiCall(t, srv, http.MethodGet, "/api/alarms", ""); status != http.StatusOK || body != `{"alarms":[]}`+"\n" {
+		t.Errorf("GET /api/alarms = %d %s, want no alarms", status, body)
+	}
+	e.setAlarm(alarmStaleData, true)
+	e.setAlarm(alarmInterlock, true)
+	status, body := apiCall(t, srv, http.MethodGet, "/api/alarms", "")
+	if want := `{"alarms":["` + alarmInterlock + `","` + alarmStaleData + `"]}` + "\n"; status != http.StatusOK || body != want {
+		t.Errorf("GET /api/alarms = %d %s, want %s", status, body, want)
+	}
+}
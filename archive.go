@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+var defaultArchiveBatchScans = 240
+
+// archiveSink gzips batches of raw frame payloads with the time of their scan, one JSON document per line, and uploads
+// them to an S3-compatible bucket under date-partitioned keys
+type archiveSink struct {
+	config     *cfg.Config
+	store      *objectStore
+	batchScans int
+	scans      int
+	first      time.Time
+	buf        *bytes.Buffer
+	gz         *gzip.Writer
+	pending    *pendingBatches // objects not uploaded yet
+}
+
+var _ Sink = (*archiveSink)(nil)
+
+// newArchiveSink creates the sink and its object store client
+func newArchiveSink(config *cfg.Config) (*archiveSink, error) {
+	store, err := newObjectStore(config)
+	if err != nil {
+		return nil, err
+	}
+	s := &archiveSink{config: config, store: store, batchScans: config.ArchiveBatchScans, pending: newPendingBatches("archive", config.ArchiveMaxPending, config.SpillDir)}
+	if s.batchScans <= 0 {
+		s.batchScans = defaultArchiveBatchScans
+	}
+	return s, nil
+}
+
+// Name implements the Sink interface
+func (s *archiveSink) Name() string {
+	return "archive"
+}
+
+// Open checks that the bucket exists
+func (s *archiveSink) Open() error {
+	return s.store.checkBucket()
+}
+
+// Write appends the frame payload of the scan to the current batch and uploads it once full. A batch that can't be
+// uploaded is kept pending rather than failing the scan, which is in it already
+func (s *archiveSink) Write(scan *Scan) error {
+	b, err := json.Marshal(&archiveLine{Time: scan.Time, Frame: &Frame{Rig: scan.Rig, Serial: scan.Serial, Flags: scan.Flags, Data: scan.Readings}})
+	if err != nil {
+		return err
+	}
+	if s.gz == nil {
+		// the buffer of an object still pending is kept, a new one is used
+		s.buf = new(bytes.Buffer)
+		s.gz = gzip.NewWriter(s.buf)
+		s.first = scan.Time
+	}
+	if _, err := s.gz.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	s.scans++
+	if s.scans >= s.batchScans {
+		if err := s.upload(); err != nil {
+			log.Printf("Could not archive scans, kept pending: %v", err)
+		}
+	}
+	return nil
+}
+
+// upload closes the current batch and writes it to the bucket as <prefix>/YYYY/MM/DD/mks-<first scan>.jsonl.gz, along
+// with the pending objects
+func (s *archiveSink) upload() error {
+	if s.gz == nil {
+		return s.pending.flush(s.put)
+	}
+	err := s.gz.Close()
+	scans := s.scans
+	s.gz = nil
+	s.scans = 0
+	if err != nil {
+		sinkScansDropped.Add(s.Name(), int64(scans))
+		return err
+	}
+	t := s.first.UTC()
+	key := path.Join(s.config.ArchivePrefix, t.Format("2006/01/02"), fmt.Sprintf("mks-%d.jsonl.gz", t.UnixMilli()))
+	return s.pending.write(pendingBatch{name: key, data: s.buf.Bytes(), scans: scans}, s.put)
+}
+
+// put uploads the object
+func (s *archiveSink) put(b pendingBatch) error {
+	if err := s.store.put(b.name, b.data, "application/gzip"); err != nil {
+		return err
+	}
+	log.Printf("Archived %d scans to %s", b.scans, b.name)
+	return nil
+}
+
+// Flush uploads the current batch
+func (s *archiveSink) Flush() error {
+	return s.upload()
+}
+
+// Close uploads the current batch
+func (s *archiveSink) Close() error {
+	return s.upload()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+// driveAudio sounds the sensor's audio output at the frequency of the first configured alarm that is raised and
+// silences it once none are
+func (e *MksRgaDatasource) driveAudio(class string, active bool) {
+	frequency := 0
+	for _, a := range e.config.AudioAlarms {
+		if e.alarms[a.Alarm] {
+			frequency = a.Frequency
+			break
+		}
+	}
+	if frequency == e.audioFrequency {
+		return
+	}
+	if frequency == 0 {
+		if _, err := e.connection.AudioMode(mks.RGA_AUDIO_OFF); err != nil {
+			log.Printf("Could not turn audio off: %v", err)
+			return
+		}
+		e.audioFrequency = 0
+		return
+	}
+	if _, err := e.connection.AudioFrequency(frequency); err != nil {
+		log.Printf("Could not set audio frequency: %v", err)
+		return
+	}
+	if e.audioFrequency == 0 {
+		if _, err := e.connection.AudioMode(mks.RGA_AUDIO_MANUAL); err != nil {
+			log.Printf("Could not turn audio on: %v", err)
+			return
+		}
+	}
+	e.audioFrequency = frequency
+}
+
+// clearAlarms clears every raised alarm, releasing the outputs they drive
+func (e *MksRgaDatasource) clearAlarms() {
+	for class, active := range e.alarms {
+		if active {
+			e.setAlarm(class, false)
+		}
+	}
+}
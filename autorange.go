@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+var (
+	defaultAutoRangeHeadroom = 0.5
+	defaultAutoRangeScans    = 3
+)
+
+// rangeSetting is a detector and electronic gain a measurement can be ranged to
+type rangeSetting struct {
+	detector int
+	eGain    int
+	readingRange
+}
+
+// rangeLadder returns the settings the measurement can be ranged to, from the least to the most sensitive. The
+// electronic gains are the ones reported by EGains, the detectors the current one and, if Detectors is set, the
+// Faraday or the first multiplier when the source has one
+func (e *MksRgaDatasource) rangeLadder(m cfg.Measurement) []rangeSetting {
+	gains := []int{m.EGainIndex}
+	if e.limits != nil && len(e.limits.eGains) > 0 {
+		gains = gains[:0]
+		for g := range e.limits.eGains {
+			gains = append(gains, g)
+		}
+	}
+	detectors := []int{m.DetectorIndex}
+	if e.config.AutoRange.Detectors && e.limits != nil && e.limits.detectors[m.SourceIndex] > 1 {
+		if m.DetectorIndex == 0 {
+			detectors = append(detectors, 1)
+		} else {
+			detectors = append(detectors, 0)
+		}
+	}
+	var ladder []rangeSetting
+	for _, d := range detectors {
+		for _, g := range gains {
+			s := m
+			s.DetectorIndex, s.EGainIndex = d, g
+			ladder = append(ladder, rangeSetting{detector: d, eGain: g, readingRange: e.readingRange(s)})
+		}
+	}
+	sort.SliceStable(ladder, func(i, j int) bool { return ladder[i].ceiling > ladder[j].ceiling })
+	return ladder
+}
+
+// autoRange keeps the highest reading of every ranged measurement under Headroom times the ceiling of its setting.
+// A measurement going over it moves right away to the most sensitive setting it fits in, a measurement fitting a more
+// sensitive setting for Scans consecutive scans moves to the most sensitive one. Every change is emitted as an event
+// and applies from the next scan
+func (e *MksRgaDatasource) autoRange(frameChan chan *proto.Frame, scan *Scan) {
+	ar := e.config.AutoRange
+	if ar == nil {
+		return
+	}
+	headroom := ar.Headroom
+	if headroom <= 0 || headroom > 1 {
+		headroom = defaultAutoRangeHeadroom
+	}
+	scans := ar.Scans
+	if scans <= 0 {
+		scans = defaultAutoRangeScans
+	}
+	peaks := make(map[string]float64)
+	for _, r := range scan.Readings {
+		if p, ok := peaks[r.Measurement]; !ok || r.Value > p {
+			peaks[r.Measurement] = r.Value
+		}
+	}
+	if e.autoRangeScans == nil {
+		e.autoRangeScans = make(map[string]int)
+	}
+	for _, m := range e.measurements {
+		peak, ok := peaks[m.Name]
+		if !ok || (len(ar.Measurements) > 0 && !slices.Contains(ar.Measurements, m.Name)) {
+			continue
+		}
+		ladder := e.rangeLadder(m)
+		current := slices.IndexFunc(ladder, func(s rangeSetting) bool {
+			return s.detector == m.DetectorIndex && s.eGain == m.EGainIndex
+		})
+		if current < 0 {
+			continue
+		}
+		// the most sensitive setting the peak fits in, the least sensitive one if it fits nowhere
+		target := 0
+		for i := len(ladder) - 1; i > 0; i-- {
+			if peak < ladder[i].ceiling*headroom {
+				target = i
+				break
+			}
+		}
+		switch {
+		case target < current:
+			e.autoRangeScans[m.Name] = 0
+		case target > current:
+			if e.autoRangeScans[m.Name]++; e.autoRangeScans[m.Name] < scans {
+				continue
+			}
+			e.autoRangeScans[m.Name] = 0
+		default:
+			e.autoRangeScans[m.Name] = 0
+			continue
+		}
+		e.switchRange(frameChan, scan, m, ladder[target], peak)
+	}
+}
+
+// switchRange moves the measurement to the setting and emits the change as an event
+func (e *MksRgaDatasource) switchRange(frameChan chan *proto.Frame, scan *Scan, m cfg.Measurement, to rangeSetting, peak float64) {
+	var edits []mks.MeasurementEdit
+	if to.detector != m.DetectorIndex {
+		edits = append(edits, mks.DetectorIndex(to.detector))
+	}
+	if to.eGain != m.EGainIndex {
+		edits = append(edits, mks.EGainIndex(to.eGain))
+	}
+	if err := e.applyMeasurementEdit(m.Name, edits); err != nil {
+		log.Printf("Could not range %s: %v", m.Name, err)
+		return
+	}
+	a := &Annotation{
+		Time:  scan.Time,
+		Title: "Gain changed",
+		Text:  fmt.Sprintf("%s from detector %d gain %d to detector %d gain %d, highest reading %.3g Pa", m.Name, m.DetectorIndex, m.EGainIndex, to.detector, to.eGain, peak),
+		Tags:  []string{"autorange"},
+	}
+	log.Printf("%s: %s", a.Title, a.Text)
+	e.emitEvent(frameChan, a)
+}
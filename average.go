@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"sort"
+)
+
+var (
+	scanAverageMean   = "mean"
+	scanAverageMedian = "median"
+)
+
+// scansPerTick returns the number of scans run on every polling tick, at least 1
+func (e *MksRgaDatasource) scansPerTick() int {
+	if e.config.ScansPerTick < 1 {
+		return 1
+	}
+	return e.config.ScansPerTick
+}
+
+// averageScans aggregates the readings of numScans scans into one reading per measurement and mass, using the mean or
+// the median of the values. Readings keep the order of the first scan and the flags of every scan. A reading missing
+// from some of the scans is flagged interpolated
+func (e *MksRgaDatasource) averageScans(scan *Scan, numScans int) *Scan {
+	if numScans <= 1 {
+		return scan
+	}
+	type key struct {
+		measurement string
+		mass        float64
+	}
+	values := make(map[key][]float64, len(scan.Readings)/numScans)
+	readings := make([]Payload, 0, len(scan.Readings)/numScans)
+	index := make(map[key]int, len(scan.Readings)/numScans)
+	for _, r := range scan.Readings {
+		k := key{r.Measurement, r.Mass}
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(readings)
+			readings = append(readings, r)
+		} else {
+			for _, flag := range r.Flags {
+				readings[i].Flags = addFlag(readings[i].Flags, flag)
+			}
+		}
+		values[k] = append(values[k], r.Value)
+	}
+	median := false
+	switch e.config.ScanAverage {
+	case scanAverageMean, "":
+	case scanAverageMedian:
+		median = true
+	default:
+		log.Printf("Unknown scan average %s, using the mean", e.config.ScanAverage)
+	}
+	for i, r := range readings {
+		v := values[key{r.Measurement, r.Mass}]
+		if len(v) < numScans {
+			readings[i].Flags = addFlag(readings[i].Flags, flagInterpolated)
+		}
+		if median {
+			readings[i].Value = medianOf(v)
+		} else {
+			readings[i].Value = meanOf(v)
+		}
+	}
+	scan.Readings = readings
+	return scan
+}
+
+// meanOf returns the mean of the values
+func meanOf(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// medianOf returns the median of the values, sorting them in place
+func medianOf(values []float64) float64 {
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
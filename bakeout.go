@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	bg "github.com/SSSOCPaulCote/blunderguard"
+)
+
+var (
+	defaultBakeOutMasses   = []cfg.BakeOutMass{{Mass: 2}, {Mass: 17}, {Mass: 18}}
+	defaultBakeOutInterval = 10 * time.Minute
+	defaultBakeOutWindow   = 2 * time.Hour
+	minBakeOutSamples      = 10
+	ErrBakeOutDisabled     = bg.Error("bake-out tracking is not configured")
+)
+
+// BakeOutMass is the progress of the outgassing of one mass
+type BakeOutMass struct {
+	Mass         int     `json:"mass"`
+	Pressure     float64 `json:"pressure"`               // last reading [Pa]
+	Target       float64 `json:"target,omitempty"`       // [Pa]
+	TimeConstant float64 `json:"timeConstant,omitempty"` // [s] of the exponential decay fitted over the window, 0 if not decaying
+	Remaining    float64 `json:"remaining,omitempty"`    // [s] estimated time until the target is reached, 0 if unknown
+	Reached      bool    `json:"reached"`
+}
+
+// BakeOutProgress is a periodic report of a bake-out
+type BakeOutProgress struct {
+	Time    time.Time     `json:"time"`
+	Started time.Time     `json:"started"`
+	Masses  []BakeOutMass `json:"masses"`
+	Done    bool          `json:"done"` // every target is reached, never set without targets
+}
+
+// bakeOutFrame wraps a bake-out progress report in a frame for Laniakea
+type bakeOutFrame struct {
+	Schema  string           `json:"schema"`
+	Rig     string           `json:"rig,omitempty"`
+	Run     string           `json:"run,omitempty"`
+	Serial  string           `json:"serial,omitempty"`
+	BakeOut *BakeOutProgress `json:"bakeOut"`
+}
+
+// bakeOutSample is the reading of a mass at a point in time
+type bakeOutSample struct {
+	t time.Time
+	p float64
+}
+
+// bakeOut tracks the decay of the outgassing masses of a running bake-out
+type bakeOut struct {
+	started    time.Time
+	lastReport time.Time
+	done       bool
+	samples    map[int][]bakeOutSample // per mass, within the fit window
+}
+
+// validateBakeOut checks the bake-out configuration
+func validateBakeOut(b *cfg.BakeOut) error {
+	if b == nil {
+		return nil
+	}
+	for _, m := range b.Masses {
+		if m.Mass <= 0 || m.Target < 0 {
+			return fmt.Errorf("Invalid bake-out mass %d with target %v", m.Mass, m.Target)
+		}
+	}
+	if b.Interval < 0 || b.Window < 0 {
+		return fmt.Errorf("Bake-out interval and window cannot be negative")
+	}
+	return nil
+}
+
+// StartBakeOut starts tracking the outgassing of the bake-out masses. Progress frames are reported every Interval
+// until StopBakeOut is called
+func (e *MksRgaDatasource) StartBakeOut() error {
+	if e.config.BakeOut == nil {
+		return ErrBakeOutDisabled
+	}
+	return e.inLoop(func() error {
+		e.bakeOut = &bakeOut{started: time.Now(), samples: make(map[int][]bakeOutSample)}
+		e.annotate("Bake-out started", "", "bakeout")
+		return nil
+	})
+}
+
+// StopBakeOut stops tracking the bake-out
+func (e *MksRgaDatasource) StopBakeOut() error {
+	return e.inLoop(func() error {
+		if e.bakeOut != nil {
+			e.annotate("Bake-out stopped", fmt.Sprintf("after %v", time.Since(e.bakeOut.started).Round(time.Minute)), "bakeout")
+			e.bakeOut = nil
+		}
+		return nil
+	})
+}
+
+// bakeOutMasses returns the configured masses, hydrogen and water if none are
+func (e *MksRgaDatasource) bakeOutMasses() []cfg.BakeOutMass {
+	if len(e.config.BakeOut.Masses) > 0 {
+		return e.config.BakeOut.Masses
+	}
+	return defaultBakeOutMasses
+}
+
+// fitDecay fits p = exp(a + b*t) to the samples by least squares on the logarithm, t in seconds from the first sample
+func fitDecay(samples []bakeOutSample) (a, b float64, ok bool) {
+	var n, sx, sy, sxx, sxy float64
+	for _, s := range samples {
+		if s.p <= 0 {
+			continue
+		}
+		x, y := s.t.Sub(samples[0].t).Seconds(), math.Log(s.p)
+		n++
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	d := n*sxx - sx*sx
+	if n < 2 || d == 0 {
+		return 0, 0, false
+	}
+	b = (n*sxy - sx*sy) / d
+	return (sy - b*sx) / n, b, true
+}
+
+// trackBakeOut records the bake-out masses of the scan and reports the progress every Interval: the time constant of
+// the decay of every mass and the time it will take to reach its target, fitted over the last Window
+func (e *MksRgaDatasource) trackBakeOut(frameChan chan *proto.Frame, scan *Scan) {
+	if e.bakeOut == nil {
+		return
+	}
+	window, interval := defaultBakeOutWindow, defaultBakeOutInterval
+	if e.config.BakeOut.Window > 0 {
+		window = time.Duration(e.config.BakeOut.Window) * time.Minute
+	}
+	if e.config.BakeOut.Interval > 0 {
+		interval = time.Duration(e.config.BakeOut.Interval) * time.Second
+	}
+	heights := massHeights(scan.Readings, "")
+	progress := &BakeOutProgress{Time: scan.Time, Started: e.bakeOut.started, Masses: []BakeOutMass{}}
+	targets, reached := 0, 0
+	for _, m := range e.bakeOutMasses() {
+		if m.Target > 0 {
+			targets++
+		}
+		p, ok := heights[strconv.Itoa(m.Mass)]
+		if !ok {
+			continue
+		}
+		samples := append(e.bakeOut.samples[m.Mass], bakeOutSample{t: scan.Time, p: p})
+		for len(samples) > 0 && scan.Time.Sub(samples[0].t) > window {
+			samples = samples[1:]
+		}
+		e.bakeOut.samples[m.Mass] = samples
+		mp := BakeOutMass{Mass: m.Mass, Pressure: p, Target: m.Target, Reached: m.Target > 0 && p <= m.Target}
+		if a, b, ok := fitDecay(samples); ok && b < 0 && len(samples) >= minBakeOutSamples {
+			mp.TimeConstant = -1 / b
+			if m.Target > 0 && !mp.Reached {
+				mp.Remaining = math.Max(0, (math.Log(m.Target)-a)/b-scan.Time.Sub(samples[0].t).Seconds())
+			}
+		}
+		if mp.Reached {
+			reached++
+		}
+		progress.Masses = append(progress.Masses, mp)
+	}
+	progress.Done = targets > 0 && reached == targets
+	if progress.Done && !e.bakeOut.done {
+		e.bakeOut.done = true
+		log.Printf("Bake-out targets reached after %v", scan.Time.Sub(e.bakeOut.started).Round(time.Minute))
+		e.annotate("Bake-out targets reached", "", "bakeout")
+	} else if scan.Time.Sub(e.bakeOut.lastReport) < interval {
+		return
+	}
+	e.bakeOut.lastReport = scan.Time
+	b, err := json.Marshal(&bakeOutFrame{Schema: frameSchema, Rig: scan.Rig, Run: scan.Run, Serial: scan.Serial, BakeOut: progress})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	e.sendFrame(frameChan, &proto.Frame{
+		Source:    pluginName,
+		Type:      "application/json",
+		Timestamp: scan.Time.UnixMilli(),
+		Payload:   b,
+	})
+}
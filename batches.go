@@ -0,0 +1,94 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+var (
+	defaultMaxPendingBatches = 10
+	batchesSpilled           = expvar.NewMap("batches_spilled") // per sink, pending batches written to SpillDir
+)
+
+// pendingBatch is an encoded batch of scans, ready to be written out under its name
+type pendingBatch struct {
+	name  string
+	data  []byte
+	scans int
+}
+
+// pendingBatches keeps the batches a sink couldn't write out, e.g. while the object store is unreachable, and writes
+// them before the next one. At most max are kept in memory, so an outage can't exhaust it: the oldest is spilled to
+// the spill directory or, if there is none, dropped
+type pendingBatches struct {
+	sink     string
+	max      int
+	spillDir string // blank to drop the batches instead
+	batches  []pendingBatch
+}
+
+// newPendingBatches returns the pending batches of the sink, keeping at most max or, if max isn't set,
+// defaultMaxPendingBatches. The batches beyond are spilled to <spillDir>/<sink>, unless spillDir is blank
+func newPendingBatches(sink string, max int, spillDir string) *pendingBatches {
+	if max <= 0 {
+		max = defaultMaxPendingBatches
+	}
+	if spillDir != "" {
+		spillDir = filepath.Join(spillDir, sink)
+	}
+	return &pendingBatches{sink: sink, max: max, spillDir: spillDir}
+}
+
+// write writes the pending batches then b, oldest first. The ones not written are kept
+func (p *pendingBatches) write(b pendingBatch, put func(b pendingBatch) error) error {
+	p.add(b)
+	return p.flush(put)
+}
+
+// flush writes the pending batches, oldest first. The ones not written are kept
+func (p *pendingBatches) flush(put func(b pendingBatch) error) error {
+	for len(p.batches) > 0 {
+		if err := put(p.batches[0]); err != nil {
+			return err
+		}
+		p.batches[0] = pendingBatch{}
+		p.batches = p.batches[1:]
+	}
+	p.batches = nil
+	return nil
+}
+
+// add keeps the batch, spilling or dropping the oldest one if max are kept already
+func (p *pendingBatches) add(b pendingBatch) {
+	if len(p.batches) >= p.max {
+		old := p.batches[0]
+		p.batches[0] = pendingBatch{}
+		p.batches = p.batches[1:]
+		p.spill(old)
+	}
+	p.batches = append(p.batches, b)
+}
+
+// spill writes the batch to the spill directory, named after the base of its name, to be written out by hand. It is
+// dropped if there is no spill directory or it can't be written
+func (p *pendingBatches) spill(b pendingBatch) {
+	if p.spillDir == "" {
+		sinkScansDropped.Add(p.sink, int64(b.scans))
+		log.Printf("%s has %d batches pending, dropped %s with %d scans", p.sink, p.max, b.name, b.scans)
+		return
+	}
+	file := filepath.Join(p.spillDir, filepath.Base(b.name))
+	err := os.MkdirAll(p.spillDir, 0755)
+	if err == nil {
+		err = os.WriteFile(file, b.data, 0644)
+	}
+	if err != nil {
+		sinkScansDropped.Add(p.sink, int64(b.scans))
+		log.Printf("Could not spill %s with %d scans, dropped: %v", b.name, b.scans, err)
+		return
+	}
+	batchesSpilled.Add(p.sink, 1)
+	log.Printf("%s has %d batches pending, spilled %s with %d scans to %s", p.sink, p.max, b.name, b.scans, file)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPendingBatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		max     int
+		fails   []bool // whether the store fails while each batch is written
+		written []string
+		pending []string
+	}{
+		{name: "store up", max: 2, fails: []bool{false, false}, written: []string{"b1", "b2"}},
+		{name: "outage", max: 3, fails: []bool{true, true}, pending: []string{"b1", "b2"}},
+		{name: "recovery", max: 3, fails: []bool{true, true, false}, written: []string{"b1", "b2", "b3"}},
+		{name: "oldest dropped", max: 2, fails: []bool{true, true, true, false}, written: []string{"b3", "b4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPendingBatches("test", tt.max, "")
+			var written []string
+			for i, fail := range tt.fails {
+				put := func(b pendingBatch) error {
+					if fail {
+						return errors.New("store unreachable")
+					}
+					written = append(written, b.name)
+					return nil
+				}
+				err := p.write(pendingBatch{name: "b" + string(rune('1'+i)), scans: 1}, put)
+				if (err != nil) != fail {
+					t.Fatalf("write() error = %v", err)
+				}
+			}
+			var pending []string
+			for _, b := range p.batches {
+				pending = append(pending, b.name)
+			}
+			if !reflect.DeepEqual(written, tt.written) {
+				t.Errorf("written %v, want %v", written, tt.written)
+			}
+			if !reflect.DeepEqual(pending, tt.pending) {
+				t.Errorf("pending %v, want %v", pending, tt.pending)
+			}
+		})
+	}
+}
+
+func TestPendingBatchesSpill(t *testing.T) {
+	dir := t.TempDir()
+	p := newPendingBatches("archive", 1, dir)
+	fail := func(pendingBatch) error { return errors.New("store unreachable") }
+	p.write(pendingBatch{name: "archive/2026/10/15/mks-1.jsonl.gz", data: []byte("first"), scans: 1}, fail)
+	p.write(pendingBatch{name: "archive/2026/10/15/mks-2.jsonl.gz", data: []byte("second"), scans: 1}, fail)
+	b, err := os.ReadFile(filepath.Join(dir, "archive", "mks-1.jsonl.gz"))
+	if err != nil {
+		t.Fatalf("oldest batch not spilled: %v", err)
+	}
+	if string(b) != "first" {
+		t.Errorf("spilled %q, want %q", b, "first")
+	}
+	if len(p.batches) != 1 || p.batches[0].name != "archive/2026/10/15/mks-2.jsonl.gz" {
+		t.Errorf("pending %v, want the newest batch only", p.batches)
+	}
+}
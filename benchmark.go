@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+var (
+	benchmarkScanTimeout = 5 * time.Minute
+	// CPU time of the Go code and of the garbage collector, estimated by the runtime
+	benchmarkCPUMetrics = []string{"/cpu/classes/user:cpu-seconds", "/cpu/classes/gc/total:cpu-seconds"}
+)
+
+// benchmarkOptions are the settings benchmarked by --benchmark. Every accuracy is run with every points per peak
+type benchmarkOptions struct {
+	Scans         int
+	StartMass     int
+	EndMass       int
+	Accuracies    []int
+	PointsPerPeak []int // 0 for a barchart
+	JSON          bool
+}
+
+// benchmarkResult is the outcome of benchmarking one setting
+type benchmarkResult struct {
+	Accuracy          int     `json:"accuracy"`
+	PointsPerPeak     int     `json:"pointsPerPeak"`
+	StartMass         int     `json:"startMass"`
+	EndMass           int     `json:"endMass"`
+	Scans             int     `json:"scans"`
+	Readings          int     `json:"readings"`
+	Seconds           float64 `json:"seconds"`
+	ScansPerSecond    float64 `json:"scansPerSecond"`
+	ReadingsPerSecond float64 `json:"readingsPerSecond"`
+	BytesPerReading   float64 `json:"bytesPerReading"`  // read from the RGA
+	CPUPerReading     float64 `json:"cpuUsPerReading"`  // [µs] of Go and GC CPU time, mostly parsing
+	AllocsPerReading  float64 `json:"allocsPerReading"` // heap allocations
+	CPUShare          float64 `json:"cpuShare"`         // CPU time over wall time, the rest is spent waiting for the RGA
+}
+
+// parseBenchmarkOptions parses the --benchmark-* flags
+func parseBenchmarkOptions(scans int, masses, accuracies, pointsPerPeak string, asJSON bool) (benchmarkOptions, error) {
+	opts := benchmarkOptions{Scans: scans, JSON: asJSON}
+	if scans < 1 {
+		return opts, fmt.Errorf("Benchmark needs at least 1 scan, got %d", scans)
+	}
+	start, end, ok := strings.Cut(masses, "-")
+	var err error
+	if opts.StartMass, err = strconv.Atoi(start); !ok || err != nil {
+		return opts, fmt.Errorf("Invalid benchmark mass range %s, expected e.g. 1-100", masses)
+	}
+	if opts.EndMass, err = strconv.Atoi(end); err != nil || opts.EndMass < opts.StartMass || opts.StartMass < 1 {
+		return opts, fmt.Errorf("Invalid benchmark mass range %s, expected e.g. 1-100", masses)
+	}
+	if opts.Accuracies, err = parseIntList(accuracies); err != nil {
+		return opts, fmt.Errorf("Invalid benchmark accuracies %s: %v", accuracies, err)
+	}
+	if opts.PointsPerPeak, err = parseIntList(pointsPerPeak); err != nil {
+		return opts, fmt.Errorf("Invalid benchmark points per peak %s: %v", pointsPerPeak, err)
+	}
+	return opts, nil
+}
+
+// parseIntList parses a comma separated list of non-negative integers
+func parseIntList(s string) ([]int, error) {
+	var values []int
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		if v < 0 {
+			return nil, fmt.Errorf("%d is negative", v)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// benchmark connects to the RGA, or a simulator at RGAAddr, and times opts.Scans scans of every setting after an
+// untimed first scan. The filament is left as it is. Results are written to w as a table or as JSON lines
+func benchmark(config *cfg.Config, w io.Writer, opts benchmarkOptions) error {
+	config.ScansPerTick = 1
+	config.ScanTimeout = int64(benchmarkScanTimeout / time.Second)
+	e := newDatasource(config)
+	var err error
+	if e.connection, err = e.dial(); err != nil {
+		return err
+	}
+	defer e.connection.Close()
+	if e.session, err = e.newSession(); err != nil {
+		return err
+	}
+	defer e.session.Close()
+	e.cleanupSensor(e.session)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	if !opts.JSON {
+		fmt.Fprintln(tw, "accuracy\tppp\tmasses\tscans/s\treadings/s\tbytes/reading\tcpu µs/reading\tallocs/reading\tcpu share\t")
+	}
+	for _, accuracy := range opts.Accuracies {
+		for _, ppp := range opts.PointsPerPeak {
+			r, err := e.benchmarkSetting(opts, accuracy, ppp)
+			if err != nil {
+				return fmt.Errorf("Benchmark of accuracy %d with %d points per peak failed: %v", accuracy, ppp, err)
+			}
+			if opts.JSON {
+				if err := json.NewEncoder(w).Encode(r); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Fprintf(tw, "%d\t%d\t%d-%d\t%.3f\t%.1f\t%.1f\t%.2f\t%.1f\t%.1f%%\t\n", r.Accuracy, r.PointsPerPeak, r.StartMass, r.EndMass, r.ScansPerSecond, r.ReadingsPerSecond, r.BytesPerReading, r.CPUPerReading, r.AllocsPerReading, r.CPUShare*100)
+			tw.Flush()
+		}
+	}
+	return nil
+}
+
+// benchmarkSetting adds a measurement with the setting, times the scans and removes it
+func (e *MksRgaDatasource) benchmarkSetting(opts benchmarkOptions, accuracy, ppp int) (*benchmarkResult, error) {
+	m := cfg.Measurement{Name: fmt.Sprintf("Benchmark%d_%d", accuracy, ppp), Type: measurementTypeBarchart, StartMass: opts.StartMass, EndMass: opts.EndMass, FilterMode: "PeakCenter", Accuracy: accuracy}
+	if ppp > 0 {
+		m.Type, m.FilterMode, m.PointsPerPeak = measurementTypeAnalog, "", ppp
+	}
+	if err := addMeasurement(e.session, m); err != nil {
+		return nil, err
+	}
+	e.measurements = []cfg.Measurement{m}
+	defer func() {
+		e.session.ScanStop()
+		e.session.MeasurementRemove(m.Name)
+	}()
+	// the first scan includes setting the sensor up
+	if _, err := e.runScan(nil, benchmarkScanTimeout); err != nil {
+		return nil, err
+	}
+	r := &benchmarkResult{Accuracy: accuracy, PointsPerPeak: ppp, StartMass: opts.StartMass, EndMass: opts.EndMass, Scans: opts.Scans}
+	cpu, mem, bytes := benchmarkCPU(), benchmarkMallocs(), bytesParsed.Value()
+	start := time.Now()
+	for i := 0; i < opts.Scans; i++ {
+		scan, err := e.runScan(nil, benchmarkScanTimeout)
+		if err != nil {
+			return nil, err
+		}
+		r.Readings += len(scan.Readings)
+	}
+	elapsed := time.Since(start)
+	cpu, mem, bytes = benchmarkCPU()-cpu, benchmarkMallocs()-mem, bytesParsed.Value()-bytes
+	r.Seconds = elapsed.Seconds()
+	r.ScansPerSecond = float64(r.Scans) / r.Seconds
+	r.ReadingsPerSecond = float64(r.Readings) / r.Seconds
+	r.CPUShare = cpu / r.Seconds
+	if r.Readings > 0 {
+		r.BytesPerReading = float64(bytes) / float64(r.Readings)
+		r.CPUPerReading = cpu * 1e6 / float64(r.Readings)
+		r.AllocsPerReading = float64(mem) / float64(r.Readings)
+	}
+	return r, nil
+}
+
+// benchmarkCPU returns the CPU seconds spent so far by the Go code and the garbage collector. The runtime updates the
+// estimate on every collection, so one is forced first
+func benchmarkCPU() float64 {
+	runtime.GC()
+	samples := make([]metrics.Sample, len(benchmarkCPUMetrics))
+	for i, name := range benchmarkCPUMetrics {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+	var total float64
+	for _, s := range samples {
+		if s.Value.Kind() == metrics.KindFloat64 {
+			total += s.Value.Float64()
+		}
+	}
+	return total
+}
+
+// benchmarkMallocs returns the number of heap allocations so far
+func benchmarkMallocs() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.Mallocs
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"log"
+	"net"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+// runBroker connects to the RGA and shares the connection with the clients of addr, e.g. other plugin instances with
+// RGAAddr set to addr, until the connection drops. A client holding the sensor loses its lease after lease of silence
+func (e *MksRgaDatasource) runBroker(addr string, lease time.Duration) error {
+	conn, err := e.connect()
+	if err != nil {
+		return err
+	}
+	broker, err := mks.NewBroker(conn, lease)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer broker.Close()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Sharing the connection to the RGA on %s", ln.Addr())
+	return broker.Serve(ln)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+)
+
+var calDateLayouts = []string{"2006-01-02_15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseCalDate parses a calibration date as reported by the sensor
+func parseCalDate(v interface{}) (time.Time, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range calDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// overdueCalibrations returns a description of every calibration date of the run header older than the calibration
+// interval. Detector calibration dates are read from DetectorInfo and the gauge one from TotalPressureInfo
+func (e *MksRgaDatasource) overdueCalibrations(h *RunHeader, now time.Time) []string {
+	interval := time.Duration(e.config.CalibrationIntervalDays) * 24 * time.Hour
+	var overdue []string
+	check := func(prefix string, values map[string]interface{}) {
+		for name, v := range values {
+			if !strings.Contains(name, "CalDate") {
+				continue
+			}
+			t, ok := parseCalDate(v)
+			if !ok || now.Sub(t) <= interval {
+				continue
+			}
+			overdue = append(overdue, fmt.Sprintf("%s %s %s", prefix, name, t.Format("2006-01-02")))
+		}
+	}
+	for idx, values := range h.Detectors {
+		check(fmt.Sprintf("source %d", idx), values)
+	}
+	check("total pressure", h.TotalPressure)
+	sort.Strings(overdue)
+	return overdue
+}
+
+// checkCalibration warns when a calibration is overdue: the dates are logged, reported as a calibration status and
+// annotated
+func (e *MksRgaDatasource) checkCalibration(frameChan chan *proto.Frame, h *RunHeader) {
+	if e.config.CalibrationIntervalDays <= 0 {
+		return
+	}
+	overdue := e.overdueCalibrations(h, time.Now())
+	st := &Status{Time: e.now(), Kind: statusKindCalibration, CalibrationOverdue: len(overdue) > 0, Rig: e.config.RigID, Serial: e.serial, Inlet: e.inlet}
+	if len(overdue) > 0 {
+		st.Reason = "calibration overdue: " + strings.Join(overdue, ", ")
+		log.Printf("Calibration overdue: %s", strings.Join(overdue, ", "))
+		e.annotate("Calibration overdue", strings.Join(overdue, ", "), "calibration")
+	}
+	e.reportStatus(frameChan, st)
+}
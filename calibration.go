@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// calibrationFactors returns the relative sensitivity factors by mass, checking that every one is positive
+func calibrationFactors(factors map[string]float64) (map[int]float64, error) {
+	byMass, err := massFactors(factors)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid calibration factors: %v", err)
+	}
+	for mass, f := range byMass {
+		if f <= 0 {
+			return nil, fmt.Errorf("Invalid calibration factor %v for mass %d: must be positive", f, mass)
+		}
+	}
+	return byMass, nil
+}
+
+// massFactors returns factors configured by mass by integer mass. The config keys them with strings, which every
+// config format supports
+func massFactors(factors map[string]float64) (map[int]float64, error) {
+	byMass := make(map[int]float64, len(factors))
+	for key, f := range factors {
+		mass, err := strconv.Atoi(strings.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("mass %q is not an integer", key)
+		}
+		byMass[mass] = f
+	}
+	return byMass, nil
+}
+
+// calibrationText lists the relative sensitivity factors by mass, for the annotation of the calibration in use
+func calibrationText(factors map[int]float64) string {
+	masses := make([]int, 0, len(factors))
+	for mass := range factors {
+		masses = append(masses, mass)
+	}
+	sort.Ints(masses)
+	parts := make([]string, len(masses))
+	for i, mass := range masses {
+		parts[i] = fmt.Sprintf("m%d=%v", mass, factors[mass])
+	}
+	return strings.Join(parts, " ")
+}
+
+// calibrate divides every reading by the relative sensitivity factor of its mass. Fractional analog positions use the
+// factor of the nearest integer mass. The raw value is kept alongside if CalibrationKeepRaw is set
+func (e *MksRgaDatasource) calibrate(scan *Scan) *Scan {
+	for i, r := range scan.Readings {
+		f, ok := e.calibration[int(math.Round(r.Mass))]
+		if !ok {
+			continue
+		}
+		if e.config.CalibrationKeepRaw {
+			raw := r.Value
+			scan.Readings[i].Raw = &raw
+		}
+		scan.Readings[i].Value = r.Value / f
+	}
+	return scan
+}
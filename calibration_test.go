@@ -0,0 +1,32 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCalibrationFactors(t *testing.T) {
+	tests := []struct {
+		name    string
+		factors map[string]float64
+		want    map[int]float64
+		err     bool
+	}{
+		{name: "none", want: map[int]float64{}},
+		{name: "by mass", factors: map[string]float64{"2": 0.44, " 44 ": 1.4}, want: map[int]float64{2: 0.44, 44: 1.4}},
+		{name: "fractional mass", factors: map[string]float64{"28.5": 1}, err: true},
+		{name: "not a mass", factors: map[string]float64{"N2": 1}, err: true},
+		{name: "zero factor", factors: map[string]float64{"28": 0}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := calibrationFactors(tt.factors)
+			if (err != nil) != tt.err {
+				t.Fatalf("calibrationFactors() error = %v, want error %v", err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("calibrationFactors() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
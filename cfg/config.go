@@ -1,37 +1,510 @@
 package cfg
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/btcsuite/btcd/btcutil"
 	yaml "gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	Influx           bool   `yaml:"Influx"`
-	InfluxURL        string `yaml:"InfluxURL"`
-	InfuxAPIToken    string `yaml:"InfluxAPIToken"`
-	InfluxOrgName    string `yaml:"InfluxOrgName"`
-	InfluxBucketName string `yaml:"InfluxBucketName"`
-	InfluxSkipTLS    bool   `yaml:"InfluxSkipTLS"`
-	RGAAddr          string `yaml:"RGAAddr"`
-	PollingInterval  int64  `yaml:"PollingInterval"`
+	Influx                       bool               `yaml:"Influx" toml:"Influx" json:"Influx"`
+	InfluxURL                    string             `yaml:"InfluxURL" toml:"InfluxURL" json:"InfluxURL"`
+	InfuxAPIToken                string             `yaml:"InfluxAPIToken" toml:"InfluxAPIToken" json:"InfluxAPIToken"`
+	InfluxAPITokenEnv            string             `yaml:"InfluxAPITokenEnv" toml:"InfluxAPITokenEnv" json:"InfluxAPITokenEnv"`
+	InfluxAPITokenFile           string             `yaml:"InfluxAPITokenFile" toml:"InfluxAPITokenFile" json:"InfluxAPITokenFile"`
+	InfluxAPITokenCommand        string             `yaml:"InfluxAPITokenCommand" toml:"InfluxAPITokenCommand" json:"InfluxAPITokenCommand"`
+	InfluxOrgName                string             `yaml:"InfluxOrgName" toml:"InfluxOrgName" json:"InfluxOrgName"`
+	InfluxBucketName             string             `yaml:"InfluxBucketName" toml:"InfluxBucketName" json:"InfluxBucketName"`
+	InfluxBucketRetention        int64              `yaml:"InfluxBucketRetention" toml:"InfluxBucketRetention" json:"InfluxBucketRetention"`
+	InfluxSummaryBucketName      string             `yaml:"InfluxSummaryBucketName" toml:"InfluxSummaryBucketName" json:"InfluxSummaryBucketName"`
+	InfluxSummaryBucketRetention int64              `yaml:"InfluxSummaryBucketRetention" toml:"InfluxSummaryBucketRetention" json:"InfluxSummaryBucketRetention"`
+	InfluxSummaryInterval        int64              `yaml:"InfluxSummaryInterval" toml:"InfluxSummaryInterval" json:"InfluxSummaryInterval"`
+	InfluxFailoverURLs           []string           `yaml:"InfluxFailoverURLs" toml:"InfluxFailoverURLs" json:"InfluxFailoverURLs"`       // replicas written to when InfluxURL keeps failing, in order, with the same token, org and buckets
+	InfluxFailoverChecks         int                `yaml:"InfluxFailoverChecks" toml:"InfluxFailoverChecks" json:"InfluxFailoverChecks"` // consecutive failing or passing checks before failing over or back, defaults to 3
+	InfluxSkipTLS                bool               `yaml:"InfluxSkipTLS" toml:"InfluxSkipTLS" json:"InfluxSkipTLS"`
+	InfluxBufferLimit            int                `yaml:"InfluxBufferLimit" toml:"InfluxBufferLimit" json:"InfluxBufferLimit"` // points kept per bucket for retrying while InfluxDB is unreachable, the oldest are dropped first. Defaults to 50000
+	InfluxPrecision              string             `yaml:"InfluxPrecision" toml:"InfluxPrecision" json:"InfluxPrecision"`       // timestamp precision of the points: s, ms, us or ns. Defaults to ns
+	InfluxFlushPeriod            int                `yaml:"InfluxFlushPeriod" toml:"InfluxFlushPeriod" json:"InfluxFlushPeriod"` // [ms] longest time points wait to be sent in a batch. Defaults to 1000
+	InfluxMaxRetries             int                `yaml:"InfluxMaxRetries" toml:"InfluxMaxRetries" json:"InfluxMaxRetries"`    // attempts to write a failed batch again, defaults to 5, -1 disables retries
+	RGAAddr                      string             `yaml:"RGAAddr" toml:"RGAAddr" json:"RGAAddr"`
+	RGASerial                    string             `yaml:"RGASerial" toml:"RGASerial" json:"RGASerial"`                         // serial number of the sensor, its controller is looked up instead of relying on RGAAddr alone
+	RGASearchNetwork             string             `yaml:"RGASearchNetwork" toml:"RGASearchNetwork" json:"RGASearchNetwork"`    // IPv4 network probed for the controller reporting RGASerial, e.g. 192.168.0.0/24
+	RGASearchPort                int                `yaml:"RGASearchPort" toml:"RGASearchPort" json:"RGASearchPort"`             // port probed on RGASearchNetwork, defaults to 10014
+	Proxy                        *Proxy             `yaml:"Proxy" toml:"Proxy" json:"Proxy"`                                     // SOCKS5 proxy or SSH jump host the RGA is reached through, direct if not set
+	Socket                       *Socket            `yaml:"Socket" toml:"Socket" json:"Socket"`                                  // TCP keepalive, no-delay and buffer sizes of the RGA connections, Go and OS defaults if not set
+	ConnectRetries               int                `yaml:"ConnectRetries" toml:"ConnectRetries" json:"ConnectRetries"`          // connection attempts retried when the RGA is unreachable, -1 retries forever
+	ConnectRetryDelay            int                `yaml:"ConnectRetryDelay" toml:"ConnectRetryDelay" json:"ConnectRetryDelay"` // [s] before the first retry, doubled on every attempt up to 2 minutes. Defaults to 5
+	ConnectLazily                bool               `yaml:"ConnectLazily" toml:"ConnectLazily" json:"ConnectLazily"`             // connect on the first StartRecord instead of when the plugin starts
+	IdlePolicy                   string             `yaml:"IdlePolicy" toml:"IdlePolicy" json:"IdlePolicy"`                      // release, hold or disconnect from the sensor between recordings, release if blank
+	DualConnection               bool               `yaml:"DualConnection" toml:"DualConnection" json:"DualConnection"`          // read the asynchronous readings from a second connection, commands use the first one
+	StrictParsing                bool               `yaml:"StrictParsing" toml:"StrictParsing" json:"StrictParsing"`             // reject unexpected responses with the raw bytes instead of parsing them leniently
+	ParseQuarantine              string             `yaml:"ParseQuarantine" toml:"ParseQuarantine" json:"ParseQuarantine"`       // file the responses rejected by StrictParsing are appended to, none if blank
+	RejectLog                    *RejectLog         `yaml:"RejectLog" toml:"RejectLog" json:"RejectLog"`                         // troubleshooting log of the data dropped by the plugin, none if not set
+	CommandInterval              int                `yaml:"CommandInterval" toml:"CommandInterval" json:"CommandInterval"`       // [ms] minimum spacing between any two commands sent to the RGA, 0 disables it
+	CommandRateLimits            map[string]float64 `yaml:"CommandRateLimits" toml:"CommandRateLimits" json:"CommandRateLimits"` // maximum commands per second per class: query, scan, measurement, tuning, io or control
+	CommandTimeout               int                `yaml:"CommandTimeout" toml:"CommandTimeout" json:"CommandTimeout"`          // [s] response timeout of every command without an entry in CommandTimeouts, queries included, defaults to 10, -1 disables every timeout
+	MinFirmware                  map[string]string  `yaml:"MinFirmware" toml:"MinFirmware" json:"MinFirmware"`                   // oldest firmware version supporting a command, by command name. Blank lifts the built-in requirement
+	CommandTimeouts              map[string]float64 `yaml:"CommandTimeouts" toml:"CommandTimeouts" json:"CommandTimeouts"`       // [s] response timeout per command name, e.g. RunDiagnostics, 0 for none. Overrides the built-in defaults
+	PollingInterval              int64              `yaml:"PollingInterval" toml:"PollingInterval" json:"PollingInterval"`
+	ScansPerTick                 int                `yaml:"ScansPerTick" toml:"ScansPerTick" json:"ScansPerTick"`       // scans run on every polling tick and averaged into a single frame, defaults to 1
+	ScanAverage                  string             `yaml:"ScanAverage" toml:"ScanAverage" json:"ScanAverage"`          // mean or median
+	PipelineBuffer               int                `yaml:"PipelineBuffer" toml:"PipelineBuffer" json:"PipelineBuffer"` // completed scans queued between reading the sensor and publishing, defaults to 16
+	FrameBacklog                 int                `yaml:"FrameBacklog" toml:"FrameBacklog" json:"FrameBacklog"`       // frames buffered until Laniakea drains the channel, defaults to 256
+	MemoryLimit                  int                `yaml:"MemoryLimit" toml:"MemoryLimit" json:"MemoryLimit"`          // [MiB] soft limit of the Go runtime memory, collected harder when reached. 0 leaves GOMEMLIMIT
+	Heartbeat                    int                `yaml:"Heartbeat" toml:"Heartbeat" json:"Heartbeat"`                // [s] interval of the heartbeat status (sensor state, total pressure, filament), 0 disables it
+	Clock                        *Clock             `yaml:"Clock" toml:"Clock" json:"Clock"`                            // timestamp source, the system clock if nil
+	FrameEncoding                string             `yaml:"FrameEncoding" toml:"FrameEncoding" json:"FrameEncoding"`    // json or protobuf (see schema/scan.proto) for data frames, defaults to json
+	FrameChunkSize               int                `yaml:"FrameChunkSize" toml:"FrameChunkSize" json:"FrameChunkSize"` // maximum readings per data frame, larger scans are split over several frames. 0 disables chunking
+	AnalogPeaks                  bool               `yaml:"AnalogPeaks" toml:"AnalogPeaks" json:"AnalogPeaks"`          // emit the centroid, height and FWHM of the peaks of analog scans as a peak-list frame
+	PeakMinHeight                float64            `yaml:"PeakMinHeight" toml:"PeakMinHeight" json:"PeakMinHeight"`    // minimum height of a peak [Pa], 1% of the highest point of the measurement if 0
+	StaleDataFactor              float64            `yaml:"StaleDataFactor" toml:"StaleDataFactor" json:"StaleDataFactor"`
+	StaleDataRestart             bool               `yaml:"StaleDataRestart" toml:"StaleDataRestart" json:"StaleDataRestart"`
+	ScanTimeout                  int64              `yaml:"ScanTimeout" toml:"ScanTimeout" json:"ScanTimeout"`
+	RestartOnPanic               bool               `yaml:"RestartOnPanic" toml:"RestartOnPanic" json:"RestartOnPanic"`
+	Measurements                 []Measurement      `yaml:"Measurements" toml:"Measurements" json:"Measurements"`
+	ResumeRecording              bool               `yaml:"ResumeRecording" toml:"ResumeRecording" json:"ResumeRecording"`
+	SkipStartupCleanup           bool               `yaml:"SkipStartupCleanup" toml:"SkipStartupCleanup" json:"SkipStartupCleanup"`
+	ControlWaitTimeout           int64              `yaml:"ControlWaitTimeout" toml:"ControlWaitTimeout" json:"ControlWaitTimeout"`
+	ControlAppName               string             `yaml:"ControlAppName" toml:"ControlAppName" json:"ControlAppName"`          // application name reported to the sensor by Control, defaults to the plugin name
+	ControlAppVersion            string             `yaml:"ControlAppVersion" toml:"ControlAppVersion" json:"ControlAppVersion"` // version reported to the sensor by Control, defaults to the plugin version
+	StateFile                    string             `yaml:"StateFile" toml:"StateFile" json:"StateFile"`
+	Redis                        bool               `yaml:"Redis" toml:"Redis" json:"Redis"`
+	RedisAddr                    string             `yaml:"RedisAddr" toml:"RedisAddr" json:"RedisAddr"`
+	RedisPassword                string             `yaml:"RedisPassword" toml:"RedisPassword" json:"RedisPassword"`
+	RedisDB                      int                `yaml:"RedisDB" toml:"RedisDB" json:"RedisDB"`
+	RedisKeyPrefix               string             `yaml:"RedisKeyPrefix" toml:"RedisKeyPrefix" json:"RedisKeyPrefix"`
+	RedisStreamMaxLen            int64              `yaml:"RedisStreamMaxLen" toml:"RedisStreamMaxLen" json:"RedisStreamMaxLen"`
+	RedisTimeSeries              bool               `yaml:"RedisTimeSeries" toml:"RedisTimeSeries" json:"RedisTimeSeries"`
+	OPCUA                        bool               `yaml:"OPCUA" toml:"OPCUA" json:"OPCUA"`
+	OPCUAEndpoint                string             `yaml:"OPCUAEndpoint" toml:"OPCUAEndpoint" json:"OPCUAEndpoint"`
+	OPCUAPort                    int                `yaml:"OPCUAPort" toml:"OPCUAPort" json:"OPCUAPort"`
+	OPCUACertFile                string             `yaml:"OPCUACertFile" toml:"OPCUACertFile" json:"OPCUACertFile"`
+	OPCUAKeyFile                 string             `yaml:"OPCUAKeyFile" toml:"OPCUAKeyFile" json:"OPCUAKeyFile"`
+	OPCUAAllowInsecure           bool               `yaml:"OPCUAAllowInsecure" toml:"OPCUAAllowInsecure" json:"OPCUAAllowInsecure"` // also serve the None security policy when a certificate is set, for clients that can't encrypt
+	Modbus                       bool               `yaml:"Modbus" toml:"Modbus" json:"Modbus"`
+	ModbusURL                    string             `yaml:"ModbusURL" toml:"ModbusURL" json:"ModbusURL"`
+	ModbusMasses                 []int              `yaml:"ModbusMasses" toml:"ModbusMasses" json:"ModbusMasses"`
+	Prometheus                   bool               `yaml:"Prometheus" toml:"Prometheus" json:"Prometheus"`
+	PrometheusRemoteWriteURL     string             `yaml:"PrometheusRemoteWriteURL" toml:"PrometheusRemoteWriteURL" json:"PrometheusRemoteWriteURL"`
+	PrometheusUsername           string             `yaml:"PrometheusUsername" toml:"PrometheusUsername" json:"PrometheusUsername"`
+	PrometheusPassword           string             `yaml:"PrometheusPassword" toml:"PrometheusPassword" json:"PrometheusPassword"`
+	PrometheusLabels             map[string]string  `yaml:"PrometheusLabels" toml:"PrometheusLabels" json:"PrometheusLabels"`
+	PrometheusMetricsAddr        string             `yaml:"PrometheusMetricsAddr" toml:"PrometheusMetricsAddr" json:"PrometheusMetricsAddr"`
+	S3Endpoint                   string             `yaml:"S3Endpoint" toml:"S3Endpoint" json:"S3Endpoint"`
+	S3AccessKey                  string             `yaml:"S3AccessKey" toml:"S3AccessKey" json:"S3AccessKey"`
+	S3SecretKey                  string             `yaml:"S3SecretKey" toml:"S3SecretKey" json:"S3SecretKey"`
+	S3Bucket                     string             `yaml:"S3Bucket" toml:"S3Bucket" json:"S3Bucket"`
+	S3Region                     string             `yaml:"S3Region" toml:"S3Region" json:"S3Region"`
+	S3UseSSL                     bool               `yaml:"S3UseSSL" toml:"S3UseSSL" json:"S3UseSSL"`
+	Parquet                      bool               `yaml:"Parquet" toml:"Parquet" json:"Parquet"`
+	ParquetDir                   string             `yaml:"ParquetDir" toml:"ParquetDir" json:"ParquetDir"`
+	ParquetS3                    bool               `yaml:"ParquetS3" toml:"ParquetS3" json:"ParquetS3"`
+	ParquetPrefix                string             `yaml:"ParquetPrefix" toml:"ParquetPrefix" json:"ParquetPrefix"`
+	ParquetBatchScans            int                `yaml:"ParquetBatchScans" toml:"ParquetBatchScans" json:"ParquetBatchScans"`
+	ParquetMaxPending            int                `yaml:"ParquetMaxPending" toml:"ParquetMaxPending" json:"ParquetMaxPending"`
+	Archive                      bool               `yaml:"Archive" toml:"Archive" json:"Archive"`
+	ArchivePrefix                string             `yaml:"ArchivePrefix" toml:"ArchivePrefix" json:"ArchivePrefix"`
+	ArchiveBatchScans            int                `yaml:"ArchiveBatchScans" toml:"ArchiveBatchScans" json:"ArchiveBatchScans"`
+	ArchiveMaxPending            int                `yaml:"ArchiveMaxPending" toml:"ArchiveMaxPending" json:"ArchiveMaxPending"`
+	SpillDir                     string             `yaml:"SpillDir" toml:"SpillDir" json:"SpillDir"`
+	SQLite                       bool               `yaml:"SQLite" toml:"SQLite" json:"SQLite"`
+	SQLitePath                   string             `yaml:"SQLitePath" toml:"SQLitePath" json:"SQLitePath"`
+	SQLiteRetentionDays          int                `yaml:"SQLiteRetentionDays" toml:"SQLiteRetentionDays" json:"SQLiteRetentionDays"` // scans and events older than this are deleted, 0 keeps everything
+	Webhooks                     []Webhook          `yaml:"Webhooks" toml:"Webhooks" json:"Webhooks"`                                  // URLs scan summaries and alarm events are posted to
+	SinkQueues                   []SinkQueue        `yaml:"SinkQueues" toml:"SinkQueues" json:"SinkQueues"`                            // per sink queue, batching, retries and circuit breaker
+	Routes                       []Route            `yaml:"Routes" toml:"Routes" json:"Routes"`                                        // sinks and Influx bucket of the readings of some measurements, the others go to every sink
+	InfluxDownsample             []InfluxDownsample `yaml:"InfluxDownsample" toml:"InfluxDownsample" json:"InfluxDownsample"`          // groups of masses written to Influx every few scans only, the others are written every scan
+	InfluxAnnotations            bool               `yaml:"InfluxAnnotations" toml:"InfluxAnnotations" json:"InfluxAnnotations"`
+	GrafanaAnnotations           bool               `yaml:"GrafanaAnnotations" toml:"GrafanaAnnotations" json:"GrafanaAnnotations"`
+	GrafanaURL                   string             `yaml:"GrafanaURL" toml:"GrafanaURL" json:"GrafanaURL"`
+	GrafanaAPIToken              string             `yaml:"GrafanaAPIToken" toml:"GrafanaAPIToken" json:"GrafanaAPIToken"`
+	GrafanaDashboardUID          string             `yaml:"GrafanaDashboardUID" toml:"GrafanaDashboardUID" json:"GrafanaDashboardUID"`
+	SMTP                         *SMTP              `yaml:"SMTP" toml:"SMTP" json:"SMTP"`                                  // email notifications of alarms and faults
+	AnnotationsAddr              string             `yaml:"AnnotationsAddr" toml:"AnnotationsAddr" json:"AnnotationsAddr"` // local address accepting operator annotations posted to /annotations, blank to disable
+	APIAddr                      string             `yaml:"APIAddr" toml:"APIAddr" json:"APIAddr"`                         // local address of the operator API under /api/, blank to disable
+	APIToken                     string             `yaml:"APIToken" toml:"APIToken" json:"APIToken"`                      // bearer token every API request must carry, the API isn't served if blank
+	StatusPageAddr               string             `yaml:"StatusPageAddr" toml:"StatusPageAddr" json:"StatusPageAddr"`    // address serving the HTML status page, blank to disable
+	HealthAddr                   string             `yaml:"HealthAddr" toml:"HealthAddr" json:"HealthAddr"`                // address serving /healthz and /readyz, blank to disable
+	HealthTimeout                int                `yaml:"HealthTimeout" toml:"HealthTimeout" json:"HealthTimeout"`       // [s] without progress of the recording before it is reported wedged, the polling interval plus twice the scan timeout if 0
+	RigID                        string             `yaml:"RigID" toml:"RigID" json:"RigID"`
+	DebugAddr                    string             `yaml:"DebugAddr" toml:"DebugAddr" json:"DebugAddr"`
+	DegasInterval                int64              `yaml:"DegasInterval" toml:"DegasInterval" json:"DegasInterval"`
+	DegasAfterFilamentHours      float64            `yaml:"DegasAfterFilamentHours" toml:"DegasAfterFilamentHours" json:"DegasAfterFilamentHours"`
+	DegasWindow                  string             `yaml:"DegasWindow" toml:"DegasWindow" json:"DegasWindow"`
+	DegasStartPower              int                `yaml:"DegasStartPower" toml:"DegasStartPower" json:"DegasStartPower"`
+	DegasEndPower                int                `yaml:"DegasEndPower" toml:"DegasEndPower" json:"DegasEndPower"`
+	DegasRampPeriod              int                `yaml:"DegasRampPeriod" toml:"DegasRampPeriod" json:"DegasRampPeriod"`
+	DegasMaxPowerPeriod          int                `yaml:"DegasMaxPowerPeriod" toml:"DegasMaxPowerPeriod" json:"DegasMaxPowerPeriod"`
+	DegasResettlePeriod          int                `yaml:"DegasResettlePeriod" toml:"DegasResettlePeriod" json:"DegasResettlePeriod"`
+	DetectorRampStart            int                `yaml:"DetectorRampStart" toml:"DetectorRampStart" json:"DetectorRampStart"`
+	DetectorRampStep             int                `yaml:"DetectorRampStep" toml:"DetectorRampStep" json:"DetectorRampStep"`
+	DetectorRampDelay            int64              `yaml:"DetectorRampDelay" toml:"DetectorRampDelay" json:"DetectorRampDelay"`
+	SourceProfiles               []SourceProfile    `yaml:"SourceProfiles" toml:"SourceProfiles" json:"SourceProfiles"`
+	SourceProfile                string             `yaml:"SourceProfile" toml:"SourceProfile" json:"SourceProfile"`
+	IonizationMode               string             `yaml:"IonizationMode" toml:"IonizationMode" json:"IonizationMode"`
+	IonizationSourceIndex        int                `yaml:"IonizationSourceIndex" toml:"IonizationSourceIndex" json:"IonizationSourceIndex"`
+	StandardElectronEnergy       int                `yaml:"StandardElectronEnergy" toml:"StandardElectronEnergy" json:"StandardElectronEnergy"`
+	StandardEmission             float64            `yaml:"StandardEmission" toml:"StandardEmission" json:"StandardEmission"`
+	SoftElectronEnergy           int                `yaml:"SoftElectronEnergy" toml:"SoftElectronEnergy" json:"SoftElectronEnergy"`
+	SoftEmission                 float64            `yaml:"SoftEmission" toml:"SoftEmission" json:"SoftEmission"`
+	Rollover                     *Rollover          `yaml:"Rollover" toml:"Rollover" json:"Rollover"`                                        // HPQ2 only, rollover variables sent when recording starts. Left unchanged if not set
+	Inlets                       []Inlet            `yaml:"Inlets" toml:"Inlets" json:"Inlets"`                                              // inlets of multi-inlet systems. Data is tagged with the active inlet if set
+	Inlet                        int                `yaml:"Inlet" toml:"Inlet" json:"Inlet"`                                                 // index of the inlet active when recording starts
+	DigitalInputs                []DigitalInput     `yaml:"DigitalInputs" toml:"DigitalInputs" json:"DigitalInputs"`                         // digital input bits reported as boolean channels in frames
+	AlarmOutputs                 []AlarmOutput      `yaml:"AlarmOutputs" toml:"AlarmOutputs" json:"AlarmOutputs"`                            // digital output bits set while an alarm is raised
+	ExternalGauge                bool               `yaml:"ExternalGauge" toml:"ExternalGauge" json:"ExternalGauge"`                         // feed the total pressure read from an external gauge on an analog input to the sensor every scan
+	ExternalGaugeInput           int                `yaml:"ExternalGaugeInput" toml:"ExternalGaugeInput" json:"ExternalGaugeInput"`          // analog input index
+	ExternalGaugeInterval        int                `yaml:"ExternalGaugeInterval" toml:"ExternalGaugeInterval" json:"ExternalGaugeInterval"` // [µs] between analog input readings, 0 leaves it unchanged
+	ExternalGaugeSlope           float64            `yaml:"ExternalGaugeSlope" toml:"ExternalGaugeSlope" json:"ExternalGaugeSlope"`
+	ExternalGaugeOffset          float64            `yaml:"ExternalGaugeOffset" toml:"ExternalGaugeOffset" json:"ExternalGaugeOffset"`
+	ExternalGaugeLog             bool               `yaml:"ExternalGaugeLog" toml:"ExternalGaugeLog" json:"ExternalGaugeLog"`                      // log10(P) = Slope*V + Offset instead of P = Slope*V + Offset
+	TotalPressureCalFactor       float64            `yaml:"TotalPressureCalFactor" toml:"TotalPressureCalFactor" json:"TotalPressureCalFactor"`    // applied by the sensor to the external gauge pressure, 0 leaves it unchanged
+	AudioAlarms                  []AudioAlarm       `yaml:"AudioAlarms" toml:"AudioAlarms" json:"AudioAlarms"`                                     // alarms sounded by the sensor's audio output, the first raised one sets the frequency
+	MonitorMode                  bool               `yaml:"MonitorMode" toml:"MonitorMode" json:"MonitorMode"`                                     // only publish the sensor state, never taking control of the sensor
+	SensorSerial                 string             `yaml:"SensorSerial" toml:"SensorSerial" json:"SensorSerial"`                                  // serial number of the sensor selected in monitor mode, blank for the default sensor
+	DryRun                       bool               `yaml:"DryRun" toml:"DryRun" json:"DryRun"`                                                    // log calibration and tuning commands instead of sending them to the sensor
+	AdminToken                   string             `yaml:"AdminToken" toml:"AdminToken" json:"AdminToken"`                                        // required by calibration writes, degas, source tuning and digital outputs, disabled if blank
+	StartCheckOverrides          []string           `yaml:"StartCheckOverrides" toml:"StartCheckOverrides" json:"StartCheckOverrides"`             // start checks that only log when they fail: filament, rftrip, multiplier or pressure
+	MaxStartPressure             float64            `yaml:"MaxStartPressure" toml:"MaxStartPressure" json:"MaxStartPressure"`                      // [Pa] total pressure above which a recording won't start, defaults to 6.67e-3 (5e-5 Torr)
+	RFTripTimeout                int                `yaml:"RFTripTimeout" toml:"RFTripTimeout" json:"RFTripTimeout"`                               // [s] the recording waits for an RF trip to clear before it stops, 0 waits forever
+	ResolutionMonitor            *ResolutionMonitor `yaml:"ResolutionMonitor" toml:"ResolutionMonitor" json:"ResolutionMonitor"`                   // raise the ResolutionDrift alarm when the reference peak of analog scans broadens or shifts
+	Fingerprint                  *Fingerprint       `yaml:"Fingerprint" toml:"Fingerprint" json:"Fingerprint"`                                     // compare every scan to a reference spectrum and raise the FingerprintDeviation alarm when the composition changes
+	AirLeakDetector              *AirLeakDetector   `yaml:"AirLeakDetector" toml:"AirLeakDetector" json:"AirLeakDetector"`                         // raise the AirLeak alarm and an event when scans match the air leak signature
+	BakeOut                      *BakeOut           `yaml:"BakeOut" toml:"BakeOut" json:"BakeOut"`                                                 // masses tracked by StartBakeOut, whose progress is reported as bake-out frames
+	FilamentWarmUp               *FilamentWarmUp    `yaml:"FilamentWarmUp" toml:"FilamentWarmUp" json:"FilamentWarmUp"`                            // wait for the filament to be ON with a stable emission before collecting data, not checked if nil
+	KeepFilamentOn               bool               `yaml:"KeepFilamentOn" toml:"KeepFilamentOn" json:"KeepFilamentOn"`                            // leave the filament on when a recording stops
+	ShutdownTimeout              int                `yaml:"ShutdownTimeout" toml:"ShutdownTimeout" json:"ShutdownTimeout"`                         // [s] the plugin waits for the recording to clean up when it stops, defaults to 30
+	ShutdownScanTimeout          int                `yaml:"ShutdownScanTimeout" toml:"ShutdownScanTimeout" json:"ShutdownScanTimeout"`             // [s] the in-flight scan is given to finish when the plugin stops, defaults to 10
+	CalibrationFactors           map[string]float64 `yaml:"CalibrationFactors" toml:"CalibrationFactors" json:"CalibrationFactors"`                // relative sensitivity factor keyed by integer mass, e.g. "28", readings are divided by it before publishing
+	CalibrationKeepRaw           bool               `yaml:"CalibrationKeepRaw" toml:"CalibrationKeepRaw" json:"CalibrationKeepRaw"`                // keep the uncalibrated value alongside calibrated readings
+	SaturationPressure           float64            `yaml:"SaturationPressure" toml:"SaturationPressure" json:"SaturationPressure"`                // [Pa] ceiling of the multipliers without a DetectorRanges entry, defaults to 1e-4
+	DetectorRanges               []DetectorRange    `yaml:"DetectorRanges" toml:"DetectorRanges" json:"DetectorRanges"`                            // noise floor and saturation ceiling per detector, readings outside are flagged underRange or saturated
+	GainSwitching                bool               `yaml:"GainSwitching" toml:"GainSwitching" json:"GainSwitching"`                               // step the electronic gain or detector of a measurement with saturated or only under range readings
+	AutoRange                    *AutoRange         `yaml:"AutoRange" toml:"AutoRange" json:"AutoRange"`                                           // range the electronic gain, and optionally the detector, of the measurements between scans. Replaces GainSwitching
+	DetectorMerges               []DetectorMerge    `yaml:"DetectorMerges" toml:"DetectorMerges" json:"DetectorMerges"`                            // Faraday and multiplier measurements of the same masses published as a single wide dynamic range measurement
+	Transforms                   []Transform        `yaml:"Transforms" toml:"Transforms" json:"Transforms"`                                        // transforms applied in order to the selected channels before the scans are published
+	IncludeMasses                []int              `yaml:"IncludeMasses" toml:"IncludeMasses" json:"IncludeMasses"`                               // only masses published, every scanned mass if empty
+	ExcludeMasses                []int              `yaml:"ExcludeMasses" toml:"ExcludeMasses" json:"ExcludeMasses"`                               // masses left out of the frames and sinks though they are scanned
+	RunDescription               string             `yaml:"RunDescription" toml:"RunDescription" json:"RunDescription"`                            // description of the run opened when a recording starts
+	CalibrationIntervalDays      int                `yaml:"CalibrationIntervalDays" toml:"CalibrationIntervalDays" json:"CalibrationIntervalDays"` // warn when a detector or gauge calibration is older than this, 0 disables the check
 }
 
-var configFileName = "mks.yaml"
+// Measurement describes a single measurement to be added to the RGA scan
+type Measurement struct {
+	Name               string `yaml:"Name" toml:"Name" json:"Name"`
+	Type               string `yaml:"Type" toml:"Type" json:"Type"` // Barchart or Analog
+	StartMass          int    `yaml:"StartMass" toml:"StartMass" json:"StartMass"`
+	EndMass            int    `yaml:"EndMass" toml:"EndMass" json:"EndMass"`
+	FilterMode         string `yaml:"FilterMode" toml:"FilterMode" json:"FilterMode"`          // Barchart only
+	PointsPerPeak      int    `yaml:"PointsPerPeak" toml:"PointsPerPeak" json:"PointsPerPeak"` // Analog only
+	Accuracy           int    `yaml:"Accuracy" toml:"Accuracy" json:"Accuracy"`
+	EGainIndex         int    `yaml:"EGainIndex" toml:"EGainIndex" json:"EGainIndex"`
+	SourceIndex        int    `yaml:"SourceIndex" toml:"SourceIndex" json:"SourceIndex"`
+	DetectorIndex      int    `yaml:"DetectorIndex" toml:"DetectorIndex" json:"DetectorIndex"`
+	DetectorVoltage    int    `yaml:"DetectorVoltage" toml:"DetectorVoltage" json:"DetectorVoltage"`          // multiplier voltage ramped to when recording starts, 0 leaves it unchanged
+	RolloverCorrection bool   `yaml:"RolloverCorrection" toml:"RolloverCorrection" json:"RolloverCorrection"` // HPQ2 only, applies the rollover correction to this measurement
+}
+
+// DetectorRange is the range a detector reads reliably at the lowest electronic gain, higher gains scale it down by
+// their ratio to the lowest one as reported by EGains
+type DetectorRange struct {
+	SourceIndex   int     `yaml:"SourceIndex" toml:"SourceIndex" json:"SourceIndex"`
+	DetectorIndex int     `yaml:"DetectorIndex" toml:"DetectorIndex" json:"DetectorIndex"` // 0 for the Faraday, 1 to 3 for the multiplier settings
+	Floor         float64 `yaml:"Floor" toml:"Floor" json:"Floor"`                         // [Pa] noise floor, defaults to 1e-9 for the Faraday and 1e-12 for multipliers
+	Ceiling       float64 `yaml:"Ceiling" toml:"Ceiling" json:"Ceiling"`                   // [Pa] saturation, defaults to 1e-2 for the Faraday and SaturationPressure for multipliers
+}
+
+// AutoRange configures the automatic gain ranging keeping the highest reading of a measurement under the ceiling of
+// its detector and electronic gain, on the most sensitive setting it fits in
+type AutoRange struct {
+	Measurements []string `yaml:"Measurements" toml:"Measurements" json:"Measurements"` // names of the measurements ranged, every one if empty
+	Headroom     float64  `yaml:"Headroom" toml:"Headroom" json:"Headroom"`             // fraction of the ceiling the highest reading is kept under, 0.5 if 0
+	Scans        int      `yaml:"Scans" toml:"Scans" json:"Scans"`                      // consecutive scans fitting a more sensitive setting before switching to it, 3 if 0
+	Detectors    bool     `yaml:"Detectors" toml:"Detectors" json:"Detectors"`          // also switch between the Faraday and the first multiplier, only the electronic gain otherwise
+}
+
+// DetectorMerge merges a Faraday and a multiplier measurement over the same masses into a single measurement
+type DetectorMerge struct {
+	Name         string  `yaml:"Name" toml:"Name" json:"Name"`                         // name of the merged measurement
+	Faraday      string  `yaml:"Faraday" toml:"Faraday" json:"Faraday"`                // name of the Faraday measurement
+	Multiplier   string  `yaml:"Multiplier" toml:"Multiplier" json:"Multiplier"`       // name of the multiplier measurement
+	Mode         string  `yaml:"Mode" toml:"Mode" json:"Mode"`                         // switch or blend, switch if blank
+	Crossover    float64 `yaml:"Crossover" toml:"Crossover" json:"Crossover"`          // [Pa] multiplier reading above which the Faraday is used, 0 only switches on saturated multiplier readings
+	BlendDecades float64 `yaml:"BlendDecades" toml:"BlendDecades" json:"BlendDecades"` // blend: width in decades of the band around Crossover where both readings are weighted, 1 if 0
+}
+
+// SourceProfile is a named set of source tuning parameters. Parameters left out are not changed
+type SourceProfile struct {
+	Name               string   `yaml:"Name" toml:"Name" json:"Name"`
+	SourceIndex        int      `yaml:"SourceIndex" toml:"SourceIndex" json:"SourceIndex"`
+	IonEnergy          *float64 `yaml:"IonEnergy" toml:"IonEnergy" json:"IonEnergy"`
+	Emission           *float64 `yaml:"Emission" toml:"Emission" json:"Emission"`
+	Extract            *int     `yaml:"Extract" toml:"Extract" json:"Extract"`
+	ElectronEnergy     *int     `yaml:"ElectronEnergy" toml:"ElectronEnergy" json:"ElectronEnergy"`
+	LowMassResolution  *int     `yaml:"LowMassResolution" toml:"LowMassResolution" json:"LowMassResolution"`
+	LowMassAlignment   *int     `yaml:"LowMassAlignment" toml:"LowMassAlignment" json:"LowMassAlignment"`
+	HighMassAlignment  *int     `yaml:"HighMassAlignment" toml:"HighMassAlignment" json:"HighMassAlignment"`
+	HighMassResolution *int     `yaml:"HighMassResolution" toml:"HighMassResolution" json:"HighMassResolution"`
+}
+
+// Rollover holds the rollover correction variables of HPQ2 sensors
+type Rollover struct {
+	M1           int                `yaml:"M1" toml:"M1" json:"M1"`
+	M2           int                `yaml:"M2" toml:"M2" json:"M2"`
+	B1           float64            `yaml:"B1" toml:"B1" json:"B1"`
+	B2           float64            `yaml:"B2" toml:"B2" json:"B2"`
+	BP1          float64            `yaml:"BP1" toml:"BP1" json:"BP1"`
+	ScaleFactors map[string]float64 `yaml:"ScaleFactors" toml:"ScaleFactors" json:"ScaleFactors"` // peak scale factor keyed by integer mass, e.g. "28"
+}
+
+// Inlet describes an inlet of a multi-inlet system
+type Inlet struct {
+	Index  int     `yaml:"Index" toml:"Index" json:"Index"` // 0 based
+	Name   string  `yaml:"Name" toml:"Name" json:"Name"`
+	Factor float64 `yaml:"Factor" toml:"Factor" json:"Factor"` // pressure reduction factor, 0 leaves it unchanged
+}
+
+// DigitalInput maps a bit of a digital port to a named boolean channel
+type DigitalInput struct {
+	Name      string `yaml:"Name" toml:"Name" json:"Name"`
+	Port      string `yaml:"Port" toml:"Port" json:"Port"` // A, B, C, etc.
+	Bit       int    `yaml:"Bit" toml:"Bit" json:"Bit"`    // 0-7
+	ActiveLow bool   `yaml:"ActiveLow" toml:"ActiveLow" json:"ActiveLow"`
+	Interlock bool   `yaml:"Interlock" toml:"Interlock" json:"Interlock"` // pauses scanning while active
+}
+
+// AlarmOutput maps an alarm to a bit of a digital port, set while the alarm is raised
+type AlarmOutput struct {
+	Alarm string `yaml:"Alarm" toml:"Alarm" json:"Alarm"` // StaleData, Interlock, RFTrip, ResolutionDrift, FingerprintDeviation or AirLeak
+	Port  string `yaml:"Port" toml:"Port" json:"Port"`
+	Bit   int    `yaml:"Bit" toml:"Bit" json:"Bit"`
+}
+
+// AudioAlarm sounds the sensor's audio output at the given frequency while the alarm is raised
+type AudioAlarm struct {
+	Alarm     string `yaml:"Alarm" toml:"Alarm" json:"Alarm"`             // StaleData, Interlock, RFTrip, ResolutionDrift, FingerprintDeviation or AirLeak
+	Frequency int    `yaml:"Frequency" toml:"Frequency" json:"Frequency"` // [Hz]
+}
+
+// ResolutionMonitor tracks the FWHM and position of a reference peak across analog scans
+type ResolutionMonitor struct {
+	Mass          float64 `yaml:"Mass" toml:"Mass" json:"Mass"`                            // nominal mass of the reference peak, e.g. 28
+	Measurement   string  `yaml:"Measurement" toml:"Measurement" json:"Measurement"`       // analog measurement the peak is read from, any if blank
+	ReferenceFWHM float64 `yaml:"ReferenceFWHM" toml:"ReferenceFWHM" json:"ReferenceFWHM"` // [AMU] learnt from the first window if 0
+	MaxFWHMDrift  float64 `yaml:"MaxFWHMDrift" toml:"MaxFWHMDrift" json:"MaxFWHMDrift"`    // [AMU] allowed change of the FWHM, 0 disables the check
+	MaxMassDrift  float64 `yaml:"MaxMassDrift" toml:"MaxMassDrift" json:"MaxMassDrift"`    // [AMU] allowed shift of the peak centroid, 0 disables the check
+	Window        int     `yaml:"Window" toml:"Window" json:"Window"`                      // scans averaged before comparing, 5 if 0
+}
+
+// Fingerprint compares scans to a reference spectrum, e.g. the clean baseline after a bake
+type Fingerprint struct {
+	File          string  `yaml:"File" toml:"File" json:"File"`                            // reference spectrum, written by CaptureFingerprint
+	Measurement   string  `yaml:"Measurement" toml:"Measurement" json:"Measurement"`       // measurement compared, every measurement if blank
+	MinSimilarity float64 `yaml:"MinSimilarity" toml:"MinSimilarity" json:"MinSimilarity"` // cosine similarity below which the alarm is raised, 0.95 if 0
+	Diffs         int     `yaml:"Diffs" toml:"Diffs" json:"Diffs"`                         // masses that grew the most listed in the alert, 3 if 0
+}
+
+// AirLeakDetector looks for the air leak signature: m28/m32 close to 3.7 with argon at m40
+type AirLeakDetector struct {
+	MinPressure    float64 `yaml:"MinPressure" toml:"MinPressure" json:"MinPressure"`          // [Pa] mass 28 and 32 must be above it to be evaluated
+	RatioTolerance float64 `yaml:"RatioTolerance" toml:"RatioTolerance" json:"RatioTolerance"` // relative deviation of m28/m32 from 3.7 scoring 0, 0.3 if 0
+	MinConfidence  float64 `yaml:"MinConfidence" toml:"MinConfidence" json:"MinConfidence"`    // confidence from 0 to 1 needed to suspect a leak, 0.6 if 0
+	Scans          int     `yaml:"Scans" toml:"Scans" json:"Scans"`                            // consecutive scans needed, 3 if 0
+}
+
+// FilamentWarmUp configures the wait for the filament to warm up when a recording starts
+type FilamentWarmUp struct {
+	TurnOn    bool    `yaml:"TurnOn" toml:"TurnOn" json:"TurnOn"`          // turn the filament on first
+	Timeout   int     `yaml:"Timeout" toml:"Timeout" json:"Timeout"`       // [s] the recording fails if the filament isn't ready by then, 120 if 0
+	Settle    int     `yaml:"Settle" toml:"Settle" json:"Settle"`          // [s] the emission must stay stable this long once ON, 10 if 0
+	Tolerance float64 `yaml:"Tolerance" toml:"Tolerance" json:"Tolerance"` // relative emission change still considered stable, 0.02 if 0
+}
 
-// InitConfig initializes the config from the config YAML file
+// BakeOut configures the tracking of the outgassing decay during a bake-out
+type BakeOut struct {
+	Masses   []BakeOutMass `yaml:"Masses" toml:"Masses" json:"Masses"`       // 2, 17 and 18 without targets if empty
+	Interval int           `yaml:"Interval" toml:"Interval" json:"Interval"` // [s] between progress frames, 10 minutes if 0
+	Window   int           `yaml:"Window" toml:"Window" json:"Window"`       // [min] of readings the decay is fitted over, 2 hours if 0
+}
+
+// BakeOutMass is a mass tracked during a bake-out
+type BakeOutMass struct {
+	Mass   int     `yaml:"Mass" toml:"Mass" json:"Mass"`
+	Target float64 `yaml:"Target" toml:"Target" json:"Target"` // [Pa] partial pressure the bake-out aims for, 0 if none
+}
+
+// Webhook posts scan summaries or alarm events to a URL
+type Webhook struct {
+	URL          string            `yaml:"URL" toml:"URL" json:"URL"`
+	Events       []string          `yaml:"Events" toml:"Events" json:"Events"`                   // scan and/or alarm, both if empty
+	Template     string            `yaml:"Template" toml:"Template" json:"Template"`             // Go text/template of the payload, the event as JSON if blank
+	ContentType  string            `yaml:"ContentType" toml:"ContentType" json:"ContentType"`    // defaults to application/json
+	Headers      map[string]string `yaml:"Headers" toml:"Headers" json:"Headers"`                // e.g. Authorization
+	Retries      int               `yaml:"Retries" toml:"Retries" json:"Retries"`                // attempts after a failure, 3 if 0
+	ScanInterval int               `yaml:"ScanInterval" toml:"ScanInterval" json:"ScanInterval"` // [s] minimum time between scan events, every scan if 0
+}
+
+// Route sends the readings of measurements to some of the sinks only
+type Route struct {
+	Measurements []string `yaml:"Measurements" toml:"Measurements" json:"Measurements"` // names of the measurements, or of detector merges
+	Sinks        []string `yaml:"Sinks" toml:"Sinks" json:"Sinks"`                      // names of the sinks, e.g. influx or archive, every sink if empty
+	InfluxBucket string   `yaml:"InfluxBucket" toml:"InfluxBucket" json:"InfluxBucket"` // bucket the influx sink writes them to instead of InfluxBucketName, created if missing
+}
+
+// InfluxDownsample reduces the points written to Influx for a group of masses
+type InfluxDownsample struct {
+	StartMass float64 `yaml:"StartMass" toml:"StartMass" json:"StartMass"` // first mass of the group
+	EndMass   float64 `yaml:"EndMass" toml:"EndMass" json:"EndMass"`       // last mass of the group
+	Every     int     `yaml:"Every" toml:"Every" json:"Every"`             // scans the group is written once every, every scan if 0 or 1
+	Aggregate bool    `yaml:"Aggregate" toml:"Aggregate" json:"Aggregate"` // write the mean, min and max of those scans instead of the last
+}
+
+// SinkQueue configures how scans are queued and written to a sink
+type SinkQueue struct {
+	Sink            string `yaml:"Sink" toml:"Sink" json:"Sink"`                                  // name of the sink, e.g. influx, blank for every sink without its own entry
+	Size            int    `yaml:"Size" toml:"Size" json:"Size"`                                  // scans queued before the oldest is dropped, 256 if 0
+	Batch           int    `yaml:"Batch" toml:"Batch" json:"Batch"`                               // maximum scans written at once, 1 if 0
+	Retries         int    `yaml:"Retries" toml:"Retries" json:"Retries"`                         // attempts after a failed write, with exponential backoff
+	BreakerFailures int    `yaml:"BreakerFailures" toml:"BreakerFailures" json:"BreakerFailures"` // failed batches in a row before the sink is skipped, 5 if 0
+	BreakerCooldown int    `yaml:"BreakerCooldown" toml:"BreakerCooldown" json:"BreakerCooldown"` // [s] time the sink is skipped for, 60 if 0
+}
+
+// RejectLog configures the troubleshooting log of the data the plugin drops: unparseable messages, scans dropped by
+// full queues or failing sinks and frames Laniakea didn't read
+type RejectLog struct {
+	Path    string `yaml:"Path" toml:"Path" json:"Path"`          // JSON lines file, the previous one is kept as Path.1 when it is rotated
+	MaxSize int    `yaml:"MaxSize" toml:"MaxSize" json:"MaxSize"` // [MiB] size the file is rotated at, 10 if 0
+}
+
+// SMTP configures email notifications
+type SMTP struct {
+	Addr     string   `yaml:"Addr" toml:"Addr" json:"Addr"` // host:port of the SMTP server
+	Username string   `yaml:"Username" toml:"Username" json:"Username"`
+	Password string   `yaml:"Password" toml:"Password" json:"Password"`
+	From     string   `yaml:"From" toml:"From" json:"From"`
+	To       []string `yaml:"To" toml:"To" json:"To"`
+	Events   []string `yaml:"Events" toml:"Events" json:"Events"`       // alarm, filament, link and/or recording, all if empty
+	Interval int      `yaml:"Interval" toml:"Interval" json:"Interval"` // [s] minimum time between emails, notifications in between are digested. 15 minutes if 0
+}
+
+// Clock configures the source of the timestamps
+type Clock struct {
+	Source      string  `yaml:"Source" toml:"Source" json:"Source"`                // system, monotonic or ntp
+	NTPServer   string  `yaml:"NTPServer" toml:"NTPServer" json:"NTPServer"`       // host[:port], pool.ntp.org if blank
+	NTPInterval int     `yaml:"NTPInterval" toml:"NTPInterval" json:"NTPInterval"` // [s] time between NTP queries, 10 minutes if 0
+	Offset      float64 `yaml:"Offset" toml:"Offset" json:"Offset"`                // [ms] added to every timestamp
+}
+
+// Transform is an ordered list of steps applied to the values of a channel
+type Transform struct {
+	Channel string          `yaml:"Channel" toml:"Channel" json:"Channel"` // * for every reading, a mass, a measurement name or total for the total pressure
+	Steps   []TransformStep `yaml:"Steps" toml:"Steps" json:"Steps"`
+}
+
+// TransformStep configures a single transform. Only the fields used by its type are read
+type TransformStep struct {
+	Type   string   `yaml:"Type" toml:"Type" json:"Type"`       // unit, factor, smooth, log10 or clamp
+	Unit   string   `yaml:"Unit" toml:"Unit" json:"Unit"`       // unit: Pa, mbar, Torr or psi
+	Factor float64  `yaml:"Factor" toml:"Factor" json:"Factor"` // factor: multiplier
+	Window int      `yaml:"Window" toml:"Window" json:"Window"` // smooth: number of scans averaged
+	Min    *float64 `yaml:"Min" toml:"Min" json:"Min"`          // clamp: lower bound, log10: floor applied first
+	Max    *float64 `yaml:"Max" toml:"Max" json:"Max"`          // clamp: upper bound
+}
+
+// Proxy is a SOCKS5 proxy or SSH jump host the RGA connection is tunnelled through
+type Proxy struct {
+	Type           string `yaml:"Type" toml:"Type" json:"Type"` // socks5 or ssh
+	Addr           string `yaml:"Addr" toml:"Addr" json:"Addr"` // host:port of the proxy or SSH server
+	Username       string `yaml:"Username" toml:"Username" json:"Username"`
+	Password       string `yaml:"Password" toml:"Password" json:"Password"`
+	KeyFile        string `yaml:"KeyFile" toml:"KeyFile" json:"KeyFile"`                      // SSH private key
+	KnownHostsFile string `yaml:"KnownHostsFile" toml:"KnownHostsFile" json:"KnownHostsFile"` // verifies the SSH server's host key, required for ssh
+}
+
+// Socket tunes the TCP connections to the RGA. Through a Proxy it only applies to the local end of the tunnel
+type Socket struct {
+	KeepAlive   int  `yaml:"KeepAlive" toml:"KeepAlive" json:"KeepAlive"`       // [s] idle time before the first keepalive probe and between probes, 0 keeps the default of 15, -1 disables them
+	Nagle       bool `yaml:"Nagle" toml:"Nagle" json:"Nagle"`                   // coalesce small writes (disables TCP_NODELAY), off by default so commands are sent right away
+	ReadBuffer  int  `yaml:"ReadBuffer" toml:"ReadBuffer" json:"ReadBuffer"`    // [bytes] receive buffer size, OS default if 0
+	WriteBuffer int  `yaml:"WriteBuffer" toml:"WriteBuffer" json:"WriteBuffer"` // [bytes] send buffer size, OS default if 0
+}
+
+var (
+	configFileBase     = "mks"
+	configExtensions   = []string{".yaml", ".yml", ".toml", ".json"}
+	stateFileName      = "mks-state.json"
+	defaultMeasurement = Measurement{
+		Name:       "Bar1",
+		Type:       "Barchart",
+		StartMass:  1,
+		EndMass:    200,
+		FilterMode: "PeakCenter",
+		Accuracy:   5,
+	}
+)
+
+// findConfigFile returns the path of the first config file found in the given directory, trying each supported extension
+func findConfigFile(dir string) (string, error) {
+	for _, ext := range configExtensions {
+		path := filepath.Join(dir, configFileBase+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("No %s config file found in %s (supported extensions: %s)", configFileBase, dir, strings.Join(configExtensions, ", "))
+}
+
+// unmarshalConfig decodes the config bytes according to the format implied by the file extension
+func unmarshalConfig(path string, cfgBytes []byte, cfg *Config) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(cfgBytes, cfg)
+	case ".toml":
+		return toml.Unmarshal(cfgBytes, cfg)
+	case ".json":
+		return json.Unmarshal(cfgBytes, cfg)
+	default:
+		return fmt.Errorf("Unsupported config file format: %s", path)
+	}
+}
+
+// DefaultConfigPath returns the path where the YAML config file is expected
+func DefaultConfigPath() string {
+	return filepath.Join(btcutil.AppDataDir("fmtd", false), configFileBase+configExtensions[0])
+}
+
+// InitConfig initializes the config from the config file. YAML, TOML and JSON are supported and detected by file extension
 func InitConfig() (*Config, error) {
 	// Use lani appdata dir for MKS plugin config
-	cfgBytes, err := ioutil.ReadFile(filepath.Join(btcutil.AppDataDir("fmtd", false), configFileName))
+	appDataDir := btcutil.AppDataDir("fmtd", false)
+	cfgPath, err := findConfigFile(appDataDir)
+	if err != nil {
+		return nil, err
+	}
+	cfgBytes, err := ioutil.ReadFile(cfgPath)
 	if err != nil {
 		return nil, err
 	}
 	var cfg Config
-	err = yaml.Unmarshal(cfgBytes, &cfg)
+	err = unmarshalConfig(cfgPath, cfgBytes, &cfg)
 	if err != nil {
 		return nil, err
 	}
+	if len(cfg.Measurements) == 0 {
+		cfg.Measurements = []Measurement{defaultMeasurement}
+	}
+	if err := resolveInfluxToken(&cfg); err != nil {
+		return nil, err
+	}
+	if cfg.StateFile == "" {
+		cfg.StateFile = filepath.Join(appDataDir, stateFileName)
+	}
 	return &cfg, nil
 }
@@ -0,0 +1,172 @@
+package cfg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// configFormats holds the same config in every supported format
+var configFormats = map[string]string{
+	".yaml": `
+Influx: true
+InfluxURL: "http://localhost:8086"
+InfluxAPIToken: "token"
+InfluxBucketRetention: 86400
+InfluxFailoverURLs: ["http://replica:8086"]
+RGAAddr: "10.0.0.2:10014"
+PollingInterval: 20
+StateFile: "/var/lib/mks/state.json"
+CommandRateLimits:
+  scan: 2.5
+Measurements:
+  - Name: "bar"
+    Type: "Barchart"
+    StartMass: 1
+    EndMass: 50
+    FilterMode: "PeakCenter"
+    Accuracy: 5
+  - Name: "peaks"
+    Type: "Analog"
+    StartMass: 10
+    EndMass: 20
+    PointsPerPeak: 8
+CalibrationFactors:
+  2: 0.44
+  44: 1.4
+Rollover:
+  M1: 10
+  M2: 30
+  BP1: 0.0012
+  ScaleFactors:
+    28: 1.0
+Inlets:
+  - Index: 1
+    Name: "chamber"
+    Factor: 0.5
+`,
+	".toml": `
+Influx = true
+InfluxURL = "http://localhost:8086"
+InfluxAPIToken = "token"
+InfluxBucketRetention = 86400
+InfluxFailoverURLs = ["http://replica:8086"]
+RGAAddr = "10.0.0.2:10014"
+PollingInterval = 20
+StateFile = "/var/lib/mks/state.json"
+
+[CommandRateLimits]
+scan = 2.5
+
+[[Measurements]]
+Name = "bar"
+Type = "Barchart"
+StartMass = 1
+EndMass = 50
+FilterMode = "PeakCenter"
+Accuracy = 5
+
+[[Measurements]]
+Name = "peaks"
+Type = "Analog"
+StartMass = 10
+EndMass = 20
+PointsPerPeak = 8
+
+[CalibrationFactors]
+2 = 0.44
+44 = 1.4
+
+[Rollover]
+M1 = 10
+M2 = 30
+BP1 = 0.0012
+
+[Rollover.ScaleFactors]
+28 = 1.0
+
+[[Inlets]]
+Index = 1
+Name = "chamber"
+Factor = 0.5
+`,
+	".json": `{
+	"Influx": true,
+	"InfluxURL": "http://localhost:8086",
+	"InfluxAPIToken": "token",
+	"InfluxBucketRetention": 86400,
+	"InfluxFailoverURLs": ["http://replica:8086"],
+	"RGAAddr": "10.0.0.2:10014",
+	"PollingInterval": 20,
+	"StateFile": "/var/lib/mks/state.json",
+	"CommandRateLimits": {"scan": 2.5},
+	"Measurements": [
+		{"Name": "bar", "Type": "Barchart", "StartMass": 1, "EndMass": 50, "FilterMode": "PeakCenter", "Accuracy": 5},
+		{"Name": "peaks", "Type": "Analog", "StartMass": 10, "EndMass": 20, "PointsPerPeak": 8}
+	],
+	"CalibrationFactors": {"2": 0.44, "44": 1.4},
+	"Rollover": {"M1": 10, "M2": 30, "BP1": 0.0012, "ScaleFactors": {"28": 1.0}},
+	"Inlets": [{"Index": 1, "Name": "chamber", "Factor": 0.5}]
+}`,
+}
+
+// initConfig loads the config file with the given extension and contents with InitConfig, from a fresh home directory
+func initConfig(t *testing.T, ext, contents string) *Config {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	dir := btcutil.AppDataDir("fmtd", false)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, configFileBase+ext), []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := InitConfig()
+	if err != nil {
+		t.Fatalf("InitConfig() with %s config error = %v", ext, err)
+	}
+	return cfg
+}
+
+func TestInitConfigFormats(t *testing.T) {
+	want := initConfig(t, ".yaml", configFormats[".yaml"])
+	if want.InfuxAPIToken != "token" || len(want.Measurements) != 2 || want.Rollover == nil || want.CalibrationFactors["44"] != 1.4 {
+		t.Fatalf("InitConfig() with .yaml config = %+v, missing options", want)
+	}
+	for _, ext := range []string{".toml", ".json"} {
+		t.Run(ext, func(t *testing.T) {
+			if got := initConfig(t, ext, configFormats[ext]); !reflect.DeepEqual(got, want) {
+				t.Errorf("InitConfig() with %s config = %+v, want %+v as from YAML", ext, got, want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalMassKeys(t *testing.T) {
+	want := map[string]float64{"2": 0.44, "44": 1.4}
+	tests := []struct {
+		path string
+		raw  string
+	}{
+		{path: "mks.yaml", raw: "CalibrationFactors:\n  2: 0.44\n  \"44\": 1.4\nRollover:\n  ScaleFactors:\n    2: 0.44\n    \"44\": 1.4\n"},
+		{path: "mks.toml", raw: "[CalibrationFactors]\n2 = 0.44\n\"44\" = 1.4\n[Rollover.ScaleFactors]\n2 = 0.44\n\"44\" = 1.4\n"},
+		{path: "mks.json", raw: `{"CalibrationFactors": {"2": 0.44, "44": 1.4}, "Rollover": {"ScaleFactors": {"2": 0.44, "44": 1.4}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var cfg Config
+			if err := unmarshalConfig(tt.path, []byte(tt.raw), &cfg); err != nil {
+				t.Fatalf("unmarshalConfig() error = %v", err)
+			}
+			if !reflect.DeepEqual(cfg.CalibrationFactors, want) {
+				t.Errorf("CalibrationFactors = %v, want %v", cfg.CalibrationFactors, want)
+			}
+			if cfg.Rollover == nil || !reflect.DeepEqual(cfg.Rollover.ScaleFactors, want) {
+				t.Errorf("Rollover = %+v, want ScaleFactors %v", cfg.Rollover, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package cfg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// resolveInfluxToken fills in the Influx API token from the first configured secret source.
+// Sources are checked in order: environment variable, token file, secret command. The plain text token is used otherwise
+func resolveInfluxToken(cfg *Config) error {
+	if cfg.InfluxAPITokenEnv != "" {
+		if token, ok := os.LookupEnv(cfg.InfluxAPITokenEnv); ok {
+			cfg.InfuxAPIToken = strings.TrimSpace(token)
+			return nil
+		}
+	}
+	if cfg.InfluxAPITokenFile != "" {
+		b, err := ioutil.ReadFile(cfg.InfluxAPITokenFile)
+		if err != nil {
+			return fmt.Errorf("Could not read Influx API token file: %v", err)
+		}
+		cfg.InfuxAPIToken = strings.TrimSpace(string(b))
+		return nil
+	}
+	if cfg.InfluxAPITokenCommand != "" {
+		args, err := splitWords(cfg.InfluxAPITokenCommand)
+		if err != nil {
+			return fmt.Errorf("Could not parse Influx API token command: %v", err)
+		}
+		out, err := exec.Command(args[0], args[1:]...).Output()
+		if err != nil {
+			return fmt.Errorf("Could not run Influx API token command: %v", err)
+		}
+		cfg.InfuxAPIToken = strings.TrimSpace(string(out))
+	}
+	return nil
+}
+
+// splitWords splits a command line into its arguments the way a POSIX shell does, without expansions: single quotes
+// keep their content as is, double quotes group words and a backslash escapes the next character
+func splitWords(line string) ([]string, error) {
+	var (
+		args    []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			if quote == '"' && r != '"' && r != '\\' && r != '$' && r != '`' {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if escaped || quote != 0 {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", line)
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return args, nil
+}
@@ -0,0 +1,37 @@
+package cfg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		args []string
+		err  bool
+	}{
+		{name: "plain", line: "pass show influx/mks", args: []string{"pass", "show", "influx/mks"}},
+		{name: "extra spaces", line: "  pass \t show  ", args: []string{"pass", "show"}},
+		{name: "double quotes", line: `vault kv get -field "api token" secret/influx`, args: []string{"vault", "kv", "get", "-field", "api token", "secret/influx"}},
+		{name: "single quotes", line: `sh -c 'cat "$HOME/token"'`, args: []string{"sh", "-c", `cat "$HOME/token"`}},
+		{name: "escaped space", line: `cat my\ token`, args: []string{"cat", "my token"}},
+		{name: "escape in double quotes", line: `echo "a\"b\c"`, args: []string{"echo", `a"b\c`}},
+		{name: "empty quotes", line: `echo ""`, args: []string{"echo", ""}},
+		{name: "unterminated quote", line: `echo "token`, err: true},
+		{name: "trailing backslash", line: `echo \`, err: true},
+		{name: "empty", line: "   ", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := splitWords(tt.line)
+			if (err != nil) != tt.err {
+				t.Fatalf("splitWords(%q) error = %v, want error %v", tt.line, err, tt.err)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("splitWords(%q) = %q, want %q", tt.line, args, tt.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+// FrameChunk identifies one part of a scan split over several data frames. Consumers reassemble a scan by collecting
+// the Total chunks with the same Sequence and concatenating their data in Index order
+type FrameChunk struct {
+	Sequence uint64 `json:"sequence"` // scan sequence number within the recording, starting at 1
+	Index    int    `json:"index"`    // 0 based
+	Total    int    `json:"total"`
+	Offset   int    `json:"offset"`   // position of the first reading of the chunk in the scan
+	Readings int    `json:"readings"` // readings of the whole scan
+}
+
+// chunkScan splits the readings of the scan into chunks of at most size readings. Every chunk shares the scan metadata.
+// Scans are not split if size is 0 or the scan fits in a single frame, but still carry chunk details when size is set
+func chunkScan(scan *Scan, seq uint64, size int) ([]*Scan, []*FrameChunk) {
+	if size <= 0 {
+		return []*Scan{scan}, []*FrameChunk{nil}
+	}
+	total := (len(scan.Readings) + size - 1) / size
+	if total == 0 {
+		total = 1
+	}
+	scans := make([]*Scan, 0, total)
+	chunks := make([]*FrameChunk, 0, total)
+	for i := 0; i < total; i++ {
+		start, end := i*size, (i+1)*size
+		if end > len(scan.Readings) {
+			end = len(scan.Readings)
+		}
+		part := *scan
+		part.Readings = scan.Readings[start:end]
+		scans = append(scans, &part)
+		chunks = append(chunks, &FrameChunk{Sequence: seq, Index: i, Total: total, Offset: start, Readings: len(scan.Readings)})
+	}
+	return scans, chunks
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+// cleanupSensor stops any scan and removes every measurement left on the sensor by a previous session, for instance
+// after a crash, so that adding the configured measurements doesn't fail because their names already exist
+func (e *MksRgaDatasource) cleanupSensor(session *mks.Session) {
+	// there is no command listing measurements, so the configured names are probed instead
+	var found []string
+	for _, m := range e.config.Measurements {
+		if _, err := session.MeasurementSelect(m.Name); err == nil {
+			found = append(found, m.Name)
+		}
+	}
+	if _, err := session.ScanStop(); err != nil {
+		log.Printf("Could not stop previous scan: %v", err)
+	}
+	if _, err := session.MeasurementRemoveAll(); err != nil {
+		log.Printf("Could not remove previous measurements: %v", err)
+		return
+	}
+	if len(found) > 0 {
+		log.Printf("Removed measurements left on the sensor: %s", strings.Join(found, ", "))
+	}
+}
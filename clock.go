@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+var (
+	clockSourceSystem    = "system"
+	clockSourceMonotonic = "monotonic"
+	clockSourceNTP       = "ntp"
+	defaultNTPServer     = "pool.ntp.org"
+	defaultNTPInterval   = 10 * time.Minute
+	ntpTimeout           = 5 * time.Second
+	ntpEpochOffset       = int64(2208988800) // seconds from 1900, the NTP epoch, to 1970
+)
+
+// ClockQuality describes how the timestamps of a frame were taken, to correlate them with other instruments of the rig
+type ClockQuality struct {
+	Source      string     `json:"source"`                // system, monotonic or ntp
+	Offset      float64    `json:"offset"`                // [ms] correction applied to the system clock, configured offset included
+	Uncertainty float64    `json:"uncertainty,omitempty"` // [ms] half the round trip to the NTP server
+	Stratum     int        `json:"stratum,omitempty"`     // of the NTP server
+	LastSync    *time.Time `json:"lastSync,omitempty"`    // last successful NTP query
+	Synced      bool       `json:"synced"`                // false until the NTP server answers and after it fails to
+}
+
+// clock timestamps scans and events. The system source uses the wall clock as is, the monotonic source advances the
+// wall clock read at startup by the monotonic clock so steps of the system clock never show, and the ntp source
+// corrects the system clock by the offset measured against an NTP server every Interval. The configured Offset is
+// added to every source, e.g. to align with a rig clock known to be off
+type clock struct {
+	source   string
+	offset   time.Duration
+	server   string
+	interval time.Duration
+	base     time.Time // wall clock at startup, with its monotonic reading
+	mu       sync.RWMutex
+	quality  ClockQuality
+	measured time.Duration // offset measured against the NTP server
+}
+
+// newClock validates the clock configuration and, for the ntp source, starts synchronizing
+func newClock(config *cfg.Clock) (*clock, error) {
+	c := &clock{source: config.Source, offset: time.Duration(config.Offset * float64(time.Millisecond)), server: config.NTPServer, interval: time.Duration(config.NTPInterval) * time.Second, base: time.Now()}
+	if c.source == "" {
+		c.source = clockSourceSystem
+	}
+	c.quality = ClockQuality{Source: c.source, Offset: config.Offset, Synced: c.source != clockSourceNTP}
+	switch c.source {
+	case clockSourceSystem, clockSourceMonotonic:
+	case clockSourceNTP:
+		if c.server == "" {
+			c.server = defaultNTPServer
+		}
+		if _, _, err := net.SplitHostPort(c.server); err != nil {
+			c.server = net.JoinHostPort(c.server, "123")
+		}
+		if c.interval <= 0 {
+			c.interval = defaultNTPInterval
+		}
+		c.sync()
+		go c.run()
+	default:
+		return nil, fmt.Errorf("Unknown clock source %s, expected system, monotonic or ntp", c.source)
+	}
+	return c, nil
+}
+
+// now returns the current time of the clock
+func (c *clock) now() time.Time {
+	switch c.source {
+	case clockSourceMonotonic:
+		return c.base.Add(time.Since(c.base) + c.offset).Round(0)
+	case clockSourceNTP:
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return time.Now().Add(c.measured + c.offset)
+	}
+	return time.Now().Add(c.offset)
+}
+
+// Quality returns the current quality of the clock
+func (c *clock) Quality() *ClockQuality {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	q := c.quality
+	return &q
+}
+
+// run synchronizes with the NTP server every interval
+func (c *clock) run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.sync()
+	}
+}
+
+// sync measures the offset of the system clock against the NTP server. The last offset is kept if the server fails
+func (c *clock) sync() {
+	offset, delay, stratum, err := queryNTP(c.server)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		if c.quality.Synced {
+			log.Printf("Lost synchronization with NTP server %s: %v", c.server, err)
+		}
+		c.quality.Synced = false
+		return
+	}
+	now := time.Now()
+	c.measured = offset
+	c.quality.Offset = float64(offset+c.offset) / float64(time.Millisecond)
+	c.quality.Uncertainty = float64(delay/2) / float64(time.Millisecond)
+	c.quality.Stratum = stratum
+	c.quality.LastSync = &now
+	c.quality.Synced = true
+}
+
+// queryNTP queries the server with SNTP (RFC 4330) and returns the offset of the system clock, the round trip delay
+// and the stratum of the server
+func queryNTP(server string) (offset, delay time.Duration, stratum int, err error) {
+	conn, err := net.DialTimeout("udp", server, ntpTimeout)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ntpTimeout))
+	req := make([]byte, 48)
+	req[0] = 0x23 // no leap warning, version 4, client mode
+	sent := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, 0, 0, err
+	}
+	resp := make([]byte, 48)
+	if _, err := conn.Read(resp); err != nil {
+		return 0, 0, 0, err
+	}
+	received := time.Now()
+	if mode := resp[0] & 0x7; mode != 4 {
+		return 0, 0, 0, fmt.Errorf("unexpected NTP mode %d", mode)
+	}
+	if resp[0]>>6 == 3 || resp[1] == 0 {
+		return 0, 0, 0, fmt.Errorf("NTP server is not synchronized")
+	}
+	rx, tx := ntpTime(resp[32:40]), ntpTime(resp[40:48])
+	offset = (rx.Sub(sent) + tx.Sub(received)) / 2
+	delay = received.Sub(sent) - tx.Sub(rx)
+	return offset, delay, int(resp[1]), nil
+}
+
+// ntpTime decodes a 64 bit NTP timestamp
+func ntpTime(b []byte) time.Time {
+	sec, frac := binary.BigEndian.Uint32(b[:4]), binary.BigEndian.Uint32(b[4:8])
+	return time.Unix(int64(sec)-ntpEpochOffset, int64(frac)*1e9>>32)
+}
+
+// now returns the current time of the configured clock, the system clock if none is
+func (e *MksRgaDatasource) now() time.Time {
+	if e.clock == nil {
+		return time.Now()
+	}
+	return e.clock.now()
+}
+
+// clockQuality returns the quality of the configured clock, nil if none is so frames stay unchanged
+func (e *MksRgaDatasource) clockQuality() *ClockQuality {
+	if e.clock == nil {
+		return nil
+	}
+	return e.clock.Quality()
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+	bg "github.com/SSSOCPaulCote/blunderguard"
+)
+
+var (
+	defaultConnectRetryDelay = 5 * time.Second
+	maxConnectRetryDelay     = 2 * time.Minute
+	ErrSensorNotFound        = bg.Error("no controller reports the sensor")
+)
+
+// connectWithRetry connects to the RGA with dial, retrying up to ConnectRetries times with an exponential backoff
+// starting at ConnectRetryDelay. A negative ConnectRetries retries forever
+func connectWithRetry(dial func() (*mks.RGAConnection, error), retries int, delay time.Duration) (*mks.RGAConnection, error) {
+	if delay <= 0 {
+		delay = defaultConnectRetryDelay
+	}
+	for attempt := 0; ; attempt++ {
+		conn, err := dial()
+		if err == nil {
+			return conn, nil
+		}
+		if retries >= 0 && attempt >= retries {
+			return nil, err
+		}
+		log.Printf("Could not connect to RGA: %v, retrying in %v", err, delay)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxConnectRetryDelay {
+			delay = maxConnectRetryDelay
+		}
+	}
+}
+
+// connect connects to the RGA using the configured retries
+func (e *MksRgaDatasource) connect() (*mks.RGAConnection, error) {
+	return connectWithRetry(e.dial, e.config.ConnectRetries, time.Duration(e.config.ConnectRetryDelay)*time.Second)
+}
+
+// dial connects once to the RGA, resolving its address from RGASerial if set and going through the proxy if one is
+// configured. Every connection shares the command rate limiter
+func (e *MksRgaDatasource) dial() (*mks.RGAConnection, error) {
+	addr, err := e.rgaAddr()
+	if err != nil {
+		return nil, err
+	}
+	dialAddr := addr
+	if e.config.Proxy != nil {
+		if dialAddr, err = e.proxyTunnel().localAddr(addr); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := ConnectToRGA(dialAddr)
+	if err != nil {
+		return nil, fmt.Errorf("Could not connect to %s: %v", addr, err)
+	}
+	if s := e.config.Socket; s != nil {
+		if err := conn.Tune(mks.SocketOptions{KeepAlive: time.Duration(s.KeepAlive) * time.Second, Nagle: s.Nagle, ReadBuffer: s.ReadBuffer, WriteBuffer: s.WriteBuffer}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Could not tune connection to %s: %v", addr, err)
+		}
+	}
+	if e.limiter != nil {
+		conn.Limit(e.limiter)
+	}
+	if e.config.StrictParsing {
+		conn.SetStrict(true, e.quarantine)
+	}
+	conn.SetCommandTimeouts(e.commandTimeouts())
+	e.subscribeEvents(conn)
+	return conn, nil
+}
+
+// commandTimeouts returns the default response timeout of the commands and the built-in timeouts of the slow ones,
+// overridden by CommandTimeouts
+func (e *MksRgaDatasource) commandTimeouts() (time.Duration, map[string]time.Duration) {
+	if e.config.CommandTimeout < 0 {
+		return 0, nil
+	}
+	def := mks.DefaultCommandTimeout
+	if e.config.CommandTimeout > 0 {
+		def = time.Duration(e.config.CommandTimeout) * time.Second
+	}
+	overrides := make(map[string]time.Duration, len(mks.DefaultCommandTimeouts)+len(e.config.CommandTimeouts))
+	for command, timeout := range mks.DefaultCommandTimeouts {
+		overrides[command] = timeout
+	}
+	for command, timeout := range e.config.CommandTimeouts {
+		overrides[command] = time.Duration(timeout * float64(time.Second))
+	}
+	return def, overrides
+}
+
+// rgaAddr returns RGAAddr or, if RGASerial is set, the address of the controller reporting that serial. The last
+// resolved address and RGAAddr are tried before RGASearchNetwork is probed, so a network scan only happens when the
+// controller moved. Probes go through the proxy if one is configured
+func (e *MksRgaDatasource) rgaAddr() (string, error) {
+	if e.config.RGASerial == "" {
+		return e.config.RGAAddr, nil
+	}
+	for _, addr := range []string{e.resolvedAddr, e.config.RGAAddr} {
+		if addr == "" {
+			continue
+		}
+		if c, err := mks.ProbeWith(context.Background(), addr, discoverTimeout, e.probeDialer()); err == nil && c.HasSensor(e.config.RGASerial) {
+			e.resolvedAddr = addr
+			return addr, nil
+		}
+	}
+	if e.config.RGASearchNetwork == "" {
+		return "", fmt.Errorf("%w: %s not found at %q and RGASearchNetwork is not set", ErrSensorNotFound, e.config.RGASerial, e.config.RGAAddr)
+	}
+	port := e.config.RGASearchPort
+	if port == 0 {
+		port = mks.DefaultPort
+	}
+	controllers, err := mks.DiscoverWith(context.Background(), e.config.RGASearchNetwork, port, discoverTimeout, e.probeDialer())
+	if err != nil {
+		return "", err
+	}
+	for _, c := range controllers {
+		if c.HasSensor(e.config.RGASerial) {
+			log.Printf("Sensor %s found at %s", e.config.RGASerial, c.Addr)
+			e.resolvedAddr = c.Addr
+			return c.Addr, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s not found on %s", ErrSensorNotFound, e.config.RGASerial, e.config.RGASearchNetwork)
+}
+
+// proxyTunnel returns the tunnel through the configured proxy, created on first use
+func (e *MksRgaDatasource) proxyTunnel() *tunnel {
+	if e.tunnel == nil {
+		e.tunnel = newTunnel(e.config.Proxy)
+	}
+	return e.tunnel
+}
+
+// probeDialer returns the dialer of the probes resolving RGASerial: through the proxy if one is configured, else nil
+// to dial directly
+func (e *MksRgaDatasource) probeDialer() mks.Dialer {
+	if e.config.Proxy == nil {
+		return nil
+	}
+	return e.proxyTunnel().dialOnce
+}
+
+// ensureConnected connects to the RGA if the connection was deferred to the first recording
+func (e *MksRgaDatasource) ensureConnected() error {
+	if e.connection != nil {
+		return nil
+	}
+	conn, err := e.connect()
+	if err != nil {
+		return err
+	}
+	e.connection = conn
+	return nil
+}
+
+// newRateLimiter returns the limiter shared by the RGA connections, nil if neither CommandInterval nor
+// CommandRateLimits is set
+func newRateLimiter(config *cfg.Config) (*mks.RateLimiter, error) {
+	if config.CommandInterval <= 0 && len(config.CommandRateLimits) == 0 {
+		return nil, nil
+	}
+	return mks.NewRateLimiter(time.Duration(config.CommandInterval)*time.Millisecond, config.CommandRateLimits)
+}
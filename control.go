@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+var controlRetryInterval = 10 * time.Second
+
+// controlIdentity returns the application name and version reported to the sensor by Control, defaulting to the
+// plugin name and version
+func (e *MksRgaDatasource) controlIdentity() (string, string) {
+	appName, version := e.config.ControlAppName, e.config.ControlAppVersion
+	if appName == "" {
+		appName = pluginName
+	}
+	if version == "" {
+		version = pluginVersion
+	}
+	return appName, version
+}
+
+// newSession takes control of the sensor, in dry-run mode if DryRun is set. The ASCII protocol has no way to take
+// control away from another client, so if ControlWaitTimeout is set and the sensor is in use, Control is retried until
+// the other client releases it
+func (e *MksRgaDatasource) newSession() (*mks.Session, error) {
+	deadline := time.Now().Add(time.Duration(e.config.ControlWaitTimeout) * time.Second)
+	appName, version := e.controlIdentity()
+	for {
+		session, err := mks.NewSession(context.Background(), e.connection, appName, version)
+		if err == nil && e.config.DryRun {
+			log.Println("Dry run: calibration and tuning commands are logged instead of sent")
+			session.SetDryRun(true, log.Printf)
+		}
+		var inUse *mks.SensorInUseError
+		if err == nil || !errors.As(err, &inUse) || time.Now().Add(controlRetryInterval).After(deadline) {
+			return session, err
+		}
+		log.Printf("%v, retrying in %v", inUse, controlRetryInterval)
+		time.Sleep(controlRetryInterval)
+	}
+}
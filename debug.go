@@ -0,0 +1,117 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+var (
+	framesEmitted      = expvar.NewInt("frames_emitted")
+	framesDropped      = expvar.NewInt("frames_dropped")
+	scansCompleted     = expvar.NewInt("scans_completed")
+	scansAborted       = expvar.NewInt("scans_aborted")
+	scansDropped       = expvar.NewInt("scans_dropped")
+	linksReestablished = expvar.NewInt("links_reestablished")
+	resolutionFWHM     = expvar.NewFloat("resolution_fwhm") // averaged FWHM of the reference peak [AMU]
+	bytesParsed        = expvar.NewInt("bytes_parsed")
+	commandLatency     = expvar.NewMap("command_latency") // per command count, total_us and max_us
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("memory", expvar.Func(func() interface{} {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		return map[string]interface{}{
+			"heap_alloc":   ms.HeapAlloc,
+			"heap_inuse":   ms.HeapInuse,
+			"heap_objects": ms.HeapObjects,
+			"sys":          ms.Sys,
+			"num_gc":       ms.NumGC,
+			"limit":        debug.SetMemoryLimit(-1),
+		}
+	}))
+}
+
+// setMemoryLimit sets the soft memory limit of the runtime [MiB], the garbage collector runs more often as the heap
+// approaches it. 0 leaves the limit set by GOMEMLIMIT
+func setMemoryLimit(mib int) {
+	if mib <= 0 {
+		return
+	}
+	debug.SetMemoryLimit(int64(mib) << 20)
+	log.Printf("Memory limit set to %d MiB", mib)
+}
+
+// publishQueueDepths publishes the number of items waiting in every queue: the operator events, the pipeline stages
+// and the frame backlog of the running recording, and every sink queue
+func (e *MksRgaDatasource) publishQueueDepths() {
+	expvar.Publish("queue_depths", expvar.Func(func() interface{} {
+		depths := map[string]int{"events": len(e.eventChan)}
+		if p := e.pipe.Load(); p != nil {
+			depths["pipeline_scans"] = len(p.scans)
+			depths["pipeline_processed"] = len(p.processed)
+			depths["frame_backlog"] = len(p.frameChan)
+		}
+		for _, q := range e.sinkQueues {
+			depths["sink_"+q.sink.Name()] = len(q.items)
+		}
+		return depths
+	}))
+}
+
+// observeRead records the bytes read from the RGA and the round trip latency of commands
+func observeRead(command string, latency time.Duration, n int) {
+	bytesParsed.Add(int64(n))
+	if n > 0 {
+		lastRGARead.Store(time.Now().UnixNano())
+	}
+	if command == "" {
+		return
+	}
+	var m *expvar.Map
+	if v, ok := commandLatency.Get(command).(*expvar.Map); ok {
+		m = v
+	} else {
+		m = new(expvar.Map).Init()
+		commandLatency.Set(command, m)
+	}
+	us := latency.Microseconds()
+	m.Add("count", 1)
+	m.Add("total_us", us)
+	if max, ok := m.Get("max_us").(*expvar.Int); !ok || max.Value() < us {
+		v := new(expvar.Int)
+		v.Set(us)
+		m.Set("max_us", v)
+	}
+}
+
+// debugMux returns the handler of /debug/vars and /debug/pprof. It doesn't use the default mux, which the pprof package
+// registers itself on, so other servers of the process never expose the profiles
+func debugMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// startDebugServer serves /debug/vars and /debug/pprof on the given address
+func startDebugServer(addr string) {
+	go func() {
+		log.Printf("Debug server listening on %s", addr)
+		if err := http.ListenAndServe(addr, debugMux()); err != nil {
+			log.Printf("Debug server stopped: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugMux(t *testing.T) {
+	tests := []struct {
+		path string
+		code int
+	}{
+		{path: "/debug/vars", code: http.StatusOK},
+		{path: "/debug/pprof/", code: http.StatusOK},
+		{path: "/debug/pprof/goroutine?debug=1", code: http.StatusOK},
+		{path: "/debug/pprof/cmdline", code: http.StatusOK},
+		{path: "/", code: http.StatusNotFound},
+	}
+	mux := debugMux()
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.code {
+				t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+var (
+	// typical degas parameters from the protocol documentation
+	defaultDegasStartPower     = 10
+	defaultDegasEndPower       = 85
+	defaultDegasRampPeriod     = 90
+	defaultDegasMaxPowerPeriod = 240
+	defaultDegasResettlePeriod = 30
+	degasMargin                = 60 * time.Second
+	degasReadTimeout           = 5 * time.Second
+)
+
+// degasWindow is the time of day during which scheduled degas cycles may run. The zero value allows any time
+type degasWindow struct {
+	start, end time.Duration // offsets from midnight
+	set        bool
+}
+
+// parseDegasWindow parses a HH:MM-HH:MM window. The window may wrap around midnight, e.g. 22:00-04:00
+func parseDegasWindow(s string) (degasWindow, error) {
+	if s == "" {
+		return degasWindow{}, nil
+	}
+	var sh, sm, eh, em int
+	if _, err := fmt.Sscanf(s, "%d:%d-%d:%d", &sh, &sm, &eh, &em); err != nil {
+		return degasWindow{}, fmt.Errorf("invalid DegasWindow %q, expected HH:MM-HH:MM: %v", s, err)
+	}
+	return degasWindow{
+		start: time.Duration(sh)*time.Hour + time.Duration(sm)*time.Minute,
+		end:   time.Duration(eh)*time.Hour + time.Duration(em)*time.Minute,
+		set:   true,
+	}, nil
+}
+
+// contains reports whether t falls within the window
+func (w degasWindow) contains(t time.Time) bool {
+	if !w.set {
+		return true
+	}
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if w.start <= w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+// degasDue reports whether a scheduled degas should run now
+func (e *MksRgaDatasource) degasDue(now time.Time) bool {
+	if !e.degasWindow.contains(now) {
+		return false
+	}
+	if e.config.DegasInterval > 0 && now.Sub(e.lastDegas) >= time.Duration(e.config.DegasInterval)*time.Hour {
+		return true
+	}
+	return e.config.DegasAfterFilamentHours > 0 && e.filamentHours >= e.config.DegasAfterFilamentHours
+}
+
+// degasPeriods returns the configured degas parameters, using the typical values for those left at 0
+func degasPeriods(config *cfg.Config) (startPower, endPower, ramp, maxPower, resettle int) {
+	or := func(v, def int) int {
+		if v <= 0 {
+			return def
+		}
+		return v
+	}
+	return or(config.DegasStartPower, defaultDegasStartPower), or(config.DegasEndPower, defaultDegasEndPower),
+		or(config.DegasRampPeriod, defaultDegasRampPeriod), or(config.DegasMaxPowerPeriod, defaultDegasMaxPowerPeriod),
+		or(config.DegasResettlePeriod, defaultDegasResettlePeriod)
+}
+
+// runDegas pauses the scan, runs a degas cycle while draining its readings and adds the measurements back so the
+// recording can resume. ErrRecordingStopped is returned if the recording is stopped during the cycle
+func (e *MksRgaDatasource) runDegas() error {
+	startPower, endPower, ramp, maxPower, resettle := degasPeriods(e.config)
+	log.Printf("Starting scheduled degas (%d%% to %d%%)", startPower, endPower)
+	if _, err := e.session.ScanStop(); err != nil {
+		return fmt.Errorf("could not pause scan for degas: %w", err)
+	}
+	// the measurements are always added back, even if the degas fails
+	defer e.restoreScan()
+	if _, err := e.session.StartDegas(startPower, endPower, ramp, maxPower, resettle); err != nil {
+		return fmt.Errorf("could not start degas: %w", err)
+	}
+	e.annotate("Degas started", fmt.Sprintf("%d%% to %d%%", startPower, endPower), "degas")
+	end := time.Now().Add(time.Duration(ramp+maxPower+resettle)*time.Second + degasMargin)
+	defer e.reader().SetReadDeadline(time.Time{})
+	var readings int
+	for time.Now().Before(end) {
+		select {
+		case <-e.quitChan:
+			if _, err := e.session.StopDegas(); err != nil {
+				log.Printf("Could not stop degas: %v", err)
+			}
+			e.annotate("Degas aborted", "recording stopped", "degas")
+			return ErrRecordingStopped
+		default:
+		}
+		e.reader().SetReadDeadline(time.Now().Add(degasReadTimeout))
+		if _, err := e.reader().ReadResponse(); err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				continue
+			}
+			return fmt.Errorf("could not read degas response: %w", err)
+		}
+		readings++
+	}
+	log.Printf("Degas completed, %d readings received", readings)
+	e.lastDegas = time.Now()
+	e.filamentHours = 0
+	e.saveState()
+	e.annotate("Degas completed", "", "degas")
+	return nil
+}
+
+// restoreScan adds the measurements back to the scan list after ScanStop emptied it
+func (e *MksRgaDatasource) restoreScan() {
+	for _, m := range e.measurements {
+		if _, err := e.session.ScanAdd(m.Name); err != nil {
+			log.Printf("Could not add %s back to scan: %v", m.Name, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+var (
+	defaultDetectorRampStep  = 50
+	defaultDetectorRampDelay = 2 * time.Second
+)
+
+// rampDetectors ramps the multiplier voltage of every detector setting used by a measurement with a DetectorVoltage,
+// from its current voltage or, if it can't be read, from DetectorRampStart. The ramp stops if the context is cancelled
+func (e *MksRgaDatasource) rampDetectors(ctx context.Context, session *mks.Session) error {
+	step := e.config.DetectorRampStep
+	if step <= 0 {
+		step = defaultDetectorRampStep
+	}
+	delay := time.Duration(e.config.DetectorRampDelay) * time.Second
+	if delay <= 0 {
+		delay = defaultDetectorRampDelay
+	}
+	done := make(map[[2]int]bool)
+	for _, m := range e.config.Measurements {
+		// detector 0 is the Faraday cup, which has no multiplier
+		key := [2]int{m.SourceIndex, m.DetectorIndex}
+		if m.DetectorVoltage <= 0 || m.DetectorIndex == 0 || done[key] {
+			continue
+		}
+		done[key] = true
+		from, err := session.CurrentDetectorVoltage(m.SourceIndex, m.DetectorIndex)
+		if err != nil {
+			log.Printf("Could not read the voltage of detector %d of source %d, ramping from %d V: %v", m.DetectorIndex, m.SourceIndex, e.config.DetectorRampStart, err)
+			from = e.config.DetectorRampStart
+		}
+		if from == m.DetectorVoltage {
+			continue
+		}
+		log.Printf("Ramping detector %d of source %d from %d V to %d V", m.DetectorIndex, m.SourceIndex, from, m.DetectorVoltage)
+		err = session.RampDetectorVoltage(ctx, mks.VoltageRamp{
+			SourceIndex:   m.SourceIndex,
+			DetectorIndex: m.DetectorIndex,
+			From:          from,
+			To:            m.DetectorVoltage,
+			Step:          step,
+			Delay:         delay,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rampBeforeScans ramps the detectors from the recording goroutine before the first scan, so StartRecord returns
+// meanwhile. A StopRecord or shutdown cancels the ramp. It returns false if the recording stopped
+func (e *MksRgaDatasource) rampBeforeScans(session *mks.Session) (bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- e.rampDetectors(ctx, session)
+	}()
+	select {
+	case err := <-errChan:
+		return true, err
+	case <-e.quitChan:
+	case <-e.stopping:
+	}
+	cancel()
+	if err := <-errChan; err != nil {
+		log.Printf("Detector ramp stopped: %v", err)
+	}
+	return false, nil
+}
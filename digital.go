@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+// validateDigitalMappings checks the port bits of the configured digital inputs and alarm outputs
+func (e *MksRgaDatasource) validateDigitalMappings() error {
+	for _, in := range e.config.DigitalInputs {
+		if in.Port == "" || in.Bit < 0 || in.Bit > 7 {
+			return fmt.Errorf("Invalid digital input %s: port %q bit %d", in.Name, in.Port, in.Bit)
+		}
+	}
+	for _, out := range e.config.AlarmOutputs {
+		if out.Port == "" || out.Bit < 0 || out.Bit > 7 {
+			return fmt.Errorf("Invalid alarm output for %s: port %q bit %d", out.Alarm, out.Port, out.Bit)
+		}
+	}
+	return nil
+}
+
+// usesDigitalIO reports whether digital inputs or alarm outputs are configured
+func (e *MksRgaDatasource) usesDigitalIO() bool {
+	return len(e.config.DigitalInputs) > 0 || len(e.config.AlarmOutputs) > 0
+}
+
+// refreshDigitalPorts reads the state of every digital port from the sensor
+func (e *MksRgaDatasource) refreshDigitalPorts() error {
+	ports, err := e.connection.DigitalPorts()
+	if err != nil {
+		return err
+	}
+	if e.digitalPorts == nil {
+		e.digitalPorts = make(map[string]int, len(ports))
+	}
+	for _, p := range ports {
+		e.digitalPorts[p.Name] = p.Value
+	}
+	return nil
+}
+
+// handleDigitalPortChange keeps track of the port state reported by a DigitalPortChange event
+func (e *MksRgaDatasource) handleDigitalPortChange(resp *mks.RGAResponse) {
+	value, ok := resp.Fields["Value"].Float()
+	if !ok {
+		log.Printf("Ignoring digital port change with invalid value %v", resp.Fields["Value"].Value)
+		return
+	}
+	if e.digitalPorts == nil {
+		e.digitalPorts = make(map[string]int)
+	}
+	e.digitalPorts[fmt.Sprint(resp.Fields["Port"].Value)] = int(value)
+}
+
+// digitalInputs returns the state of the configured digital inputs, nil if none are configured
+func (e *MksRgaDatasource) digitalInputs() map[string]bool {
+	if len(e.config.DigitalInputs) == 0 {
+		return nil
+	}
+	inputs := make(map[string]bool, len(e.config.DigitalInputs))
+	for _, in := range e.config.DigitalInputs {
+		inputs[in.Name] = (mks.DigitalPort{Value: e.digitalPorts[in.Port]}).Bit(in.Bit) != in.ActiveLow
+	}
+	return inputs
+}
+
+// updateInterlock raises the interlock alarm while any interlock input is active
+func (e *MksRgaDatasource) updateInterlock() {
+	inputs := e.digitalInputs()
+	active := false
+	for _, in := range e.config.DigitalInputs {
+		if in.Interlock && inputs[in.Name] {
+			active = true
+		}
+	}
+	e.setAlarm(alarmInterlock, active)
+}
+
+// interlocked reports whether scanning is paused by an interlock input. While paused no events are read, so the
+// inputs are polled instead
+func (e *MksRgaDatasource) interlocked() bool {
+	if !e.alarms[alarmInterlock] {
+		return false
+	}
+	if err := e.refreshDigitalPorts(); err != nil {
+		log.Printf("Could not read digital ports: %v", err)
+		return true
+	}
+	e.updateInterlock()
+	return e.alarms[alarmInterlock]
+}
+
+// driveAlarmOutputs sets or clears the output bits mapped to the alarm
+func (e *MksRgaDatasource) driveAlarmOutputs(class string, active bool) {
+	for _, out := range e.config.AlarmOutputs {
+		if out.Alarm != class {
+			continue
+		}
+		if e.digitalPorts == nil {
+			e.digitalPorts = make(map[string]int)
+		}
+		value := e.digitalPorts[out.Port]
+		if active {
+			value |= 1 << out.Bit
+		} else {
+			value &^= 1 << out.Bit
+		}
+		if _, err := e.connection.DigitalOutput(out.Port, value); err != nil {
+			log.Printf("Could not set digital output %s bit %d: %v", out.Port, out.Bit, err)
+			continue
+		}
+		e.digitalPorts[out.Port] = value
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+var discoverTimeout = 2 * time.Second
+
+// printDiscovered probes the network for RGA controllers and writes each one with its sensors, ready to be copied
+// into RGAAddr
+func printDiscovered(w io.Writer, cidr string, port int) error {
+	controllers, err := mks.Discover(context.Background(), cidr, port, discoverTimeout)
+	if err != nil {
+		return err
+	}
+	if len(controllers) == 0 {
+		fmt.Fprintf(w, "No RGA controller found on %s port %d\n", cidr, port)
+		return nil
+	}
+	for _, c := range controllers {
+		fmt.Fprintf(w, "RGAAddr: %q\n", c.Addr)
+		for _, s := range c.Sensors {
+			fmt.Fprintf(w, "  sensor %s (%s)\n", s.Serial, s.State)
+		}
+	}
+	return nil
+}
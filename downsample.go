@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+// influxDownsampler reduces the readings the influx sink writes for the masses of the InfluxDownsample groups. A
+// group is written once every few scans, either its last readings or their mean, min and max over those scans
+type influxDownsampler struct {
+	groups []cfg.InfluxDownsample
+	scans  []int                      // by group, scans including the group since it was last written
+	stats  []map[string]*readingStats // by group then reading, of the aggregated groups
+	order  [][]string                 // by group, keys of stats in the order of the readings
+}
+
+// newInfluxDownsampler checks the groups and returns their downsampler, nil if there is none
+func newInfluxDownsampler(groups []cfg.InfluxDownsample) (*influxDownsampler, error) {
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	for i, g := range groups {
+		if g.EndMass < g.StartMass {
+			return nil, fmt.Errorf("Influx downsample group %d ends before it starts", i)
+		}
+		if g.Every < 0 {
+			return nil, fmt.Errorf("Influx downsample group %d has a negative Every", i)
+		}
+	}
+	d := &influxDownsampler{groups: groups}
+	d.reset()
+	return d, nil
+}
+
+// reset forgets the scans counted and aggregated so far, e.g. at the beginning of a recording
+func (d *influxDownsampler) reset() {
+	d.scans = make([]int, len(d.groups))
+	d.stats = make([]map[string]*readingStats, len(d.groups))
+	d.order = make([][]string, len(d.groups))
+}
+
+// group returns the index of the first group including the mass, -1 if none does
+func (d *influxDownsampler) group(mass float64) int {
+	for i, g := range d.groups {
+		if mass >= g.StartMass && mass <= g.EndMass {
+			return i
+		}
+	}
+	return -1
+}
+
+// add counts the scan and returns the readings to write as is, those outside every group and those of the groups due,
+// along with the aggregated readings of the aggregated groups due
+func (d *influxDownsampler) add(scan *Scan) ([]Payload, []*readingStats) {
+	index := make([]int, len(scan.Readings))
+	seen := make([]bool, len(d.groups))
+	for i, r := range scan.Readings {
+		index[i] = d.group(r.Mass)
+		if g := index[i]; g >= 0 && !seen[g] {
+			seen[g] = true
+			d.scans[g]++
+		}
+	}
+	readings := make([]Payload, 0, len(scan.Readings))
+	for i, r := range scan.Readings {
+		g := index[i]
+		if g < 0 {
+			readings = append(readings, r)
+			continue
+		}
+		if d.groups[g].Aggregate {
+			d.aggregate(g, r)
+		} else if d.due(g) {
+			readings = append(readings, r)
+		}
+	}
+	var stats []*readingStats
+	for g := range d.groups {
+		if !seen[g] || !d.due(g) {
+			continue
+		}
+		for _, k := range d.order[g] {
+			stats = append(stats, d.stats[g][k])
+		}
+		d.scans[g], d.stats[g], d.order[g] = 0, nil, nil
+	}
+	return readings, stats
+}
+
+// due reports whether the group is written with the current scan
+func (d *influxDownsampler) due(g int) bool {
+	return d.scans[g] >= d.groups[g].Every
+}
+
+// aggregate adds the reading to the stats of its group
+func (d *influxDownsampler) aggregate(g int, r Payload) {
+	if d.stats[g] == nil {
+		d.stats[g] = make(map[string]*readingStats)
+	}
+	k := readingKey(r)
+	st, ok := d.stats[g][k]
+	if !ok {
+		st = &readingStats{Measurement: r.Measurement, Mass: r.Mass, Min: r.Value, Max: r.Value}
+		d.stats[g][k] = st
+		d.order[g] = append(d.order[g], k)
+	}
+	st.Min = min(st.Min, r.Value)
+	st.Max = max(st.Max, r.Value)
+	st.Sum += r.Value
+	st.Count++
+}
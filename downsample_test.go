@@ -0,0 +1,109 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+func TestNewInfluxDownsampler(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []cfg.InfluxDownsample
+		none   bool
+		err    bool
+	}{
+		{name: "no groups", none: true},
+		{name: "valid", groups: []cfg.InfluxDownsample{{StartMass: 1, EndMass: 10, Every: 5}}},
+		{name: "single mass", groups: []cfg.InfluxDownsample{{StartMass: 28, EndMass: 28}}},
+		{name: "reversed", groups: []cfg.InfluxDownsample{{StartMass: 10, EndMass: 1}}, err: true},
+		{name: "negative every", groups: []cfg.InfluxDownsample{{StartMass: 1, EndMass: 10, Every: -1}}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newInfluxDownsampler(tt.groups)
+			if (err != nil) != tt.err {
+				t.Fatalf("newInfluxDownsampler() error = %v, want error %v", err, tt.err)
+			}
+			if !tt.err && (d == nil) != tt.none {
+				t.Errorf("newInfluxDownsampler() = %v, want none %v", d, tt.none)
+			}
+		})
+	}
+}
+
+func TestInfluxDownsampler(t *testing.T) {
+	scan := func(values ...float64) *Scan {
+		s := &Scan{}
+		for i, v := range values {
+			s.Readings = append(s.Readings, Payload{Measurement: "bar", Mass: float64(i + 1), Value: v})
+		}
+		return s
+	}
+	tests := []struct {
+		name    string
+		groups  []cfg.InfluxDownsample
+		scans   []*Scan
+		written [][]float64 // by scan, masses written as is
+		stats   [][]readingStats
+	}{
+		{
+			name:    "every scan",
+			groups:  []cfg.InfluxDownsample{{StartMass: 1, EndMass: 2, Every: 1}},
+			scans:   []*Scan{scan(1, 2, 3), scan(4, 5, 6)},
+			written: [][]float64{{1, 2, 3}, {1, 2, 3}},
+			stats:   [][]readingStats{nil, nil},
+		},
+		{
+			name:    "last of every third scan",
+			groups:  []cfg.InfluxDownsample{{StartMass: 2, EndMass: 3, Every: 3}},
+			scans:   []*Scan{scan(1, 2, 3), scan(4, 5, 6), scan(7, 8, 9), scan(1, 2, 3)},
+			written: [][]float64{{1}, {1}, {1, 2, 3}, {1}},
+			stats:   [][]readingStats{nil, nil, nil, nil},
+		},
+		{
+			name:    "aggregated",
+			groups:  []cfg.InfluxDownsample{{StartMass: 1, EndMass: 1, Every: 2, Aggregate: true}},
+			scans:   []*Scan{scan(3, 10), scan(1, 20), scan(5, 30)},
+			written: [][]float64{{2}, {2}, {2}},
+			stats: [][]readingStats{
+				nil,
+				{{Measurement: "bar", Mass: 1, Min: 1, Max: 3, Sum: 4, Count: 2}},
+				nil,
+			},
+		},
+		{
+			name:    "first group wins",
+			groups:  []cfg.InfluxDownsample{{StartMass: 1, EndMass: 2, Every: 2}, {StartMass: 2, EndMass: 3, Every: 1}},
+			scans:   []*Scan{scan(1, 2, 3), scan(1, 2, 3)},
+			written: [][]float64{{3}, {1, 2, 3}},
+			stats:   [][]readingStats{nil, nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newInfluxDownsampler(tt.groups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, s := range tt.scans {
+				readings, stats := d.add(s)
+				var masses []float64
+				for _, r := range readings {
+					masses = append(masses, r.Mass)
+				}
+				if !reflect.DeepEqual(masses, tt.written[i]) {
+					t.Errorf("scan %d wrote masses %v, want %v", i, masses, tt.written[i])
+				}
+				var got []readingStats
+				for _, st := range stats {
+					got = append(got, *st)
+				}
+				if !reflect.DeepEqual(got, tt.stats[i]) {
+					t.Errorf("scan %d aggregated %+v, want %+v", i, got, tt.stats[i])
+				}
+			}
+		})
+	}
+}
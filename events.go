@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+	bg "github.com/SSSOCPaulCote/blunderguard"
+)
+
+var (
+	eventQueueSize       = 64
+	ErrEventQueueFull    = bg.Error("event queue full")
+	ErrBlankEventTitle   = bg.Error("annotation title cannot be blank")
+	maxAnnotationRequest = int64(64 << 10)
+)
+
+// EventSource raises events of its own, e.g. an Influx failover. Sinks implementing it are connected automatically
+type EventSource interface {
+	SetEventHandler(handler func(title, text string, tags ...string))
+}
+
+// eventFrame wraps an operator annotation in a frame for Laniakea
+type eventFrame struct {
+	Schema string      `json:"schema"`
+	Event  *Annotation `json:"event"`
+}
+
+// AddAnnotation records an operator annotation, e.g. "opened gate valve". It is sent to every annotator right away and,
+// while recording, emitted as an event frame between scans with its original time
+func (e *MksRgaDatasource) AddAnnotation(title, text string, tags ...string) error {
+	if title == "" {
+		return ErrBlankEventTitle
+	}
+	return e.queueEvent(&Annotation{Time: e.now(), Title: title, Text: text, Tags: append([]string{"operator"}, tags...)})
+}
+
+// raiseEvent records an event raised by the plugin itself, e.g. by an EventSource, like an operator annotation
+func (e *MksRgaDatasource) raiseEvent(title, text string, tags ...string) {
+	if err := e.queueEvent(&Annotation{Time: e.now(), Title: title, Text: text, Tags: tags}); err != nil {
+		log.Printf("Could not queue event %q: %v", title, err)
+	}
+}
+
+// queueEvent sends the annotation to every annotator right away and, while recording, queues it to be emitted as an
+// event frame between scans
+func (e *MksRgaDatasource) queueEvent(a *Annotation) error {
+	e.writeAnnotation(a)
+	if atomic.LoadInt32(&e.recording) != 1 {
+		return nil
+	}
+	select {
+	case e.eventChan <- a:
+		return nil
+	default:
+		return ErrEventQueueFull
+	}
+}
+
+// emitEvent sends an operator annotation as an event frame
+func (e *MksRgaDatasource) emitEvent(frameChan chan *proto.Frame, a *Annotation) {
+	b, err := json.Marshal(&eventFrame{Schema: frameSchema, Event: a})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	e.sendFrame(frameChan, &proto.Frame{
+		Source:    pluginName,
+		Type:      "application/json",
+		Timestamp: a.Time.UnixMilli(),
+		Payload:   b,
+	})
+}
+
+// annotationRequest is the body of a POST /annotations request
+type annotationRequest struct {
+	Title string   `json:"title"`
+	Text  string   `json:"text"`
+	Tags  []string `json:"tags"`
+}
+
+// serveAnnotations accepts operator annotations posted as JSON to /annotations on the given address
+func (e *MksRgaDatasource) serveAnnotations(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/annotations", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req annotationRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAnnotationRequest)).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch err := e.AddAnnotation(req.Title, req.Text, req.Tags...); err {
+		case nil:
+			w.WriteHeader(http.StatusNoContent)
+		case ErrBlankEventTitle:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		}
+	})
+	go func() {
+		log.Printf("Annotations endpoint listening on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Annotations endpoint stopped: %v", err)
+		}
+	}()
+}
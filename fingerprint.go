@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	bg "github.com/SSSOCPaulCote/blunderguard"
+)
+
+var (
+	alarmFingerprintDeviation = "FingerprintDeviation"
+	statusKindFingerprint     = "fingerprint"
+	defaultMinSimilarity      = 0.95
+	defaultFingerprintDiffs   = 3
+	ErrFingerprintDisabled    = bg.Error("fingerprint comparison is not configured")
+)
+
+// ReferenceSpectrum is the fingerprint scans are compared to, e.g. the clean baseline after a bake. It is stored as
+// JSON in the fingerprint file
+type ReferenceSpectrum struct {
+	Time     time.Time          `json:"time"`
+	Spectrum map[string]float64 `json:"spectrum"` // share of the summed pressure per integer mass
+}
+
+// validateFingerprint checks the fingerprint configuration
+func validateFingerprint(f *cfg.Fingerprint) error {
+	if f == nil {
+		return nil
+	}
+	if f.File == "" {
+		return fmt.Errorf("Fingerprint file cannot be blank")
+	}
+	if f.MinSimilarity < 0 || f.MinSimilarity > 1 {
+		return fmt.Errorf("Fingerprint minimum similarity must be between 0 and 1, got %v", f.MinSimilarity)
+	}
+	return nil
+}
+
+// loadReferenceSpectrum reads the reference spectrum from the fingerprint file. A missing file is no reference
+func loadReferenceSpectrum(file string) (*ReferenceSpectrum, error) {
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var ref ReferenceSpectrum
+	if err := json.Unmarshal(b, &ref); err != nil {
+		return nil, fmt.Errorf("Could not read reference spectrum %s: %v", file, err)
+	}
+	return &ref, nil
+}
+
+// massHeights returns the highest non-negative reading of every integer mass of the measurement, or of every
+// measurement if blank, so that analog readings count with the height of their peak
+func massHeights(readings []Payload, measurement string) map[string]float64 {
+	heights := make(map[string]float64)
+	for _, r := range readings {
+		if measurement != "" && r.Measurement != measurement {
+			continue
+		}
+		mass := strconv.Itoa(int(math.Round(r.Mass)))
+		heights[mass] = math.Max(heights[mass], r.Value)
+	}
+	return heights
+}
+
+// spectrum returns the share of the summed pressure of every integer mass of the readings. It returns nil if the
+// readings sum to 0
+func spectrum(readings []Payload, measurement string) map[string]float64 {
+	heights := massHeights(readings, measurement)
+	var sum float64
+	for _, v := range heights {
+		sum += v
+	}
+	if sum == 0 {
+		return nil
+	}
+	for mass := range heights {
+		heights[mass] /= sum
+	}
+	return heights
+}
+
+// similarity returns the cosine similarity of two spectra, 1 if they have the same composition
+func similarity(ref, s map[string]float64) float64 {
+	var dot, refNorm, norm float64
+	for mass, v := range ref {
+		dot += v * s[mass]
+		refNorm += v * v
+	}
+	for _, v := range s {
+		norm += v * v
+	}
+	if refNorm == 0 || norm == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(refNorm*norm)
+}
+
+// spectrumDiff describes the n masses whose share grew the most compared to the reference, e.g. "mass 44 +12.3%"
+func spectrumDiff(ref, s map[string]float64, n int) []string {
+	type change struct {
+		mass  string
+		delta float64
+	}
+	var changes []change
+	for mass, v := range s {
+		if d := v - ref[mass]; d > 0 {
+			changes = append(changes, change{mass, d})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].delta > changes[j].delta })
+	var diff []string
+	for i := 0; i < len(changes) && i < n; i++ {
+		diff = append(diff, fmt.Sprintf("mass %s %+.1f%%", changes[i].mass, changes[i].delta*100))
+	}
+	return diff
+}
+
+// CaptureFingerprint makes the next completed scan the reference spectrum and saves it to the fingerprint file
+func (e *MksRgaDatasource) CaptureFingerprint() error {
+	if e.config.Fingerprint == nil {
+		return ErrFingerprintDisabled
+	}
+	return e.inLoop(func() error {
+		e.captureRef = true
+		return nil
+	})
+}
+
+// captureFingerprint makes the scan the reference spectrum
+func (e *MksRgaDatasource) captureFingerprint(scan *Scan) {
+	s := spectrum(scan.Readings, e.config.Fingerprint.Measurement)
+	if s == nil {
+		log.Println("Could not capture fingerprint: the scan has no positive readings")
+		return
+	}
+	e.captureRef = false
+	e.fingerprint = &ReferenceSpectrum{Time: scan.Time, Spectrum: s}
+	b, err := json.Marshal(e.fingerprint)
+	if err != nil {
+		log.Printf("Could not encode reference spectrum: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(e.config.Fingerprint.File, b, 0644); err != nil {
+		log.Printf("Could not write reference spectrum: %v", err)
+	}
+	e.annotate("Fingerprint captured", fmt.Sprintf("%d masses", len(s)), "fingerprint")
+}
+
+// compareFingerprint scores the scan against the reference spectrum. The score is added to the scan and the
+// FingerprintDeviation alarm raised, with a fingerprint status listing the masses that grew the most, when it falls
+// below MinSimilarity
+func (e *MksRgaDatasource) compareFingerprint(frameChan chan *proto.Frame, scan *Scan) {
+	f := e.config.Fingerprint
+	if f == nil {
+		return
+	}
+	if e.captureRef {
+		e.captureFingerprint(scan)
+	}
+	if e.fingerprint == nil {
+		return
+	}
+	s := spectrum(scan.Readings, f.Measurement)
+	if s == nil {
+		return
+	}
+	score := similarity(e.fingerprint.Spectrum, s)
+	scan.Similarity = &score
+	minSimilarity := f.MinSimilarity
+	if minSimilarity == 0 {
+		minSimilarity = defaultMinSimilarity
+	}
+	active := score < minSimilarity
+	if active == e.alarms[alarmFingerprintDeviation] {
+		return
+	}
+	st := &Status{Time: e.now(), Kind: statusKindFingerprint, CompositionChanged: active, Similarity: score, Rig: e.config.RigID, Serial: e.serial, Inlet: e.inlet}
+	if active {
+		n := f.Diffs
+		if n <= 0 {
+			n = defaultFingerprintDiffs
+		}
+		diff := strings.Join(spectrumDiff(e.fingerprint.Spectrum, s, n), ", ")
+		st.Reason = fmt.Sprintf("similarity %.3f below %v: %s", score, minSimilarity, diff)
+		log.Printf("Composition deviates from the reference spectrum: %s", st.Reason)
+	}
+	e.setAlarm(alarmFingerprintDeviation, active)
+	e.reportStatus(frameChan, st)
+}
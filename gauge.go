@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+// setupExternalGauge enables the analog input wired to the external gauge and sets the gauge calibration factor
+func (e *MksRgaDatasource) setupExternalGauge() error {
+	idx := e.config.ExternalGaugeInput
+	if _, err := e.connection.AnalogInputEnable(idx, true); err != nil {
+		return fmt.Errorf("Could not enable analog input %d: %v", idx, err)
+	}
+	if e.config.ExternalGaugeInterval > 0 {
+		if _, err := e.connection.AnalogInputInterval(idx, e.config.ExternalGaugeInterval); err != nil {
+			return fmt.Errorf("Could not set analog input %d interval: %v", idx, err)
+		}
+	}
+	if e.config.TotalPressureCalFactor > 0 {
+		if _, err := e.connection.TotalPressureCalFactor(e.config.TotalPressureCalFactor); err != nil {
+			return fmt.Errorf("Could not set total pressure calibration factor: %v", err)
+		}
+	}
+	e.gaugePressure = 0
+	return nil
+}
+
+// gaugePressureFromVoltage converts an analog input voltage to a pressure [Pa]. Logarithmic gauges output
+// log10(P) = Slope*V + Offset, linear ones P = Slope*V + Offset. The slope defaults to 1
+func (e *MksRgaDatasource) gaugePressureFromVoltage(v float64) float64 {
+	slope := e.config.ExternalGaugeSlope
+	if slope == 0 {
+		slope = 1
+	}
+	p := slope*v + e.config.ExternalGaugeOffset
+	if e.config.ExternalGaugeLog {
+		return math.Pow(10, p)
+	}
+	return p
+}
+
+// handleAnalogInput keeps the last pressure read from the external gauge
+func (e *MksRgaDatasource) handleAnalogInput(resp *mks.RGAResponse) {
+	idx, ok := resp.Fields["Index"].Float()
+	if !ok || int(idx) != e.config.ExternalGaugeInput {
+		return
+	}
+	v, ok := resp.Fields["Value"].Float()
+	if !ok {
+		log.Printf("Ignoring analog input reading with invalid value %v", resp.Fields["Value"].Value)
+		return
+	}
+	e.gaugePressure = e.gaugePressureFromVoltage(v)
+}
+
+// feedTotalPressure sends the last external gauge reading to the sensor so the rollover correction uses a current
+// total pressure
+func (e *MksRgaDatasource) feedTotalPressure() {
+	if e.gaugePressure <= 0 {
+		return
+	}
+	if _, err := e.connection.SetTotalPressure(e.gaugePressure); err != nil {
+		log.Printf("Could not set total pressure: %v", err)
+	}
+}
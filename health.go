@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	bg "github.com/SSSOCPaulCote/blunderguard"
+)
+
+var (
+	healthInfluxTimeout = 5 * time.Second
+	// lastRGARead is the time of the last bytes read from the RGA, in Unix nanoseconds
+	lastRGARead        atomic.Int64
+	ErrNotConnected    = bg.Error("not connected to the RGA")
+	ErrPanicked        = bg.Error("a goroutine panicked, see the log")
+	ErrRecordingWedged = bg.Error("recording loop made no progress")
+)
+
+// serveHealth serves /healthz, the liveness, and /readyz, the readiness, on the address. Both answer 200 with "ok" or
+// 503 with the reason
+func (e *MksRgaDatasource) serveHealth(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, e.alive())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, e.ready(r.Context()))
+	})
+	go func() {
+		log.Printf("Health endpoints listening on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Health endpoints stopped: %v", err)
+		}
+	}()
+}
+
+// writeHealth answers a health check
+func writeHealth(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// healthTimeout returns the time the recording loop may go without progress, or the RGA without sending anything
+// while recording, before the plugin is reported wedged or not ready. It defaults to the polling interval plus twice
+// the scan timeout, which covers a tick spent waiting, a scan or a degas, and a restarted scan
+func (e *MksRgaDatasource) healthTimeout() time.Duration {
+	if e.config.HealthTimeout > 0 {
+		return time.Duration(e.config.HealthTimeout) * time.Second
+	}
+	scanTimeout := time.Duration(e.config.ScanTimeout) * time.Second
+	if scanTimeout <= 0 {
+		scanTimeout = defaultScanTimeout
+	}
+	return e.pollInterval() + 2*scanTimeout
+}
+
+// alive returns an error if a goroutine panicked without recovering or the recording loop is stuck, either of which
+// a restart of the plugin fixes
+func (e *MksRgaDatasource) alive() error {
+	if !e.Healthy() {
+		return ErrPanicked
+	}
+	if atomic.LoadInt32(&e.recording) != 1 {
+		return nil
+	}
+	if since := time.Since(time.Unix(0, e.progress.Load())); since > e.healthTimeout() {
+		return fmt.Errorf("%w for %v", ErrRecordingWedged, since.Round(time.Second))
+	}
+	return nil
+}
+
+// ready returns an error unless the RGA answers and, if enabled, InfluxDB is reachable. Between recordings the sensor
+// state is queried. While recording the connection belongs to the recording, which reads from the RGA at least once
+// per scan
+func (e *MksRgaDatasource) ready(ctx context.Context) error {
+	if err := e.alive(); err != nil {
+		return err
+	}
+	if e.connMu.TryLock() {
+		err := e.queryRGA()
+		e.connMu.Unlock()
+		if err != nil {
+			return err
+		}
+	} else if since := time.Since(time.Unix(0, lastRGARead.Load())); since > e.healthTimeout() {
+		return fmt.Errorf("Nothing read from the RGA for %v", since.Round(time.Second))
+	}
+	for _, s := range e.sinks {
+		if influx, ok := s.(*influxSink); ok {
+			ctx, cancel := context.WithTimeout(ctx, healthInfluxTimeout)
+			err := influx.ping(ctx)
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// queryRGA queries the sensor state of the idle connection
+func (e *MksRgaDatasource) queryRGA() error {
+	if e.connection == nil {
+		return ErrNotConnected
+	}
+	if _, err := e.connection.SensorState(); err != nil {
+		return fmt.Errorf("RGA not answering: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+var (
+	statusKindHeartbeat   = "heartbeat"
+	heartbeatNotConnected = "idle, not connected" // reason of the heartbeats sent while there is no connection
+)
+
+// heartbeatStatus returns a heartbeat status. While recording it reports the state known from the scans, so that it
+// never interleaves with their responses. Idle, it queries the sensor state and the filament
+func (e *MksRgaDatasource) heartbeatStatus(recording bool) *Status {
+	st := &Status{Time: e.now(), Kind: statusKindHeartbeat, Recording: recording, SensorState: e.sensorState, TotalPressure: e.totalPressure, Filament: e.filament, Rig: e.config.RigID, Serial: e.serial, Inlet: e.inlet}
+	if e.gaugePressure > 0 {
+		st.TotalPressure = e.gaugePressure
+	}
+	if recording {
+		st.Reason = "recording"
+		return st
+	}
+	st.Reason = "idle"
+	if e.connection == nil {
+		st.Reason = heartbeatNotConnected
+		return st
+	}
+	if resp, err := e.connection.SensorState(); err != nil {
+		st.Reason = fmt.Sprintf("idle, could not read sensor state: %v", err)
+	} else {
+		st.SensorState = fieldString(resp, "State")
+	}
+	if resp, err := e.connection.FilamentInfo(); err == nil {
+		st.Filament = fieldString(resp, "SummaryState")
+	}
+	return st
+}
+
+// runHeartbeat reports a heartbeat status to the sinks every Heartbeat seconds between recordings, until the plugin
+// stops. Laniakea only receives frames while recording, the recording emits its own heartbeat frames
+func (e *MksRgaDatasource) runHeartbeat() {
+	ticker := time.NewTicker(time.Duration(e.config.Heartbeat) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// a recording or monitoring goroutine owns the connection
+			if !e.connMu.TryLock() {
+				continue
+			}
+			st := e.heartbeatStatus(false)
+			e.connMu.Unlock()
+			e.reportStatus(nil, st)
+		case <-e.stopping:
+			return
+		}
+	}
+}
+
+// fieldString returns the field of a response formatted as a string, blank if missing
+func fieldString(resp *mks.RGAResponse, name string) string {
+	v, ok := resp.Fields[name]
+	if !ok || v.Value == nil {
+		return ""
+	}
+	return fmt.Sprint(v.Value)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+// readIdentity reads the serial number of the sensor and tags every subsequent log line with the rig and serial
+func (e *MksRgaDatasource) readIdentity() error {
+	resp, err := e.connection.Info()
+	if err != nil {
+		return err
+	}
+	serial, ok := resp.Fields["SerialNumber"].Value.(string)
+	if !ok {
+		return fmt.Errorf("sensor info did not contain a serial number")
+	}
+	e.serial = serial
+	setLogPrefix(e.config.RigID, e.serial)
+	e.detectFirmware()
+	return nil
+}
+
+// detectFirmware gates the commands the firmware of the sensor doesn't support, applying MinFirmware over the
+// built-in capability matrix. Commands are sent unchecked if the firmware can't be read
+func (e *MksRgaDatasource) detectFirmware() {
+	fw, err := e.connection.DetectFirmware()
+	if err != nil {
+		log.Printf("Could not read the firmware version, commands are sent unchecked: %v", err)
+		return
+	}
+	log.Printf("Sensor firmware %v, protocol revision %v", fw.Version, fw.Protocol)
+	for command, version := range e.config.MinFirmware {
+		// validated at startup
+		v, _ := mks.ParseVersion(version)
+		e.connection.SetFirmwareRequirement(command, mks.Requirement{Firmware: v})
+	}
+}
+
+// validateMinFirmware checks the versions of MinFirmware
+func validateMinFirmware(requirements map[string]string) error {
+	for command, version := range requirements {
+		if version == "" {
+			continue
+		}
+		if _, err := mks.ParseVersion(version); err != nil {
+			return fmt.Errorf("Invalid firmware requirement of %s: %v", command, err)
+		}
+	}
+	return nil
+}
+
+// setLogPrefix prefixes log lines with the non-blank identifiers
+func setLogPrefix(ids ...string) {
+	var parts []string
+	for _, id := range ids {
+		if id != "" {
+			parts = append(parts, id)
+		}
+	}
+	if len(parts) == 0 {
+		log.SetPrefix("")
+		return
+	}
+	log.SetPrefix("[" + strings.Join(parts, " ") + "] ")
+}
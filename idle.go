@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+var (
+	idlePolicyRelease    = "release"
+	idlePolicyHold       = "hold"
+	idlePolicyDisconnect = "disconnect"
+)
+
+// validateIdlePolicy checks IdlePolicy
+func validateIdlePolicy(policy string) error {
+	switch policy {
+	case "", idlePolicyRelease, idlePolicyHold, idlePolicyDisconnect:
+		return nil
+	}
+	return fmt.Errorf("Unknown idle policy %s, expected release, hold or disconnect", policy)
+}
+
+// idle leaves the sensor to other clients, e.g. Process Eye, once a recording stops, according to IdlePolicy. The
+// session is always undone. With release, the default, control is released. With hold, control is kept until the next
+// recording. With disconnect, control is released and the connection closed, to be opened again on the next StartRecord
+func (e *MksRgaDatasource) idle() {
+	if e.config.IdlePolicy == idlePolicyHold {
+		if err := e.session.Reset(); err != nil {
+			log.Println(err)
+		}
+		e.heldSession = e.session
+		return
+	}
+	if err := e.session.Close(); err != nil {
+		log.Println(err)
+	}
+	if e.config.IdlePolicy == idlePolicyDisconnect {
+		if err := e.connection.Close(); err != nil {
+			log.Printf("Could not close connection: %v", err)
+		}
+		e.connection = nil
+		log.Println("Disconnected from the sensor until the next recording")
+	}
+}
+
+// takeSession returns the session held since the last recording or, if there is none, takes control of the sensor
+func (e *MksRgaDatasource) takeSession() (*mks.Session, error) {
+	if s := e.heldSession; s != nil {
+		e.heldSession = nil
+		return s, nil
+	}
+	return e.newSession()
+}
+
+// releaseHeldSession releases control of the sensor if it is held between recordings
+func (e *MksRgaDatasource) releaseHeldSession() {
+	if e.heldSession == nil {
+		return
+	}
+	if err := e.heldSession.Close(); err != nil {
+		log.Println(err)
+	}
+	e.heldSession = nil
+}
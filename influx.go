@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	influx "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+)
+
+var influxBucketsTimeout = 30 * time.Second
+
+// influxSink writes every reading as a pressure point to InfluxDB and, if configured, periodic summaries to a second bucket
+type influxSink struct {
+	config     *cfg.Config
+	client     influx.Client
+	writeAPI   api.WriteAPI
+	summaryAPI api.WriteAPI // nil unless a summary bucket is configured
+	summary    *scanSummary
+	routed     map[string]api.WriteAPI // by measurement, of the measurements routed to another bucket
+	downsample *influxDownsampler      // nil unless InfluxDownsample groups are configured
+	failover   *influxFailover         // nil unless InfluxFailoverURLs are configured
+	sync.Mutex                         // guards the client and the write APIs, replaced on failover
+}
+
+var _ Sink = (*influxSink)(nil)
+var _ Annotator = (*influxSink)(nil)
+var _ StatusWriter = (*influxSink)(nil)
+var _ RunHeaderWriter = (*influxSink)(nil)
+var _ RunSummaryWriter = (*influxSink)(nil)
+
+// newInfluxSink creates the Influx client from the config
+func newInfluxSink(config *cfg.Config) (*influxSink, error) {
+	if config.InfluxURL == "" || config.InfuxAPIToken == "" {
+		log.Println("Influx URL or API Token config parameters cannot be blank")
+	}
+	opts, err := influxOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	downsample, err := newInfluxDownsampler(config.InfluxDownsample)
+	if err != nil {
+		return nil, err
+	}
+	s := &influxSink{
+		config: config,
+		client: influx.NewClientWithOptions(config.InfluxURL, config.InfuxAPIToken, opts),
+	}
+	s.downsample = downsample
+	if len(config.InfluxFailoverURLs) > 0 {
+		s.failover = newInfluxFailover(s, opts)
+	}
+	return s, nil
+}
+
+// influxOptions returns the client options of the config, the library defaults where it leaves them unset
+func influxOptions(config *cfg.Config) (*influx.Options, error) {
+	opts := influx.DefaultOptions().SetTLSConfig(&tls.Config{InsecureSkipVerify: config.InfluxSkipTLS})
+	if config.InfluxBufferLimit > 0 {
+		opts.SetRetryBufferLimit(uint(config.InfluxBufferLimit))
+	}
+	switch config.InfluxPrecision {
+	case "", "ns":
+	case "us":
+		opts.SetPrecision(time.Microsecond)
+	case "ms":
+		opts.SetPrecision(time.Millisecond)
+	case "s":
+		opts.SetPrecision(time.Second)
+	default:
+		return nil, fmt.Errorf("Unknown Influx precision %s, expected s, ms, us or ns", config.InfluxPrecision)
+	}
+	if config.InfluxFlushPeriod > 0 {
+		opts.SetFlushInterval(uint(config.InfluxFlushPeriod))
+	}
+	switch {
+	case config.InfluxMaxRetries < 0:
+		opts.SetMaxRetries(0)
+	case config.InfluxMaxRetries > 0:
+		opts.SetMaxRetries(uint(config.InfluxMaxRetries))
+	}
+	return opts, nil
+}
+
+// Name implements the Sink interface
+func (s *influxSink) Name() string {
+	return "influx"
+}
+
+// Open validates the organization, creates the buckets if necessary and prepares the write APIs
+func (s *influxSink) Open() error {
+	if s.config.InfluxOrgName == "" || s.config.InfluxBucketName == "" {
+		return ErrBlankInfluxOrgOrBucket
+	}
+	s.Lock()
+	client := s.client
+	s.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), influxBucketsTimeout)
+	defer cancel()
+	if err := s.ensureBuckets(ctx, client); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.config.InfluxSummaryBucketName != "" {
+		s.summary = newScanSummary(s.config.InfluxSummaryInterval)
+	}
+	if s.downsample != nil {
+		s.downsample.reset()
+	}
+	s.openAPIs(s.writeAPIs(s.client))
+	return nil
+}
+
+// ensureBuckets creates the main, routed and summary buckets on the endpoint of the client if necessary
+func (s *influxSink) ensureBuckets(ctx context.Context, client influx.Client) error {
+	if err := s.ensureBucket(ctx, client, s.config.InfluxBucketName, s.config.InfluxBucketRetention); err != nil {
+		return err
+	}
+	for _, r := range s.config.Routes {
+		if r.InfluxBucket == "" {
+			continue
+		}
+		if err := s.ensureBucket(ctx, client, r.InfluxBucket, s.config.InfluxBucketRetention); err != nil {
+			return err
+		}
+	}
+	if s.config.InfluxSummaryBucketName != "" {
+		return s.ensureBucket(ctx, client, s.config.InfluxSummaryBucketName, s.config.InfluxSummaryBucketRetention)
+	}
+	return nil
+}
+
+// influxAPIs are the write APIs of the buckets on an endpoint
+type influxAPIs struct {
+	write   api.WriteAPI
+	routed  map[string]api.WriteAPI
+	summary api.WriteAPI // nil unless a summary bucket is configured
+}
+
+// writeAPIs gets the write APIs of the buckets from the client
+func (s *influxSink) writeAPIs(client influx.Client) influxAPIs {
+	apis := influxAPIs{write: client.WriteAPI(s.config.InfluxOrgName, s.config.InfluxBucketName), routed: make(map[string]api.WriteAPI)}
+	for _, r := range s.config.Routes {
+		if r.InfluxBucket == "" {
+			continue
+		}
+		for _, m := range r.Measurements {
+			apis.routed[m] = client.WriteAPI(s.config.InfluxOrgName, r.InfluxBucket)
+		}
+	}
+	if s.config.InfluxSummaryBucketName != "" {
+		apis.summary = client.WriteAPI(s.config.InfluxOrgName, s.config.InfluxSummaryBucketName)
+	}
+	return apis
+}
+
+// openAPIs makes the sink write to the write APIs. Their write failures are counted by the failover
+func (s *influxSink) openAPIs(apis influxAPIs) {
+	s.writeAPI, s.routed, s.summaryAPI = apis.write, apis.routed, apis.summary
+	if s.failover == nil {
+		return
+	}
+	s.failover.observe(s.writeAPI)
+	for _, w := range s.routed {
+		s.failover.observe(w)
+	}
+	if s.summaryAPI != nil {
+		s.failover.observe(s.summaryAPI)
+	}
+}
+
+// ensureBucket creates the bucket with the given retention [s] if it doesn't exist. A retention of 0 keeps data forever
+func (s *influxSink) ensureBucket(ctx context.Context, client influx.Client, name string, retention int64) error {
+	orgAPI := client.OrganizationsAPI()
+	org, err := orgAPI.FindOrganizationByName(ctx, s.config.InfluxOrgName)
+	if err != nil {
+		return ErrInvalidOrg
+	}
+	bucketAPI := client.BucketsAPI()
+	buckets, err := bucketAPI.FindBucketsByOrgName(ctx, s.config.InfluxOrgName)
+	if err != nil {
+		return ErrInvalidOrg
+	}
+	for _, bucket := range *buckets {
+		if bucket.Name == name {
+			return nil
+		}
+	}
+	log.Printf("Creating %s bucket...", name)
+	_, err = bucketAPI.CreateBucketWithName(ctx, org, name, domain.RetentionRule{EverySeconds: retention})
+	return err
+}
+
+// Write implements the Sink interface
+func (s *influxSink) Write(scan *Scan) error {
+	s.Lock()
+	defer s.Unlock()
+	readings, aggregated := scan.Readings, []*readingStats(nil)
+	if s.downsample != nil {
+		readings, aggregated = s.downsample.add(scan)
+	}
+	for _, r := range readings {
+		fields := map[string]interface{}{
+			"pressure": r.Value,
+		}
+		if r.Raw != nil {
+			fields["raw_pressure"] = *r.Raw
+		}
+		if flags := append(append([]string(nil), scan.Flags...), r.Flags...); len(flags) > 0 {
+			fields["flags"] = strings.Join(flags, ",")
+		}
+		s.writePressure(scan, r.Measurement, r.Mass, fields)
+	}
+	// downsampled groups are written at the time of the scan completing them
+	for _, st := range aggregated {
+		fields := map[string]interface{}{
+			"pressure": st.Mean(),
+			"min":      st.Min,
+			"max":      st.Max,
+			"count":    st.Count,
+		}
+		if len(scan.Flags) > 0 {
+			fields["flags"] = strings.Join(scan.Flags, ",")
+		}
+		s.writePressure(scan, st.Measurement, st.Mass, fields)
+	}
+	if s.summary != nil && s.summary.add(scan) {
+		s.writeSummary()
+	}
+	return nil
+}
+
+// writePressure writes a pressure point of the mass to the bucket of its measurement. The caller holds the lock
+func (s *influxSink) writePressure(scan *Scan, measurement string, mass float64, fields map[string]interface{}) {
+	p := influx.NewPoint(
+		"pressure",
+		identityTags(scan, map[string]string{
+			"mass":        formatMass(mass),
+			"measurement": measurement,
+		}),
+		fields,
+		scan.Time,
+	)
+	w := s.writeAPI
+	if routed, ok := s.routed[measurement]; ok {
+		w = routed
+	}
+	// write asynchronously
+	w.WritePoint(p)
+}
+
+// writeSummary writes the mean, min and max of every mass over the last window to the summary bucket. The caller holds
+// the lock
+func (s *influxSink) writeSummary() {
+	start, last, stats := s.summary.drain()
+	if last == nil {
+		return
+	}
+	for _, st := range stats {
+		p := influx.NewPoint(
+			"pressure_summary",
+			identityTags(last, map[string]string{
+				"mass":        formatMass(st.Mass),
+				"measurement": st.Measurement,
+			}),
+			map[string]interface{}{
+				"mean":  st.Mean(),
+				"min":   st.Min,
+				"max":   st.Max,
+				"count": st.Count,
+			},
+			start,
+		)
+		s.summaryAPI.WritePoint(p)
+	}
+}
+
+// identityTags adds the rig, sensor serial and source tags to the given tags
+func identityTags(scan *Scan, tags map[string]string) map[string]string {
+	if scan.Rig != "" {
+		tags["rig"] = scan.Rig
+	}
+	if scan.Serial != "" {
+		tags["serial"] = scan.Serial
+	}
+	if scan.Run != "" {
+		tags["run"] = scan.Run
+	}
+	if scan.SourceProfile != "" {
+		tags["source_profile"] = scan.SourceProfile
+	}
+	if scan.IonizationMode != "" {
+		tags["ionization"] = scan.IonizationMode
+	}
+	if scan.Inlet != "" {
+		tags["inlet"] = scan.Inlet
+	}
+	return tags
+}
+
+// Annotate writes the annotation as an events point, ready to be used as a Grafana annotation query
+func (s *influxSink) Annotate(a *Annotation) error {
+	s.Lock()
+	defer s.Unlock()
+	if !s.config.InfluxAnnotations || s.writeAPI == nil {
+		return nil
+	}
+	p := influx.NewPoint(
+		"events",
+		map[string]string{
+			"tags": strings.Join(a.Tags, ","),
+		},
+		map[string]interface{}{
+			"title": a.Title,
+			"text":  a.Text,
+		},
+		a.Time,
+	)
+	s.writeAPI.WritePoint(p)
+	return nil
+}
+
+// WriteStatus writes the status as a status point
+func (s *influxSink) WriteStatus(st *Status) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.writeAPI == nil {
+		return nil
+	}
+	tags := map[string]string{"kind": st.Kind}
+	if st.Rig != "" {
+		tags["rig"] = st.Rig
+	}
+	if st.Serial != "" {
+		tags["serial"] = st.Serial
+	}
+	if st.Inlet != "" {
+		tags["inlet"] = st.Inlet
+	}
+	fields := map[string]interface{}{
+		"stale":               st.Stale,
+		"calibration_overdue": st.CalibrationOverdue,
+		"reason":              st.Reason,
+	}
+	if st.Kind == statusKindHeartbeat {
+		fields["recording"] = st.Recording
+		fields["sensor_state"] = st.SensorState
+		fields["total_pressure"] = st.TotalPressure
+		fields["filament"] = st.Filament
+	}
+	p := influx.NewPoint("status", tags, fields, st.Time)
+	s.writeAPI.WritePoint(p)
+	return nil
+}
+
+// WriteRunHeader writes the run header as a run_header metadata point, one field per reported value
+func (s *influxSink) WriteRunHeader(h *RunHeader) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.writeAPI == nil {
+		return nil
+	}
+	tags := map[string]string{}
+	if h.Rig != "" {
+		tags["rig"] = h.Rig
+	}
+	if h.Serial != "" {
+		tags["serial"] = h.Serial
+	}
+	if h.Run != "" {
+		tags["run"] = h.Run
+	}
+	fields := map[string]interface{}{}
+	addFields := func(prefix string, values map[string]interface{}) {
+		for name, v := range values {
+			fields[prefix+"."+name] = v
+		}
+	}
+	addFields("info", h.Info)
+	addFields("egains", h.EGains)
+	addFields("sources", h.Sources)
+	addFields("filaments", h.Filaments)
+	addFields("rf", h.RF)
+	addFields("total_pressure", h.TotalPressure)
+	for idx, values := range h.Detectors {
+		addFields(fmt.Sprintf("detectors.%d", idx), values)
+	}
+	if len(h.Errors) > 0 {
+		fields["errors"] = strings.Join(h.Errors, "; ")
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	s.writeAPI.WritePoint(influx.NewPoint("run_header", tags, fields, h.Time))
+	return nil
+}
+
+// WriteRunSummary writes the run summary as a run_summary point
+func (s *influxSink) WriteRunSummary(rs *RunSummary) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.writeAPI == nil {
+		return nil
+	}
+	tags := map[string]string{"run": rs.ID}
+	if rs.Rig != "" {
+		tags["rig"] = rs.Rig
+	}
+	if rs.Serial != "" {
+		tags["serial"] = rs.Serial
+	}
+	fields := map[string]interface{}{
+		"description":  rs.Description,
+		"duration":     rs.Duration,
+		"scans":        rs.Scans,
+		"min_pressure": rs.MinPressure,
+		"max_pressure": rs.MaxPressure,
+	}
+	for class, n := range rs.Alarms {
+		fields["alarms."+class] = n
+	}
+	s.writeAPI.WritePoint(influx.NewPoint("run_summary", tags, fields, rs.End))
+	return nil
+}
+
+// Flush implements the Sink interface
+func (s *influxSink) Flush() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.writeAPI != nil {
+		s.writeAPI.Flush()
+	}
+	for _, w := range s.routed {
+		w.Flush()
+	}
+	if s.summaryAPI != nil {
+		s.writeSummary()
+		s.summaryAPI.Flush()
+	}
+	return nil
+}
+
+// Close implements the Sink interface
+func (s *influxSink) Close() error {
+	if s.failover != nil {
+		// closes every client, the active one included
+		s.failover.close()
+		return nil
+	}
+	s.client.Close()
+	return nil
+}
+
+// ping checks that the active InfluxDB instance answers
+func (s *influxSink) ping(ctx context.Context) error {
+	s.Lock()
+	client := s.client
+	s.Unlock()
+	if ok, err := client.Ping(ctx); !ok {
+		return fmt.Errorf("InfluxDB unreachable: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	influx "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/http"
+)
+
+var (
+	influxFailoverInterval = 10 * time.Second
+	influxFailoverTimeout  = 5 * time.Second
+	defaultFailoverChecks  = 3
+)
+
+// influxFailover checks the active InfluxDB endpoint every influxFailoverInterval. An endpoint fails a check when a
+// batch failed to be written since the last check or it doesn't answer a ping. After InfluxFailoverChecks failing checks
+// in a row the sink fails over to the first other endpoint answering, and it fails back to InfluxURL once InfluxURL
+// passes as many checks in a row. Points already buffered keep being retried against the endpoint they were written to
+type influxFailover struct {
+	sink    *influxSink
+	opts    *influx.Options
+	urls    []string        // InfluxURL then the replicas
+	clients []influx.Client // by URL, created when first used
+	active  atomic.Int32    // index of the endpoint written to
+	failed  atomic.Int32    // batches of the active endpoint failed since the last check
+	checks  int
+	bad     int // consecutive failing checks of the active endpoint
+	good    int // consecutive passing checks of InfluxURL while failed over
+	mu      sync.Mutex
+	onEvent func(title, text string, tags ...string)
+	stop    chan struct{}
+	done    chan struct{}
+	closed  sync.Once
+}
+
+// newInfluxFailover starts checking the endpoints of the sink, whose client is the one of InfluxURL
+func newInfluxFailover(s *influxSink, opts *influx.Options) *influxFailover {
+	f := &influxFailover{
+		sink:    s,
+		opts:    opts,
+		urls:    append([]string{s.config.InfluxURL}, s.config.InfluxFailoverURLs...),
+		checks:  s.config.InfluxFailoverChecks,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		onEvent: func(title, text string, tags ...string) { log.Printf("%s: %s", title, text) },
+	}
+	if f.checks <= 0 {
+		f.checks = defaultFailoverChecks
+	}
+	f.clients = make([]influx.Client, len(f.urls))
+	f.clients[0] = s.client
+	go f.run()
+	return f
+}
+
+// SetEventHandler implements the EventSource interface
+func (s *influxSink) SetEventHandler(handler func(title, text string, tags ...string)) {
+	if s.failover == nil {
+		return
+	}
+	s.failover.mu.Lock()
+	s.failover.onEvent = handler
+	s.failover.mu.Unlock()
+}
+
+// observe counts the failed batches of the write API while its endpoint is the active one. The batches are retried
+func (f *influxFailover) observe(w api.WriteAPI) {
+	i := f.active.Load()
+	w.SetWriteFailedCallback(func(_ string, _ http.Error, _ uint) bool {
+		if f.active.Load() == i {
+			f.failed.Add(1)
+		}
+		return true
+	})
+}
+
+// run checks the endpoints until the failover is closed
+func (f *influxFailover) run() {
+	defer close(f.done)
+	ticker := time.NewTicker(influxFailoverInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.check()
+		}
+	}
+}
+
+// check runs a check of the active endpoint and, while failed over, of InfluxURL, then switches endpoint if needed
+func (f *influxFailover) check() {
+	active := int(f.active.Load())
+	if f.failed.Swap(0) == 0 && f.ping(active) {
+		f.bad = 0
+	} else {
+		f.bad++
+	}
+	if active != 0 {
+		if f.ping(0) {
+			f.good++
+		} else {
+			f.good = 0
+		}
+		if f.good >= f.checks {
+			f.switchTo(0, fmt.Sprintf("%s passed %d checks", f.urls[0], f.good))
+			return
+		}
+	}
+	if f.bad < f.checks {
+		return
+	}
+	for i := range f.urls {
+		if i != active && f.ping(i) {
+			f.switchTo(i, fmt.Sprintf("%s failed %d checks", f.urls[active], f.bad))
+			return
+		}
+	}
+	if f.bad == f.checks {
+		log.Printf("%s failed %d checks but no other InfluxDB endpoint answers", f.urls[active], f.bad)
+	}
+}
+
+// ping returns whether the endpoint answers
+func (f *influxFailover) ping(i int) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), influxFailoverTimeout)
+	defer cancel()
+	ok, err := f.client(i).Ping(ctx)
+	if !ok && err != nil {
+		log.Printf("InfluxDB endpoint %s unreachable: %v", f.urls[i], err)
+	}
+	return ok
+}
+
+// client returns the client of the endpoint, created the first time
+func (f *influxFailover) client(i int) influx.Client {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.clients[i] == nil {
+		f.clients[i] = influx.NewClientWithOptions(f.urls[i], f.sink.config.InfuxAPIToken, f.opts)
+	}
+	return f.clients[i]
+}
+
+// switchTo makes the sink write to the endpoint and raises an event. If the sink is open its buckets are created on
+// the endpoint if necessary and its write APIs replaced. The endpoint is prepared before the sink is locked, so writes
+// go on meanwhile
+func (f *influxFailover) switchTo(i int, reason string) {
+	s := f.sink
+	client := f.client(i)
+	s.Lock()
+	open := s.writeAPI != nil
+	s.Unlock()
+	var apis influxAPIs
+	if open {
+		ctx, cancel := context.WithTimeout(context.Background(), influxBucketsTimeout)
+		if err := s.ensureBuckets(ctx, client); err != nil {
+			log.Printf("Could not check the buckets of %s: %v", f.urls[i], err)
+		}
+		cancel()
+		apis = s.writeAPIs(client)
+	}
+	s.Lock()
+	s.client = client
+	f.active.Store(int32(i))
+	if open {
+		s.openAPIs(apis)
+	}
+	s.Unlock()
+	f.failed.Store(0)
+	f.bad, f.good = 0, 0
+	title := "Influx failover"
+	if i == 0 {
+		title = "Influx failback"
+	}
+	f.mu.Lock()
+	onEvent := f.onEvent
+	f.mu.Unlock()
+	// the event is written to the sink itself, so it is raised once the sink is unlocked
+	onEvent(title, fmt.Sprintf("Writing to %s, %s", f.urls[i], reason), "influx")
+}
+
+// close stops checking the endpoints and closes every client. Closing again does nothing
+func (f *influxFailover) close() {
+	f.closed.Do(func() {
+		close(f.stop)
+		<-f.done
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, c := range f.clients {
+			if c != nil {
+				c.Close()
+			}
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	bg "github.com/SSSOCPaulCote/blunderguard"
+)
+
+var (
+	//go:embed mks.yaml.example
+	defaultConfig          string
+	ErrConfigAlreadyExists = bg.Error("config file already exists")
+)
+
+// discoverSensors connects to the RGA at the given address and returns a description of each sensor it reports
+func discoverSensors(rgaAddr string) ([]string, error) {
+	conn, err := ConnectToRGA(rgaAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.InitMsg(); err != nil {
+		return nil, err
+	}
+	resp, err := conn.Sensors()
+	if err != nil {
+		return nil, err
+	}
+	var sensors []string
+	states := resp.Column("State")
+	for i, serial := range resp.Column("SerialNumber") {
+		sensor := fmt.Sprintf("%v", serial.Value)
+		if i < len(states) {
+			sensor += fmt.Sprintf(" (%v)", states[i].Value)
+		}
+		sensors = append(sensors, sensor)
+	}
+	return sensors, nil
+}
+
+// writeDefaultConfig writes the commented default configuration to outPath, or stdout if outPath is "-".
+// If rgaAddr is set, the RGA is queried for its sensors and the address is filled in
+func writeDefaultConfig(outPath, rgaAddr string) error {
+	config := defaultConfig
+	if rgaAddr != "" {
+		sensors, err := discoverSensors(rgaAddr)
+		if err != nil {
+			return fmt.Errorf("Could not discover sensors on %s: %v", rgaAddr, err)
+		}
+		var header strings.Builder
+		fmt.Fprintf(&header, "# Sensors found on %s:\n", rgaAddr)
+		for _, sensor := range sensors {
+			fmt.Fprintf(&header, "#   %s\n", sensor)
+		}
+		lines := strings.Split(config, "\n")
+		for i, line := range lines {
+			if strings.HasPrefix(line, "RGAAddr:") {
+				lines[i] = fmt.Sprintf("RGAAddr: %q # address of the RGA controller", rgaAddr)
+			}
+		}
+		config = header.String() + strings.Join(lines, "\n")
+	}
+	var w io.Writer
+	if outPath == "-" {
+		w = os.Stdout
+	} else {
+		if outPath == "" {
+			outPath = cfg.DefaultConfigPath()
+		}
+		f, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			return ErrConfigAlreadyExists
+		} else if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	_, err := io.WriteString(w, config)
+	return err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+// inletName returns the configured name of the inlet at the given index, or its index if it has no name
+func (e *MksRgaDatasource) inletName(index int) string {
+	for _, in := range e.config.Inlets {
+		if in.Index == index && in.Name != "" {
+			return in.Name
+		}
+	}
+	return strconv.Itoa(index)
+}
+
+// applyInletFactors sends the configured pressure reduction factor of every inlet to the sensor
+func (e *MksRgaDatasource) applyInletFactors() error {
+	for _, in := range e.config.Inlets {
+		if in.Factor == 0 {
+			continue
+		}
+		if err := e.setInletFactor(in.Index, in.Factor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setInletFactor sets the pressure reduction factor of an inlet
+func (e *MksRgaDatasource) setInletFactor(index int, factor float64) error {
+	if factor <= 0 {
+		return fmt.Errorf("Invalid factor %v for inlet %d: must be positive", factor, index)
+	}
+	if _, err := e.connection.InletFactor(index, factor); err != nil {
+		return fmt.Errorf("Could not set factor for inlet %d: %v", index, err)
+	}
+	log.Printf("Inlet %s factor set to %v", e.inletName(index), factor)
+	return nil
+}
+
+// handleInletChange tags the data following an InletChange event with the new inlet
+func (e *MksRgaDatasource) handleInletChange(resp *mks.RGAResponse) {
+	index, ok := resp.Fields["Index"].Float()
+	if !ok {
+		log.Printf("Ignoring inlet change with invalid index %v", resp.Fields["Index"].Value)
+		return
+	}
+	e.setActiveInlet(int(index))
+}
+
+// setActiveInlet changes the inlet subsequent data is tagged with
+func (e *MksRgaDatasource) setActiveInlet(index int) {
+	name := e.inletName(index)
+	if name == e.inlet {
+		return
+	}
+	log.Printf("Active inlet changed to %s", name)
+	e.inlet = name
+	e.annotate("Inlet changed", name, "inlet")
+}
+
+// SelectInlet tags subsequent data with the given inlet, for inlets switched manually that don't report InletChange events
+func (e *MksRgaDatasource) SelectInlet(index int) error {
+	return e.inLoop(func() error {
+		e.setActiveInlet(index)
+		return nil
+	})
+}
+
+// ActiveInlet returns the name of the inlet data is currently tagged with, blank if inlets aren't configured
+func (e *MksRgaDatasource) ActiveInlet() (inlet string, err error) {
+	err = e.inLoop(func() error {
+		inlet = e.inlet
+		return nil
+	})
+	return inlet, err
+}
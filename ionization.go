@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+var (
+	ionizationModeStandard        = "Standard"
+	ionizationModeSoft            = "Soft"
+	defaultStandardElectronEnergy = 70
+	defaultSoftElectronEnergy     = 20
+)
+
+// ionizationSettings returns the source settings of the given ionization mode. Emission is only changed if configured
+func (e *MksRgaDatasource) ionizationSettings(mode string) (mks.SourceSettings, error) {
+	var (
+		energy   int
+		emission float64
+	)
+	switch mode {
+	case ionizationModeStandard:
+		energy, emission = e.config.StandardElectronEnergy, e.config.StandardEmission
+		if energy <= 0 {
+			energy = defaultStandardElectronEnergy
+		}
+	case ionizationModeSoft:
+		energy, emission = e.config.SoftElectronEnergy, e.config.SoftEmission
+		if energy <= 0 {
+			energy = defaultSoftElectronEnergy
+		}
+	default:
+		return mks.SourceSettings{}, ErrUnknownIonizationMode
+	}
+	s := mks.SourceSettings{ElectronEnergy: &energy}
+	if emission > 0 {
+		s.Emission = &emission
+	}
+	return s, nil
+}
+
+// setIonizationMode switches the source between standard and soft ionization
+func (e *MksRgaDatasource) setIonizationMode(mode string) error {
+	s, err := e.ionizationSettings(mode)
+	if err != nil {
+		return err
+	}
+	if err := e.connection.ApplySourceSettings(e.config.IonizationSourceIndex, s); err != nil {
+		return err
+	}
+	log.Printf("Switched to %s ionization (%d eV)", mode, *s.ElectronEnergy)
+	e.ionizationMode = mode
+	e.annotate("Ionization mode", fmt.Sprintf("%s (%d eV)", mode, *s.ElectronEnergy), "source")
+	return nil
+}
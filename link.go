@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"syscall"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+	bg "github.com/SSSOCPaulCote/blunderguard"
+)
+
+var ErrConnectionLost = bg.Error("connection to the RGA was lost")
+
+// readError classifies a failed read. A closed or reset connection is reported as ErrConnectionLost
+func readError(err error) error {
+	var nerr net.Error
+	if errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, net.ErrClosed) || (errors.As(err, &nerr) && !nerr.Timeout()) {
+		return fmt.Errorf("%w: %v", ErrConnectionLost, err)
+	}
+	return fmt.Errorf("could not read response: %w", err)
+}
+
+// linkLost reports whether the recording lost its link to the sensor, either by a LinkDown event, a dropped connection
+// or a response timing out, after which the connection is out of sync
+func linkLost(err error) bool {
+	var (
+		ld  *mks.LinkDownError
+		tmo *mks.ErrCommandTimeout
+	)
+	return errors.As(err, &ld) || errors.Is(err, ErrConnectionLost) || errors.As(err, &tmo) || errors.Is(err, mks.ErrOutOfSync)
+}
+
+// reestablishLink reconnects to the sensor, takes control again, adds the measurements back and restores the state
+// the recording had set after the link was lost. If another client took control, Control only succeeds once it
+// releases the sensor within ControlWaitTimeout
+func (e *MksRgaDatasource) reestablishLink(cause error) error {
+	filamentOn := e.filament == mks.RGA_FILAMENT_ON || e.filament == mks.RGA_FILAMENT_WARM_UP
+	var ld *mks.LinkDownError
+	if errors.As(cause, &ld) && ld.TakenOver() {
+		log.Printf("Another client took control of the sensor: %v", cause)
+		e.annotate("Link down", "control taken by another client: "+ld.Reason, "link")
+	} else {
+		log.Printf("Link to the sensor dropped: %v", cause)
+		e.annotate("Link down", cause.Error(), "link")
+	}
+	// the session can't be closed over a dropped link, the sensor releases it when the connection closes
+	e.connection.Close()
+	e.closeStream()
+	conn, err := e.connect()
+	if err != nil {
+		return err
+	}
+	e.connection = conn
+	session, err := e.newSession()
+	if err != nil {
+		return err
+	}
+	e.session = session
+	e.cleanupSensor(session)
+	// the zero buffers restart with the measurements
+	e.zeroed = make(map[string]bool, len(e.measurements))
+	e.reconnected = true
+	for _, m := range e.measurements {
+		if err := addMeasurement(session, m); err != nil {
+			return err
+		}
+	}
+	if err := e.restoreSensorState(session, filamentOn); err != nil {
+		return err
+	}
+	if err := e.openStream(); err != nil {
+		return err
+	}
+	linksReestablished.Add(1)
+	log.Println("Link to the sensor re-established")
+	e.annotate("Link re-established", "", "link")
+	return nil
+}
+
+// dropLink closes the connection the link couldn't be re-established over, and forgets a session held over it, so
+// that the next recording connects again
+func (e *MksRgaDatasource) dropLink() {
+	e.heldSession = nil
+	// already closed unless the sensor was reached again
+	e.connection.Close()
+	e.connection = nil
+}
+
+// restoreSensorState applies again what the recording set on the sensor, which a new session may not keep: the
+// rollover variables, the source profile, the ionization mode, the filament if it was on and the detector voltages
+func (e *MksRgaDatasource) restoreSensorState(session *mks.Session, filamentOn bool) error {
+	if e.config.Rollover != nil {
+		if err := e.setRollover(*e.config.Rollover); err != nil {
+			return err
+		}
+	}
+	if e.sourceProfile != "" {
+		if err := e.applySourceProfile(e.sourceProfile); err != nil {
+			return err
+		}
+	}
+	if e.ionizationMode != "" {
+		if err := e.setIonizationMode(e.ionizationMode); err != nil {
+			return err
+		}
+	}
+	// warmUpFilament turns the filament on itself with TurnOn
+	if filamentOn && (e.config.FilamentWarmUp == nil || !e.config.FilamentWarmUp.TurnOn) {
+		if _, err := session.FilamentControl(mks.RGA_ON); err != nil {
+			return fmt.Errorf("Could not turn the filament back on: %v", err)
+		}
+		e.annotate("Filament on", "restored after the link dropped", "filament")
+	}
+	if err := e.warmUpFilament(session); err != nil {
+		return err
+	}
+	return e.rampDetectors(context.Background(), session)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+func TestReestablishLinkFailed(t *testing.T) {
+	defer func(d time.Duration) { minPolInterval = d }(minPolInterval)
+	minPolInterval = 10 * time.Millisecond
+	s := newFakeSensor(t)
+	// the link drops during the first scan and the sensor can't be reached again
+	s.goDown("ScanResume")
+	e := newDatasource(&cfg.Config{
+		RGAAddr:      s.addr(),
+		StateFile:    filepath.Join(t.TempDir(), "state.json"),
+		Measurements: []cfg.Measurement{{Name: "bar", StartMass: 1, EndMass: 50, FilterMode: "PeakCenter"}},
+	})
+	if _, err := e.StartRecord(); err != nil {
+		t.Fatalf("StartRecord() error = %v", err)
+	}
+	waitStopped(t, e)
+	if err := stopRecord(t, e); err != ErrAlreadyStoppedRecording {
+		t.Errorf("StopRecord() after the link failed = %v, want %v", err, ErrAlreadyStoppedRecording)
+	}
+
+	// once the sensor is back, the next recording connects again
+	s.up(t)
+	if _, err := e.StartRecord(); err != nil {
+		t.Fatalf("StartRecord() after the link failed = %v", err)
+	}
+	if err := stopRecord(t, e); err != nil {
+		t.Errorf("StopRecord() = %v", err)
+	}
+}
@@ -1,27 +1,22 @@
 package main
 
 import (
-	"context"
-	"crypto/tls"
-	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
-	"net"
+	"os"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/SSSOC-CAN/fmtd/errors"
 	sdk "github.com/SSSOC-CAN/laniakea-plugin-sdk"
 	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
 	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
 	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
 	bg "github.com/SSSOCPaulCote/blunderguard"
 	"github.com/hashicorp/go-plugin"
-	influx "github.com/influxdata/influxdb-client-go/v2"
-	"github.com/influxdata/influxdb-client-go/v2/api"
-	"github.com/influxdata/influxdb-client-go/v2/domain"
 )
 
 var (
@@ -34,42 +29,197 @@ var (
 	ErrBlankInfluxOrgOrBucket                = bg.Error("influx organization or bucket cannot be blank")
 	ErrInvalidOrg                            = bg.Error("invalid influx organization")
 	ErrInvalidBucket                         = bg.Error("invalid influx bucket")
+	ErrNotRecording                          = bg.Error("not recording")
+	ErrUnknownMeasurement                    = bg.Error("unknown measurement")
+	ErrEditTimeout                           = bg.Error("timed out waiting for scan loop to accept request")
+	ErrStaleData                             = bg.Error("no mass reading received before the data went stale")
+	ErrScanTimeout                           = bg.Error("scan did not complete before its deadline")
+	ErrRecordingStopped                      = bg.Error("recording stopped during scan")
+	ErrUnknownSourceProfile                  = bg.Error("unknown source profile")
+	ErrUnknownIonizationMode                 = bg.Error("unknown ionization mode, expected Standard or Soft")
 )
 
 type MksRgaDatasource struct {
 	sdk.DatasourceBase
-	recording  int32 // used atomically
-	quitChan   chan struct{}
-	connection *mks.RGAConnection
-	config     *cfg.Config
-	client     influx.Client
+	recording      int32 // used atomically
+	detached       int32 // used atomically, set while a resumed recording waits for Laniakea
+	unhealthy      int32 // used atomically, set when a goroutine panicked
+	quitChan       chan struct{}
+	stopping       chan struct{} // closed when the plugin stops, recordings return after the in-flight scan
+	stopOnce       sync.Once
+	frameChan      chan *proto.Frame
+	done           chan struct{} // closed when the goroutine of the current recording returns
+	frameMu        sync.Mutex    // guards frameChan and done, replaced by every recording, and the handover
+	loopChan       chan *loopReq
+	eventChan      chan *Annotation // operator annotations emitted as event frames between scans
+	connection     *mks.RGAConnection
+	stream         *mks.RGAConnection // second connection the readings are read from when DualConnection is set
+	resolvedAddr   string             // address RGASerial was last found at
+	tunnel         *tunnel            // forwards the RGA connection through the proxy, nil if none is configured
+	limiter        *mks.RateLimiter   // spaces out the commands of every connection, nil if unlimited
+	quarantine     io.Writer          // responses rejected by StrictParsing, nil if not dumped
+	rejects        *rejectLog         // troubleshooting log of the dropped data, nil if not configured
+	resolution     *resolutionTracker // reference peak of analog scans, nil without ResolutionMonitor
+	limits         *detectorLimits    // electronic gains and detectors read when recording starts
+	fingerprint    *ReferenceSpectrum // spectrum scans are compared to, nil if none was captured
+	session        *mks.Session       // control of the sensor held by the running recording
+	heldSession    *mks.Session       // control kept between recordings when IdlePolicy is hold, nil otherwise
+	config         *cfg.Config
+	measurements   []cfg.Measurement // measurements of the running scan, kept in sync with runtime edits
+	sensorState    string
+	degasWindow    degasWindow
+	lastDegas      time.Time
+	degasRequested bool            // set by Admin.Degas, the degas runs on the next tick
+	captureRef     bool            // set by CaptureFingerprint, the next completed scan becomes the reference spectrum
+	autoRangeScans map[string]int  // consecutive scans a measurement fit a more sensitive setting
+	reconnected    bool            // set when the link is re-established, the next scan is flagged
+	zeroed         map[string]bool // measurements that reported a zero reading since they were added to the scan
+	airLeakScans   int             // consecutive scans matching the air leak signature
+	bakeOut        *bakeOut        // running bake-out, nil if none
+	filamentHours  float64         // recording hours since the last degas
+	serial         string          // serial number of the sensor, read when recording starts
+	sourceProfile  string          // name of the active source profile, blank if none was applied
+	ionizationMode string          // Standard or Soft, blank if never set
+	inlet          string          // name of the active inlet, blank if inlets aren't configured
+	calibration    map[int]float64 // CalibrationFactors by mass
+	digitalPorts   map[string]int  // last known value of every digital port
+	alarms         map[string]bool // alarm classes currently raised
+	alarmHandlers  []alarmHandler
+	rfTripSince    time.Time   // start of the RF trip, zero if the RF isn't tripped
+	gaugePressure  float64     // last external gauge reading [Pa], 0 if none
+	totalPressure  float64     // total pressure of the last scan [Pa], 0 if none
+	filament       string      // summary state of the last FilamentStatus event
+	warmUpSince    time.Time   // since when scans are skipped for a filament warming up again, zero if they aren't
+	audioFrequency int         // frequency the audio output is sounding at, 0 if silent
+	clock          *clock      // timestamp source, nil for the system clock
+	run            *Run        // open run, nil if none
+	runStats       RunSummary  // statistics of the open run
+	processors     []Processor // run on every completed scan before it is published
+	sinks          []Sink
+	sinkQueues     []*sinkQueue // call each sink from its own goroutine
+	routes         routingTable // sinks of the routed measurements
+	connMu         sync.Mutex   // held by the recording or monitoring goroutine while it runs, idle heartbeats skip
+	annotators     []Annotator
+	pipe           atomic.Pointer[pipeline] // pipeline of the running recording, nil when idle
+	progress       atomic.Int64             // Unix nanoseconds of the last iteration of the recording loop
 	sync.WaitGroup
 }
 
 type Payload struct {
-	Name  string  `json:"name"`
-	Value float64 `json:"value"`
+	Name          string   `json:"name"`
+	Measurement   string   `json:"measurement"`
+	Mass          float64  `json:"mass"`                    // fractional for analog measurements
+	PointsPerPeak int      `json:"pointsPerPeak,omitempty"` // points per AMU of the measurement
+	Value         float64  `json:"value"`
+	Raw           *float64 `json:"raw,omitempty"`   // value before software calibration, if kept
+	Flags         []string `json:"flags,omitempty"` // quality flags, see quality.go
+}
+
+// formatMass formats a mass position without trailing zeros, e.g. 28 or 28.25
+func formatMass(mass float64) string {
+	return strconv.FormatFloat(mass, 'f', -1, 64)
 }
 
 type Frame struct {
-	Data []Payload `json:"data"`
+	Schema         string          `json:"schema"` // schema URL and version, see schema/frame.schema.json
+	Rig            string          `json:"rig,omitempty"`
+	Run            string          `json:"run,omitempty"`
+	Serial         string          `json:"serial,omitempty"`
+	SourceProfile  string          `json:"sourceProfile,omitempty"`
+	IonizationMode string          `json:"ionizationMode,omitempty"`
+	Inlet          string          `json:"inlet,omitempty"`
+	Digital        map[string]bool `json:"digital,omitempty"`
+	Chunk          *FrameChunk     `json:"chunk,omitempty"`      // set when FrameChunkSize is configured
+	Similarity     *float64        `json:"similarity,omitempty"` // similarity to the reference spectrum, set when Fingerprint is configured
+	Clock          *ClockQuality   `json:"clock,omitempty"`      // set when Clock is configured
+	Flags          []string        `json:"flags,omitempty"`      // quality flags of every reading, see quality.go
+	Data           []Payload       `json:"data"`
 }
 
 // Implements the Datasource interface funciton StartRecord
 func (e *MksRgaDatasource) StartRecord() (chan *proto.Frame, error) {
+	// A recording resumed at startup is handed over to the first caller, with the frame channel it currently sends to
+	e.frameMu.Lock()
+	if atomic.CompareAndSwapInt32(&e.detached, 1, 0) {
+		frameChan := e.frameChan
+		e.frameMu.Unlock()
+		log.Println("Handing resumed recording over to Laniakea")
+		return frameChan, nil
+	}
+	e.frameMu.Unlock()
+	return e.startRecording(false)
+}
+
+// frames returns the frame channel of the current recording, which a restart after a panic replaces
+func (e *MksRgaDatasource) frames() chan *proto.Frame {
+	e.frameMu.Lock()
+	defer e.frameMu.Unlock()
+	return e.frameChan
+}
+
+// setFrameChan makes frameChan the channel of the recording. A resumed recording is detached until StartRecord hands
+// it over
+func (e *MksRgaDatasource) setFrameChan(frameChan chan *proto.Frame, resume bool) {
+	e.frameMu.Lock()
+	defer e.frameMu.Unlock()
+	e.frameChan = frameChan
+	if resume {
+		atomic.StoreInt32(&e.detached, 1)
+	}
+}
+
+// setDone makes done the channel closed when the goroutine of the recording returns
+func (e *MksRgaDatasource) setDone(done chan struct{}) {
+	e.frameMu.Lock()
+	defer e.frameMu.Unlock()
+	e.done = done
+}
+
+// recordingDone returns the channel closed when the goroutine of the current recording returns
+func (e *MksRgaDatasource) recordingDone() chan struct{} {
+	e.frameMu.Lock()
+	defer e.frameMu.Unlock()
+	return e.done
+}
+
+// startRecording takes control of the sensor, builds the measurements and starts the recording goroutine.
+// Measurements left on the sensor by a previous session are removed first, always when resuming
+func (e *MksRgaDatasource) startRecording(resume bool) (_ chan *proto.Frame, err error) {
 	if atomic.LoadInt32(&e.recording) == 1 {
 		return nil, ErrAlreadyRecording
 	}
-	// InitMsg
-	err := e.connection.InitMsg()
-	if err != nil {
+	// released when the recording goroutine returns
+	e.connMu.Lock()
+	defer func() {
+		if err != nil {
+			e.connMu.Unlock()
+		}
+	}()
+	if err := e.ensureConnected(); err != nil {
 		return nil, err
 	}
-	// Setup Data
-	_, err = e.connection.Control(pluginName, pluginVersion)
+	if e.config.MonitorMode {
+		return e.startMonitoring(resume)
+	}
+	// InitMsg and Control, unless control was held since the last recording
+	session, err := e.takeSession()
 	if err != nil {
 		return nil, err
 	}
+	// don't keep control of the sensor if the recording can't start
+	defer func() {
+		if err != nil {
+			if cerr := session.Close(); cerr != nil {
+				log.Printf("Could not close session: %v", cerr)
+			}
+		}
+	}()
+	if resume || !e.config.SkipStartupCleanup {
+		e.cleanupSensor(session)
+	}
+	if err := e.readIdentity(); err != nil {
+		log.Printf("Could not read sensor serial number: %v", err)
+	}
 	resp, err := e.connection.SensorState()
 	if err != nil {
 		return nil, err
@@ -77,135 +227,259 @@ func (e *MksRgaDatasource) StartRecord() (chan *proto.Frame, error) {
 	if resp.Fields["State"].Value.(string) != mks.RGA_SENSOR_STATE_INUSE {
 		return nil, fmt.Errorf("Sensor not ready: %v", resp.Fields["State"])
 	}
-	_, err = e.connection.AddBarchart("Bar1", 1, 200, mks.RGA_PeakCenter, 5, 0, 0, 0)
-	if err != nil {
-		return nil, fmt.Errorf("Could not add Barchart: %v", err)
+	e.sensorState = resp.Fields["State"].Value.(string)
+	if err = e.checkStartPreconditions(); err != nil {
+		return nil, err
 	}
-	_, err = e.connection.ScanAdd("Bar1")
-	if err != nil {
-		return nil, fmt.Errorf("Could not add measurement to scan: %v", err)
+	for _, m := range e.config.Measurements {
+		err = addMeasurement(session, m)
+		if err != nil {
+			return nil, err
+		}
 	}
-	var ticker *time.Ticker
-	if e.config.PollingInterval == 0 || time.Duration(e.config.PollingInterval)*time.Second < minPolInterval {
-		ticker = time.NewTicker(minPolInterval)
-	} else {
-		ticker = time.NewTicker(time.Duration(e.config.PollingInterval) * time.Second)
+	e.measurements = append([]cfg.Measurement(nil), e.config.Measurements...)
+	e.zeroed = make(map[string]bool, len(e.measurements))
+	e.readDetectorLimits()
+	if e.config.Rollover != nil {
+		if err = e.setRollover(*e.config.Rollover); err != nil {
+			return nil, err
+		}
 	}
-	frameChan := make(chan *proto.Frame)
-	var writeAPI api.WriteAPI
-	if e.config.Influx {
-		if e.config.InfluxOrgName == "" || e.config.InfluxBucketName == "" {
-			return nil, ErrBlankInfluxOrgOrBucket
+	if len(e.config.Inlets) > 0 {
+		if err = e.applyInletFactors(); err != nil {
+			return nil, err
 		}
-		orgAPI := e.client.OrganizationsAPI()
-		org, err := orgAPI.FindOrganizationByName(context.Background(), e.config.InfluxOrgName)
-		if err != nil {
-			return nil, ErrInvalidOrg
+		e.inlet = e.inletName(e.config.Inlet)
+	}
+	if e.usesDigitalIO() {
+		if err = e.refreshDigitalPorts(); err != nil {
+			return nil, err
 		}
-		bucketAPI := e.client.BucketsAPI()
-		buckets, err := bucketAPI.FindBucketsByOrgName(context.Background(), e.config.InfluxOrgName)
-		if err != nil {
-			return nil, ErrInvalidOrg
+		e.updateInterlock()
+	}
+	if e.config.ExternalGauge {
+		if err = e.setupExternalGauge(); err != nil {
+			return nil, err
 		}
-		var found bool
-		for _, bucket := range *buckets {
-			if bucket.Name == e.config.InfluxBucketName {
-				found = true
-				break
-			}
+	}
+	if err = e.warmUpFilament(session); err != nil {
+		return nil, err
+	}
+	if e.config.SourceProfile != "" {
+		if err = e.applySourceProfile(e.config.SourceProfile); err != nil {
+			return nil, err
 		}
-		if !found {
-			log.Printf("Creating %s bucket...", e.config.InfluxBucketName)
-			_, err := bucketAPI.CreateBucketWithName(context.Background(), org, e.config.InfluxBucketName, domain.RetentionRule{EverySeconds: 0})
-			if err != nil {
-				return nil, err
-			}
+	}
+	if e.config.IonizationMode != "" {
+		if err = e.setIonizationMode(e.config.IonizationMode); err != nil {
+			return nil, err
 		}
-		writeAPI = e.client.WriteAPI(e.config.InfluxOrgName, e.config.InfluxBucketName)
 	}
+	if err = e.openStream(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			e.closeStream()
+		}
+	}()
+	header := e.readRunHeader()
+	pollInterval := e.pollInterval()
+	ticker := time.NewTicker(pollInterval)
+	backlog := e.config.FrameBacklog
+	if backlog <= 0 {
+		backlog = defaultFrameBacklog
+	}
+	frameChan := make(chan *proto.Frame, backlog)
+	out := make(chan *proto.Frame)
+	if err := e.openSinks(); err != nil {
+		return nil, err
+	}
+	e.progress.Store(time.Now().UnixNano())
+	// set before the flag, a StopRecord must never wait on the channel of the previous recording
+	done := make(chan struct{})
+	e.setDone(done)
 	if ok := atomic.CompareAndSwapInt32(&e.recording, 0, 1); !ok {
 		return nil, ErrAlreadyRecording
 	}
+	e.session = session
+	if e.run == nil {
+		e.openRun("", e.config.RunDescription)
+	} else {
+		// a resumed run keeps its ID, its statistics restart
+		e.runStats = RunSummary{Run: *e.run, Alarms: make(map[string]int)}
+	}
+	header.Run = e.runID()
+	e.saveState()
+	e.annotate("Recording started", "", "recording")
+	if len(e.calibration) > 0 {
+		e.annotate("Calibration factors", calibrationText(e.calibration), "calibration")
+	}
+	pipe := e.newPipeline(frameChan)
+	e.pipe.Store(pipe)
+	e.setFrameChan(out, resume)
+	go forwardFrames(frameChan, out)
 	e.Add(1)
 	go func() {
+		defer e.connMu.Unlock()
+		defer e.recordingEnded(done)
+		defer e.recoverPanic("recording", e.recordingPanicked)
 		defer e.Done()
 		defer close(frameChan)
+		// set when the link couldn't be re-established, the connection is dropped once the recording cleaned up
+		var linkFailed bool
 		defer func() {
-			_, err := e.connection.FilamentControl("Off")
-			if err != nil {
-				log.Println(err)
-			}
-			_, err = e.connection.Release()
-			if err != nil {
-				log.Println(err)
-			}
-			if e.config.Influx {
-				writeAPI.Flush()
-				e.client.Close()
+			if !e.config.KeepFilamentOn {
+				_, err := e.connection.FilamentControl("Off")
+				if err != nil {
+					log.Println(err)
+				} else {
+					e.annotate("Filament off", "", "filament")
+				}
 			}
+			e.clearAlarms()
+			// the session is replaced when the link is re-established
+			e.idle()
+			e.closeStream()
+			pipe.close()
+			e.pipe.Store(nil)
+			e.closeRun(frameChan)
+			e.flushSinks()
 			ticker.Stop()
+			if linkFailed {
+				e.dropLink()
+			}
 		}()
-		time.Sleep(1 * time.Second) // sleep for a second while laniakea sets up the plugin
+		e.publishRunHeader(frameChan, header)
+		e.checkCalibration(frameChan, header)
+		if running, err := e.rampBeforeScans(session); err != nil {
+			e.recordingFailed(err)
+			return
+		} else if !running {
+			return
+		}
+		var heartbeat <-chan time.Time
+		if e.config.Heartbeat > 0 {
+			heartbeatTicker := time.NewTicker(time.Duration(e.config.Heartbeat) * time.Second)
+			defer heartbeatTicker.Stop()
+			heartbeat = heartbeatTicker.C
+		}
+		// until a scan completes, a scan is expected to last at most one polling interval
+		expectedScan := pollInterval
 		for {
+			e.progress.Store(time.Now().UnixNano())
 			select {
 			case <-ticker.C:
-				data := []Payload{}
-				df := Frame{}
-				current_time := time.Now()
-				// Start scan
-				_, err := e.connection.ScanResume(1)
-				if err != nil {
-					log.Printf("Could not resume scan: %v", err)
+				if e.stoppingNow() {
 					return
 				}
-				for {
-					resp, err := e.connection.ReadResponse()
-					if err != nil {
-						log.Printf("Could not read response: %v", err)
+				if e.interlocked() || e.warmingUp() {
+					continue
+				}
+				if tripped, err := e.rfTripActive(); err != nil {
+					e.recordingFailed(err)
+					return
+				} else if tripped {
+					continue
+				}
+				e.filamentHours += pollInterval.Hours()
+				if e.degasRequested || e.degasDue(time.Now()) {
+					e.degasRequested = false
+					err := e.runDegas()
+					if err == ErrRecordingStopped {
 						return
+					} else if err != nil {
+						log.Printf("Degas failed: %v", err)
+						// don't retry on every tick
+						e.lastDegas = time.Now()
+						e.filamentHours = 0
 					}
-					if resp.ErrMsg.CommandName == mks.MassReading {
-						massPos := resp.Fields["MassPosition"].Value.(int64)
-						v := resp.Fields["Value"].Value.(float64)
-						data = append(data, Payload{Name: fmt.Sprintf("mass %v", massPos), Value: v})
-						if e.config.Influx {
-							p := influx.NewPoint(
-								"pressure",
-								map[string]string{
-									"mass": strconv.FormatInt(massPos, 10),
-								},
-								map[string]interface{}{
-									"pressure": v,
-								},
-								current_time,
-							)
-							// write asynchronously
-							writeAPI.WritePoint(p)
-						}
-						if resp.Fields["MassPosition"].Value.(int64) == int64(200) {
-							break
+					continue
+				}
+				if e.config.ExternalGauge {
+					e.feedTotalPressure()
+				}
+				// timed with the local clock, scan.Time may carry an offset or step with the configured clock
+				started := time.Now()
+				scan, err := e.runScan(frameChan, expectedScan)
+				switch err {
+				case nil:
+				case ErrStaleData, ErrScanTimeout:
+					log.Printf("Scan aborted: %v", err)
+					scansAborted.Add(1)
+					if err == ErrStaleData {
+						e.setAlarm(alarmStaleData, true)
+					}
+					continue
+				case ErrRFTripped:
+					log.Printf("Scan aborted: %v", err)
+					scansAborted.Add(1)
+					continue
+				case ErrRecordingStopped:
+					return
+				default:
+					if linkLost(err) {
+						if rerr := e.reestablishLink(err); rerr != nil {
+							e.recordingFailed(fmt.Errorf("could not re-establish link: %w", rerr))
+							linkFailed = true
+							return
 						}
+						continue
 					}
-				}
-				df.Data = data[:]
-				// transform to json string
-				b, err := json.Marshal(&df)
-				if err != nil {
-					log.Println(err)
+					e.recordingFailed(err)
 					return
 				}
-				frameChan <- &proto.Frame{
-					Source:    pluginName,
-					Type:      "application/json",
-					Timestamp: current_time.UnixMilli(),
-					Payload:   b,
+				expectedScan = time.Since(started)
+				e.setAlarm(alarmStaleData, false)
+				if len(e.config.DigitalInputs) > 0 {
+					scan.Digital = e.digitalInputs()
+					e.updateInterlock()
 				}
+				e.checkResolution(frameChan, scan)
+				e.compareFingerprint(frameChan, scan)
+				e.detectAirLeak(frameChan, scan)
+				e.trackBakeOut(frameChan, scan)
+				e.switchGains(scan)
+				e.autoRange(frameChan, scan)
+				scansCompleted.Add(1)
+				e.totalPressure = scan.TotalPressure
+				e.countRunScan(scan)
+				pipe.push(scan)
+			case <-heartbeat:
+				e.reportStatus(frameChan, e.heartbeatStatus(true))
+			case req := <-e.loopChan:
+				req.errChan <- req.fn()
+			case a := <-e.eventChan:
+				e.emitEvent(frameChan, a)
 			case <-e.quitChan:
 				return
+			case <-e.stopping:
+				return
 			}
 		}
 	}()
-	return frameChan, nil
+	return out, nil
+}
+
+// newDatasource returns the datasource of the config, not connected yet. The plugin, the self-test and the benchmark
+// all start from it
+func newDatasource(config *cfg.Config) *MksRgaDatasource {
+	return &MksRgaDatasource{
+		quitChan:  make(chan struct{}),
+		stopping:  make(chan struct{}),
+		loopChan:  make(chan *loopReq),
+		eventChan: make(chan *Annotation, eventQueueSize),
+		config:    config,
+		zeroed:    make(map[string]bool),
+	}
+}
+
+// pollInterval returns the configured polling interval, at least minPolInterval
+func (e *MksRgaDatasource) pollInterval() time.Duration {
+	if e.config.PollingInterval == 0 || time.Duration(e.config.PollingInterval)*time.Second < minPolInterval {
+		return minPolInterval
+	}
+	return time.Duration(e.config.PollingInterval) * time.Second
 }
 
 // Implements the Datasource interface funciton StopRecord
@@ -213,48 +487,281 @@ func (e *MksRgaDatasource) StopRecord() error {
 	if ok := atomic.CompareAndSwapInt32(&e.recording, 1, 0); !ok {
 		return ErrAlreadyStoppedRecording
 	}
-	e.quitChan <- struct{}{}
+	// the recording may be returning on an error meanwhile, no longer reading quitChan
+	select {
+	case e.quitChan <- struct{}{}:
+	case <-e.recordingDone():
+	}
+	e.saveState()
+	e.annotate("Recording stopped", "", "recording")
 	return nil
 }
 
 // Implements the Datasource interface funciton Stop
 func (e *MksRgaDatasource) Stop() error {
-	close(e.quitChan)
-	e.Wait()
+	e.stopOnce.Do(e.shutdown)
 	return nil
 }
 
 // ConnectToRGA establishes a conncetion with the RGA
 func ConnectToRGA(rgaServer string) (*mks.RGAConnection, error) {
-	c, err := net.Dial("tcp", rgaServer)
+	conn, err := mks.Dial(rgaServer)
 	if err != nil {
 		return nil, err
 	}
-	cAssert, ok := c.(*net.TCPConn)
-	if !ok {
-		return nil, errors.ErrInvalidType
-	}
-	return &mks.RGAConnection{cAssert}, nil
+	conn.Observe(observeRead)
+	return conn, nil
 }
 
 func main() {
+	initConfig := flag.Bool("init-config", false, "write a commented default config file and exit")
+	configOut := flag.String("config-out", "", "where --init-config writes the config. Defaults to the expected config path, - for stdout")
+	discoverAddr := flag.String("rga-addr", "", "RGA address queried by --init-config to fill in discovered values")
+	runSelfTest := flag.Bool("selftest", false, "run one short scan to validate the setup, report every step and exit")
+	selfTestInflux := flag.Bool("selftest-influx", false, "also write one point to Influx during --selftest")
+	runBenchmark := flag.Bool("benchmark", false, "time scans of the --benchmark-* settings against the RGA or simulator at RGAAddr, report scan and reading rates and the parsing overhead, and exit")
+	benchmarkScans := flag.Int("benchmark-scans", 10, "scans timed per setting by --benchmark")
+	benchmarkMasses := flag.String("benchmark-masses", "1-100", "mass range scanned by --benchmark")
+	benchmarkAccuracy := flag.String("benchmark-accuracy", "5", "comma separated accuracy codes benchmarked by --benchmark")
+	benchmarkPPP := flag.String("benchmark-ppp", "0", "comma separated points per peak benchmarked by --benchmark, 0 for a barchart")
+	benchmarkJSON := flag.Bool("benchmark-json", false, "print one JSON object per --benchmark setting instead of a table")
+	printSchema := flag.Bool("print-schema", false, "print the JSON Schema of the frame payloads and exit")
+	discoverNet := flag.String("discover", "", "probe an IPv4 network, e.g. 192.168.0.0/24, for RGA controllers, list them and exit")
+	discoverPort := flag.Int("discover-port", mks.DefaultPort, "TCP port probed by --discover")
+	replayFile := flag.String("replay", "", "push the scans of a capture file (.db, .sqlite, .jsonl, .jsonl.gz or .parquet) through the processors to the configured sinks and exit")
+	replaySpeed := flag.Float64("replay-speed", 1, "speed of --replay relative to the recording, 0 for as fast as possible")
+	brokerAddr := flag.String("broker", "", "share a single connection to the RGA with the clients of this address, e.g. :10015, instead of running as a plugin")
+	brokerLease := flag.Int("broker-lease", 60, "[s] a client controlling the sensor through --broker loses control after this long without a command, 0 never")
+	flag.Parse()
+	if *printSchema {
+		fmt.Print(frameSchemaJSON)
+		return
+	}
+	if *discoverNet != "" {
+		if err := printDiscovered(os.Stdout, *discoverNet, *discoverPort); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *initConfig {
+		if err := writeDefaultConfig(*configOut, *discoverAddr); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
 	config, err := cfg.InitConfig()
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	conn, err := ConnectToRGA(config.RGAAddr)
+	setLogPrefix(config.RigID)
+	if *runSelfTest {
+		if err := selfTest(config, os.Stdout, *selfTestInflux); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if *runBenchmark {
+		opts, err := parseBenchmarkOptions(*benchmarkScans, *benchmarkMasses, *benchmarkAccuracy, *benchmarkPPP, *benchmarkJSON)
+		if err == nil {
+			err = benchmark(config, os.Stdout, opts)
+		}
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	setMemoryLimit(config.MemoryLimit)
+	if config.DebugAddr != "" {
+		startDebugServer(config.DebugAddr)
+	}
+	impl := newDatasource(config)
+	impl.limiter, err = newRateLimiter(config)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if config.StrictParsing && config.ParseQuarantine != "" {
+		f, err := os.OpenFile(config.ParseQuarantine, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		impl.quarantine = f
+	}
+	if config.RejectLog != nil {
+		if impl.rejects, err = newRejectLog(config.RejectLog); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	if config.Clock != nil {
+		if impl.clock, err = newClock(config.Clock); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	if *brokerAddr != "" {
+		if err := impl.runBroker(*brokerAddr, time.Duration(*brokerLease)*time.Second); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	// a replay never talks to the sensor
+	if !config.ConnectLazily && *replayFile == "" {
+		impl.connection, err = impl.connect()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	impl.sinks, err = newSinks(config)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	impl := &MksRgaDatasource{quitChan: make(chan struct{}), connection: conn, config: config}
-	if config.Influx {
-		if config.InfluxURL == "" || config.InfuxAPIToken == "" {
-			log.Println("Influx URL or API Token config parameters cannot be blank")
+	if impl.routes, err = newRoutingTable(config.Routes, config, impl.sinks); err != nil {
+		log.Println(err)
+		return
+	}
+	// a replay must not drop scans, it waits for the sinks instead
+	impl.sinkQueues = newSinkQueues(config.SinkQueues, impl.sinks, *replayFile != "", impl.rejects)
+	impl.publishQueueDepths()
+	impl.annotators = newAnnotators(config)
+	for _, s := range impl.sinks {
+		if src, ok := s.(EventSource); ok {
+			src.SetEventHandler(impl.raiseEvent)
 		}
-		impl.client = influx.NewClientWithOptions(config.InfluxURL, config.InfuxAPIToken, influx.DefaultOptions().SetTLSConfig(&tls.Config{InsecureSkipVerify: config.InfluxSkipTLS}))
 	}
+	if err := impl.validateDigitalMappings(); err != nil {
+		log.Println(err)
+		return
+	}
+	impl.alarmHandlers = append(impl.alarmHandlers, impl.driveAlarmOutputs, impl.countRunAlarm, impl.writeAlarm)
+	if err := validateStartCheckOverrides(config.StartCheckOverrides); err != nil {
+		log.Println(err)
+		return
+	}
+	if err := validateProxy(config.Proxy); err != nil {
+		log.Println(err)
+		return
+	}
+	if err := validateResolutionMonitor(config.ResolutionMonitor); err != nil {
+		log.Println(err)
+		return
+	}
+	if config.ResolutionMonitor != nil {
+		impl.resolution = newResolutionTracker(config.ResolutionMonitor)
+	}
+	if err := validateFingerprint(config.Fingerprint); err != nil {
+		log.Println(err)
+		return
+	}
+	if err := validateAirLeakDetector(config.AirLeakDetector); err != nil {
+		log.Println(err)
+		return
+	}
+	if err := validateBakeOut(config.BakeOut); err != nil {
+		log.Println(err)
+		return
+	}
+	if err := validateDetectorMerges(config.DetectorMerges, config.Measurements); err != nil {
+		log.Println(err)
+		return
+	}
+	if err := validateIdlePolicy(config.IdlePolicy); err != nil {
+		log.Println(err)
+		return
+	}
+	if err := validateMinFirmware(config.MinFirmware); err != nil {
+		log.Println(err)
+		return
+	}
+	if config.Fingerprint != nil {
+		impl.fingerprint, err = loadReferenceSpectrum(config.Fingerprint.File)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	if err := validateFrameEncoding(config.FrameEncoding); err != nil {
+		log.Println(err)
+		return
+	}
+	calibration, err := calibrationFactors(config.CalibrationFactors)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	impl.calibration = calibration
+	if len(config.DetectorMerges) > 0 {
+		impl.processors = append(impl.processors, impl.mergeDetectors)
+	}
+	if len(impl.calibration) > 0 {
+		impl.processors = append(impl.processors, impl.calibrate)
+	}
+	if len(config.Transforms) > 0 {
+		chain, err := newTransformChain(config.Transforms)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		impl.processors = append(impl.processors, chain.transform)
+	}
+	if len(config.IncludeMasses) > 0 || len(config.ExcludeMasses) > 0 {
+		masses, err := newMassFilter(config.IncludeMasses, config.ExcludeMasses)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		impl.processors = append(impl.processors, masses.filter)
+	}
+	if len(config.AudioAlarms) > 0 {
+		impl.alarmHandlers = append(impl.alarmHandlers, impl.driveAudio)
+	}
+	impl.degasWindow, err = parseDegasWindow(config.DegasWindow)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if *replayFile != "" {
+		if err := impl.replay(*replayFile, *replaySpeed); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if state, err := loadState(config.StateFile); err == nil {
+		impl.lastDegas, impl.filamentHours = state.LastDegas, state.FilamentHours
+	}
+	if impl.lastDegas.IsZero() {
+		// the degas interval starts counting on first use
+		impl.lastDegas = time.Now()
+	}
+	if config.ResumeRecording {
+		if err := impl.resumeRecording(); err != nil {
+			log.Printf("Could not resume recording: %v", err)
+		}
+	}
+	if config.HealthAddr != "" {
+		impl.serveHealth(config.HealthAddr)
+	}
+	if config.AnnotationsAddr != "" {
+		impl.serveAnnotations(config.AnnotationsAddr)
+	}
+	if config.APIAddr != "" && config.APIToken == "" {
+		log.Println("APIAddr is set without an APIToken, the API isn't served")
+	} else if config.APIAddr != "" {
+		impl.serveAPI(config.APIAddr)
+	}
+	if config.Heartbeat > 0 {
+		go impl.runHeartbeat()
+	}
+	impl.handleSignals()
 	impl.SetPluginVersion(pluginVersion)              // set the plugin version before serving
 	impl.SetVersionConstraints(laniVersionConstraint) // set required laniakea version before serving
 	plugin.Serve(&plugin.ServeConfig{
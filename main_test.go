@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+// fakeSensor serves the sensor protocol on a local port until the test ends. Every command is answered OK, unless
+// other lines were set with respond for its name
+type fakeSensor struct {
+	address   string
+	mu        sync.Mutex
+	l         net.Listener
+	responses map[string][]string
+	downAfter string // command after which the sensor goes down
+}
+
+// newFakeSensor serves a sensor in use until the test ends
+func newFakeSensor(t *testing.T) *fakeSensor {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSensor{address: l.Addr().String(), responses: map[string][]string{
+		"":             {"MKSRGA Multi", "Protocol_Revision 1.1", "Min_Compatibility 1.1"},
+		"SensorState":  {"SensorState OK", "State InUse", "UserApplication test", "UserVersion 1.0", "UserAddress 127.0.0.1"},
+		"EGains":       {"EGains OK", "  Index Gain Name", "  0 1 Faraday"},
+		"DetectorInfo": {"DetectorInfo OK", "  SourceIndex 0", "  Detector Factor Voltage", "  0 1.0 0"},
+	}}
+	s.serve(t, l)
+	return s
+}
+
+// addr returns the address the sensor listens on
+func (s *fakeSensor) addr() string {
+	return s.address
+}
+
+// up serves the sensor again on the same address after it went down
+func (s *fakeSensor) up(t *testing.T) {
+	t.Helper()
+	l, err := net.Listen("tcp", s.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.serve(t, l)
+}
+
+// serve accepts the connections of l until it is closed or the test ends
+func (s *fakeSensor) serve(t *testing.T, l net.Listener) {
+	s.mu.Lock()
+	s.l = l
+	s.mu.Unlock()
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.answer(conn)
+		}
+	}()
+}
+
+// respond answers the command with the given lines
+func (s *fakeSensor) respond(command string, lines ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[command] = lines
+}
+
+// goDown makes the sensor go down, closing its connections and no longer accepting any, once it answered the command
+func (s *fakeSensor) goDown(command string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.downAfter = command
+}
+
+// answer answers the commands of the connection
+func (s *fakeSensor) answer(conn net.Conn) {
+	defer conn.Close()
+	sc := bufio.NewScanner(conn)
+	sc.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.Index(data, []byte("\n\r")); i >= 0 {
+			return i + 2, data[:i], nil
+		}
+		return 0, nil, nil
+	})
+	for sc.Scan() {
+		command, _, _ := strings.Cut(strings.TrimSpace(sc.Text()), " ")
+		s.mu.Lock()
+		lines, ok := s.responses[command]
+		down := s.downAfter != "" && command == s.downAfter
+		s.mu.Unlock()
+		if !ok {
+			lines = []string{command + " OK"}
+		}
+		var m string
+		for _, l := range lines {
+			m += l + "\r\n"
+		}
+		if _, err := conn.Write([]byte(m + "\r\n\r\r")); err != nil {
+			return
+		}
+		if down {
+			s.mu.Lock()
+			s.downAfter = ""
+			s.l.Close()
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+// waitStopped waits for the recording to stop on its own
+func waitStopped(t *testing.T, e *MksRgaDatasource) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadInt32(&e.recording) == 1; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("recording still running")
+		}
+	}
+}
+
+// stopRecord calls StopRecord, failing the test if it blocks
+func stopRecord(t *testing.T, e *MksRgaDatasource) error {
+	t.Helper()
+	errChan := make(chan error, 1)
+	go func() { errChan <- e.StopRecord() }()
+	select {
+	case err := <-errChan:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("StopRecord blocked")
+		return nil
+	}
+}
+
+func TestRecordingFailed(t *testing.T) {
+	defer func(d time.Duration) { minPolInterval = d }(minPolInterval)
+	minPolInterval = 10 * time.Millisecond
+	s := newFakeSensor(t)
+	s.respond("ScanResume", "ScanResume ERROR", "  Number 200", "  Description Scan failed")
+	e := newDatasource(&cfg.Config{
+		RGAAddr:      s.addr(),
+		StateFile:    filepath.Join(t.TempDir(), "state.json"),
+		Measurements: []cfg.Measurement{{Name: "bar", StartMass: 1, EndMass: 50, FilterMode: "PeakCenter"}},
+	})
+	if _, err := e.StartRecord(); err != nil {
+		t.Fatalf("StartRecord() error = %v", err)
+	}
+	waitStopped(t, e)
+	if err := stopRecord(t, e); err != ErrAlreadyStoppedRecording {
+		t.Errorf("StopRecord() after the recording failed = %v, want %v", err, ErrAlreadyStoppedRecording)
+	}
+
+	// the scans now start, the recording runs until stopped
+	s.respond("ScanResume", "ScanResume OK")
+	if _, err := e.StartRecord(); err != nil {
+		t.Fatalf("StartRecord() after the recording failed = %v", err)
+	}
+	if err := stopRecord(t, e); err != nil {
+		t.Errorf("StopRecord() = %v", err)
+	}
+}
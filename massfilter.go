@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// massFilter leaves the readings of uninteresting masses out of the published scans, without changing what the sensor
+// scans. Fractional analog positions count as the nearest integer mass
+type massFilter struct {
+	include map[int]bool // nil to keep every mass not excluded
+	exclude map[int]bool
+}
+
+// newMassFilter returns the filter of the masses. A mass can't be both included and excluded
+func newMassFilter(include, exclude []int) (*massFilter, error) {
+	f := &massFilter{exclude: make(map[int]bool)}
+	for _, m := range exclude {
+		f.exclude[m] = true
+	}
+	if len(include) > 0 {
+		f.include = make(map[int]bool)
+	}
+	for _, m := range include {
+		if f.exclude[m] {
+			return nil, fmt.Errorf("Mass %d is both included and excluded", m)
+		}
+		f.include[m] = true
+	}
+	return f, nil
+}
+
+// filter removes the readings of the masses not included or excluded. The scan is kept even if no reading is left, its
+// total pressure and sensor state still being published
+func (f *massFilter) filter(scan *Scan) *Scan {
+	readings := make([]Payload, 0, len(scan.Readings))
+	for _, r := range scan.Readings {
+		m := int(math.Round(r.Mass))
+		if f.exclude[m] || (f.include != nil && !f.include[m]) {
+			continue
+		}
+		readings = append(readings, r)
+	}
+	scan.Readings = readings
+	return scan
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMassFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []int
+		exclude []int
+		masses  []float64
+		kept    []float64
+		err     bool
+	}{
+		{name: "no filter", masses: []float64{1, 2, 28}, kept: []float64{1, 2, 28}},
+		{name: "exclude", exclude: []int{2, 28}, masses: []float64{1, 2, 18, 28}, kept: []float64{1, 18}},
+		{name: "include", include: []int{18, 44}, masses: []float64{1, 18, 28, 44}, kept: []float64{18, 44}},
+		{name: "include and exclude", include: []int{18, 28}, exclude: []int{2}, masses: []float64{2, 18, 28, 32}, kept: []float64{18, 28}},
+		{name: "analog positions", exclude: []int{28}, masses: []float64{27.4, 27.5, 28.25, 28.6}, kept: []float64{27.4, 28.6}},
+		{name: "nothing left", include: []int{40}, masses: []float64{1, 2}, kept: []float64{}},
+		{name: "conflict", include: []int{28}, exclude: []int{28}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newMassFilter(tt.include, tt.exclude)
+			if (err != nil) != tt.err {
+				t.Fatalf("newMassFilter() error = %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			scan := &Scan{TotalPressure: 1e-6}
+			for _, m := range tt.masses {
+				scan.Readings = append(scan.Readings, Payload{Mass: m})
+			}
+			scan = f.filter(scan)
+			kept := []float64{}
+			for _, r := range scan.Readings {
+				kept = append(kept, r.Mass)
+			}
+			if !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("filter() kept %v, want %v", kept, tt.kept)
+			}
+			if scan.TotalPressure != 1e-6 {
+				t.Errorf("filter() changed the total pressure to %g", scan.TotalPressure)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+var (
+	measurementTypeBarchart = "Barchart"
+	measurementTypeAnalog   = "Analog"
+	editTimeout             = 2 * minPolInterval
+)
+
+// addMeasurement adds the given measurement to the sensor and to the scan
+func addMeasurement(session *mks.Session, m cfg.Measurement) error {
+	var b *mks.MeasurementBuilder
+	switch m.Type {
+	case measurementTypeBarchart, "":
+		b = mks.NewBarchart(m.Name).Range(m.StartMass, m.EndMass).Filter(mks.RGAFilterMode(m.FilterMode))
+	case measurementTypeAnalog:
+		b = mks.NewAnalog(m.Name).Range(m.StartMass, m.EndMass).PointsPerPeak(m.PointsPerPeak)
+	default:
+		return fmt.Errorf("Unknown measurement type %s for measurement %s", m.Type, m.Name)
+	}
+	_, err := session.Add(b.Accuracy(m.Accuracy).EGain(m.EGainIndex).Source(m.SourceIndex).Detector(m.DetectorIndex))
+	if err != nil {
+		return fmt.Errorf("Could not add %s: %v", m.Name, err)
+	}
+	_, err = session.ScanAdd(m.Name)
+	if err != nil {
+		return fmt.Errorf("Could not add %s to scan: %v", m.Name, err)
+	}
+	if m.RolloverCorrection {
+		if err := session.SetRolloverCorrection(m.Name, true); err != nil {
+			return fmt.Errorf("Could not enable rollover correction for %s: %v", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// loopReq is a function run by the recording goroutine between scans
+type loopReq struct {
+	fn      func() error
+	errChan chan error
+}
+
+// inLoop runs fn in the recording goroutine between scans, so that it never interleaves with the responses of a scan
+func (e *MksRgaDatasource) inLoop(fn func() error) error {
+	if atomic.LoadInt32(&e.recording) != 1 {
+		return ErrNotRecording
+	}
+	req := &loopReq{fn: fn, errChan: make(chan error, 1)}
+	select {
+	case e.loopChan <- req:
+	case <-time.After(editTimeout):
+		return ErrEditTimeout
+	}
+	return <-req.errChan
+}
+
+// EditMeasurement queues edits to a measurement of the running scan. Edits are applied between scans
+func (e *MksRgaDatasource) EditMeasurement(name string, edits ...mks.MeasurementEdit) error {
+	return e.inLoop(func() error {
+		return e.applyMeasurementEdit(name, edits)
+	})
+}
+
+// applyMeasurementEdit applies the requested edits one by one and keeps track of the resulting mass range
+func (e *MksRgaDatasource) applyMeasurementEdit(name string, edits []mks.MeasurementEdit) error {
+	idx := -1
+	for i, m := range e.measurements {
+		if m.Name == name {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return ErrUnknownMeasurement
+	}
+	for _, edit := range edits {
+		err := e.connection.EditMeasurement(name, edit)
+		if err != nil {
+			return err
+		}
+		switch edit.Edit {
+		case mks.RGA_EDIT_START_MASS:
+			e.measurements[idx].StartMass = edit.Value
+		case mks.RGA_EDIT_END_MASS:
+			e.measurements[idx].EndMass = edit.Value
+		case mks.RGA_EDIT_ACCURACY:
+			e.measurements[idx].Accuracy = edit.Value
+		case mks.RGA_EDIT_EGAIN:
+			e.measurements[idx].EGainIndex = edit.Value
+		case mks.RGA_EDIT_DETECTOR:
+			e.measurements[idx].DetectorIndex = edit.Value
+		}
+		log.Printf("Applied %s %d to %s", edit.Edit, edit.Value, name)
+		e.annotate("Measurement edited", fmt.Sprintf("%s %s %d", name, edit.Edit, edit.Value), "measurement")
+	}
+	e.saveState()
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+var (
+	mergeModeSwitch     = "switch"
+	mergeModeBlend      = "blend"
+	defaultBlendDecades = 1.0
+)
+
+// validateDetectorMerges checks that every merge combines two different configured measurements with a valid
+// crossover
+func validateDetectorMerges(merges []cfg.DetectorMerge, measurements []cfg.Measurement) error {
+	configured := make(map[string]bool, len(measurements))
+	for _, m := range measurements {
+		configured[m.Name] = true
+	}
+	for _, m := range merges {
+		if m.Name == "" {
+			return fmt.Errorf("Detector merge of %s and %s has no name", m.Faraday, m.Multiplier)
+		}
+		if !configured[m.Faraday] || !configured[m.Multiplier] || m.Faraday == m.Multiplier {
+			return fmt.Errorf("Detector merge %s needs two different configured measurements, got %s and %s", m.Name, m.Faraday, m.Multiplier)
+		}
+		if configured[m.Name] && m.Name != m.Faraday && m.Name != m.Multiplier {
+			return fmt.Errorf("Detector merge %s has the name of another measurement", m.Name)
+		}
+		switch m.Mode {
+		case "", mergeModeSwitch:
+		case mergeModeBlend:
+			if m.Crossover <= 0 {
+				return fmt.Errorf("Detector merge %s blends around the crossover, which must be positive", m.Name)
+			}
+		default:
+			return fmt.Errorf("Unknown detector merge mode %s, expected switch or blend", m.Mode)
+		}
+		if m.Crossover < 0 || m.BlendDecades < 0 {
+			return fmt.Errorf("Detector merge %s crossover and blend decades cannot be negative", m.Name)
+		}
+	}
+	return nil
+}
+
+// mergeDetectors replaces the readings of the measurements of every DetectorMerges entry with the readings of the
+// merged measurement. It runs before calibration, the crossover applies to uncalibrated readings
+func (e *MksRgaDatasource) mergeDetectors(scan *Scan) *Scan {
+	for _, m := range e.config.DetectorMerges {
+		scan.Readings = mergeReadings(scan.Readings, m)
+	}
+	return scan
+}
+
+// mergeReadings merges the Faraday and multiplier readings into one reading per mass, in mass order, where the first
+// of them was. A mass read by a single detector keeps its reading
+func mergeReadings(readings []Payload, m cfg.DetectorMerge) []Payload {
+	faraday := make(map[string]Payload)
+	multiplier := make(map[string]Payload)
+	var masses []float64
+	out := make([]Payload, 0, len(readings))
+	at := -1
+	for _, r := range readings {
+		var dst map[string]Payload
+		switch r.Measurement {
+		case m.Faraday:
+			dst = faraday
+		case m.Multiplier:
+			dst = multiplier
+		default:
+			out = append(out, r)
+			continue
+		}
+		if at < 0 {
+			at = len(out)
+		}
+		k := formatMass(r.Mass)
+		if _, ok := faraday[k]; !ok {
+			if _, ok := multiplier[k]; !ok {
+				masses = append(masses, r.Mass)
+			}
+		}
+		dst[k] = r
+	}
+	if at < 0 {
+		return readings
+	}
+	sort.Float64s(masses)
+	merged := make([]Payload, 0, len(masses))
+	for _, mass := range masses {
+		k := formatMass(mass)
+		f, hasFaraday := faraday[k]
+		x, hasMultiplier := multiplier[k]
+		var r Payload
+		switch {
+		case !hasMultiplier:
+			r = f
+		case !hasFaraday:
+			r = x
+		default:
+			r = crossover(f, x, m)
+		}
+		r.Measurement = m.Name
+		merged = append(merged, r)
+	}
+	return slices.Insert(out, at, merged...)
+}
+
+// crossover returns the merged reading of a mass read by both detectors. A saturated multiplier reading is never
+// used. Otherwise switch uses the multiplier below Crossover and the Faraday above, while blend weights them on a log
+// scale over BlendDecades around Crossover. Without a Crossover the multiplier is used until it saturates
+func crossover(f, x Payload, m cfg.DetectorMerge) Payload {
+	if hasFlag(x.Flags, flagSaturated) {
+		return f
+	}
+	if m.Crossover <= 0 {
+		return x
+	}
+	if m.Mode != mergeModeBlend {
+		if x.Value >= m.Crossover {
+			return f
+		}
+		return x
+	}
+	decades := m.BlendDecades
+	if decades <= 0 {
+		decades = defaultBlendDecades
+	}
+	lo := m.Crossover / math.Pow(10, decades/2)
+	hi := m.Crossover * math.Pow(10, decades/2)
+	switch {
+	case x.Value <= lo:
+		return x
+	case x.Value >= hi:
+		return f
+	}
+	w := math.Log10(x.Value/lo) / decades
+	r := x
+	r.Value = (1-w)*x.Value + w*f.Value
+	r.Flags = slices.Clone(x.Flags)
+	for _, flag := range f.Flags {
+		r.Flags = addFlag(r.Flags, flag)
+	}
+	return r
+}
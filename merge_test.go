@@ -0,0 +1,119 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+func TestValidateDetectorMerges(t *testing.T) {
+	measurements := []cfg.Measurement{{Name: "faraday"}, {Name: "multiplier"}, {Name: "bar"}}
+	tests := []struct {
+		name  string
+		merge cfg.DetectorMerge
+		err   bool
+	}{
+		{name: "switch", merge: cfg.DetectorMerge{Name: "merged", Faraday: "faraday", Multiplier: "multiplier", Crossover: 1e-6}},
+		{name: "blend", merge: cfg.DetectorMerge{Name: "merged", Faraday: "faraday", Multiplier: "multiplier", Mode: "blend", Crossover: 1e-6}},
+		{name: "named after a detector", merge: cfg.DetectorMerge{Name: "faraday", Faraday: "faraday", Multiplier: "multiplier"}},
+		{name: "no name", merge: cfg.DetectorMerge{Faraday: "faraday", Multiplier: "multiplier"}, err: true},
+		{name: "unknown measurement", merge: cfg.DetectorMerge{Name: "merged", Faraday: "faraday", Multiplier: "analog"}, err: true},
+		{name: "same measurement", merge: cfg.DetectorMerge{Name: "merged", Faraday: "faraday", Multiplier: "faraday"}, err: true},
+		{name: "name taken", merge: cfg.DetectorMerge{Name: "bar", Faraday: "faraday", Multiplier: "multiplier"}, err: true},
+		{name: "blend without crossover", merge: cfg.DetectorMerge{Name: "merged", Faraday: "faraday", Multiplier: "multiplier", Mode: "blend"}, err: true},
+		{name: "unknown mode", merge: cfg.DetectorMerge{Name: "merged", Faraday: "faraday", Multiplier: "multiplier", Mode: "average"}, err: true},
+		{name: "negative decades", merge: cfg.DetectorMerge{Name: "merged", Faraday: "faraday", Multiplier: "multiplier", BlendDecades: -1}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDetectorMerges([]cfg.DetectorMerge{tt.merge}, measurements)
+			if (err != nil) != tt.err {
+				t.Errorf("validateDetectorMerges() error = %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMergeReadings(t *testing.T) {
+	m := cfg.DetectorMerge{Name: "merged", Faraday: "faraday", Multiplier: "multiplier", Crossover: 1e-6}
+	tests := []struct {
+		name     string
+		readings []Payload
+		merged   []Payload
+	}{
+		{
+			name:     "nothing to merge",
+			readings: []Payload{{Measurement: "bar", Mass: 1, Value: 1}},
+			merged:   []Payload{{Measurement: "bar", Mass: 1, Value: 1}},
+		},
+		{
+			name: "switch at the crossover",
+			readings: []Payload{
+				{Measurement: "bar", Mass: 1, Value: 1},
+				{Measurement: "faraday", Mass: 28, Value: 2e-6},
+				{Measurement: "faraday", Mass: 2, Value: 3e-9},
+				{Measurement: "multiplier", Mass: 28, Value: 2.1e-6},
+				{Measurement: "multiplier", Mass: 2, Value: 1e-9},
+				{Measurement: "bar", Mass: 40, Value: 4},
+			},
+			merged: []Payload{
+				{Measurement: "bar", Mass: 1, Value: 1},
+				{Measurement: "merged", Mass: 2, Value: 1e-9},
+				{Measurement: "merged", Mass: 28, Value: 2e-6},
+				{Measurement: "bar", Mass: 40, Value: 4},
+			},
+		},
+		{
+			name: "single detector",
+			readings: []Payload{
+				{Measurement: "multiplier", Mass: 44, Value: 5e-10},
+				{Measurement: "faraday", Mass: 18, Value: 3e-7},
+			},
+			merged: []Payload{
+				{Measurement: "merged", Mass: 18, Value: 3e-7},
+				{Measurement: "merged", Mass: 44, Value: 5e-10},
+			},
+		},
+		{
+			name: "saturated multiplier",
+			readings: []Payload{
+				{Measurement: "faraday", Mass: 18, Value: 3e-7},
+				{Measurement: "multiplier", Mass: 18, Value: 1e-7, Flags: []string{flagSaturated}},
+			},
+			merged: []Payload{{Measurement: "merged", Mass: 18, Value: 3e-7}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeReadings(tt.readings, m); !reflect.DeepEqual(got, tt.merged) {
+				t.Errorf("mergeReadings() = %+v, want %+v", got, tt.merged)
+			}
+		})
+	}
+}
+
+func TestCrossoverBlend(t *testing.T) {
+	m := cfg.DetectorMerge{Mode: "blend", Crossover: 1e-6, BlendDecades: 2}
+	tests := []struct {
+		name       string
+		multiplier float64
+		faraday    float64
+		want       float64
+	}{
+		{name: "below the band", multiplier: 1e-8, faraday: 5e-8, want: 1e-8},
+		{name: "at the bottom", multiplier: 1e-7, faraday: 5e-7, want: 1e-7},
+		{name: "at the crossover", multiplier: 1e-6, faraday: 2e-6, want: 1.5e-6},
+		{name: "at the top", multiplier: 1e-5, faraday: 2e-5, want: 2e-5},
+		{name: "above the band", multiplier: 1e-4, faraday: 3e-4, want: 3e-4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := crossover(Payload{Value: tt.faraday}, Payload{Value: tt.multiplier}, m)
+			if math.Abs(r.Value-tt.want) > 1e-9*tt.want {
+				t.Errorf("crossover(%g, %g) = %g, want %g", tt.faraday, tt.multiplier, r.Value, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package mks
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+var brokerWriteTimeout = 5 * time.Second
+
+// Broker shares a single connection to a controller between several clients, for controllers limiting the number of
+// concurrent TCP clients. Clients connect to the broker as they would to the controller: commands are forwarded one at
+// a time and their response is returned to the client that sent them, while asynchronous messages go to every client.
+// A successful Control leases the sensor to the client until it sends Release, disconnects or, if the lease duration
+// is positive, sends no command for that long. Meanwhile the commands of other clients that change the sensor are
+// refused with an ERROR response, only queries are forwarded. Every client shares the sensor selected upstream
+type Broker struct {
+	upstream *RGAConnection
+	lease    time.Duration
+	ack      []byte     // answer of the controller to InitMsg, replayed to every client
+	cmdMu    sync.Mutex // serializes the commands sent upstream
+	mu       sync.Mutex // guards the fields below
+	clients  map[*brokerClient]struct{}
+	holder   *brokerClient
+	lastUsed time.Time // last command of the holder
+	inflight *brokerCommand
+	done     chan struct{} // closed once the upstream connection drops
+	err      error
+}
+
+// brokerClient is a client connected to the broker
+type brokerClient struct {
+	conn net.Conn
+	mu   sync.Mutex // serializes responses and asynchronous messages
+}
+
+// brokerCommand is a command awaiting its response from the controller
+type brokerCommand struct {
+	name string
+	resp chan []byte
+}
+
+// NewBroker initializes the connection to the controller and returns a broker sharing it. The broker owns the
+// connection from then on: it reads it directly, so observers and strict mode don't apply, but commands are still
+// sent through its rate limiter
+func NewBroker(upstream *RGAConnection, lease time.Duration) (*Broker, error) {
+	b := &Broker{upstream: upstream, lease: lease, clients: make(map[*brokerClient]struct{}), done: make(chan struct{})}
+	go b.read()
+	ack, err := b.roundTrip(ACKMsg, []byte(commandSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("Could not initialize the connection: %v", err)
+	}
+	b.ack = ack
+	return b, nil
+}
+
+// Serve accepts clients until the listener or the upstream connection closes. The listener is closed on return
+func (b *Broker) Serve(ln net.Listener) error {
+	go func() {
+		<-b.done
+		ln.Close()
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-b.done:
+				return b.err
+			default:
+			}
+			return err
+		}
+		go b.serveClient(conn)
+	}
+}
+
+// Close closes the upstream connection and disconnects every client
+func (b *Broker) Close() error {
+	err := b.upstream.Close()
+	<-b.done
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.clients {
+		c.conn.Close()
+	}
+	return err
+}
+
+// read dispatches the messages of the controller: the response to the command in flight to its client, any other
+// message to every client
+func (b *Broker) read() {
+	sc := bufio.NewScanner(b.upstream.TCPConn)
+	sc.Buffer(make([]byte, BUFFER), BIG_BUFFER*16)
+	sc.Split(splitOn(commandEnd))
+	for sc.Scan() {
+		msg := append(bytes.Clone(sc.Bytes()), commandEnd...)
+		name := messageName(msg)
+		b.mu.Lock()
+		if b.inflight != nil && b.inflight.name == name {
+			b.inflight.resp <- msg
+			b.inflight = nil
+			b.mu.Unlock()
+			continue
+		}
+		clients := make([]*brokerClient, 0, len(b.clients))
+		for c := range b.clients {
+			clients = append(clients, c)
+		}
+		b.mu.Unlock()
+		for _, c := range clients {
+			c.write(msg)
+		}
+	}
+	b.err = sc.Err()
+	if b.err == nil {
+		b.err = io.EOF
+	}
+	close(b.done)
+}
+
+// roundTrip sends the command upstream and waits for its response, at most the timeout of the command
+func (b *Broker) roundTrip(name string, cmd []byte) ([]byte, error) {
+	b.cmdMu.Lock()
+	defer b.cmdMu.Unlock()
+	pending := &brokerCommand{name: name, resp: make(chan []byte, 1)}
+	b.mu.Lock()
+	b.inflight = pending
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.inflight = nil
+		b.mu.Unlock()
+	}()
+	if _, err := b.upstream.Write(cmd); err != nil {
+		return nil, err
+	}
+	timeout, ok := DefaultCommandTimeouts[name]
+	if !ok {
+		timeout = DefaultCommandTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case resp := <-pending.resp:
+		return resp, nil
+	case <-b.done:
+		return nil, b.err
+	case <-timer.C:
+		return nil, &ErrCommandTimeout{Command: name, After: timeout}
+	}
+}
+
+// serveClient forwards the commands of the client until it disconnects, releasing the sensor if it holds the lease
+func (b *Broker) serveClient(conn net.Conn) {
+	c := &brokerClient{conn: conn}
+	b.mu.Lock()
+	b.clients[c] = struct{}{}
+	b.mu.Unlock()
+	defer func() {
+		conn.Close()
+		b.mu.Lock()
+		delete(b.clients, c)
+		held := b.holder == c
+		if held {
+			b.holder = nil
+		}
+		b.mu.Unlock()
+		if held {
+			b.releaseUpstream(fmt.Sprintf("%s disconnected", conn.RemoteAddr()))
+		}
+	}()
+	sc := bufio.NewScanner(conn)
+	sc.Split(splitOn([]byte(commandSuffix)))
+	for sc.Scan() {
+		line := sc.Bytes()
+		fields := fieldRe.FindAllString(string(line), 1)
+		if len(fields) == 0 {
+			// InitMsg
+			if !c.write(b.ack) {
+				return
+			}
+			continue
+		}
+		name := fields[0]
+		if err := b.admit(c, name); err != nil {
+			if !c.write(brokerError(name, err)) {
+				return
+			}
+			continue
+		}
+		resp, err := b.roundTrip(name, append(bytes.Clone(line), commandSuffix...))
+		if err != nil {
+			log.Printf("Broker could not forward %s from %s: %v", name, conn.RemoteAddr(), err)
+			return
+		}
+		b.settle(c, name, resp)
+		if !c.write(resp) {
+			return
+		}
+	}
+}
+
+// admit returns an error if the command changes the sensor while another client holds the lease. An expired lease
+// is released first
+func (b *Broker) admit(c *brokerClient, name string) error {
+	if CommandClass(name) == CommandClassQuery {
+		return nil
+	}
+	b.mu.Lock()
+	holder := b.holder
+	switch {
+	case holder == nil:
+	case holder == c:
+		b.lastUsed = time.Now()
+	case b.lease <= 0 || time.Since(b.lastUsed) < b.lease:
+		b.mu.Unlock()
+		return fmt.Errorf("sensor leased to %s", holder.conn.RemoteAddr())
+	default:
+		b.holder = nil
+	}
+	b.mu.Unlock()
+	if holder != nil && holder != c {
+		b.releaseUpstream(fmt.Sprintf("lease of %s expired", holder.conn.RemoteAddr()))
+	}
+	return nil
+}
+
+// settle grants the lease on a successful Control and ends it on Release
+func (b *Broker) settle(c *brokerClient, name string, resp []byte) {
+	ok := bytes.HasPrefix(resp, []byte(name+" "+string(RGA_OK)))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case name == control && ok:
+		b.holder, b.lastUsed = c, time.Now()
+	case name == release && b.holder == c:
+		b.holder = nil
+	}
+}
+
+// releaseUpstream releases control of the sensor on behalf of a client that left or whose lease expired
+func (b *Broker) releaseUpstream(why string) {
+	select {
+	case <-b.done:
+		// the controller releases the sensor of a closed connection
+		return
+	default:
+	}
+	if _, err := b.roundTrip(release, []byte(release+commandSuffix)); err != nil {
+		log.Printf("Broker could not release the sensor after %s: %v", why, err)
+		return
+	}
+	log.Printf("Broker released the sensor: %s", why)
+}
+
+// write sends the message to the client. It returns false and disconnects the client if it can't keep up
+func (c *brokerClient) write(msg []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(brokerWriteTimeout))
+	if _, err := c.conn.Write(msg); err != nil {
+		c.conn.Close()
+		return false
+	}
+	return true
+}
+
+// brokerError returns an ERROR response to the command, formatted like those of the controller
+func brokerError(name string, err error) []byte {
+	return []byte(fmt.Sprintf("%s %s\r\n  Number 0\r\n  Description Broker: %v\r\n\r\r", name, RGA_ERROR, err))
+}
+
+// messageName returns the first token of a message
+func messageName(msg []byte) string {
+	fields := fieldRe.FindAllString(string(bytes.SplitN(msg, delim, 2)[0]), 1)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// splitOn returns a bufio.SplitFunc splitting on sep
+func splitOn(sep []byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.Index(data, sep); i >= 0 {
+			return i + len(sep), data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
@@ -0,0 +1,153 @@
+package mks
+
+import (
+	"fmt"
+)
+
+const (
+	minAccuracy = 0
+	maxAccuracy = 8
+)
+
+// MeasurementBuilder builds a measurement and validates its parameters before adding it to the sensor
+type MeasurementBuilder struct {
+	command       string
+	name          string
+	startMass     int
+	endMass       int
+	mass          float64
+	filterMode    RGAFilterMode
+	pointsPerPeak int
+	accuracy      int
+	eGainIndex    int
+	sourceIndex   int
+	detectorIndex int
+}
+
+// NewBarchart returns a builder for a barchart measurement. Defaults to 1-200 AMU, PeakCenter, accuracy 5
+func NewBarchart(Name string) *MeasurementBuilder {
+	return &MeasurementBuilder{command: addBarchart, name: Name, startMass: 1, endMass: 200, filterMode: RGA_PeakCenter, accuracy: 5}
+}
+
+// NewAnalog returns a builder for an analog measurement. Defaults to 1-200 AMU, 32 points per peak, accuracy 5
+func NewAnalog(Name string) *MeasurementBuilder {
+	return &MeasurementBuilder{command: addAnalog, name: Name, startMass: 1, endMass: 200, pointsPerPeak: 32, accuracy: 5}
+}
+
+// NewPeakJump returns a builder for a peak jump measurement. Masses are added afterwards using MeasurementAddMass
+func NewPeakJump(Name string) *MeasurementBuilder {
+	return &MeasurementBuilder{command: addPeakJump, name: Name, filterMode: RGA_PeakCenter, accuracy: 5}
+}
+
+// NewSinglePeak returns a builder for a single peak measurement of the given mass
+func NewSinglePeak(Name string, Mass float64) *MeasurementBuilder {
+	return &MeasurementBuilder{command: addSinglePeak, name: Name, mass: Mass, accuracy: 5}
+}
+
+// Name returns the name of the measurement
+func (b *MeasurementBuilder) Name() string {
+	return b.name
+}
+
+// Range sets the start and end mass of an analog or barchart measurement
+func (b *MeasurementBuilder) Range(StartMass, EndMass int) *MeasurementBuilder {
+	b.startMass = StartMass
+	b.endMass = EndMass
+	return b
+}
+
+// Mass sets the mass of a single peak measurement
+func (b *MeasurementBuilder) Mass(Mass float64) *MeasurementBuilder {
+	b.mass = Mass
+	return b
+}
+
+// Filter sets the filter mode of a barchart or peak jump measurement
+func (b *MeasurementBuilder) Filter(FilterMode RGAFilterMode) *MeasurementBuilder {
+	b.filterMode = FilterMode
+	return b
+}
+
+// PointsPerPeak sets the number of points per peak of an analog measurement
+func (b *MeasurementBuilder) PointsPerPeak(PointsPerPeak int) *MeasurementBuilder {
+	b.pointsPerPeak = PointsPerPeak
+	return b
+}
+
+// Accuracy sets the accuracy code (0-8) of the measurement
+func (b *MeasurementBuilder) Accuracy(Accuracy int) *MeasurementBuilder {
+	b.accuracy = Accuracy
+	return b
+}
+
+// EGain sets the electronic gain index of the measurement
+func (b *MeasurementBuilder) EGain(EGainIndex int) *MeasurementBuilder {
+	b.eGainIndex = EGainIndex
+	return b
+}
+
+// Source sets the source parameters index of the measurement
+func (b *MeasurementBuilder) Source(SourceIndex int) *MeasurementBuilder {
+	b.sourceIndex = SourceIndex
+	return b
+}
+
+// Detector sets the detector parameters index of the measurement
+func (b *MeasurementBuilder) Detector(DetectorIndex int) *MeasurementBuilder {
+	b.detectorIndex = DetectorIndex
+	return b
+}
+
+// Validate checks the measurement parameters which don't require querying the sensor
+func (b *MeasurementBuilder) Validate() error {
+	if b.name == "" {
+		return fmt.Errorf("Measurement name cannot be blank")
+	}
+	if b.accuracy < minAccuracy || b.accuracy > maxAccuracy {
+		return fmt.Errorf("Invalid accuracy %d for %s: must be between %d and %d", b.accuracy, b.name, minAccuracy, maxAccuracy)
+	}
+	if b.eGainIndex < 0 || b.sourceIndex < 0 || b.detectorIndex < 0 {
+		return fmt.Errorf("Invalid indices for %s: EGainIndex, SourceIndex and DetectorIndex cannot be negative", b.name)
+	}
+	switch b.command {
+	case addBarchart, addAnalog:
+		if b.startMass < 1 || b.endMass < b.startMass {
+			return fmt.Errorf("Invalid mass range %d-%d for %s", b.startMass, b.endMass, b.name)
+		}
+	case addSinglePeak:
+		if b.mass <= 0 {
+			return fmt.Errorf("Invalid mass %f for %s", b.mass, b.name)
+		}
+	}
+	switch b.command {
+	case addBarchart, addPeakJump:
+		if b.filterMode != RGA_PeakCenter && b.filterMode != RGA_PeakMax && b.filterMode != RGA_PeakAverage {
+			return fmt.Errorf("Invalid filter mode %s for %s", b.filterMode, b.name)
+		}
+	case addAnalog:
+		if b.pointsPerPeak < 1 {
+			return fmt.Errorf("Invalid points per peak %d for %s", b.pointsPerPeak, b.name)
+		}
+	}
+	return nil
+}
+
+// Apply validates the measurement, including its indices against the sensor tables, and adds it to the sensor
+func (b *MeasurementBuilder) Apply(c *RGAConnection) (*RGAResponse, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.ValidateIndices(b.eGainIndex, b.sourceIndex, b.detectorIndex); err != nil {
+		return nil, fmt.Errorf("Invalid measurement %s: %v", b.name, err)
+	}
+	switch b.command {
+	case addBarchart:
+		return c.AddBarchart(b.name, b.startMass, b.endMass, b.filterMode, b.accuracy, b.eGainIndex, b.sourceIndex, b.detectorIndex)
+	case addAnalog:
+		return c.AddAnalog(b.name, b.startMass, b.endMass, b.pointsPerPeak, b.accuracy, b.eGainIndex, b.sourceIndex, b.detectorIndex)
+	case addPeakJump:
+		return c.AddPeakJump(b.name, b.filterMode, b.accuracy, b.eGainIndex, b.sourceIndex, b.detectorIndex)
+	default:
+		return c.AddSinglePeak(b.name, b.mass, b.accuracy, b.eGainIndex, b.sourceIndex, b.detectorIndex)
+	}
+}
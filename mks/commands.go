@@ -9,8 +9,8 @@ package mks
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"net"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -676,18 +676,18 @@ var (
 		return fmt.Errorf("%s\nCODE: %s\nDESCRIPTION: %s", RGA_ERROR, code, msg)
 	}
 	RGA_ERR_OK            = fmt.Errorf("%s", RGA_OK)
-	filamentStatus        = "FilamentStatus"
+	FilamentStatus        = "FilamentStatus"
 	filamentTimeRemaining = "FilamentTimeRemaining"
-	startingScan          = "StartingScan"
-	startingMeasurement   = "StartingMeasurement"
-	zeroReading           = "ZeroReading"
+	StartingScan          = "StartingScan"
+	StartingMeasurement   = "StartingMeasurement"
+	ZeroReading           = "ZeroReading"
 	MassReading           = "MassReading"
 	multiplierStatus      = "MultiplierStatus"
-	rfTripState           = "RFTripState"
-	inletChange           = "InletChange"
-	analogInput           = "AnalogInput"
-	totalPressure         = "TotalPressure"
-	digitalPortChange     = "DigitalPortChange"
+	RFTripState           = "RFTripState"
+	InletChange           = "InletChange"
+	AnalogInput           = "AnalogInput"
+	TotalPressure         = "TotalPressure"
+	DigitalPortChange     = "DigitalPortChange"
 	rvcPumpStatus         = "RVCPumpStatus"
 	rvcHeaterStatus       = "RVCHeaterStatus"
 	rvcValveStatus        = "RVCValveStatus"
@@ -695,7 +695,7 @@ var (
 	rvcStatus             = "RVCStatus"
 	rvcDigitalInput       = "RVCDigitalInput"
 	rvcValveMode          = "RVCValveMode"
-	linkDown              = "LinkDown"
+	LinkDown              = "LinkDown"
 	vscEvent              = "VSCEvent"
 	degasReading          = "DegasReading"
 	BIG_BUFFER            = 16384
@@ -707,10 +707,17 @@ type RGAType int32
 
 type RGAConnection struct {
 	*net.TCPConn
+	obs    *readObserver
+	lim    *RateLimiter
+	dry    *dryRun
+	strict *strictMode
+	events *eventHandlers
+	tmo    *commandTimeouts
+	compat *compatibility
 }
 
-var _ DriverConnectionErr = (*RGAConnection)(nil)
-var _ DriverConnectionErr = RGAConnection{}
+var _ io.ReadWriteCloser = (*RGAConnection)(nil)
+var _ io.ReadWriteCloser = RGAConnection{}
 
 type RGARespErr struct {
 	CommandName string
@@ -720,9 +727,23 @@ type RGAValue struct {
 	Type  RGAType
 	Value interface{}
 }
+// Float returns the value as a float64 if it is numeric
+func (v RGAValue) Float() (float64, bool) {
+	switch n := v.Value.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
 type RGAResponse struct {
 	ErrMsg RGARespErr
 	Fields map[string]RGAValue
+	cols   []string
+	event  *UnknownEvent
+	Rows   int // number of table rows for horizontal responses
 }
 
 // String returns a string formatted RGA response
@@ -734,6 +755,21 @@ func (r *RGAResponse) String() string {
 	return respStr
 }
 
+// Column returns the values of the given header for every row of an horizontal response
+func (r *RGAResponse) Column(header string) []RGAValue {
+	var values []RGAValue
+	for i := 0; i < r.Rows; i++ {
+		name := header
+		if i > 0 {
+			name = header + strconv.Itoa(i)
+		}
+		if v, ok := r.Fields[name]; ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
 // StringSlice returns a string slice formatted RGA response
 func (r *RGAResponse) StringSlice() []string {
 	respSlice := []string{fmt.Sprintf("%s %s", r.ErrMsg.CommandName, r.ErrMsg.Err)}
@@ -745,10 +781,7 @@ func (r *RGAResponse) StringSlice() []string {
 
 // parseHorizontalResp will parse an horizontal response from the RGA into a RGAResponse object
 func parseHorizontalResp(resp []byte) (*RGAResponse, error) {
-	re, err := regexp.Compile(fieldRegex)
-	if err != nil {
-		return nil, err
-	}
+	re := fieldRe
 	split := bytes.Split(resp, delim)
 	//We know the first row is always the name of the command it's error status
 	errorStatusField := re.FindAllString(string(split[0]), 2)
@@ -767,12 +800,12 @@ func parseHorizontalResp(resp []byte) (*RGAResponse, error) {
 	// We know that the second row will be headers
 	headers := re.FindAllString(string(split[1]), -1)
 	// We know that split has a length of four since it's an horizontal response. We can ignore the last line.
-	fields := make(map[string]RGAValue)
+	fields := make(map[string]RGAValue, len(headers)*max(len(split)-3, 1))
 	for j := 2; j < len(split)-1; j++ {
 		values := re.FindAllString(string(split[j]), len(headers))
 		for i, header := range headers {
 			if j > 2 {
-				header = header + strconv.Itoa(i-2)
+				header = header + strconv.Itoa(j-2)
 			}
 			if _, ok := fields[header]; !ok {
 				// if int64
@@ -798,15 +831,14 @@ func parseHorizontalResp(resp []byte) (*RGAResponse, error) {
 			Err:         errorStatus,
 		},
 		Fields: fields,
+		cols:   headers,
+		Rows:   len(split) - 3,
 	}, errMsg
 }
 
 // parseVerticalResp will parse a vertical response from the RGA into a RGAResponse object
 func parseVerticalResp(resp []byte, oneValuePerLine bool) (*RGAResponse, error) {
-	re, err := regexp.Compile(fieldRegex)
-	if err != nil {
-		return nil, err
-	}
+	re := fieldRe
 	split := bytes.Split(resp, delim)
 	//We know the first row is always the name of the command it's error status
 	errorStatusField := re.FindAllString(string(split[0]), 2)
@@ -822,7 +854,7 @@ func parseVerticalResp(resp []byte, oneValuePerLine bool) (*RGAResponse, error)
 		return nil, RGA_ERR_ERROR(re.FindAllString(string(split[1]), 2)[1], errDescription)
 	}
 	// We know that the second to the before last will be our header value combos
-	fields := make(map[string]RGAValue)
+	fields := make(map[string]RGAValue, max(len(split)-2, 0))
 	for i := 1; i < len(split)-1; i++ {
 		var (
 			field []string
@@ -866,7 +898,9 @@ func parseVerticalResp(resp []byte, oneValuePerLine bool) (*RGAResponse, error)
 // InitMsg returns the standard response when the RGA receives it's first message from the client
 func (c *RGAConnection) InitMsg() error {
 	fmt.Fprintf(c, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return err
@@ -874,63 +908,88 @@ func (c *RGAConnection) InitMsg() error {
 	resp := bytes.Split(buf, commandEnd) // The whole response minus the empty bytes leftover
 	split := bytes.Split(resp[0], delim)
 	splitAgain := bytes.Split(split[0], delim)
-	re, err := regexp.Compile(fieldRegex)
-	if err != nil {
-		return err
-	}
+	re := fieldRe
 	firstLine := re.FindAllString(string(splitAgain[0]), 2)
 	if firstLine[0] != ACKMsg {
 		return fmt.Errorf("RGA did not respond with expected ACK msg: %s", string(split[0]))
 	}
+	c.recordProtocol(split[1:])
 	return nil
 }
 
-//ReadResponse reads an asynchronous response from the RGA
+//ReadResponse reads an asynchronous response from the RGA and dispatches it to the handlers subscribed with OnEvent.
+// Messages of an unknown type are returned with their tokens as fields Value1, Value2, ... and can be inspected with
+// Unknown. See RegisterEventParser to parse new types
 func (c *RGAConnection) ReadResponse() (*RGAResponse, error) {
-	buf := make([]byte, BUFFER)
-	_, err := c.Read(buf)
+	resp, err := c.readResponse()
 	if err != nil {
 		return nil, err
 	}
-	resp := bytes.Split(buf, commandEnd) // The whole response minus the empty bytes leftover
-	//Parse response here
-	re, err := regexp.Compile(fieldRegex)
+	c.dispatch(resp)
+	return resp, nil
+}
+
+// readResponse reads and parses an asynchronous response
+func (c *RGAConnection) readResponse() (*RGAResponse, error) {
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
+	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
 	}
-	split := bytes.Split(resp[0], delim)
+	return c.parseResponse(buf)
+}
+
+// parseResponse parses an asynchronous response read into buf
+func (c *RGAConnection) parseResponse(buf []byte) (*RGAResponse, error) {
+	line, _, _ := bytes.Cut(buf, commandEnd) // The whole response minus the empty bytes leftover
+	//Parse response here
+	split := bytes.Split(line, delim)
 	// We first ensure we are parsing a mass response
-	firstRow := re.FindAllString(string(split[0]), -1)
-	fields := make(map[string]RGAValue)
+	firstRow := splitFields(split[0])
+	if len(firstRow) == 0 {
+		return nil, c.parseFailure(line, 0, "blank message")
+	}
+	if parse := eventParser(firstRow[0]); parse != nil {
+		return parse(firstRow[0], bytes.Clone(line))
+	}
+	fields := make(map[string]RGAValue, max(len(firstRow)-1, 0))
 	var headers []string
 	switch firstRow[0] {
-	case startingScan:
+	case StartingScan:
 		headers = []string{"ScanNumber", "Time", "ScansRemaining"}
-	case startingMeasurement:
+	case StartingMeasurement:
 		headers = []string{"MeasurementName"}
-	case zeroReading:
+	case ZeroReading:
 		headers = []string{"MassPosition", "Value"}
 	case MassReading:
 		headers = []string{"MassPosition", "Value"}
+	case FilamentStatus:
+		headers = []string{"Filament", "SummaryState"}
 	case filamentTimeRemaining:
 		headers = []string{"Time"}
 	case multiplierStatus:
 		var trueResp []byte
 		trueResp = append(trueResp, []byte(multiplierStatus+" OK")...)
-		trueResp = append(trueResp, resp[0]...)
+		trueResp = append(trueResp, line...)
 		return parseVerticalResp(trueResp, false)
-	case rfTripState:
+	case RFTripState:
 		headers = []string{"State"}
-	case inletChange:
+	case InletChange:
 		headers = []string{"Index"}
-	case analogInput:
+	case AnalogInput:
 		headers = []string{"Index", "Value"}
-	case totalPressure:
+	case TotalPressure:
 		headers = []string{"Value"}
-	case digitalPortChange:
+	case DigitalPortChange:
 		headers = []string{"Port", "Value"}
-	case linkDown:
-		headers = []string{"Reason"}
+	case LinkDown:
+		// the reason is free text and may contain spaces
+		return &RGAResponse{
+			ErrMsg: RGARespErr{CommandName: LinkDown, Err: RGA_OK},
+			Fields: map[string]RGAValue{"Reason": {Type: RGA_STR, Value: strings.TrimSpace(strings.TrimPrefix(string(split[0]), LinkDown))}},
+		}, nil
 	case vscEvent:
 		var trueResp []byte
 		trueResp = append(trueResp, []byte(vscEvent+" OK")...)
@@ -941,8 +1000,13 @@ func (c *RGAConnection) ReadResponse() (*RGAResponse, error) {
 	case degasReading:
 		var trueResp []byte
 		trueResp = append(trueResp, []byte(degasReading+" OK")...)
-		trueResp = append(trueResp, resp[0]...)
+		trueResp = append(trueResp, line...)
 		return parseVerticalResp(trueResp, false)
+	default:
+		return parseUnknownEvent(line), nil
+	}
+	if len(firstRow)-1 < len(headers) {
+		return nil, c.parseFailure(line, len(split[0]), "%s has %d of its %d fields", firstRow[0], len(firstRow)-1, len(headers))
 	}
 	i := 1
 	for _, name := range headers {
@@ -975,7 +1039,9 @@ func (c *RGAConnection) ReadResponse() (*RGAResponse, error) {
 // Sensors returns a table of sensors that can be controlled
 func (c *RGAConnection) Sensors() (*RGAResponse, error) {
 	fmt.Fprintf(c, sensors+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -987,7 +1053,9 @@ func (c *RGAConnection) Sensors() (*RGAResponse, error) {
 // Select selects the device via the inputted SerialNumber
 func (c *RGAConnection) Select(SerialNumber string) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", selectCmd, SerialNumber, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -999,7 +1067,9 @@ func (c *RGAConnection) Select(SerialNumber string) (*RGAResponse, error) {
 // SensorState retrieves the state of the selected sensor. State can only one of Ready, InUse, Config, N/A
 func (c *RGAConnection) SensorState() (*RGAResponse, error) {
 	fmt.Fprintf(c, sensorState+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1011,7 +1081,9 @@ func (c *RGAConnection) SensorState() (*RGAResponse, error) {
 // Info returns the sensor config
 func (c *RGAConnection) Info() (*RGAResponse, error) {
 	fmt.Fprintf(c, info+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1023,7 +1095,9 @@ func (c *RGAConnection) Info() (*RGAResponse, error) {
 // EGains returns the list of electronic gain factors available for the sensor
 func (c *RGAConnection) EGains() (*RGAResponse, error) {
 	fmt.Fprintf(c, eGains+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1035,7 +1109,9 @@ func (c *RGAConnection) EGains() (*RGAResponse, error) {
 // InletInfo returns inlet information
 func (c *RGAConnection) InletInfo() (*RGAResponse, error) {
 	fmt.Fprintf(c, inletInfo+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1047,7 +1123,9 @@ func (c *RGAConnection) InletInfo() (*RGAResponse, error) {
 // RFInfo returns the current configuration and state of the RF Trip
 func (c *RGAConnection) RFInfo() (*RGAResponse, error) {
 	fmt.Fprintf(c, rfInfo+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1059,7 +1137,9 @@ func (c *RGAConnection) RFInfo() (*RGAResponse, error) {
 // MultiplierInfo returns the current configuration the current state of the multiplier and the reason why it is locked
 func (c *RGAConnection) MultiplierInfo() (*RGAResponse, error) {
 	fmt.Fprintf(c, multiplierInfo+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1068,10 +1148,12 @@ func (c *RGAConnection) MultiplierInfo() (*RGAResponse, error) {
 	return parseVerticalResp(resp[0], false)
 }
 
-// SourceInfo returns the current configuration the current state of the multiplier and the reason why it is locked
+// SourceInfo returns the settings of the current source table. Use SourceInfoIndex for a specific table
 func (c *RGAConnection) SourceInfo() (*RGAResponse, error) {
 	fmt.Fprintf(c, sourceInfo+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1083,44 +1165,24 @@ func (c *RGAConnection) SourceInfo() (*RGAResponse, error) {
 // DetectorInfo returns a table of information about the detector settings for a particular source table
 func (c *RGAConnection) DetectorInfo(SourceIndex int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", detectorInfo, SourceIndex, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
 	}
 	resp := bytes.Split(buf, commandEnd) // The whole response minus the empty bytes leftover
-	// Detector info has a line that is vertical so we parse that separately
-	split := bytes.Split(resp[0], delim)
-	var vertBytes []byte
-	vertBytes = append(vertBytes, split[0]...)
-	vertBytes = append(vertBytes, delim...)
-	vertBytes = append(vertBytes, split[1]...)
-	vertBytes = append(vertBytes, delim...)
-	vertPortion, err := parseVerticalResp(vertBytes, false)
-	if err != nil {
-		return nil, err
-	}
-	var horizBytes []byte
-	horizBytes = append(horizBytes, split[0]...)
-	horizBytes = append(horizBytes, delim...)
-	for i := 2; i < len(split)-1; i++ {
-		horizBytes = append(horizBytes, split[i]...)
-		horizBytes = append(horizBytes, delim...)
-	}
-	horizPortion, err := parseHorizontalResp(horizBytes)
-	if err != nil {
-		return nil, err
-	}
-	for name, value := range vertPortion.Fields {
-		horizPortion.Fields[name] = value
-	}
-	return horizPortion, nil
+	// Detector info starts with name value lines, one or more depending on the firmware, followed by the table
+	return parseMixedResp(resp[0])
 }
 
 // FilamentInfo returns the current config and state of the filaments
 func (c *RGAConnection) FilamentInfo() (*RGAResponse, error) {
 	fmt.Fprintf(c, filamentInfo+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1132,7 +1194,9 @@ func (c *RGAConnection) FilamentInfo() (*RGAResponse, error) {
 // TotalPressureInfo returns information about the current state and settings being used if a total pressure gauge has been fitted onto the sensor
 func (c *RGAConnection) TotalPressureInfo() (*RGAResponse, error) {
 	fmt.Fprintf(c, totalPressureInfo+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1144,7 +1208,9 @@ func (c *RGAConnection) TotalPressureInfo() (*RGAResponse, error) {
 // AnalogInputInfo returns information about all the analog inputs that the sensor has.
 func (c *RGAConnection) AnalogInputInfo() (*RGAResponse, error) {
 	fmt.Fprintf(c, analogInputInfo+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1156,7 +1222,9 @@ func (c *RGAConnection) AnalogInputInfo() (*RGAResponse, error) {
 // AnalogOutputInfo rReturns information about all analog outputs that a sensor has
 func (c *RGAConnection) AnalogOutputInfo() (*RGAResponse, error) {
 	fmt.Fprintf(c, analogOutputInfo+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1166,21 +1234,25 @@ func (c *RGAConnection) AnalogOutputInfo() (*RGAResponse, error) {
 }
 
 // DigitalInfo returns information about the fitted digital input ports
-func (c *RGAConnection) DigitalInfo() (*RGAResponse, error) { // TODO:SSSOCPaulCote this command has both vertical and horizontal outputs
+func (c *RGAConnection) DigitalInfo() (*RGAResponse, error) {
 	fmt.Fprintf(c, digitalInfo+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
 	}
 	resp := bytes.Split(buf, commandEnd) // The whole response minus the empty bytes leftover
-	return parseVerticalResp(resp[0], false)
+	return parseMixedResp(resp[0])
 }
 
 // RolloverInfo Returns configuration settings for the rollover correction algorithm used in the HPQ2s
 func (c *RGAConnection) RolloverInfo() (*RGAResponse, error) {
 	fmt.Fprintf(c, rolloverInfo+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1192,7 +1264,9 @@ func (c *RGAConnection) RolloverInfo() (*RGAResponse, error) {
 // RVCInfo returns the current state of the RVC if the sensor has an RVC fitted.
 func (c *RGAConnection) RVCInfo() (*RGAResponse, error) {
 	fmt.Fprintf(c, rVCInfo+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1204,7 +1278,9 @@ func (c *RGAConnection) RVCInfo() (*RGAResponse, error) {
 //CirrusInfo returns the current Cirrus status and configuration if the sensor is a Cirrus
 func (c *RGAConnection) CirrusInfo() (*RGAResponse, error) {
 	fmt.Fprintf(c, cirrusInfo+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1216,7 +1292,9 @@ func (c *RGAConnection) CirrusInfo() (*RGAResponse, error) {
 //PECal_Info It is not meant to be used by non MKS software
 func (c *RGAConnection) PECal_Info(SourceIndex, DetectorIndex int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d%s", pECal_Info, SourceIndex, DetectorIndex, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1228,7 +1306,9 @@ func (c *RGAConnection) PECal_Info(SourceIndex, DetectorIndex int) (*RGAResponse
 //Control takes an AppName (name of the TCP client) and the version of the controlling application to control an unused sensor
 func (c *RGAConnection) Control(AppName, Version string) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s %s%s", control, AppName, Version, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1240,7 +1320,9 @@ func (c *RGAConnection) Control(AppName, Version string) (*RGAResponse, error) {
 // Release releases control of the sensor
 func (c *RGAConnection) Release() (*RGAResponse, error) {
 	fmt.Fprintf(c, release+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1259,7 +1341,9 @@ const (
 // FilamentControl turns the currently selected filament On or Off
 func (c *RGAConnection) FilamentControl(State RGAOnOff) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", filamentControl, State, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1271,7 +1355,9 @@ func (c *RGAConnection) FilamentControl(State RGAOnOff) (*RGAResponse, error) {
 // FilamentSelect selects a particular filament
 func (c *RGAConnection) FilamentSelect(Number int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", filamentSelect, Number, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1283,7 +1369,9 @@ func (c *RGAConnection) FilamentSelect(Number int) (*RGAResponse, error) {
 // FilamentOnTime sets the amount of time that filaments will stay on for if the unit is configured to use a time limit before filaments automatically go off
 func (c *RGAConnection) FilamentOnTime(Time int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", filamentOnTime, Time, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1293,9 +1381,11 @@ func (c *RGAConnection) FilamentOnTime(Time int) (*RGAResponse, error) {
 }
 
 // AddAnalog adds a new analog measurement to the sensor
-func (c *RGAConnection) AddAnalog(Name string, StartMass, EndMass, PointerPerPeak, Accuracy, SourceIndex, DetectorIndex int) (*RGAResponse, error) {
-	fmt.Fprintf(c, "%s %s %d %d %d %d %d %d%s", addAnalog, Name, StartMass, EndMass, PointerPerPeak, Accuracy, SourceIndex, DetectorIndex, commandSuffix)
-	buf := make([]byte, BUFFER)
+func (c *RGAConnection) AddAnalog(Name string, StartMass, EndMass, PointsPerPeak, Accuracy, EGainIndex, SourceIndex, DetectorIndex int) (*RGAResponse, error) {
+	fmt.Fprintf(c, "%s %s %d %d %d %d %d %d %d%s", addAnalog, Name, StartMass, EndMass, PointsPerPeak, Accuracy, EGainIndex, SourceIndex, DetectorIndex, commandSuffix)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1315,7 +1405,9 @@ const (
 // AddBarchart adds a new barchart measurement to the sensor
 func (c *RGAConnection) AddBarchart(Name string, StartMass, EndMass int, FilterMode RGAFilterMode, Accuracy, EGainIndex, SourceIndex, DetectorIndex int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s %d %d %s %d %d %d %d%s", addBarchart, Name, StartMass, EndMass, FilterMode, Accuracy, EGainIndex, SourceIndex, DetectorIndex, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1327,7 +1419,9 @@ func (c *RGAConnection) AddBarchart(Name string, StartMass, EndMass int, FilterM
 // AddPeakJump adds a new peak jump measurement to the sensor
 func (c *RGAConnection) AddPeakJump(Name string, FilterMode RGAFilterMode, Accuracy, EGainIndex, SourceIndex, DetectorIndex int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s %s %d %d %d %d%s", addPeakJump, Name, FilterMode, Accuracy, EGainIndex, SourceIndex, DetectorIndex, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1339,7 +1433,9 @@ func (c *RGAConnection) AddPeakJump(Name string, FilterMode RGAFilterMode, Accur
 // AddSinglePeak adds a new single peak measurement to the sensor
 func (c *RGAConnection) AddSinglePeak(Name string, Mass float64, Accuracy, EGainIndex, SourceIndex, DetectorIndex int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s %f %d %d %d %d%s", addSinglePeak, Name, Mass, Accuracy, EGainIndex, SourceIndex, DetectorIndex, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1351,7 +1447,9 @@ func (c *RGAConnection) AddSinglePeak(Name string, Mass float64, Accuracy, EGain
 // MeasurementAccuracy changes the accuracy code of the currently selected measurement.
 func (c *RGAConnection) MeasurementAccuracy(Accuracy int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", measurementAccuracy, Accuracy, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1363,7 +1461,9 @@ func (c *RGAConnection) MeasurementAccuracy(Accuracy int) (*RGAResponse, error)
 // MeasurementAddMass adds a mass to a peak jump measurement
 func (c *RGAConnection) MeasurementAddMass(Mass int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", measurementAddMass, Mass, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1375,7 +1475,9 @@ func (c *RGAConnection) MeasurementAddMass(Mass int) (*RGAResponse, error) {
 // MeasurementChangeMass changes a mass on a Peak Jump measurement
 func (c *RGAConnection) MeasurementChangeMass(MassIndex, NewMass int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d%s", measurementChangeMass, MassIndex, NewMass, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1387,7 +1489,9 @@ func (c *RGAConnection) MeasurementChangeMass(MassIndex, NewMass int) (*RGARespo
 // MeasurmentDetectorIndex changes the selected measurements detector index
 func (c *RGAConnection) MeasurementDetectorIndex(DetectorIndex int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", measurementDetectorIndex, DetectorIndex, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1399,7 +1503,9 @@ func (c *RGAConnection) MeasurementDetectorIndex(DetectorIndex int) (*RGARespons
 // MeasurementEGainIndex changes a measurements electronic gain index
 func (c *RGAConnection) MeasurementEGainIndex(EGainIndex int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", measurementEGainIndex, EGainIndex, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1411,7 +1517,9 @@ func (c *RGAConnection) MeasurementEGainIndex(EGainIndex int) (*RGAResponse, err
 // MeasurementFilterMode selects the mass filter mode to be used for the Barchart and Peak Jump measurements
 func (c *RGAConnection) MeasurementFilterMode(FilterMode RGAFilterMode) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", measurementFilterMode, FilterMode, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1423,7 +1531,9 @@ func (c *RGAConnection) MeasurementFilterMode(FilterMode RGAFilterMode) (*RGARes
 // MeasurementMass changes the mass used for the selected single peak measurement
 func (c *RGAConnection) MeasurementMass(Mass float64) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %f%s", measurementMass, Mass, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1435,7 +1545,9 @@ func (c *RGAConnection) MeasurementMass(Mass float64) (*RGAResponse, error) {
 // MeasurementPointsPerPeak sets the selected analog measurements number of points to measure per peak (or AMU)
 func (c *RGAConnection) MeasurementPointsPerPeak(PointsPerPeak int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", measurementPointsPerPeak, PointsPerPeak, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1447,7 +1559,9 @@ func (c *RGAConnection) MeasurementPointsPerPeak(PointsPerPeak int) (*RGARespons
 // MeasurementRemoveMass removes a mass peak from the selected Peak Jump measurement
 func (c *RGAConnection) MeasurementRemoveMass(MassIndex int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", measurementRemoveMass, MassIndex, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1459,7 +1573,9 @@ func (c *RGAConnection) MeasurementRemoveMass(MassIndex int) (*RGAResponse, erro
 // MeasurementSourceIndex changes the selected measurements source parameters
 func (c *RGAConnection) MeasurementSourceIndex(SourceIndex int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", measurementSourceIndex, SourceIndex, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1471,7 +1587,9 @@ func (c *RGAConnection) MeasurementSourceIndex(SourceIndex int) (*RGAResponse, e
 // MeasurementRolloverCorrection changes whether the selected measurement uses rollover correction
 func (c *RGAConnection) MeasurementRolloverCorrection(UseCorrection bool) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", measurementRolloverCorrection, strings.Title(fmt.Sprintf("%t", UseCorrection)), commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1483,7 +1601,9 @@ func (c *RGAConnection) MeasurementRolloverCorrection(UseCorrection bool) (*RGAR
 // MeasurementZeroBeamOff controls whether the ion beam should be on or off during a measurements zero readings
 func (c *RGAConnection) MeasurementZeroBeamOff(BeamOff bool) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", measurementZeroBeamOff, strings.Title(fmt.Sprintf("%t", BeamOff)), commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1495,7 +1615,9 @@ func (c *RGAConnection) MeasurementZeroBeamOff(BeamOff bool) (*RGAResponse, erro
 // MeasurementZeroBufferDepth sets the selected measurements zero buffer depth
 func (c *RGAConnection) MeasurementZeroBufferDepth(ZeroBufferDepth int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", measurementZeroBufferDepth, ZeroBufferDepth, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1516,7 +1638,9 @@ const (
 // MeasurementZeroBufferMode sets the selected measurements zero buffer mode
 func (c *RGAConnection) MeasurementZeroBufferMode(ZeroBufferMode RGAZeroBufferMode) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", measurementZeroBufferMode, ZeroBufferMode, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1528,7 +1652,9 @@ func (c *RGAConnection) MeasurementZeroBufferMode(ZeroBufferMode RGAZeroBufferMo
 // MeasurementZeroReTrigger re-triggers the selected measurements zero buffer if it's mode is SingleShot
 func (c *RGAConnection) MeasurementZeroReTrigger() (*RGAResponse, error) {
 	fmt.Fprintf(c, measurementZeroReTrigger+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1540,7 +1666,9 @@ func (c *RGAConnection) MeasurementZeroReTrigger() (*RGAResponse, error) {
 // MeasurementZeroMass sets the mass position where the selected measurement should take it's zero readings from
 func (c *RGAConnection) MeasurementZeroMass(ZeroMass float64) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %f%s", measurementZeroMass, ZeroMass, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1552,7 +1680,9 @@ func (c *RGAConnection) MeasurementZeroMass(ZeroMass float64) (*RGAResponse, err
 // MultiplierProtect controls whether the multiplier is allowed to come on or not
 func (c *RGAConnection) MultiplierProtect(Protect bool) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", multiplierProtect, strings.Title(fmt.Sprintf("%t", Protect)), commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1564,7 +1694,9 @@ func (c *RGAConnection) MultiplierProtect(Protect bool) (*RGAResponse, error) {
 // RunDiagnostics runs the sensors diagnostics measurements
 func (c *RGAConnection) RunDiagnostics() (*RGAResponse, error) {
 	fmt.Fprintf(c, runDiagnostics+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1576,7 +1708,9 @@ func (c *RGAConnection) RunDiagnostics() (*RGAResponse, error) {
 // SetTotalPressure if no gauge is fitted for measuring total pressure it is sometimes useful to pass in a value for total pressure so that the sensors roll over correction can still function properly
 func (c *RGAConnection) SetTotalPressure(Pressure float64) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %E%s", setTotalPressure, Pressure, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1588,7 +1722,9 @@ func (c *RGAConnection) SetTotalPressure(Pressure float64) (*RGAResponse, error)
 // TotalPressureCalFactor sets a value to apply to external gauge total pressure readings to compensate for any differences between the gauge and the true pressure
 func (c *RGAConnection) TotalPressureCalFactor(Factor float64) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %f%s", totalPressureCalFactor, Factor, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1600,7 +1736,9 @@ func (c *RGAConnection) TotalPressureCalFactor(Factor float64) (*RGAResponse, er
 // TotalPressureCalDate sets the date/time associated with a calibration
 func (c *RGAConnection) TotalPressureCalDate(DateTime time.Time) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d-%2d-%2d_%2d:%2d:%2d%s", totalPressureCalDate, DateTime.Year(), DateTime.Month(), DateTime.Day(), DateTime.Hour(), DateTime.Minute(), DateTime.Second(), commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1620,7 +1758,9 @@ const (
 // CalibrationOptions sets how to apply calibration factors to acquired measurement data
 func (c *RGAConnection) CalibrationOptions(InletOption, DetectorOption RGAOption) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s %s%s", calibrationOptions, InletOption, DetectorOption, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1632,7 +1772,9 @@ func (c *RGAConnection) CalibrationOptions(InletOption, DetectorOption RGAOption
 // DetectorFactor sets a calibration factor for a given set of source parameters and detector parameters
 func (c *RGAConnection) DetectorFactor(SourceIndex, DetectorIndex, Filament int, Factor float64) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d %d %e%s", detectorFactor, SourceIndex, DetectorIndex, Filament, Factor, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1644,7 +1786,9 @@ func (c *RGAConnection) DetectorFactor(SourceIndex, DetectorIndex, Filament int,
 // DetectorCalDate sets a calibration date for a given set of source parameters and detector parameters
 func (c *RGAConnection) DetectorCalDate(SourceIndex, DetectorIndex, Filament int, Date time.Time) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d %d %d-%2d-%2d_%2d:%2d:%2d%s", detectorCalDate, SourceIndex, DetectorIndex, Filament, Date.Year(), Date.Month(), Date.Day(), Date.Hour(), Date.Minute(), Date.Second(), commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1656,7 +1800,9 @@ func (c *RGAConnection) DetectorCalDate(SourceIndex, DetectorIndex, Filament int
 // DetectorVoltage sets the multiplier voltage for a particular set of detector settings
 func (c *RGAConnection) DetectorVoltage(SourceIndex, DetectorIndex, Filament, Voltage int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d %d %d%s", detectorVoltage, SourceIndex, DetectorIndex, Filament, Voltage, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1668,7 +1814,9 @@ func (c *RGAConnection) DetectorVoltage(SourceIndex, DetectorIndex, Filament, Vo
 // InletFactor sets a particular inlets pressure reduction factor
 func (c *RGAConnection) InletFactor(InletIndex int, Factor float64) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %f%s", inletFactor, InletIndex, Factor, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1680,7 +1828,9 @@ func (c *RGAConnection) InletFactor(InletIndex int, Factor float64) (*RGARespons
 // ScanAdd adds a measurement to the scans list of measurements
 func (c *RGAConnection) ScanAdd(MeasurementName string) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", scanAdd, MeasurementName, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1692,7 +1842,9 @@ func (c *RGAConnection) ScanAdd(MeasurementName string) (*RGAResponse, error) {
 // ScanStart starts a scan running and will re-trigger the scan automatically the number of times specified by NumScans
 func (c *RGAConnection) ScanStart(NumScans int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", scanStart, NumScans, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1704,19 +1856,20 @@ func (c *RGAConnection) ScanStart(NumScans int) (*RGAResponse, error) {
 // ScanStop stops a scan and removes all measurements from the scan list
 func (c *RGAConnection) ScanStop() (*RGAResponse, error) {
 	fmt.Fprintf(c, scanStop+commandSuffix)
-	buf := make([]byte, BUFFER)
-	_, err := c.Read(buf)
+	// readings of the scan being stopped may arrive before the response
+	resp, err := c.readReply(scanStop)
 	if err != nil {
 		return nil, err
 	}
-	resp := bytes.Split(buf, commandEnd) // The whole response minus the empty bytes leftover
-	return parseVerticalResp(resp[0], false)
+	return parseVerticalResp(resp, false)
 }
 
 // ScanResume re-triggers the scan NumScans times
 func (c *RGAConnection) ScanResume(NumScans int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", scanResume, NumScans, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1728,7 +1881,9 @@ func (c *RGAConnection) ScanResume(NumScans int) (*RGAResponse, error) {
 // ScanRestart re-starts the current scan from the beginning
 func (c *RGAConnection) ScanRestart() (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s%s", scanRestart, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1740,7 +1895,9 @@ func (c *RGAConnection) ScanRestart() (*RGAResponse, error) {
 // MeasurementSelect selects a measurement for other MeasurementXXX comands to act upon
 func (c *RGAConnection) MeasurementSelect(MeasurementName string) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", measurementSelect, MeasurementName, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1752,7 +1909,9 @@ func (c *RGAConnection) MeasurementSelect(MeasurementName string) (*RGAResponse,
 // MeasurementStartMass sets the selected Analog or Barchart measurements starting mass
 func (c *RGAConnection) MeasurmentStartMass(Mass int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", measurementStartMass, Mass, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1764,7 +1923,9 @@ func (c *RGAConnection) MeasurmentStartMass(Mass int) (*RGAResponse, error) {
 // MeasurementEndMass sets the selected analog or barchart measurements ending mass
 func (c *RGAConnection) MeasurementEndMass(Mass int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", measurementEndMass, Mass, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1776,7 +1937,9 @@ func (c *RGAConnection) MeasurementEndMass(Mass int) (*RGAResponse, error) {
 // MeasurementRemoveAll removes all measurements from the sensor
 func (c *RGAConnection) MeasurementRemoveAll() (*RGAResponse, error) {
 	fmt.Fprintf(c, measurementRemoveAll+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1788,7 +1951,9 @@ func (c *RGAConnection) MeasurementRemoveAll() (*RGAResponse, error) {
 // MeasurementRemove removes the specified measurement from the sensor
 func (c *RGAConnection) MeasurementRemove(MeasurementName string) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", measurementRemove, MeasurementName, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1802,7 +1967,9 @@ func (c *RGAConnection) MeasurementRemove(MeasurementName string) (*RGAResponse,
 // of characters sent in each message slightly as groups of spaces will be replaced by a single tab character
 func (c *RGAConnection) FormatWithTab(UseTab bool) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", formatWithTab, strings.Title(fmt.Sprintf("%t", UseTab)), commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1814,7 +1981,9 @@ func (c *RGAConnection) FormatWithTab(UseTab bool) (*RGAResponse, error) {
 // SourceIonEnergy sets a source settings parameters Ion Energy setting
 func (c *RGAConnection) SourceIonEnergy(SourceIndex int, IonEnergy float64) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %f%s", sourceIonEnergy, SourceIndex, IonEnergy, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1826,7 +1995,9 @@ func (c *RGAConnection) SourceIonEnergy(SourceIndex int, IonEnergy float64) (*RG
 // SourceEmission sets a source settings parameters Emission setting
 func (c *RGAConnection) SourceEmission(SourceIndex int, Emission float64) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %f%s", sourceEmission, SourceIndex, Emission, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1838,7 +2009,9 @@ func (c *RGAConnection) SourceEmission(SourceIndex int, Emission float64) (*RGAR
 // SourceExtract sets a source settings parameters Extract setting
 func (c *RGAConnection) SourceExtract(SourceIndex, Extract int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d%s", sourceExtract, SourceIndex, Extract, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1850,7 +2023,9 @@ func (c *RGAConnection) SourceExtract(SourceIndex, Extract int) (*RGAResponse, e
 // SourceElectronEnergy sets a source settings parameters Electron Energy setting
 func (c *RGAConnection) SourceElectronEnergy(SourceIndex, ElectronEnergy int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d%s", sourceElectronEnergy, SourceIndex, ElectronEnergy, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1862,7 +2037,9 @@ func (c *RGAConnection) SourceElectronEnergy(SourceIndex, ElectronEnergy int) (*
 // SourceLowMassResolution sets a source settings parameters Low Mass Resolution setting
 func (c *RGAConnection) SourceLowMassResolution(SourceIndex, LowMassResolution int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d%s", sourceLowMassResolution, SourceIndex, LowMassResolution, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1874,7 +2051,9 @@ func (c *RGAConnection) SourceLowMassResolution(SourceIndex, LowMassResolution i
 // SourceLowMassAlignment sets a source settings parameters Low Mass Alignment setting
 func (c *RGAConnection) SourceLowMassAlignment(SourceIndex, LowMassAlignment int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d%s", sourceLowMassAlignment, SourceIndex, LowMassAlignment, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1886,7 +2065,9 @@ func (c *RGAConnection) SourceLowMassAlignment(SourceIndex, LowMassAlignment int
 // SourceHighMassAlignment sets a source settings parameters High Mass Alignment setting
 func (c *RGAConnection) SourceHighMassAlignment(SourceIndex, HighMassAlignment int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d%s", sourceHighMassAlignment, SourceIndex, HighMassAlignment, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1898,7 +2079,9 @@ func (c *RGAConnection) SourceHighMassAlignment(SourceIndex, HighMassAlignment i
 // SourceHighMassResolution sets a source settings parameters High Mass Resolution setting
 func (c *RGAConnection) SourceHighMassResolution(SourceIndex, HighMassResolution int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d%s", sourceHighMassResolution, SourceIndex, HighMassResolution, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1910,7 +2093,9 @@ func (c *RGAConnection) SourceHighMassResolution(SourceIndex, HighMassResolution
 // AnalogInputAverageCount sets the number of readings that should be taken and averaged before results are sent back
 func (c *RGAConnection) AnalogInputAverageCount(Index, NumberToAverage int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d%s", analogInputAverageCount, Index, NumberToAverage, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1922,7 +2107,9 @@ func (c *RGAConnection) AnalogInputAverageCount(Index, NumberToAverage int) (*RG
 // AnalogInputEnable enables or disables analog input readings from being sent when in control of the sensor
 func (c *RGAConnection) AnalogInputEnable(Index int, Enable bool) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %s%s", analogInputEnable, Index, strings.Title(fmt.Sprintf("%t", Enable)), commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1934,7 +2121,9 @@ func (c *RGAConnection) AnalogInputEnable(Index int, Enable bool) (*RGAResponse,
 // AnalogInputInterval sets the interval between analog input readings in the sensor
 func (c *RGAConnection) AnalogInputInterval(Index, Interval int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d%s", analogInputInterval, Index, Interval, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1946,7 +2135,9 @@ func (c *RGAConnection) AnalogInputInterval(Index, Interval int) (*RGAResponse,
 // AnalogOutput sets a given analog output channel to the specified voltage
 func (c *RGAConnection) AnalogOutput(Index, Value int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d%s", analogOutput, Index, Value, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1958,7 +2149,9 @@ func (c *RGAConnection) AnalogOutput(Index, Value int) (*RGAResponse, error) {
 // AudioFrequency sets the frequency of the audio output if the sensor supports audio output
 func (c *RGAConnection) AudioFrequency(Frequency int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", audioFrequency, Frequency, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1978,7 +2171,9 @@ const (
 // AudioMode changes the mode if the sensor supports audio output
 func (c *RGAConnection) AudioMode(Mode RGAAudioMode) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", audioMode, Mode, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -1990,7 +2185,9 @@ func (c *RGAConnection) AudioMode(Mode RGAAudioMode) (*RGAResponse, error) {
 // CirrusCapillaryHeater turns the capillary heater on/off
 func (c *RGAConnection) CirrusCapillaryHeater(HeatOn bool) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", cirrusCapillaryHeater, strings.Title(fmt.Sprintf("%t", HeatOn)), commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2010,7 +2207,9 @@ const (
 // CirrusHeater sets the cirrus heater into the mode requested
 func (c *RGAConnection) CirrusHeater(Mode RGACirrusHeaterMode) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", cirrusHeater, Mode, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2022,7 +2221,9 @@ func (c *RGAConnection) CirrusHeater(Mode RGACirrusHeaterMode) (*RGAResponse, er
 // CirrusPump turns the cirrus pumps on or off
 func (c *RGAConnection) CirrusPump(PumpOn bool) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", cirrusPump, strings.Title(fmt.Sprintf("%t", PumpOn)), commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2034,7 +2235,9 @@ func (c *RGAConnection) CirrusPump(PumpOn bool) (*RGAResponse, error) {
 // CirrusValvePosition moves the cirrus rotary valve to the specified position
 func (c *RGAConnection) CirrusValvePosition(ValvePos int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", cirrusValvePosition, ValvePos, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2046,7 +2249,9 @@ func (c *RGAConnection) CirrusValvePosition(ValvePos int) (*RGAResponse, error)
 // DigitalMaxPB67OnTime sets the time that either pin 6 or 7 will remain set for after they are initially set
 func (c *RGAConnection) DigitalMaxPB67OnTime(Time int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d%s", digitalMaxPB67OnTime, Time, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2058,7 +2263,9 @@ func (c *RGAConnection) DigitalMaxPB67OnTime(Time int) (*RGAResponse, error) {
 // DigitalOutput sets digital outputs according to the value specified
 func (c *RGAConnection) DigitalOutput(Port string, Value int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s %d%s", digitalOutput, Port, Value, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2070,7 +2277,9 @@ func (c *RGAConnection) DigitalOutput(Port string, Value int) (*RGAResponse, err
 // PECal_DateMsg this is a message specifically for MKS Process Eye software to maintain compatability with some of the softwares calibration features
 func (c *RGAConnection) PECal_DateMsg(Date time.Time, Message string) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d-%2d-%2d_%2d:%2d:%2d %s%s", pECal_DateMsg, Date.Year(), Date.Month(), Date.Day(), Date.Hour(), Date.Minute(), Date.Second(), Message, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2083,7 +2292,9 @@ func (c *RGAConnection) PECal_DateMsg(Date time.Time, Message string) (*RGARespo
 // calibration features. It flushes the selected calibration settings to persistent storeage of the sensor.
 func (c *RGAConnection) PECal_Flush() (*RGAResponse, error) {
 	fmt.Fprintf(c, pECal_Flush+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2095,7 +2306,9 @@ func (c *RGAConnection) PECal_Flush() (*RGAResponse, error) {
 // PECal_Inlet this is a message specifically for MKS Process Eye software to maintain compatability with some of the software calibration features.
 func (c *RGAConnection) PECal_Inlet(Inlet1, Inlet2, Inlet3 float64) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %f %f %f%s", pECal_Inlet, Inlet1, Inlet2, Inlet3, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2107,7 +2320,9 @@ func (c *RGAConnection) PECal_Inlet(Inlet1, Inlet2, Inlet3 float64) (*RGARespons
 // PECal_MassMethodContribution this is a message specifically for MKS Process Eye software to maintain compatability with some of the softwares calibration features
 func (c *RGAConnection) PECal_MassMethodContribution(Mass, Method int, Contribution float64) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d %f%s", pECal_MassMethodContribution, Mass, Method, Contribution, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2119,7 +2334,9 @@ func (c *RGAConnection) PECal_MassMethodContribution(Mass, Method int, Contribut
 // PECal_Pressures this is a message specifically for MKS Process Eye software to maintain compatability with some of the softwares calibration features
 func (c *RGAConnection) PECal_Pressures() (*RGAResponse, error) {
 	fmt.Fprintf(c, pECal_Pressures+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2131,7 +2348,9 @@ func (c *RGAConnection) PECal_Pressures() (*RGAResponse, error) {
 // PECal_Select This is a message specifically for MKS Process Eye software to maintain compatability with some of the softwares calibration features
 func (c *RGAConnection) PECal_Select(SourceIndex, DetectorIndex int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d%s", pECal_Select, SourceIndex, DetectorIndex, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2143,7 +2362,9 @@ func (c *RGAConnection) PECal_Select(SourceIndex, DetectorIndex int) (*RGARespon
 // RolloverScaleFactor sets a given masses peak scale factor to compensate for differences in sensitivity to the rollover effect
 func (c *RGAConnection) RolloverScaleFactor(Mass int, Factor float64) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %f%s", rolloverScaleFactor, Mass, Factor, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2155,7 +2376,9 @@ func (c *RGAConnection) RolloverScaleFactor(Mass int, Factor float64) (*RGARespo
 // RolloverVariables sets the key rollover algorithm constants
 func (c *RGAConnection) RolloverVariables(M1, M2 int, B1, B2, BP1 float64) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d %f %f %f%s", rolloverVariables, M1, M2, B1, B2, BP1, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2167,7 +2390,9 @@ func (c *RGAConnection) RolloverVariables(M1, M2 int, B1, B2, BP1 float64) (*RGA
 // RVCAlarm sets of clears the digital alarm output on the RVC
 func (c *RGAConnection) RVCAlarm(State bool) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", rVCAlarm, strings.Title(fmt.Sprintf("%t", State)), commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2179,7 +2404,9 @@ func (c *RGAConnection) RVCAlarm(State bool) (*RGAResponse, error) {
 // RVCCloseAllValves the sensor must have an RVC fitted for this command to be available.
 func (c *RGAConnection) RVCCloseAllValves() (*RGAResponse, error) {
 	fmt.Fprintf(c, rVCCloseAllValves+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2191,7 +2418,9 @@ func (c *RGAConnection) RVCCloseAllValves() (*RGAResponse, error) {
 // RVCHeater turns the RVC heater on/off
 func (c *RGAConnection) RVCHeater(HeaterOn bool) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", rVCHeater, strings.Title(fmt.Sprintf("%t", HeaterOn)), commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2203,7 +2432,9 @@ func (c *RGAConnection) RVCHeater(HeaterOn bool) (*RGAResponse, error) {
 // RVCPump turns the pump on or off
 func (c *RGAConnection) RVCPump(PumpOn bool) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", rVCPump, strings.Title(fmt.Sprintf("%t", PumpOn)), commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2215,7 +2446,9 @@ func (c *RGAConnection) RVCPump(PumpOn bool) (*RGAResponse, error) {
 // RVCValveControl opens or closes a specific valve
 func (c *RGAConnection) RVCValveControl(Valve int, Open bool) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %s%s", rVCValveControl, Valve, strings.Title(fmt.Sprintf("%t", Open)), commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2234,7 +2467,9 @@ const (
 // RVCValveMode switches valve mode between manual and automatic mode
 func (c *RGAConnection) RVCValveMode(Mode RGARVCValveMode) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %s%s", rVCValveMode, Mode, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2246,7 +2481,9 @@ func (c *RGAConnection) RVCValveMode(Mode RGARVCValveMode) (*RGAResponse, error)
 // SaveChanges saves any changes that may have been made to the tuning/calibration of the sensor
 func (c *RGAConnection) SaveChanges() (*RGAResponse, error) {
 	fmt.Fprintf(c, saveChanges+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2258,7 +2495,9 @@ func (c *RGAConnection) SaveChanges() (*RGAResponse, error) {
 // StartDegas runs a degas operation
 func (c *RGAConnection) StartDegas(StartPower, EndPower, RampPeriod, MaxPowerPeriod, ResettlePeriod int) (*RGAResponse, error) {
 	fmt.Fprintf(c, "%s %d %d %d %d %d%s", startDegas, StartPower, EndPower, RampPeriod, MaxPowerPeriod, ResettlePeriod, commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -2270,7 +2509,9 @@ func (c *RGAConnection) StartDegas(StartPower, EndPower, RampPeriod, MaxPowerPer
 // StopDegas ends a degas operation that is currently running
 func (c *RGAConnection) StopDegas() (*RGAResponse, error) {
 	fmt.Fprintf(c, stopDegas+commandSuffix)
-	buf := make([]byte, BUFFER)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
 	_, err := c.Read(buf)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,39 @@
+package mks
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHorizontalResp(t *testing.T) {
+	resp, err := parseHorizontalResp([]byte(message("DetectorInfo OK", "  Detector Factor Voltage", "  0 1.0 0", "  1 2.5e-4 950", "  2 1.1e-3 1200.5")))
+	if err != nil {
+		t.Fatalf("parseHorizontalResp() error = %v", err)
+	}
+	if resp.Rows != 3 {
+		t.Errorf("Rows = %d, want 3", resp.Rows)
+	}
+	// the first row keeps the header, the following ones are suffixed with their row number
+	want := map[string]RGAValue{
+		"Detector":  {Type: RGA_INT, Value: int64(0)},
+		"Factor":    {Type: RGA_FLOAT, Value: 1.0},
+		"Voltage":   {Type: RGA_INT, Value: int64(0)},
+		"Detector1": {Type: RGA_INT, Value: int64(1)},
+		"Factor1":   {Type: RGA_FLOAT, Value: 2.5e-4},
+		"Voltage1":  {Type: RGA_INT, Value: int64(950)},
+		"Detector2": {Type: RGA_INT, Value: int64(2)},
+		"Factor2":   {Type: RGA_FLOAT, Value: 1.1e-3},
+		"Voltage2":  {Type: RGA_FLOAT, Value: 1200.5},
+	}
+	if !reflect.DeepEqual(resp.Fields, want) {
+		t.Errorf("Fields = %v, want %v", resp.Fields, want)
+	}
+	var voltages []float64
+	for _, v := range resp.Column("Voltage") {
+		f, _ := v.Float()
+		voltages = append(voltages, f)
+	}
+	if want := []float64{0, 950, 1200.5}; !reflect.DeepEqual(voltages, want) {
+		t.Errorf("Column(Voltage) = %v, want %v", voltages, want)
+	}
+}
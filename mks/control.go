@@ -0,0 +1,59 @@
+package mks
+
+import (
+	"fmt"
+)
+
+// SensorInUseError is returned when another client controls the sensor
+type SensorInUseError struct {
+	Application string // application name of the controlling client, if reported
+	Version     string
+	Address     string
+	Err         error // error returned by Control
+}
+
+// Error implements the error interface
+func (e *SensorInUseError) Error() string {
+	owner := e.Application
+	if owner == "" {
+		owner = "another client"
+	}
+	if e.Version != "" {
+		owner += " " + e.Version
+	}
+	if e.Address != "" {
+		owner += " at " + e.Address
+	}
+	return fmt.Sprintf("sensor is controlled by %s", owner)
+}
+
+// Unwrap returns the error returned by Control
+func (e *SensorInUseError) Unwrap() error {
+	return e.Err
+}
+
+// controlError turns a failed Control into a SensorInUseError when the sensor state shows it is in use
+func (c *RGAConnection) controlError(err error) error {
+	resp, serr := c.SensorState()
+	if serr != nil {
+		return err
+	}
+	if state, _ := resp.Fields["State"].Value.(string); state != RGA_SENSOR_STATE_INUSE {
+		return err
+	}
+	return &SensorInUseError{
+		Application: fieldString(resp, "UserApplication"),
+		Version:     fieldString(resp, "UserVersion"),
+		Address:     fieldString(resp, "UserAddress"),
+		Err:         err,
+	}
+}
+
+// fieldString returns the field formatted as a string, blank if missing
+func fieldString(resp *RGAResponse, name string) string {
+	v, ok := resp.Fields[name]
+	if !ok || v.Value == nil {
+		return ""
+	}
+	return fmt.Sprint(v.Value)
+}
@@ -0,0 +1,18 @@
+package mks
+
+import (
+	"net"
+)
+
+// Dial connects to the RGA at the given host:port. The connection must then be initialized with InitMsg
+func Dial(addr string) (*RGAConnection, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, err := net.DialTCP("tcp", nil, tcpAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &RGAConnection{TCPConn: c}, nil
+}
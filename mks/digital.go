@@ -0,0 +1,113 @@
+package mks
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// DigitalPort is a digital port fitted to the sensor
+type DigitalPort struct {
+	Name  string
+	Bits  int
+	Value int // current state of the port, one bit per pin
+}
+
+// Bit reports whether the given bit of the port is set
+func (p DigitalPort) Bit(bit int) bool {
+	return p.Value&(1<<bit) != 0
+}
+
+// DigitalPorts reads DigitalInfo into the list of fitted digital ports
+func (c *RGAConnection) DigitalPorts() ([]DigitalPort, error) {
+	resp, err := c.DigitalInfo()
+	if err != nil {
+		return nil, err
+	}
+	names := resp.Column("Name")
+	if len(names) == 0 {
+		names = resp.Column("Port")
+	}
+	bits, values := resp.Column("NumBits"), resp.Column("Value")
+	ports := make([]DigitalPort, 0, len(names))
+	for i, name := range names {
+		p := DigitalPort{Name: fmt.Sprint(name.Value)}
+		if i < len(bits) {
+			if v, ok := bits[i].Float(); ok {
+				p.Bits = int(v)
+			}
+		}
+		if i < len(values) {
+			if v, ok := values[i].Float(); ok {
+				p.Value = int(v)
+			}
+		}
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+// parseMixedResp parses a response made of name value lines followed by a table, like DigitalInfo. The table starts
+// at the first line with more than two fields and its rows are named like those of parseHorizontalResp
+func parseMixedResp(resp []byte) (*RGAResponse, error) {
+	re := fieldRe
+	split := bytes.Split(resp, delim)
+	errorStatusField := re.FindAllString(string(split[0]), 2)
+	if len(errorStatusField) < 2 {
+		return nil, fmt.Errorf("Invalid RGA response: %s", string(split[0]))
+	}
+	errorStatus := RGAErrStr(errorStatusField[1])
+	if errorStatus != RGA_ERROR && errorStatus != RGA_OK {
+		return nil, fmt.Errorf("Unkown RGA error code: %s", errorStatus)
+	} else if errorStatus == RGA_ERROR {
+		return parseVerticalResp(resp, false)
+	}
+	r := &RGAResponse{
+		ErrMsg: RGARespErr{
+			CommandName: errorStatusField[0],
+			Err:         errorStatus,
+		},
+		Fields: make(map[string]RGAValue, len(split)),
+	}
+	var headers []string
+	for _, line := range split[1:] {
+		values := re.FindAllString(string(line), -1)
+		if len(values) == 0 {
+			continue
+		}
+		if headers == nil && len(values) <= 2 {
+			if len(values) == 2 {
+				r.Fields[values[0]] = parseValue(values[1])
+			}
+			continue
+		}
+		if headers == nil {
+			headers = values
+			r.cols = headers
+			continue
+		}
+		for i, header := range headers {
+			if i >= len(values) {
+				break
+			}
+			if r.Rows > 0 {
+				header = header + strconv.Itoa(r.Rows)
+			}
+			r.Fields[header] = parseValue(values[i])
+		}
+		r.Rows++
+	}
+	return r, nil
+}
+
+// parseValue types a response field as an int, float, bool or string
+func parseValue(s string) RGAValue {
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return RGAValue{Type: RGA_INT, Value: v}
+	} else if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return RGAValue{Type: RGA_FLOAT, Value: v}
+	} else if v, err := strconv.ParseBool(s); err == nil {
+		return RGAValue{Type: RGA_BOOL, Value: v}
+	}
+	return RGAValue{Type: RGA_STR, Value: s}
+}
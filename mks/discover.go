@@ -0,0 +1,148 @@
+package mks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultPort is the TCP port RGA controllers accept clients on
+const DefaultPort = 10014
+
+// maxProbes bounds the concurrent connection attempts of Discover
+const maxProbes = 64
+
+// DiscoveredSensor is a sensor reported by a discovered controller
+type DiscoveredSensor struct {
+	Serial string
+	State  string
+}
+
+// Controller is an RGA controller answering on the network
+type Controller struct {
+	Addr    string // host:port
+	Sensors []DiscoveredSensor
+}
+
+// Dialer connects to a controller, e.g. through a proxy
+type Dialer func(ctx context.Context, addr string) (*net.TCPConn, error)
+
+// HasSensor reports whether the controller reports a sensor with the serial number
+func (c *Controller) HasSensor(serial string) bool {
+	for _, s := range c.Sensors {
+		if s.Serial == serial {
+			return true
+		}
+	}
+	return false
+}
+
+// Discover probes every host of an IPv4 network in CIDR notation, e.g. 192.168.0.0/24, for an RGA controller on the
+// port and lists the sensors of each one found. Controllers don't announce themselves over mDNS or UDP, so a host
+// counts as a controller if it answers InitMsg with the MKSRGA greeting within the timeout. The controllers are
+// returned sorted by address
+func Discover(ctx context.Context, cidr string, port int, timeout time.Duration) ([]Controller, error) {
+	return DiscoverWith(ctx, cidr, port, timeout, nil)
+}
+
+// DiscoverWith is Discover connecting to every host with dial, or directly if dial is nil
+func DiscoverWith(ctx context.Context, cidr string, port int, timeout time.Duration, dial Dialer) ([]Controller, error) {
+	ip, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("Discovery only supports IPv4 networks, got %s", cidr)
+	}
+	if ones, bits := network.Mask.Size(); bits-ones > 16 {
+		return nil, fmt.Errorf("Network %s is too large to probe, use at most a /16", cidr)
+	}
+	var (
+		found []Controller
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, maxProbes)
+	)
+	for host := network.IP.Mask(network.Mask).To4(); network.Contains(host); host = nextIP(host) {
+		if ctx.Err() != nil {
+			break
+		}
+		addr := net.JoinHostPort(host.String(), strconv.Itoa(port))
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			c, err := ProbeWith(ctx, addr, timeout, dial)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			found = append(found, *c)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	sort.Slice(found, func(i, j int) bool { return found[i].Addr < found[j].Addr })
+	return found, ctx.Err()
+}
+
+// Probe connects to the address and lists its sensors if it is an RGA controller
+func Probe(ctx context.Context, addr string, timeout time.Duration) (*Controller, error) {
+	return ProbeWith(ctx, addr, timeout, nil)
+}
+
+// ProbeWith is Probe connecting with dial, or directly if dial is nil
+func ProbeWith(ctx context.Context, addr string, timeout time.Duration, dial Dialer) (*Controller, error) {
+	if dial == nil {
+		dial = func(ctx context.Context, addr string) (*net.TCPConn, error) {
+			d := net.Dialer{Timeout: timeout}
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return nil, err
+			}
+			return conn.(*net.TCPConn), nil
+		}
+	}
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &RGAConnection{TCPConn: conn}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(timeout))
+	if err := c.InitMsg(); err != nil {
+		return nil, err
+	}
+	resp, err := c.Sensors()
+	if err != nil {
+		return nil, err
+	}
+	controller := &Controller{Addr: addr}
+	states := resp.Column("State")
+	for i, serial := range resp.Column("SerialNumber") {
+		s := DiscoveredSensor{Serial: fmt.Sprint(serial.Value)}
+		if i < len(states) {
+			s.State = fmt.Sprint(states[i].Value)
+		}
+		controller.Sensors = append(controller.Sensors, s)
+	}
+	return controller, nil
+}
+
+// nextIP returns the IPv4 address following ip
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
@@ -0,0 +1,60 @@
+/*
+Package mks is a client for the ASCII protocol spoken over TCP by MKS residual gas analysers.
+It has no dependencies outside of the standard library and can be used by any Go program controlling an RGA.
+
+A typical session takes control of the sensor, builds a measurement, runs a scan and releases the sensor:
+
+	conn, err := mks.Dial("192.168.0.77:10014")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.InitMsg(); err != nil {
+		return err
+	}
+	if _, err := conn.Control("my-app", "1.0"); err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err := mks.NewBarchart("Bar1").Range(1, 50).Accuracy(5).Apply(conn); err != nil {
+		return err
+	}
+	if _, err := conn.ScanAdd("Bar1"); err != nil {
+		return err
+	}
+	if _, err := conn.FilamentControl(mks.RGA_ON); err != nil {
+		return err
+	}
+	if _, err := conn.ScanStart(1); err != nil {
+		return err
+	}
+	for {
+		resp, err := conn.ReadResponse()
+		if err != nil {
+			return err
+		}
+		if resp.ErrMsg.CommandName == mks.MassReading {
+			mass, _ := resp.Fields["MassPosition"].Float()
+			value, _ := resp.Fields["Value"].Float()
+			fmt.Printf("mass %v: %e Pa\n", mass, value)
+			if mass == 50 {
+				break
+			}
+		}
+	}
+
+Asynchronous notifications (StartingMeasurement, MassReading, TotalPressure, ...) are read with ReadResponse. Parsers
+for types the package doesn't know are registered with RegisterEventParser, and unknown messages are still returned
+with their raw tokens, see UnknownEvent.
+
+Applications that react to events rather than read them in order subscribe handlers with OnEvent and let Listen read
+the connection:
+
+	conn.OnEvent(mks.FilamentStatus, func(ev mks.Event) {
+		log.Printf("filament %v: %v", ev.Fields["Filament"].Value, ev.Fields["SummaryState"].Value)
+	})
+	err := conn.Listen()
+
+The mks package lives in its own module so it can be imported without pulling in the dependencies of the plugin.
+*/
+package mks
@@ -0,0 +1,123 @@
+package mks
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EventParser parses an asynchronous message whose first token is name. raw holds the whole message
+type EventParser func(name string, raw []byte) (*RGAResponse, error)
+
+var (
+	eventParsersMu sync.RWMutex
+	eventParsers   = make(map[string]EventParser)
+)
+
+// RegisterEventParser registers the parser ReadResponse uses for the asynchronous messages named name, so new event
+// types, or quirks of known ones, can be handled without changing the package. It replaces the built-in parser of a
+// known type and any parser previously registered for name
+func RegisterEventParser(name string, p EventParser) {
+	eventParsersMu.Lock()
+	defer eventParsersMu.Unlock()
+	eventParsers[name] = p
+}
+
+// eventParser returns the parser registered for name, nil if none is
+func eventParser(name string) EventParser {
+	eventParsersMu.RLock()
+	defer eventParsersMu.RUnlock()
+	return eventParsers[name]
+}
+
+// UnknownEvent is an asynchronous message of a type the package doesn't know and no parser is registered for
+type UnknownEvent struct {
+	Name   string   // first token of the message
+	Fields []string // the other tokens of the message, line after line
+	Raw    []byte
+}
+
+// Unknown returns the message if the response is an asynchronous message of an unknown type
+func (r *RGAResponse) Unknown() (*UnknownEvent, bool) {
+	return r.event, r.event != nil
+}
+
+// parseUnknownEvent returns the message as a response named after its first token, with its other tokens as the
+// fields Value1, Value2, ... typed like those of other responses. A second token of OK or ERROR is kept as the status,
+// messages without one are OK
+func parseUnknownEvent(raw []byte) *RGAResponse {
+	tokens := fieldRe.FindAllString(string(bytes.ReplaceAll(raw, delim, []byte(" "))), -1)
+	ev := &UnknownEvent{Name: tokens[0], Fields: tokens[1:], Raw: bytes.Clone(raw)}
+	status := RGA_OK
+	if len(ev.Fields) > 0 && RGAErrStr(ev.Fields[0]) == RGA_ERROR {
+		status = RGA_ERROR
+	}
+	fields := make(map[string]RGAValue, len(ev.Fields))
+	for i, f := range ev.Fields {
+		fields["Value"+strconv.Itoa(i+1)] = parseValue(f)
+	}
+	return &RGAResponse{
+		ErrMsg: RGARespErr{CommandName: ev.Name, Err: status},
+		Fields: fields,
+		event:  ev,
+	}
+}
+
+// AllEvents subscribes a handler to every asynchronous message
+const AllEvents = ""
+
+// Event is an asynchronous message read from the RGA
+type Event struct {
+	Name string
+	Time time.Time // when it was read
+	*RGAResponse
+}
+
+// EventHandler reacts to an asynchronous message. It runs on the goroutine reading the connection, so it must not read
+// from the connection nor block for long
+type EventHandler func(ev Event)
+
+// eventHandlers holds the handlers subscribed to a connection, by message name
+type eventHandlers struct {
+	mu       sync.RWMutex
+	handlers map[string][]EventHandler
+}
+
+// OnEvent subscribes the handler to the asynchronous messages named name, e.g. MassReading or FilamentStatus, or to
+// every message with AllEvents. Handlers are called in the order they subscribed by ReadResponse, or by Listen for
+// applications that only react to events, before the message is returned
+func (c *RGAConnection) OnEvent(name string, h EventHandler) {
+	if c.events == nil {
+		c.events = &eventHandlers{handlers: make(map[string][]EventHandler)}
+	}
+	c.events.mu.Lock()
+	defer c.events.mu.Unlock()
+	c.events.handlers[name] = append(c.events.handlers[name], h)
+}
+
+// Listen reads the asynchronous messages and dispatches them to the handlers until a read fails, e.g. because the
+// connection closed or its read deadline passed, and returns the error
+func (c *RGAConnection) Listen() error {
+	for {
+		if _, err := c.ReadResponse(); err != nil {
+			return err
+		}
+	}
+}
+
+// dispatch calls the handlers subscribed to the message, then those subscribed to every message
+func (c *RGAConnection) dispatch(resp *RGAResponse) {
+	if c.events == nil || resp == nil {
+		return
+	}
+	c.events.mu.RLock()
+	named := c.events.handlers[resp.ErrMsg.CommandName]
+	// copied so handlers subscribing while others run don't race with the loop
+	handlers := append(named[:len(named):len(named)], c.events.handlers[AllEvents]...)
+	c.events.mu.RUnlock()
+	ev := Event{Name: resp.ErrMsg.CommandName, Time: time.Now(), RGAResponse: resp}
+	for _, h := range handlers {
+		h(ev)
+	}
+}
@@ -0,0 +1,83 @@
+package mks
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUnknownEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		status RGAErrStr
+		fields []string
+		values map[string]interface{}
+	}{
+		{name: "no status", raw: "PumpState 3 Running", status: RGA_OK, fields: []string{"3", "Running"}, values: map[string]interface{}{"Value1": int64(3), "Value2": "Running"}},
+		{name: "OK", raw: "PumpState OK\r\n  State Running", status: RGA_OK, fields: []string{"OK", "State", "Running"}},
+		{name: "ERROR", raw: "PumpState ERROR\r\n  Number 201\r\n  Description Pump fault", status: RGA_ERROR, fields: []string{"ERROR", "Number", "201", "Description", "Pump", "fault"}},
+		{name: "name only", raw: "Heartbeat", status: RGA_OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := parseUnknownEvent([]byte(tt.raw))
+			ev, ok := resp.Unknown()
+			if !ok {
+				t.Fatal("Unknown() = false, want the unknown event")
+			}
+			if resp.ErrMsg.CommandName != ev.Name || ev.Name != splitFields([]byte(tt.raw))[0] {
+				t.Errorf("name = %q, event %q", resp.ErrMsg.CommandName, ev.Name)
+			}
+			if resp.ErrMsg.Err != tt.status {
+				t.Errorf("status = %s, want %s", resp.ErrMsg.Err, tt.status)
+			}
+			if len(ev.Fields) != len(tt.fields) || (len(tt.fields) > 0 && !reflect.DeepEqual(ev.Fields, tt.fields)) {
+				t.Errorf("fields = %q, want %q", ev.Fields, tt.fields)
+			}
+			for name, want := range tt.values {
+				if got := resp.Fields[name].Value; got != want {
+					t.Errorf("%s = %#v, want %#v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEventDispatch(t *testing.T) {
+	RegisterEventParser("TestPing", func(name string, raw []byte) (*RGAResponse, error) {
+		return &RGAResponse{ErrMsg: RGARespErr{CommandName: name, Err: RGA_OK}, Fields: map[string]RGAValue{"Raw": {Type: RGA_STR, Value: string(raw)}}}, nil
+	})
+	t.Cleanup(func() {
+		eventParsersMu.Lock()
+		delete(eventParsers, "TestPing")
+		eventParsersMu.Unlock()
+	})
+	tests := []struct {
+		name    string
+		message string
+		named   int // calls of the handler subscribed to its name
+		unknown bool
+	}{
+		{name: "registered", message: message("TestPing 42"), named: 1},
+		{name: "unknown", message: message("PumpState 3"), unknown: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fakeRGA(t, tt.message)
+			var named, all []string
+			c.OnEvent("TestPing", func(ev Event) { named = append(named, ev.Name) })
+			c.OnEvent(AllEvents, func(ev Event) { all = append(all, ev.Name) })
+			c.Write([]byte("\r\n"))
+			resp, err := c.ReadResponse()
+			if err != nil {
+				t.Fatalf("ReadResponse() error = %v", err)
+			}
+			if len(named) != tt.named || len(all) != 1 || all[0] != resp.ErrMsg.CommandName {
+				t.Errorf("dispatched %v to the named handler and %v to every message", named, all)
+			}
+			if _, ok := resp.Unknown(); ok != tt.unknown {
+				t.Errorf("Unknown() = %v, want %v", ok, tt.unknown)
+			}
+		})
+	}
+}
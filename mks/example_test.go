@@ -0,0 +1,158 @@
+package mks_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+// simulatedResponses answers the commands of the examples the way the sensor does
+var simulatedResponses = map[string][]string{
+	"":             {"MKSRGA Multi", "Protocol_Revision 1.1", "Min_Compatibility 1.1"},
+	"Control":      {"Control OK", "  User example", "  Version 1.0"},
+	"EGains":       {"EGains OK", "  Index Gain Name", "  0 1 Faraday"},
+	"DetectorInfo": {"DetectorInfo OK", "  SourceIndex 0", "  Detector Factor Voltage", "  0 1.0 0"},
+}
+
+// simulatedScan is sent once a scan starts, a message at a time
+var simulatedScan = [][]string{
+	{"StartingScan 1 0 0"},
+	{"StartingMeasurement Bar1"},
+	{"MassReading 1 1.2e-9"},
+	{"MassReading 2 4.5e-7"},
+	{"MassReading 3 3.1e-10"},
+}
+
+// simulatedRGA serves a sensor answering every command OK on a local port, reading three masses once a scan starts,
+// and returns its address
+func simulatedRGA() string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		conn, err := l.Accept()
+		l.Close()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		send := func(lines []string) {
+			conn.Write([]byte(strings.Join(lines, "\r\n") + "\r\n\r\n\r\r"))
+			// the sensor sends every message on its own
+			time.Sleep(20 * time.Millisecond)
+		}
+		sc := bufio.NewScanner(conn)
+		sc.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+			if i := bytes.Index(data, []byte("\n\r")); i >= 0 {
+				return i + 2, data[:i], nil
+			}
+			return 0, nil, nil
+		})
+		for sc.Scan() {
+			command, _, _ := strings.Cut(strings.TrimSpace(sc.Text()), " ")
+			lines, ok := simulatedResponses[command]
+			if !ok {
+				lines = []string{command + " OK"}
+			}
+			send(lines)
+			if command == "ScanStart" {
+				for _, m := range simulatedScan {
+					send(m)
+				}
+			}
+		}
+	}()
+	return l.Addr().String()
+}
+
+// A scan of the masses 1 to 3, read from the asynchronous MassReading messages
+func ExampleDial() {
+	conn, err := mks.Dial(simulatedRGA())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.InitMsg(); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := conn.Control("example", "1.0"); err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Release()
+	if _, err := mks.NewBarchart("Bar1").Range(1, 3).Filter(mks.RGA_PeakCenter).Accuracy(5).Apply(conn); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := conn.ScanAdd("Bar1"); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := conn.ScanStart(1); err != nil {
+		log.Fatal(err)
+	}
+	for {
+		resp, err := conn.ReadResponse()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if resp.ErrMsg.CommandName == mks.MassReading {
+			mass, _ := resp.Fields["MassPosition"].Float()
+			value, _ := resp.Fields["Value"].Float()
+			fmt.Printf("mass %v: %.1e Pa\n", mass, value)
+			if mass == 3 {
+				break
+			}
+		}
+	}
+	// Output:
+	// mass 1: 1.2e-09 Pa
+	// mass 2: 4.5e-07 Pa
+	// mass 3: 3.1e-10 Pa
+}
+
+// A session removes the measurements it added and releases the sensor when it closes
+func ExampleWithSession() {
+	conn, err := mks.Dial(simulatedRGA())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	err = mks.WithSession(context.Background(), conn, "example", "1.0", func(s *mks.Session) error {
+		if _, err := s.Add(mks.NewBarchart("Bar1").Range(1, 3).Filter(mks.RGA_PeakCenter).Accuracy(5)); err != nil {
+			return err
+		}
+		if _, err := s.ScanAdd("Bar1"); err != nil {
+			return err
+		}
+		if _, err := s.ScanStart(1); err != nil {
+			return err
+		}
+		var readings int
+		for readings < 3 {
+			resp, err := s.ReadResponse()
+			if err != nil {
+				return err
+			}
+			switch resp.ErrMsg.CommandName {
+			case mks.StartingMeasurement:
+				fmt.Println("measuring", resp.Fields["MeasurementName"].Value)
+			case mks.MassReading:
+				readings++
+			}
+		}
+		fmt.Println(readings, "readings")
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Output:
+	// measuring Bar1
+	// 3 readings
+}
@@ -0,0 +1,189 @@
+package mks
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNotSupportedByFirmware is returned, wrapped with the command and the versions involved, instead of sending a
+// command the firmware of the sensor doesn't support
+var ErrNotSupportedByFirmware = errors.New("not supported by firmware")
+
+// Version is a dotted version number, e.g. the protocol revision 1.2 or the firmware version 2.0.13
+type Version []int
+
+// ParseVersion parses a dotted version number. Leading letters, e.g. V2.0, are ignored
+func ParseVersion(s string) (Version, error) {
+	s = strings.TrimLeft(strings.TrimSpace(s), "vV")
+	if s == "" {
+		return nil, fmt.Errorf("Blank version")
+	}
+	parts := strings.Split(s, ".")
+	v := make(Version, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid version %s", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 if v is older than, the same as or newer than o. Missing parts count as 0
+func (v Version) Compare(o Version) int {
+	for i := 0; i < len(v) || i < len(o); i++ {
+		var a, b int
+		if i < len(v) {
+			a = v[i]
+		}
+		if i < len(o) {
+			b = o[i]
+		}
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	}
+	return 0
+}
+
+// String formats the version
+func (v Version) String() string {
+	parts := make([]string, len(v))
+	for i, n := range v {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Firmware describes what the sensor reported about its firmware. A version is nil if it wasn't reported
+type Firmware struct {
+	Protocol         Version // Protocol_Revision answered to InitMsg
+	MinCompatibility Version // Min_Compatibility answered to InitMsg
+	Version          Version // FirmwareVersion reported by Info
+}
+
+// Requirement is the oldest protocol revision and firmware version supporting a command. A nil version is no
+// requirement
+type Requirement struct {
+	Protocol Version
+	Firmware Version
+}
+
+// FirmwareRequirements is the capability matrix: the commands older firmware doesn't know, by name. It is copied by
+// DetectFirmware, so changes only apply to connections detected afterwards. Add entries, or delete them, as firmware
+// quirks are found
+var FirmwareRequirements = map[string]Requirement{
+	startDegas:            {Protocol: Version{1, 1}},
+	stopDegas:             {Protocol: Version{1, 1}},
+	detectorFactor:        {Protocol: Version{1, 1}},
+	rvcStatus:             {Protocol: Version{1, 1}},
+	rvcPumpStatus:         {Protocol: Version{1, 1}},
+	rvcHeaterStatus:       {Protocol: Version{1, 1}},
+	rvcValveStatus:        {Protocol: Version{1, 1}},
+	rvcValveMode:          {Protocol: Version{1, 1}},
+	rvcInterlocks:         {Protocol: Version{1, 1}},
+	rvcDigitalInput:       {Protocol: Version{1, 1}},
+	cirrusInfo:            {Protocol: Version{1, 2}},
+	cirrusCapillaryHeater: {Protocol: Version{1, 2}},
+	cirrusHeater:          {Protocol: Version{1, 2}},
+	cirrusPump:            {Protocol: Version{1, 2}},
+	cirrusValvePosition:   {Protocol: Version{1, 2}},
+}
+
+// compatibility holds what the sensor reported about its firmware and, once detected, the requirements gating commands
+type compatibility struct {
+	firmware Firmware
+	matrix   map[string]Requirement // nil until DetectFirmware, commands aren't gated before
+	rejected error                  // returned by the Read following a command refused by Write
+}
+
+// recordProtocol keeps the protocol revision of the InitMsg answer, whose lines follow the ACK line
+func (c *RGAConnection) recordProtocol(lines [][]byte) {
+	if c.compat == nil {
+		c.compat = &compatibility{}
+	}
+	for _, line := range lines {
+		fields := fieldRe.FindAllString(string(line), 2)
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := ParseVersion(fields[1])
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "Protocol_Revision":
+			c.compat.firmware.Protocol = v
+		case "Min_Compatibility":
+			c.compat.firmware.MinCompatibility = v
+		}
+	}
+}
+
+// DetectFirmware reads the firmware version with Info and, from then on, answers the commands the firmware doesn't
+// support according to FirmwareRequirements with an error wrapping ErrNotSupportedByFirmware instead of sending
+// them. The protocol revision is the one recorded by InitMsg. A requirement on a version the sensor didn't report
+// never refuses a command
+func (c *RGAConnection) DetectFirmware() (*Firmware, error) {
+	resp, err := c.Info()
+	if err != nil {
+		return nil, err
+	}
+	if c.compat == nil {
+		c.compat = &compatibility{}
+	}
+	for _, name := range []string{"FirmwareVersion", "Firmware", "Version"} {
+		if v, err := ParseVersion(fieldString(resp, name)); err == nil {
+			c.compat.firmware.Version = v
+			break
+		}
+	}
+	c.compat.matrix = make(map[string]Requirement, len(FirmwareRequirements))
+	for command, req := range FirmwareRequirements {
+		c.compat.matrix[command] = req
+	}
+	fw := c.compat.firmware
+	return &fw, nil
+}
+
+// SetFirmwareRequirement overrides the requirement of a command on this connection, e.g. from the configuration. A
+// zero Requirement lifts it. It applies once DetectFirmware was called
+func (c *RGAConnection) SetFirmwareRequirement(command string, req Requirement) {
+	if c.compat == nil || c.compat.matrix == nil {
+		return
+	}
+	if req.Protocol == nil && req.Firmware == nil {
+		delete(c.compat.matrix, command)
+		return
+	}
+	c.compat.matrix[command] = req
+}
+
+// Supports returns an error wrapping ErrNotSupportedByFirmware if the detected firmware doesn't support the command
+func (c *RGAConnection) Supports(command string) error {
+	if c.compat == nil {
+		return nil
+	}
+	return c.compat.check(command)
+}
+
+// check returns an error if the requirement of the command isn't met
+func (s *compatibility) check(command string) error {
+	req, ok := s.matrix[command]
+	if !ok {
+		return nil
+	}
+	if have := s.firmware.Protocol; req.Protocol != nil && have != nil && have.Compare(req.Protocol) < 0 {
+		return fmt.Errorf("%s %w: it needs protocol revision %s, the sensor has %s", command, ErrNotSupportedByFirmware, req.Protocol, have)
+	}
+	if have := s.firmware.Version; req.Firmware != nil && have != nil && have.Compare(req.Firmware) < 0 {
+		return fmt.Errorf("%s %w: it needs firmware %s, the sensor has %s", command, ErrNotSupportedByFirmware, req.Firmware, have)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package mks
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Version
+		err  bool
+	}{
+		{s: "1.2", want: Version{1, 2}},
+		{s: "2.0.13", want: Version{2, 0, 13}},
+		{s: " V2.0 ", want: Version{2, 0}},
+		{s: "v3", want: Version{3}},
+		{s: "", err: true},
+		{s: "V", err: true},
+		{s: "1.x", err: true},
+		{s: "1..2", err: true},
+	}
+	for _, tt := range tests {
+		v, err := ParseVersion(tt.s)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseVersion(%q) error = %v, want error %v", tt.s, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.want) {
+			t.Errorf("ParseVersion(%q) = %v, want %v", tt.s, v, tt.want)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		a, b Version
+		want int
+	}{
+		{Version{1, 2}, Version{1, 2}, 0},
+		{Version{1, 2}, Version{1, 2, 0}, 0},
+		{Version{1, 1}, Version{1, 2}, -1},
+		{Version{1, 10}, Version{1, 9}, 1},
+		{Version{2}, Version{1, 9, 9}, 1},
+		{Version{1, 2}, Version{1, 2, 1}, -1},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Compare(tt.b); got != tt.want {
+			t.Errorf("%v.Compare(%v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCompatibilityCheck(t *testing.T) {
+	matrix := map[string]Requirement{
+		startDegas:   {Protocol: Version{1, 1}},
+		cirrusInfo:   {Protocol: Version{1, 2}, Firmware: Version{2, 0}},
+		cirrusHeater: {Firmware: Version{3}},
+	}
+	tests := []struct {
+		name     string
+		firmware Firmware
+		command  string
+		refused  bool
+	}{
+		{name: "no requirement", firmware: Firmware{Protocol: Version{1, 0}}, command: info},
+		{name: "protocol met", firmware: Firmware{Protocol: Version{1, 1}}, command: startDegas},
+		{name: "protocol too old", firmware: Firmware{Protocol: Version{1, 0}}, command: startDegas, refused: true},
+		{name: "firmware too old", firmware: Firmware{Protocol: Version{1, 2}, Version: Version{1, 9}}, command: cirrusInfo, refused: true},
+		{name: "both met", firmware: Firmware{Protocol: Version{1, 3}, Version: Version{2, 0, 1}}, command: cirrusInfo},
+		{name: "version not reported", firmware: Firmware{Protocol: Version{1, 2}}, command: cirrusHeater},
+		{name: "nothing reported", command: startDegas},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &compatibility{firmware: tt.firmware, matrix: matrix}
+			err := s.check(tt.command)
+			if errors.Is(err, ErrNotSupportedByFirmware) != tt.refused {
+				t.Errorf("check(%s) = %v, want refused %v", tt.command, err, tt.refused)
+			}
+		})
+	}
+}
+
+func TestRecordProtocol(t *testing.T) {
+	c := &RGAConnection{}
+	c.recordProtocol([][]byte{[]byte("  Protocol_Revision 1.2"), []byte("  Min_Compatibility 1.0"), []byte("  Garbage"), []byte("  Other 2.0")})
+	want := Firmware{Protocol: Version{1, 2}, MinCompatibility: Version{1, 0}}
+	if !reflect.DeepEqual(c.compat.firmware, want) {
+		t.Errorf("recordProtocol() = %+v, want %+v", c.compat.firmware, want)
+	}
+}
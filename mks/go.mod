@@ -0,0 +1,3 @@
+module github.com/SSSOC-CAN/mks-rga-plugin/mks
+
+go 1.21
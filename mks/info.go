@@ -0,0 +1,97 @@
+package mks
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxSourceTables bounds the enumeration of the source tables in case the sensor never rejects an index
+var maxSourceTables = 16
+
+// SourceTable is a source settings table, with the settings named as SourceInfo reports them
+type SourceTable struct {
+	Index    int
+	Settings map[string]RGAValue
+}
+
+// Detector is an entry of the detector table of a source table: the Faraday at index 0 followed by the multiplier
+// settings, with the settings named as DetectorInfo reports them
+type Detector struct {
+	SourceIndex int
+	Index       int
+	Settings    map[string]RGAValue
+}
+
+// SourceInfoIndex returns the settings of the given source table
+func (c *RGAConnection) SourceInfoIndex(SourceIndexZero int) (*RGAResponse, error) {
+	fmt.Fprintf(c, "%s %d%s", sourceInfo, SourceIndexZero, commandSuffix)
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
+	_, err := c.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	resp := bytes.Split(buf, commandEnd) // The whole response minus the empty bytes leftover
+	return parseMixedResp(resp[0])
+}
+
+// AllSources reads every source table, from index 0 until the sensor rejects an index
+func (c *RGAConnection) AllSources() ([]SourceTable, error) {
+	var sources []SourceTable
+	for i := 0; i < maxSourceTables; i++ {
+		resp, err := c.SourceInfoIndex(i)
+		if isRGAError(err) && i > 0 {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		sources = append(sources, SourceTable{Index: i, Settings: resp.Fields})
+	}
+	return sources, nil
+}
+
+// AllDetectors reads the detector table of every source table
+func (c *RGAConnection) AllDetectors() ([]Detector, error) {
+	sources, err := c.AllSources()
+	if err != nil {
+		return nil, err
+	}
+	var detectors []Detector
+	for _, s := range sources {
+		resp, err := c.DetectorInfo(s.Index)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read detectors of source %d: %w", s.Index, err)
+		}
+		for i, row := range resp.TableRows() {
+			detectors = append(detectors, Detector{SourceIndex: s.Index, Index: i, Settings: row})
+		}
+	}
+	return detectors, nil
+}
+
+// TableRows returns the rows of the table of a horizontal or mixed response, with the fields named by their header
+// without the row suffix. The name value lines of mixed responses are left out
+func (r *RGAResponse) TableRows() []map[string]RGAValue {
+	rows := make([]map[string]RGAValue, r.Rows)
+	for i := range rows {
+		rows[i] = make(map[string]RGAValue, len(r.cols))
+		for _, header := range r.cols {
+			name := header
+			if i > 0 {
+				name += strconv.Itoa(i)
+			}
+			if v, ok := r.Fields[name]; ok {
+				rows[i][header] = v
+			}
+		}
+	}
+	return rows
+}
+
+// isRGAError reports whether the sensor answered the command with an error, as opposed to the connection failing
+func isRGAError(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), string(RGA_ERROR)+"\n")
+}
@@ -0,0 +1,39 @@
+package mks
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LinkDownError reports a LinkDown event, sent by the sensor before it drops the connection
+type LinkDownError struct {
+	Reason string // free text reason reported by the sensor
+}
+
+// Error implements the error interface
+func (e *LinkDownError) Error() string {
+	if e.Reason == "" {
+		return "sensor reported link down"
+	}
+	return fmt.Sprintf("sensor reported link down: %s", e.Reason)
+}
+
+// TakenOver reports whether the link went down because another client took control of the sensor. The protocol
+// documents no fixed set of reasons, so any reason mentioning control or another client counts as a takeover
+func (e *LinkDownError) TakenOver() bool {
+	reason := strings.ToLower(e.Reason)
+	for _, word := range []string{"control", "client", "taken", "takeover"} {
+		if strings.Contains(reason, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// LinkDownFromResponse returns the LinkDownError described by a LinkDown event, nil for any other response
+func LinkDownFromResponse(resp *RGAResponse) *LinkDownError {
+	if resp == nil || resp.ErrMsg.CommandName != LinkDown {
+		return nil
+	}
+	return &LinkDownError{Reason: fieldString(resp, "Reason")}
+}
@@ -0,0 +1,62 @@
+package mks
+
+import (
+	"testing"
+)
+
+func TestLinkDownTakenOver(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   bool
+	}{
+		{"", false},
+		{"Network timeout", false},
+		{"Another client has taken control", true},
+		{"Control requested by 10.0.0.4", true},
+		{"TAKEOVER", true},
+		{"Sensor shutting down", false},
+	}
+	for _, tt := range tests {
+		if got := (&LinkDownError{Reason: tt.reason}).TakenOver(); got != tt.want {
+			t.Errorf("TakenOver() with reason %q = %v, want %v", tt.reason, got, tt.want)
+		}
+	}
+}
+
+func TestLinkDownFromResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		resp   *RGAResponse
+		reason string
+		down   bool
+	}{
+		{name: "nil"},
+		{name: "other message", resp: &RGAResponse{ErrMsg: RGARespErr{CommandName: "MassReading"}}},
+		{name: "no reason", resp: &RGAResponse{ErrMsg: RGARespErr{CommandName: LinkDown}}, down: true},
+		{name: "reason", resp: &RGAResponse{ErrMsg: RGARespErr{CommandName: LinkDown}, Fields: map[string]RGAValue{"Reason": {Type: RGA_STR, Value: "Timeout"}}}, reason: "Timeout", down: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ld := LinkDownFromResponse(tt.resp)
+			if (ld != nil) != tt.down {
+				t.Fatalf("LinkDownFromResponse() = %v, want link down %v", ld, tt.down)
+			}
+			if ld != nil && ld.Reason != tt.reason {
+				t.Errorf("reason = %q, want %q", ld.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestReadLinkDown(t *testing.T) {
+	c := fakeRGA(t, message("LinkDown Another client has taken control"))
+	c.Write([]byte("\r\n"))
+	resp, err := c.ReadResponse()
+	if err != nil {
+		t.Fatalf("ReadResponse() error = %v", err)
+	}
+	ld := LinkDownFromResponse(resp)
+	if ld == nil || ld.Reason != "Another client has taken control" || !ld.TakenOver() {
+		t.Errorf("LinkDownFromResponse() = %v, want a takeover", ld)
+	}
+}
@@ -0,0 +1,90 @@
+package mks
+
+import (
+	"fmt"
+)
+
+type RGAMeasurementEdit string
+
+const (
+	RGA_EDIT_ADD_MASS    RGAMeasurementEdit = "MeasurementAddMass"
+	RGA_EDIT_REMOVE_MASS RGAMeasurementEdit = "MeasurementRemoveMass"
+	RGA_EDIT_START_MASS  RGAMeasurementEdit = "MeasurementStartMass"
+	RGA_EDIT_END_MASS    RGAMeasurementEdit = "MeasurementEndMass"
+	RGA_EDIT_ACCURACY    RGAMeasurementEdit = "MeasurementAccuracy"
+	RGA_EDIT_EGAIN       RGAMeasurementEdit = "MeasurementEGainIndex"
+	RGA_EDIT_DETECTOR    RGAMeasurementEdit = "MeasurementDetectorIndex"
+)
+
+// MeasurementEdit is a single modification to be applied to an existing measurement
+type MeasurementEdit struct {
+	Edit  RGAMeasurementEdit
+	Value int
+}
+
+// AddMass returns an edit adding a mass to a peak jump measurement
+func AddMass(Mass int) MeasurementEdit {
+	return MeasurementEdit{Edit: RGA_EDIT_ADD_MASS, Value: Mass}
+}
+
+// RemoveMass returns an edit removing the mass at MassIndex from a peak jump measurement
+func RemoveMass(MassIndex int) MeasurementEdit {
+	return MeasurementEdit{Edit: RGA_EDIT_REMOVE_MASS, Value: MassIndex}
+}
+
+// StartMass returns an edit changing the start mass of an analog or barchart measurement
+func StartMass(Mass int) MeasurementEdit {
+	return MeasurementEdit{Edit: RGA_EDIT_START_MASS, Value: Mass}
+}
+
+// EndMass returns an edit changing the end mass of an analog or barchart measurement
+func EndMass(Mass int) MeasurementEdit {
+	return MeasurementEdit{Edit: RGA_EDIT_END_MASS, Value: Mass}
+}
+
+// Accuracy returns an edit changing the accuracy code of a measurement
+func Accuracy(Accuracy int) MeasurementEdit {
+	return MeasurementEdit{Edit: RGA_EDIT_ACCURACY, Value: Accuracy}
+}
+
+// EGainIndex returns an edit changing the electronic gain index of a measurement, an index of the EGains list
+func EGainIndex(Index int) MeasurementEdit {
+	return MeasurementEdit{Edit: RGA_EDIT_EGAIN, Value: Index}
+}
+
+// DetectorIndex returns an edit changing the detector of a measurement, 0 for the Faraday
+func DetectorIndex(Index int) MeasurementEdit {
+	return MeasurementEdit{Edit: RGA_EDIT_DETECTOR, Value: Index}
+}
+
+// EditMeasurement selects the given measurement and applies each edit in order. It should only be called between scans
+func (c *RGAConnection) EditMeasurement(MeasurementName string, Edits ...MeasurementEdit) error {
+	_, err := c.MeasurementSelect(MeasurementName)
+	if err != nil {
+		return fmt.Errorf("Could not select measurement %s: %v", MeasurementName, err)
+	}
+	for _, edit := range Edits {
+		switch edit.Edit {
+		case RGA_EDIT_ADD_MASS:
+			_, err = c.MeasurementAddMass(edit.Value)
+		case RGA_EDIT_REMOVE_MASS:
+			_, err = c.MeasurementRemoveMass(edit.Value)
+		case RGA_EDIT_START_MASS:
+			_, err = c.MeasurmentStartMass(edit.Value)
+		case RGA_EDIT_END_MASS:
+			_, err = c.MeasurementEndMass(edit.Value)
+		case RGA_EDIT_ACCURACY:
+			_, err = c.MeasurementAccuracy(edit.Value)
+		case RGA_EDIT_EGAIN:
+			_, err = c.MeasurementEGainIndex(edit.Value)
+		case RGA_EDIT_DETECTOR:
+			_, err = c.MeasurementDetectorIndex(edit.Value)
+		default:
+			return fmt.Errorf("Unknown measurement edit: %s", edit.Edit)
+		}
+		if err != nil {
+			return fmt.Errorf("Could not apply %s %d to %s: %v", edit.Edit, edit.Value, MeasurementName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package mks
+
+import (
+	"bytes"
+	"time"
+)
+
+// readObserver tracks the command awaiting a response
+type readObserver struct {
+	onRead  func(command string, latency time.Duration, n int)
+	pending string
+	sentAt  time.Time
+}
+
+// Observe registers a function called after every read with the command being answered, its round trip latency and
+// the number of bytes read. The command is blank for asynchronous responses
+func (c *RGAConnection) Observe(onRead func(command string, latency time.Duration, n int)) {
+	c.obs = &readObserver{onRead: onRead}
+}
+
+// Write sends the command to the RGA once the rate limiter allows it, remembering it so the latency of its response
+// can be reported. Tuning commands are answered locally in dry-run mode, and commands the firmware doesn't support are
+// not sent once DetectFirmware was called
+func (c RGAConnection) Write(b []byte) (int, error) {
+	gated := c.compat != nil && c.compat.matrix != nil
+	if c.obs == nil && c.lim == nil && c.dry == nil && c.strict == nil && c.tmo == nil && !gated {
+		return c.TCPConn.Write(b)
+	}
+	name := b
+	if i := bytes.IndexAny(b, " \r\n"); i >= 0 {
+		name = b[:i]
+	}
+	if gated {
+		if err := c.compat.check(string(name)); err != nil {
+			c.compat.rejected = err
+			return len(b), nil
+		}
+	}
+	if c.dry != nil && c.dry.intercept(string(name), b) {
+		return len(b), nil
+	}
+	if c.lim != nil {
+		c.lim.wait(string(name))
+	}
+	if c.obs != nil {
+		c.obs.pending = string(name)
+		c.obs.sentAt = time.Now()
+	}
+	if c.strict != nil {
+		c.strict.pending = string(name)
+	}
+	if c.tmo != nil {
+		if err := c.tmo.outOfSync(); err != nil {
+			return 0, err
+		}
+		c.tmo.pending = string(name)
+		c.tmo.sentAt = time.Now()
+	}
+	return c.TCPConn.Write(b)
+}
+
+// Read reads from the RGA and reports the read to the observer. In dry-run mode the synthesized response of an
+// intercepted command is read first. In strict mode the response to a command is checked before it is returned. The
+// response to a command is bounded by its timeout if SetCommandTimeouts was called. A command refused because of the
+// firmware fails here, it was never sent
+func (c RGAConnection) Read(b []byte) (int, error) {
+	if c.compat != nil && c.compat.rejected != nil {
+		err := c.compat.rejected
+		c.compat.rejected = nil
+		return 0, err
+	}
+	if c.dry != nil {
+		if n, ok := c.dry.read(b); ok {
+			return n, nil
+		}
+	}
+	var (
+		n   int
+		err error
+	)
+	if c.tmo != nil {
+		n, err = c.readCommand(b)
+	} else {
+		n, err = c.TCPConn.Read(b)
+	}
+	if c.obs != nil && n > 0 {
+		var latency time.Duration
+		if c.obs.pending != "" {
+			latency = time.Since(c.obs.sentAt)
+		}
+		c.obs.onRead(c.obs.pending, latency, n)
+		c.obs.pending = ""
+	}
+	if c.strict != nil && err == nil {
+		command := c.strict.pending
+		c.strict.pending = ""
+		if command != "" {
+			if perr := checkResponse(command, b[:n]); perr != nil {
+				return n, c.strict.reject(perr)
+			}
+		}
+	}
+	return n, err
+}
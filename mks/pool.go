@@ -0,0 +1,56 @@
+package mks
+
+import (
+	"regexp"
+	"sync"
+)
+
+var (
+	// fieldRe splits response lines into fields. It is safe for concurrent use
+	fieldRe = regexp.MustCompile(fieldRegex)
+	// bufPool holds the read buffers of the commands, avoiding a fresh BUFFER sized allocation per command
+	bufPool = sync.Pool{
+		New: func() interface{} {
+			b := make([]byte, BUFFER)
+			return &b
+		},
+	}
+)
+
+// getBuffer returns a zeroed read buffer of BUFFER bytes. It is returned with putBuffer through the same pointer, so
+// that pooling it never allocates
+func getBuffer() *[]byte {
+	return bufPool.Get().(*[]byte)
+}
+
+// putBuffer zeroes the buffer and returns it to the pool. The responses are parsed by splitting on commandEnd, so
+// leftovers of a longer previous response must not survive in the buffer
+func putBuffer(buf *[]byte) {
+	clear(*buf)
+	bufPool.Put(buf)
+}
+
+// splitFields splits the line into its runs of non-space bytes, as fieldRe does, without the regexp machinery. The
+// fields share a single conversion of the line, readResponse runs it on every asynchronous message
+func splitFields(line []byte) []string {
+	s := string(line)
+	fields := make([]string, 0, 4)
+	start := -1
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case ' ', '\t', '\n', '\f', '\r':
+			if start >= 0 {
+				fields = append(fields, s[start:i])
+				start = -1
+			}
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, s[start:])
+	}
+	return fields
+}
@@ -0,0 +1,75 @@
+package mks
+
+import (
+	"net"
+	"testing"
+)
+
+// pingRGA answers every write of the client with the message, until the benchmark ends
+func pingRGA(b *testing.B, msg string) *RGAConnection {
+	b.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, BUFFER)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+			if _, err := conn.Write([]byte(msg)); err != nil {
+				return
+			}
+		}
+	}()
+	c, err := Dial(l.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { c.Close() })
+	return c
+}
+
+func BenchmarkReadResponse(b *testing.B) {
+	c := pingRGA(b, message("MassReading 28 1.5e-9"))
+	ping := []byte(commandSuffix)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Write(ping)
+		if _, err := c.ReadResponse(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseResponse(b *testing.B) {
+	c := &RGAConnection{}
+	buf := make([]byte, BUFFER)
+	copy(buf, message("MassReading 28 1.5e-9"))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.parseResponse(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseHorizontalResp(b *testing.B) {
+	resp := []byte(message("DetectorInfo OK", "  Detector Factor Voltage", "  0 1.0 0", "  1 2.5e-4 950", "  2 1.1e-3 1200.0"))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := parseHorizontalResp(resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
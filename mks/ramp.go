@@ -0,0 +1,92 @@
+package mks
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RGA_FILAMENT_BAD_EMISSION is the filament summary state reported when the emission can't be regulated
+const RGA_FILAMENT_BAD_EMISSION = "BAD-EMISSION"
+
+// VoltageRamp describes a gradual change of the multiplier voltage
+type VoltageRamp struct {
+	SourceIndex   int
+	DetectorIndex int
+	Filament      int // 1 or 2, or 0 for both filaments
+	From          int // starting voltage [V]
+	To            int // target voltage [V]
+	Step          int // voltage change per step [V]
+	Delay         time.Duration
+}
+
+// RampDetectorVoltage changes the multiplier voltage to the target in steps, waiting between steps and checking the
+// filament emission before each one, rather than applying the full change at once. The ramp stops at the current
+// voltage if the context is cancelled or the emission goes bad
+func (c *RGAConnection) RampDetectorVoltage(ctx context.Context, r VoltageRamp) error {
+	if r.Step <= 0 {
+		return fmt.Errorf("Invalid ramp step %d", r.Step)
+	}
+	step := r.Step
+	if r.To < r.From {
+		step = -step
+	}
+	v := r.From
+	for v != r.To {
+		v += step
+		if (step > 0 && v > r.To) || (step < 0 && v < r.To) {
+			v = r.To
+		}
+		if err := c.checkEmission(); err != nil {
+			return err
+		}
+		if _, err := c.DetectorVoltage(r.SourceIndex, r.DetectorIndex, r.Filament, v); err != nil {
+			return fmt.Errorf("Could not set detector voltage to %d V: %v", v, err)
+		}
+		if v == r.To {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Ramp stopped at %d V: %w", v, ctx.Err())
+		case <-time.After(r.Delay):
+		}
+	}
+	return nil
+}
+
+// CurrentDetectorVoltage returns the multiplier voltage of the detector setting, as the Voltage column of DetectorInfo
+// reports it
+func (c *RGAConnection) CurrentDetectorVoltage(SourceIndex, DetectorIndex int) (int, error) {
+	resp, err := c.DetectorInfo(SourceIndex)
+	if err != nil {
+		return 0, err
+	}
+	rows := resp.TableRows()
+	if DetectorIndex < 0 || DetectorIndex >= len(rows) {
+		return 0, fmt.Errorf("DetectorIndex %d not available: sensor has %d detector settings", DetectorIndex, len(rows))
+	}
+	v, ok := rows[DetectorIndex]["Voltage"]
+	if !ok {
+		return 0, fmt.Errorf("DetectorInfo doesn't report the voltage of detector %d", DetectorIndex)
+	}
+	switch n := v.Value.(type) {
+	case int64:
+		return int(n), nil
+	case float64:
+		return int(n), nil
+	}
+	return 0, fmt.Errorf("Invalid voltage %v for detector %d", v.Value, DetectorIndex)
+}
+
+// checkEmission returns an error if the filament reports bad emission
+func (c *RGAConnection) checkEmission() error {
+	resp, err := c.FilamentInfo()
+	if err != nil {
+		return err
+	}
+	if state := fieldString(resp, "SummaryState"); state == RGA_FILAMENT_BAD_EMISSION {
+		return fmt.Errorf("Filament emission is bad, not changing detector voltage")
+	}
+	return nil
+}
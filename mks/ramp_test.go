@@ -0,0 +1,32 @@
+package mks
+
+import (
+	"testing"
+)
+
+func TestCurrentDetectorVoltage(t *testing.T) {
+	info := message("DetectorInfo OK", "  SourceIndex 0", "  Detector Factor Voltage", "  0 1.0 0", "  1 2.5e-4 950", "  2 1.1e-3 1200.0")
+	tests := []struct {
+		name     string
+		detector int
+		want     int
+		err      bool
+	}{
+		{name: "faraday", detector: 0, want: 0},
+		{name: "multiplier", detector: 1, want: 950},
+		{name: "float voltage", detector: 2, want: 1200},
+		{name: "missing detector", detector: 3, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fakeRGA(t, info)
+			got, err := c.CurrentDetectorVoltage(0, tt.detector)
+			if (err != nil) != tt.err {
+				t.Fatalf("CurrentDetectorVoltage() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("CurrentDetectorVoltage() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
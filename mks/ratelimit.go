@@ -0,0 +1,103 @@
+package mks
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// command classes rate limited by a RateLimiter
+const (
+	CommandClassQuery       = "query"       // Sensors, SensorState, Info and the *Info commands
+	CommandClassScan        = "scan"        // Scan*
+	CommandClassMeasurement = "measurement" // Add* and Measurement*
+	CommandClassTuning      = "tuning"      // source, detector, filament, calibration, rollover and degas settings
+	CommandClassIO          = "io"          // digital, analog and audio I/O, RVC and Cirrus accessories
+	CommandClassControl     = "control"     // InitMsg, Select, Control, Release and everything else
+)
+
+// CommandClasses lists the command classes
+var CommandClasses = []string{CommandClassQuery, CommandClassScan, CommandClassMeasurement, CommandClassTuning, CommandClassIO, CommandClassControl}
+
+// CommandClass returns the class of the command
+func CommandClass(command string) string {
+	switch {
+	case command == sensors || command == sensorState || command == info || command == eGains || strings.HasSuffix(command, "Info"):
+		return CommandClassQuery
+	case strings.HasPrefix(command, "Scan"):
+		return CommandClassScan
+	case strings.HasPrefix(command, "Add") || strings.HasPrefix(command, "Measurement") || strings.HasPrefix(command, "Measurment"):
+		return CommandClassMeasurement
+	case strings.HasPrefix(command, "Digital") || strings.HasPrefix(command, "Analog") || strings.HasPrefix(command, "Audio") ||
+		strings.HasPrefix(command, "RVC") || strings.HasPrefix(command, "Cirrus"):
+		return CommandClassIO
+	case strings.HasPrefix(command, "Source") || strings.HasPrefix(command, "Detector") || strings.HasPrefix(command, "Filament") ||
+		strings.HasPrefix(command, "Inlet") || strings.HasPrefix(command, "Rollover") || strings.HasPrefix(command, "TotalPressure") ||
+		strings.HasPrefix(command, "PECal_") || strings.HasSuffix(command, "Degas") ||
+		command == multiplierProtect || command == calibrationOptions || command == saveChanges:
+		return CommandClassTuning
+	}
+	return CommandClassControl
+}
+
+// RateLimiter spaces out the commands sent to a sensor so that several clients of the same connection, such as
+// scanning, runtime tuning and health checks, can't overwhelm older firmware. A limiter may be shared by connections
+type RateLimiter struct {
+	mu          sync.Mutex
+	minInterval time.Duration
+	intervals   map[string]time.Duration // minimum spacing per class
+	last        time.Time
+	lastClass   map[string]time.Time
+}
+
+// NewRateLimiter returns a limiter keeping at least minInterval between any two commands and sending at most
+// perSecond[class] commands of a class per second. Unlisted classes are only bound by minInterval
+func NewRateLimiter(minInterval time.Duration, perSecond map[string]float64) (*RateLimiter, error) {
+	l := &RateLimiter{minInterval: minInterval, intervals: make(map[string]time.Duration), lastClass: make(map[string]time.Time)}
+	for class, rate := range perSecond {
+		if !validCommandClass(class) {
+			return nil, fmt.Errorf("Unknown command class %s, expected one of %s", class, strings.Join(CommandClasses, ", "))
+		}
+		if rate <= 0 {
+			return nil, fmt.Errorf("Rate limit of %s commands must be positive, got %v", class, rate)
+		}
+		l.intervals[class] = time.Duration(float64(time.Second) / rate)
+	}
+	return l, nil
+}
+
+// validCommandClass reports whether the class is one of CommandClasses
+func validCommandClass(class string) bool {
+	for _, c := range CommandClasses {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// wait blocks until the command may be sent and records it as sent
+func (l *RateLimiter) wait(command string) {
+	class := CommandClass(command)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	next := l.last.Add(l.minInterval)
+	if interval, ok := l.intervals[class]; ok {
+		if t := l.lastClass[class].Add(interval); t.After(next) {
+			next = t
+		}
+	}
+	if d := next.Sub(now); d > 0 {
+		time.Sleep(d)
+		now = next
+	}
+	l.last = now
+	l.lastClass[class] = now
+}
+
+// Limit rate limits the commands sent on the connection. A nil limiter removes the limit
+func (c *RGAConnection) Limit(l *RateLimiter) {
+	c.lim = l
+}
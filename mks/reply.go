@@ -0,0 +1,78 @@
+package mks
+
+import (
+	"bytes"
+	"net"
+	"time"
+)
+
+// maxStrayMessages bounds the asynchronous messages readReply skips while waiting for a response
+const maxStrayMessages = 1024
+
+// readReply reads the response to the command, recognized by its shape rather than its position: a first line made
+// of the command name and a status. Asynchronous messages read before it, e.g. the readings of a scan being stopped,
+// are dispatched to the event handlers and skipped. The response is returned without its end. The timeout of the
+// command bounds the whole wait and, in strict mode, only the response is checked
+func (c *RGAConnection) readReply(command string) ([]byte, error) {
+	var sentAt time.Time
+	if c.tmo != nil {
+		sentAt = c.tmo.sentAt
+	}
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
+	for i := 0; i <= maxStrayMessages; i++ {
+		if c.strict != nil {
+			c.strict.pending = ""
+		}
+		if i > 0 && c.tmo != nil {
+			c.tmo.pending, c.tmo.sentAt = command, sentAt
+		}
+		clear(buf)
+		n, err := c.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		line, _, _ := bytes.Cut(buf[:n], commandEnd)
+		first, _, _ := bytes.Cut(line, delim)
+		if isReply(command, splitFields(first)) {
+			if c.strict != nil {
+				if perr := checkResponse(command, buf[:n]); perr != nil {
+					return nil, c.strict.reject(perr)
+				}
+			}
+			return bytes.Clone(line), nil
+		}
+		if resp, err := c.parseResponse(buf[:n]); err == nil {
+			c.dispatch(resp)
+		}
+	}
+	return nil, c.parseFailure(nil, 0, "no response to %s within %d messages", command, maxStrayMessages)
+}
+
+// isReply reports whether the fields of a first line are those of a response to the command
+func isReply(command string, fields []string) bool {
+	return len(fields) == 2 && fields[0] == command && (RGAErrStr(fields[1]) == RGA_OK || RGAErrStr(fields[1]) == RGA_ERROR)
+}
+
+// Drain reads and discards what the sensor already sent on the connection, until nothing arrives for wait, and returns
+// the number of bytes discarded. It is meant for a control connection whose asynchronous messages are read from
+// another connection, so they are never taken for the response to the next command
+func (c *RGAConnection) Drain(wait time.Duration) (int, error) {
+	defer c.SetReadDeadline(time.Time{})
+	bp := getBuffer()
+	defer putBuffer(bp)
+	buf := *bp
+	discarded := 0
+	for i := 0; i < maxStrayMessages; i++ {
+		c.SetReadDeadline(time.Now().Add(wait))
+		n, err := c.Read(buf)
+		discarded += n
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			return discarded, nil
+		} else if err != nil {
+			return discarded, err
+		}
+	}
+	return discarded, nil
+}
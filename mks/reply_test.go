@@ -0,0 +1,84 @@
+package mks
+
+import (
+	"testing"
+)
+
+func TestScanStopSkipsReadings(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+		events   int
+		err      bool
+	}{
+		{name: "reply only", messages: []string{message("ScanStop OK")}},
+		{name: "readings first", messages: []string{message("MassReading 28 1.5e-9"), message("MassReading 29 2e-11"), message("ScanStop OK")}, events: 2},
+		{name: "scan start first", messages: []string{message("StartingScan 3 123 0"), message("ScanStop OK")}, events: 1},
+		{name: "error reply", messages: []string{message("MassReading 2 1e-9"), message("ScanStop ERROR", "  Number 200", "  Description Not scanning")}, events: 1, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fakeRGA(t, tt.messages...)
+			events := 0
+			c.OnEvent(AllEvents, func(Event) { events++ })
+			resp, err := c.ScanStop()
+			if (err != nil) != tt.err {
+				t.Fatalf("ScanStop() error = %v", err)
+			}
+			if err == nil && resp.ErrMsg.CommandName != scanStop {
+				t.Errorf("ScanStop() read the response of %s", resp.ErrMsg.CommandName)
+			}
+			if events != tt.events {
+				t.Errorf("ScanStop() dispatched %d events, want %d", events, tt.events)
+			}
+		})
+	}
+}
+
+func TestIsReply(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"ScanStop OK", true},
+		{"ScanStop ERROR", true},
+		{"MassReading 28 1.5e-9", false},
+		{"ScanStop", false},
+		{"ScanStopped OK", false},
+	}
+	for _, tt := range tests {
+		if got := isReply(scanStop, splitFields([]byte(tt.line))); got != tt.want {
+			t.Errorf("isReply(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+	}{
+		{name: "nothing sent"},
+		{name: "readings", messages: []string{message("MassReading 28 1.5e-9"), message("MassReading 29 2e-11")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fakeRGA(t, tt.messages...)
+			// the fake RGA sends its messages once the client writes
+			if _, err := c.Write([]byte(scanStop + commandSuffix)); err != nil {
+				t.Fatal(err)
+			}
+			want := 0
+			for _, m := range tt.messages {
+				want += len(m)
+			}
+			got, err := c.Drain(5 * messageGap)
+			if err != nil {
+				t.Fatalf("Drain() error = %v", err)
+			}
+			if got != want {
+				t.Errorf("Drain() discarded %d bytes, want %d", got, want)
+			}
+		})
+	}
+}
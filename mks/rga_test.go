@@ -0,0 +1,53 @@
+package mks
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// messageGap separates the messages of a fake RGA so that every read returns a single message, as the sensor sends them
+var messageGap = 20 * time.Millisecond
+
+// fakeRGA returns a connection to a fake RGA which sends the messages, one per read, once the client writes anything
+func fakeRGA(t *testing.T, messages ...string) *RGAConnection {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	// read now, the fake may outlive the test changing it
+	gap := messageGap
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Read(make([]byte, BUFFER))
+		for _, m := range messages {
+			if _, err := conn.Write([]byte(m)); err != nil {
+				return
+			}
+			time.Sleep(gap)
+		}
+		// keeps the connection open until the test ends
+		conn.Read(make([]byte, BUFFER))
+	}()
+	c, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// message terminates the lines of a message the way the sensor does
+func message(lines ...string) string {
+	var m string
+	for _, l := range lines {
+		m += l + string(delim)
+	}
+	return m + string(commandEnd[len(delim):])
+}
@@ -0,0 +1,91 @@
+package mks
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RolloverSettings are the variables of the rollover correction applied at high pressure (HPQ2 sensors)
+type RolloverSettings struct {
+	M1, M2       int
+	B1, B2, BP1  float64
+	ScaleFactors map[int]float64 // peak scale factor per mass
+}
+
+// Validate checks the settings before they are sent to the sensor
+func (r RolloverSettings) Validate() error {
+	if r.M1 >= r.M2 {
+		return fmt.Errorf("Invalid rollover variables: M1 (%d) must be lower than M2 (%d)", r.M1, r.M2)
+	}
+	if r.BP1 <= 0 {
+		return fmt.Errorf("Invalid rollover variables: BP1 (%v) must be positive", r.BP1)
+	}
+	for mass, factor := range r.ScaleFactors {
+		if mass < 1 {
+			return fmt.Errorf("Invalid rollover scale factor mass %d", mass)
+		}
+		if factor <= 0 {
+			return fmt.Errorf("Invalid rollover scale factor %v for mass %d", factor, mass)
+		}
+	}
+	return nil
+}
+
+// Rollover reads RolloverInfo into typed settings
+func (c *RGAConnection) Rollover() (*RolloverSettings, error) {
+	resp, err := c.RolloverInfo()
+	if err != nil {
+		return nil, err
+	}
+	r := &RolloverSettings{ScaleFactors: make(map[int]float64)}
+	for name, dst := range map[string]*float64{"B1": &r.B1, "B2": &r.B2, "BP1": &r.BP1} {
+		if v, ok := resp.Fields[name].Float(); ok {
+			*dst = v
+		}
+	}
+	for name, dst := range map[string]*int{"M1": &r.M1, "M2": &r.M2} {
+		if v, ok := resp.Fields[name].Float(); ok {
+			*dst = int(v)
+		}
+	}
+	// scale factors are reported as ScaleFactor<mass>
+	for name, v := range resp.Fields {
+		if !strings.HasPrefix(name, "ScaleFactor") {
+			continue
+		}
+		mass, err := strconv.Atoi(name[len("ScaleFactor"):])
+		if err != nil {
+			continue
+		}
+		if f, ok := v.Float(); ok {
+			r.ScaleFactors[mass] = f
+		}
+	}
+	return r, nil
+}
+
+// SetRollover validates the settings and sends the rollover variables and every scale factor to the sensor
+func (c *RGAConnection) SetRollover(r RolloverSettings) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	if _, err := c.RolloverVariables(r.M1, r.M2, r.B1, r.B2, r.BP1); err != nil {
+		return err
+	}
+	for mass, factor := range r.ScaleFactors {
+		if _, err := c.RolloverScaleFactor(mass, factor); err != nil {
+			return fmt.Errorf("Could not set rollover scale factor for mass %d: %v", mass, err)
+		}
+	}
+	return nil
+}
+
+// SetRolloverCorrection enables or disables the rollover correction of a measurement
+func (c *RGAConnection) SetRolloverCorrection(MeasurementName string, UseCorrection bool) error {
+	if _, err := c.MeasurementSelect(MeasurementName); err != nil {
+		return err
+	}
+	_, err := c.MeasurementRolloverCorrection(UseCorrection)
+	return err
+}
@@ -0,0 +1,146 @@
+package mks
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Session holds control of the sensor and tracks what it changed so that Close can undo it: the running scan is
+// stopped, the measurements it created are removed, the filament is turned off if the session turned it on and control
+// is released. Commands sent through the embedded connection are not tracked
+type Session struct {
+	*RGAConnection
+	measurements []string
+	filamentOn   bool
+	scanning     bool
+	closed       bool
+}
+
+// NewSession initializes the connection and takes control of the sensor. The deadline of the context, if any, bounds
+// the acquisition. A *SensorInUseError is returned if another client controls the sensor
+func NewSession(ctx context.Context, c *RGAConnection, AppName, Version string) (*Session, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+		defer c.SetDeadline(time.Time{})
+	}
+	if err := c.InitMsg(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := c.Control(AppName, Version); err != nil {
+		return nil, c.controlError(err)
+	}
+	return &Session{RGAConnection: c}, nil
+}
+
+// WithSession runs fn in a new session, closing it when fn returns or panics
+func WithSession(ctx context.Context, c *RGAConnection, AppName, Version string, fn func(s *Session) error) (err error) {
+	s, err := NewSession(ctx, c, AppName, Version)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := s.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	return fn(s)
+}
+
+// Add validates the measurement and adds it to the sensor. The measurement is removed when the session closes
+func (s *Session) Add(b *MeasurementBuilder) (*RGAResponse, error) {
+	resp, err := b.Apply(s.RGAConnection)
+	if err != nil {
+		return nil, err
+	}
+	s.measurements = append(s.measurements, b.Name())
+	return resp, nil
+}
+
+// FilamentControl turns the filament on or off, keeping track of its state
+func (s *Session) FilamentControl(State RGAOnOff) (*RGAResponse, error) {
+	resp, err := s.RGAConnection.FilamentControl(State)
+	if err != nil {
+		return nil, err
+	}
+	s.filamentOn = State == RGA_ON
+	return resp, nil
+}
+
+// ScanStart starts the scan, which is stopped when the session closes
+func (s *Session) ScanStart(NumScans int) (*RGAResponse, error) {
+	resp, err := s.RGAConnection.ScanStart(NumScans)
+	if err != nil {
+		return nil, err
+	}
+	s.scanning = true
+	return resp, nil
+}
+
+// ScanResume re-triggers the scan, which is stopped when the session closes
+func (s *Session) ScanResume(NumScans int) (*RGAResponse, error) {
+	resp, err := s.RGAConnection.ScanResume(NumScans)
+	if err != nil {
+		return nil, err
+	}
+	s.scanning = true
+	return resp, nil
+}
+
+// ScanStop stops the scan
+func (s *Session) ScanStop() (*RGAResponse, error) {
+	resp, err := s.RGAConnection.ScanStop()
+	if err != nil {
+		return nil, err
+	}
+	s.scanning = false
+	return resp, nil
+}
+
+// Close undoes what the session did and releases control of the sensor. Every step is attempted even if a previous
+// one failed and the errors are joined. Calling Close more than once is a no-op
+func (s *Session) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	errs := s.undo()
+	if _, err := s.Release(); err != nil {
+		errs = append(errs, err)
+	}
+	s.RGAConnection.dry = nil
+	return errors.Join(errs...)
+}
+
+// Reset undoes what the session did like Close but keeps control of the sensor, so the session can be used again
+func (s *Session) Reset() error {
+	if s.closed {
+		return nil
+	}
+	return errors.Join(s.undo()...)
+}
+
+// undo stops the scan, removes the measurements and turns the filament off if the session turned it on
+func (s *Session) undo() []error {
+	var errs []error
+	if s.scanning {
+		if _, err := s.ScanStop(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i := len(s.measurements) - 1; i >= 0; i-- {
+		if _, err := s.MeasurementRemove(s.measurements[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.measurements = nil
+	if s.filamentOn {
+		if _, err := s.FilamentControl(RGA_OFF); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
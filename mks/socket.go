@@ -0,0 +1,45 @@
+package mks
+
+import (
+	"time"
+)
+
+// SocketOptions tunes the TCP connection to the RGA. Zero values keep the defaults of Go and the OS
+type SocketOptions struct {
+	KeepAlive   time.Duration // idle time before the first keepalive probe and between probes, negative disables them
+	Nagle       bool          // coalesce small writes, off by default so commands are sent right away
+	ReadBuffer  int           // [bytes] size of the receive buffer
+	WriteBuffer int           // [bytes] size of the send buffer
+}
+
+// Tune applies the socket options to the connection. Keepalive probes detect a half-open connection, e.g. after the
+// controller lost power, during the silent periods between scans instead of on the next command
+func (c *RGAConnection) Tune(o SocketOptions) error {
+	switch {
+	case o.KeepAlive < 0:
+		if err := c.SetKeepAlive(false); err != nil {
+			return err
+		}
+	case o.KeepAlive > 0:
+		if err := c.SetKeepAlive(true); err != nil {
+			return err
+		}
+		if err := c.SetKeepAlivePeriod(o.KeepAlive); err != nil {
+			return err
+		}
+	}
+	if err := c.SetNoDelay(!o.Nagle); err != nil {
+		return err
+	}
+	if o.ReadBuffer > 0 {
+		if err := c.SetReadBuffer(o.ReadBuffer); err != nil {
+			return err
+		}
+	}
+	if o.WriteBuffer > 0 {
+		if err := c.SetWriteBuffer(o.WriteBuffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
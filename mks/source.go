@@ -0,0 +1,104 @@
+package mks
+
+import (
+	"fmt"
+)
+
+// SourceSettings holds the tunable parameters of a source settings entry. Nil fields are left unchanged
+type SourceSettings struct {
+	IonEnergy          *float64 // [eV]
+	Emission           *float64 // [mA]
+	Extract            *int     // [V]
+	ElectronEnergy     *int     // [eV]
+	LowMassResolution  *int
+	LowMassAlignment   *int
+	HighMassAlignment  *int
+	HighMassResolution *int
+}
+
+// Validate checks the settings before any of them is sent to the sensor
+func (s SourceSettings) Validate() error {
+	if s.IonEnergy != nil && *s.IonEnergy < 0 {
+		return fmt.Errorf("Invalid ion energy %v", *s.IonEnergy)
+	}
+	if s.Emission != nil && *s.Emission < 0 {
+		return fmt.Errorf("Invalid emission %v", *s.Emission)
+	}
+	if s.ElectronEnergy != nil && *s.ElectronEnergy <= 0 {
+		return fmt.Errorf("Invalid electron energy %d", *s.ElectronEnergy)
+	}
+	return nil
+}
+
+// ApplySourceSettings validates the settings and sends them to the given source settings entry. Sending stops at the
+// first error, which names the setting that failed
+func (c *RGAConnection) ApplySourceSettings(SourceIndex int, s SourceSettings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	steps := []struct {
+		name  string
+		set   bool
+		apply func() (*RGAResponse, error)
+	}{
+		{sourceIonEnergy, s.IonEnergy != nil, func() (*RGAResponse, error) { return c.SourceIonEnergy(SourceIndex, *s.IonEnergy) }},
+		{sourceEmission, s.Emission != nil, func() (*RGAResponse, error) { return c.SourceEmission(SourceIndex, *s.Emission) }},
+		{sourceExtract, s.Extract != nil, func() (*RGAResponse, error) { return c.SourceExtract(SourceIndex, *s.Extract) }},
+		{sourceElectronEnergy, s.ElectronEnergy != nil, func() (*RGAResponse, error) {
+			return c.SourceElectronEnergy(SourceIndex, *s.ElectronEnergy)
+		}},
+		{sourceLowMassResolution, s.LowMassResolution != nil, func() (*RGAResponse, error) {
+			return c.SourceLowMassResolution(SourceIndex, *s.LowMassResolution)
+		}},
+		{sourceLowMassAlignment, s.LowMassAlignment != nil, func() (*RGAResponse, error) {
+			return c.SourceLowMassAlignment(SourceIndex, *s.LowMassAlignment)
+		}},
+		{sourceHighMassAlignment, s.HighMassAlignment != nil, func() (*RGAResponse, error) {
+			return c.SourceHighMassAlignment(SourceIndex, *s.HighMassAlignment)
+		}},
+		{sourceHighMassResolution, s.HighMassResolution != nil, func() (*RGAResponse, error) {
+			return c.SourceHighMassResolution(SourceIndex, *s.HighMassResolution)
+		}},
+	}
+	for _, step := range steps {
+		if !step.set {
+			continue
+		}
+		if _, err := step.apply(); err != nil {
+			return fmt.Errorf("%s failed: %v", step.name, err)
+		}
+	}
+	return nil
+}
+
+// ReadSourceSettings reads the current settings of the source table, as SourceInfo names them, so they can be applied
+// again. Settings the sensor doesn't report are left nil
+func (c *RGAConnection) ReadSourceSettings(SourceIndex int) (SourceSettings, error) {
+	resp, err := c.SourceInfoIndex(SourceIndex)
+	if err != nil {
+		return SourceSettings{}, err
+	}
+	float := func(name string) *float64 {
+		if v, ok := resp.Fields[name].Float(); ok {
+			return &v
+		}
+		return nil
+	}
+	integer := func(name string) *int {
+		if v, ok := resp.Fields[name].Float(); ok {
+			i := int(v)
+			return &i
+		}
+		return nil
+	}
+	return SourceSettings{
+		IonEnergy:          float("IonEnergy"),
+		Emission:           float("Emission"),
+		Extract:            integer("Extract"),
+		ElectronEnergy:     integer("ElectronEnergy"),
+		LowMassResolution:  integer("LowMassResolution"),
+		LowMassAlignment:   integer("LowMassAlignment"),
+		HighMassAlignment:  integer("HighMassAlignment"),
+		HighMassResolution: integer("HighMassResolution"),
+	}, nil
+}
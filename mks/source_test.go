@@ -0,0 +1,50 @@
+package mks
+
+import (
+	"testing"
+)
+
+func TestReadSourceSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		info     string
+		ion      *float64
+		electron *int
+	}{
+		{
+			name:     "every setting",
+			info:     message("SourceInfo OK", "  IonEnergy 5.5", "  Emission 1.0", "  Extract -112", "  ElectronEnergy 70", "  LowMassResolution 32767", "  LowMassAlignment 32767", "  HighMassAlignment 32767", "  HighMassResolution 32767"),
+			ion:      floatPtr(5.5),
+			electron: intPtr(70),
+		},
+		{
+			name:     "integer ion energy",
+			info:     message("SourceInfo OK", "  IonEnergy 5", "  ElectronEnergy 40"),
+			ion:      floatPtr(5),
+			electron: intPtr(40),
+		},
+		{
+			name: "settings not reported",
+			info: message("SourceInfo OK", "  Name Standard"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fakeRGA(t, tt.info)
+			s, err := c.ReadSourceSettings(0)
+			if err != nil {
+				t.Fatalf("ReadSourceSettings() error = %v", err)
+			}
+			if (s.IonEnergy == nil) != (tt.ion == nil) || (s.IonEnergy != nil && *s.IonEnergy != *tt.ion) {
+				t.Errorf("IonEnergy = %v, want %v", s.IonEnergy, tt.ion)
+			}
+			if (s.ElectronEnergy == nil) != (tt.electron == nil) || (s.ElectronEnergy != nil && *s.ElectronEnergy != *tt.electron) {
+				t.Errorf("ElectronEnergy = %v, want %v", s.ElectronEnergy, tt.electron)
+			}
+		})
+	}
+}
+
+func floatPtr(v float64) *float64 { return &v }
+
+func intPtr(v int) *int { return &v }
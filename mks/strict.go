@@ -0,0 +1,117 @@
+package mks
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ParseError describes a response that can't be parsed or isn't the one expected. The raw bytes are kept so firmware
+// quirks can be reported upstream
+type ParseError struct {
+	Command string // command awaiting the response, blank for asynchronous messages
+	Raw     []byte // response as read
+	Offset  int    // position of the failure in Raw
+	Reason  string
+}
+
+// Error implements the error interface
+func (e *ParseError) Error() string {
+	command := e.Command
+	if command == "" {
+		command = "asynchronous message"
+	}
+	return fmt.Sprintf("Unexpected response to %s at offset %d: %s: %q", command, e.Offset, e.Reason, e.Raw)
+}
+
+// Hex returns the raw response as a hex dump alongside its text
+func (e *ParseError) Hex() string {
+	return hex.Dump(e.Raw)
+}
+
+// strictMode holds the state of a connection in strict mode
+type strictMode struct {
+	quarantine io.Writer // nil if rejected responses aren't dumped
+	pending    string    // command awaiting its response
+}
+
+// quarantineRecord is a line of the quarantine file
+type quarantineRecord struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command,omitempty"`
+	Offset  int       `json:"offset"`
+	Reason  string    `json:"reason"`
+	Text    string    `json:"text"`
+	Hex     string    `json:"hex"`
+}
+
+// SetStrict enables or disables strict mode. In strict mode every response to a command is checked before it is
+// parsed: it must be complete, name the command sent, report OK or ERROR and have as many values on every table row as
+// the table has headers. A response failing a check is returned as a *ParseError instead of being parsed leniently
+// and, if quarantine is not nil, written to it as a JSON line with a single Write
+func (c *RGAConnection) SetStrict(enabled bool, quarantine io.Writer) {
+	if !enabled {
+		c.strict = nil
+		return
+	}
+	c.strict = &strictMode{quarantine: quarantine}
+}
+
+// reject dumps the rejected response to the quarantine and returns it as an error
+func (s *strictMode) reject(perr *ParseError) error {
+	if s.quarantine == nil {
+		return perr
+	}
+	b, err := json.Marshal(&quarantineRecord{Time: time.Now(), Command: perr.Command, Offset: perr.Offset, Reason: perr.Reason, Text: string(perr.Raw), Hex: hex.EncodeToString(perr.Raw)})
+	if err == nil {
+		s.quarantine.Write(append(b, '\n'))
+	}
+	return perr
+}
+
+// parseFailure returns a *ParseError for an asynchronous message, dumped to the quarantine in strict mode
+func (c *RGAConnection) parseFailure(raw []byte, offset int, format string, args ...interface{}) error {
+	perr := &ParseError{Raw: bytes.Clone(raw), Offset: offset, Reason: fmt.Sprintf(format, args...)}
+	if c.strict == nil {
+		return perr
+	}
+	return c.strict.reject(perr)
+}
+
+// checkResponse checks the structure of the response to the command, returning nil if it can be parsed
+func checkResponse(command string, raw []byte) *ParseError {
+	fail := func(offset int, format string, args ...interface{}) *ParseError {
+		return &ParseError{Command: command, Raw: bytes.Clone(raw), Offset: offset, Reason: fmt.Sprintf(format, args...)}
+	}
+	end := bytes.Index(raw, commandEnd)
+	if end < 0 {
+		return fail(len(raw), "no end of response, it is truncated or larger than the read buffer")
+	}
+	offset, headers := 0, 0
+	lines := bytes.Split(raw[:end], delim)
+	for i, line := range lines {
+		fields := fieldRe.FindAllString(string(line), -1)
+		switch {
+		case i == 0 && len(fields) != 2:
+			return fail(offset, "expected the command name and status, got %d fields", len(fields))
+		case i == 0 && fields[0] != command:
+			return fail(offset, "response names %s", fields[0])
+		case i == 0 && RGAErrStr(fields[1]) != RGA_OK && RGAErrStr(fields[1]) != RGA_ERROR:
+			return fail(offset+bytes.Index(line, []byte(fields[1])), "unknown status %s", fields[1])
+		case i == 0:
+		case len(fields) == 0 && i < len(lines)-1:
+			// the sensor ends responses with a blank line
+			return fail(offset, "blank line")
+		case len(fields) == 0:
+		case headers > 0 && len(fields) != headers:
+			return fail(offset, "table row has %d values for %d headers", len(fields), headers)
+		case headers == 0 && len(fields) > 2:
+			headers = len(fields)
+		}
+		offset += len(line) + len(delim)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package mks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		raw     string
+		offset  int // of the failure, -1 if the response passes
+	}{
+		{name: "vertical", command: "Info", raw: message("Info OK", "  SerialNumber 1234", "  Name Sensor", ""), offset: -1},
+		{name: "error", command: "Info", raw: message("Info ERROR", "  Number 200", "  Description Not allowed", ""), offset: -1},
+		{name: "table", command: "EGains", raw: message("EGains OK", "  Index Gain Name", "  0 1 Faraday", "  1 20000 Multiplier", ""), offset: -1},
+		{name: "truncated", command: "Info", raw: "Info OK\r\n  SerialNumber 1234\r\n", offset: len("Info OK\r\n  SerialNumber 1234\r\n")},
+		{name: "other command", command: "Info", raw: message("Sensors OK", ""), offset: 0},
+		{name: "no status", command: "Info", raw: message("Info", ""), offset: 0},
+		{name: "unknown status", command: "Info", raw: message("Info WAIT", ""), offset: len("Info ")},
+		{name: "blank line", command: "Info", raw: message("Info OK", "", "  SerialNumber 1234", ""), offset: len("Info OK\r\n")},
+		{name: "short row", command: "EGains", raw: message("EGains OK", "  Index Gain Name", "  0 1", ""), offset: len("EGains OK\r\n  Index Gain Name\r\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			perr := checkResponse(tt.command, []byte(tt.raw))
+			if tt.offset < 0 {
+				if perr != nil {
+					t.Fatalf("checkResponse() = %v, want nil", perr)
+				}
+				return
+			}
+			if perr == nil {
+				t.Fatal("checkResponse() = nil, want a parse error")
+			}
+			if perr.Offset != tt.offset || perr.Command != tt.command || string(perr.Raw) != tt.raw {
+				t.Errorf("checkResponse() failed at offset %d of %s, want %d: %v", perr.Offset, perr.Command, tt.offset, perr)
+			}
+		})
+	}
+}
+
+func TestStrictQuarantine(t *testing.T) {
+	var quarantine bytes.Buffer
+	c := fakeRGA(t, message("Info WAIT", ""))
+	c.SetStrict(true, &quarantine)
+	_, err := c.Info()
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("Info() error = %v, want a *ParseError", err)
+	}
+	var record quarantineRecord
+	if err := json.Unmarshal(quarantine.Bytes(), &record); err != nil {
+		t.Fatalf("quarantine holds %q: %v", quarantine.String(), err)
+	}
+	if record.Command != info || record.Offset != perr.Offset || record.Text != string(perr.Raw) {
+		t.Errorf("quarantined %+v for %v", record, perr)
+	}
+}
@@ -0,0 +1,133 @@
+package mks
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultCommandTimeout bounds the response of every command missing from DefaultCommandTimeouts, queries included
+const DefaultCommandTimeout = 10 * time.Second
+
+// ErrOutOfSync is returned by every command written to a connection once a response timed out: the late response may
+// still arrive and be taken for the response to a later command, so the connection must be dialled again
+var ErrOutOfSync = errors.New("connection out of sync after a response timeout")
+
+// DefaultCommandTimeouts are the response timeouts of the commands known to answer slowly
+var DefaultCommandTimeouts = map[string]time.Duration{
+	control:         30 * time.Second, // waits for the sensor to finish what it's doing
+	filamentControl: 30 * time.Second, // answers once the emission settles
+	runDiagnostics:  2 * time.Minute,
+	startDegas:      30 * time.Second,
+	saveChanges:     30 * time.Second, // writes to flash
+}
+
+// ErrCommandTimeout reports a command whose response didn't arrive within its timeout. It is a net.Error reporting a
+// timeout, so callers checking for read timeouts keep working
+type ErrCommandTimeout struct {
+	Command string
+	After   time.Duration // timeout of the command
+}
+
+// Error implements the error interface
+func (e *ErrCommandTimeout) Error() string {
+	return fmt.Sprintf("No response to %s within %v", e.Command, e.After)
+}
+
+// Timeout implements net.Error
+func (e *ErrCommandTimeout) Timeout() bool { return true }
+
+// Temporary implements net.Error
+func (e *ErrCommandTimeout) Temporary() bool { return true }
+
+// commandTimeouts holds the response timeouts of a connection and the command awaiting its response
+type commandTimeouts struct {
+	def       time.Duration
+	overrides map[string]time.Duration
+	pending   string
+	sentAt    time.Time
+	timedOut  *ErrCommandTimeout // first response that timed out, nil while the connection is in sync
+	mu        sync.Mutex         // guards deadline, set by other goroutines to unblock a read
+	deadline  time.Time          // read deadline set by the caller, restored after every response
+}
+
+// SetCommandTimeouts bounds the time the response to every command may take: def unless the command has an entry in
+// overrides, e.g. DefaultCommandTimeouts. A read deadline set by the caller still applies if it passes first. A
+// response arriving late fails with *ErrCommandTimeout and the commands written afterwards fail with ErrOutOfSync,
+// since the late response is still on its way. A def of 0 with no overrides disables the timeouts
+func (c *RGAConnection) SetCommandTimeouts(def time.Duration, overrides map[string]time.Duration) {
+	if def <= 0 && len(overrides) == 0 {
+		c.tmo = nil
+		return
+	}
+	c.tmo = &commandTimeouts{def: def, overrides: overrides}
+}
+
+// SetDeadline sets the read and write deadlines of the connection, see net.Conn
+func (c RGAConnection) SetDeadline(t time.Time) error {
+	if c.tmo != nil {
+		c.tmo.mu.Lock()
+		c.tmo.deadline = t
+		c.tmo.mu.Unlock()
+	}
+	return c.TCPConn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the connection, see net.Conn
+func (c RGAConnection) SetReadDeadline(t time.Time) error {
+	if c.tmo != nil {
+		c.tmo.mu.Lock()
+		c.tmo.deadline = t
+		c.tmo.mu.Unlock()
+	}
+	return c.TCPConn.SetReadDeadline(t)
+}
+
+// timeout returns the response timeout of the command, 0 if it has none
+func (t *commandTimeouts) timeout(command string) time.Duration {
+	if d, ok := t.overrides[command]; ok {
+		return d
+	}
+	return t.def
+}
+
+// readCommand reads the response to the pending command with its deadline, or the deadline of the caller if that passes first.
+// Once a response timed out every read fails, the commands ignoring the error of Write included
+func (c RGAConnection) readCommand(b []byte) (int, error) {
+	t := c.tmo
+	if err := t.outOfSync(); err != nil {
+		return 0, err
+	}
+	command := t.pending
+	t.pending = ""
+	timeout := t.timeout(command)
+	if command == "" || timeout <= 0 {
+		return c.TCPConn.Read(b)
+	}
+	expires := t.sentAt.Add(timeout)
+	t.mu.Lock()
+	caller := t.deadline
+	if caller.IsZero() || expires.Before(caller) {
+		c.TCPConn.SetReadDeadline(expires)
+	}
+	t.mu.Unlock()
+	n, err := c.TCPConn.Read(b)
+	t.mu.Lock()
+	caller = t.deadline
+	c.TCPConn.SetReadDeadline(caller)
+	t.mu.Unlock()
+	if nerr, ok := err.(interface{ Timeout() bool }); ok && nerr.Timeout() && !time.Now().Before(expires) && (caller.IsZero() || expires.Before(caller)) {
+		t.timedOut = &ErrCommandTimeout{Command: command, After: timeout}
+		return n, t.timedOut
+	}
+	return n, err
+}
+
+// outOfSync returns an error wrapping ErrOutOfSync if a response timed out on the connection
+func (t *commandTimeouts) outOfSync() error {
+	if t.timedOut == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %v", ErrOutOfSync, t.timedOut)
+}
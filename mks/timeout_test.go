@@ -0,0 +1,50 @@
+package mks
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCommandTimeouts(t *testing.T) {
+	tests := []struct {
+		name      string
+		def       time.Duration
+		overrides map[string]time.Duration
+		delay     time.Duration // before the fake RGA answers
+		timedOut  bool
+	}{
+		{name: "in time", def: time.Second, delay: 0},
+		{name: "late", def: 30 * time.Millisecond, delay: 150 * time.Millisecond, timedOut: true},
+		{name: "override", def: 30 * time.Millisecond, overrides: map[string]time.Duration{info: time.Second}, delay: 100 * time.Millisecond},
+		{name: "disabled", def: 30 * time.Millisecond, overrides: map[string]time.Duration{info: 0}, delay: 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messageGap = tt.delay
+			defer func() { messageGap = 20 * time.Millisecond }()
+			// the first message only delays the answer, it arrives with the response in a single read otherwise
+			c := fakeRGA(t, "", message("Info OK", "  SerialNumber 1234"))
+			c.SetCommandTimeouts(tt.def, tt.overrides)
+			_, err := c.Info()
+			var tmo *ErrCommandTimeout
+			if errors.As(err, &tmo) != tt.timedOut {
+				t.Fatalf("Info() error = %v, want timeout %v", err, tt.timedOut)
+			}
+			if !tt.timedOut {
+				if err != nil {
+					t.Fatalf("Info() error = %v", err)
+				}
+				return
+			}
+			if tmo.Command != info || tmo.After != tt.def {
+				t.Errorf("timeout of %s after %v, want %s after %v", tmo.Command, tmo.After, info, tt.def)
+			}
+			// the late response must not be taken for the response to the next command
+			time.Sleep(2 * tt.delay)
+			if _, err := c.Info(); !errors.Is(err, ErrOutOfSync) {
+				t.Errorf("Info() after a timeout error = %v, want ErrOutOfSync", err)
+			}
+		})
+	}
+}
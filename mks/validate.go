@@ -0,0 +1,32 @@
+package mks
+
+import (
+	"fmt"
+)
+
+// ValidateIndices cross-checks the given electronic gain, source and detector indices against the sensor's EGains,
+// SourceInfo and DetectorInfo tables, returning a descriptive error if any of them is not available
+func (c *RGAConnection) ValidateIndices(EGainIndex, SourceIndex, DetectorIndex int) error {
+	gains, err := c.EGains()
+	if err != nil {
+		return fmt.Errorf("Could not read electronic gains: %v", err)
+	}
+	if EGainIndex < 0 || EGainIndex >= len(gains.Fields) {
+		return fmt.Errorf("EGainIndex %d not available: sensor has %d electronic gains", EGainIndex, len(gains.Fields))
+	}
+	if SourceIndex < 0 {
+		return fmt.Errorf("SourceIndex %d not available: index cannot be negative", SourceIndex)
+	}
+	// The sensor rejects DetectorInfo for sources it doesn't have
+	detectors, err := c.DetectorInfo(SourceIndex)
+	if err != nil {
+		return fmt.Errorf("SourceIndex %d not available: %v", SourceIndex, err)
+	}
+	if DetectorIndex < 0 || DetectorIndex >= detectors.Rows {
+		if detectors.Rows == 1 {
+			return fmt.Errorf("DetectorIndex %d not available: sensor has Faraday only", DetectorIndex)
+		}
+		return fmt.Errorf("DetectorIndex %d not available: sensor has Faraday and %d multiplier settings", DetectorIndex, detectors.Rows-1)
+	}
+	return nil
+}
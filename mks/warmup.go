@@ -0,0 +1,86 @@
+package mks
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// filament summary states reported by FilamentInfo and FilamentStatus
+const (
+	RGA_FILAMENT_OFF       = "OFF"
+	RGA_FILAMENT_WARM_UP   = "WARM-UP"
+	RGA_FILAMENT_ON        = "ON"
+	RGA_FILAMENT_COOL_DOWN = "COOL-DOWN"
+)
+
+// emissionFields are the FilamentInfo fields holding the emission current, depending on the firmware
+var emissionFields = []string{"Emission", "EmissionCurrent"}
+
+// FilamentWarmUp configures WaitFilamentReady
+type FilamentWarmUp struct {
+	Poll      time.Duration // between FilamentInfo queries, 1 second if 0
+	Settle    time.Duration // the emission must stay within Tolerance this long once the filament is ON
+	Tolerance float64       // relative change of the emission current still considered stable
+	// Progress, if not nil, is called after every query with the summary state, the emission current (0 if the
+	// firmware doesn't report it) and the time waited so far
+	Progress func(state string, emission float64, waited time.Duration)
+}
+
+// WaitFilamentReady waits for the filament to leave WARM-UP for ON and its emission current to settle, e.g. after
+// FilamentControl On, so that no reading is taken while the emission is still changing. If FilamentInfo doesn't report
+// the emission current, the filament is ready once it was ON for Settle. It fails if the filament reports bad emission
+// or turns off, and when the context is done
+func (c *RGAConnection) WaitFilamentReady(ctx context.Context, w FilamentWarmUp) error {
+	poll := w.Poll
+	if poll <= 0 {
+		poll = time.Second
+	}
+	start := time.Now()
+	var (
+		stableSince time.Time
+		reference   float64
+	)
+	for {
+		resp, err := c.FilamentInfo()
+		if err != nil {
+			return err
+		}
+		state := fieldString(resp, "SummaryState")
+		emission, reported := filamentEmission(resp)
+		if w.Progress != nil {
+			w.Progress(state, emission, time.Since(start))
+		}
+		switch state {
+		case RGA_FILAMENT_BAD_EMISSION:
+			return fmt.Errorf("Filament emission is bad after %v of warm-up", time.Since(start).Round(time.Second))
+		case RGA_FILAMENT_OFF, RGA_FILAMENT_COOL_DOWN:
+			return fmt.Errorf("Filament is %s, it must be turned on first", state)
+		case RGA_FILAMENT_ON:
+			if stableSince.IsZero() || (reported && math.Abs(emission-reference) > w.Tolerance*math.Abs(reference)) {
+				stableSince, reference = time.Now(), emission
+			}
+			if time.Since(stableSince) >= w.Settle {
+				return nil
+			}
+		default:
+			stableSince = time.Time{}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Filament not ready after %v, last state %s: %w", time.Since(start).Round(time.Second), state, ctx.Err())
+		case <-time.After(poll):
+		}
+	}
+}
+
+// filamentEmission returns the emission current reported by FilamentInfo and whether it is reported
+func filamentEmission(resp *RGAResponse) (float64, bool) {
+	for _, name := range emissionFields {
+		if v, ok := resp.Fields[name].Float(); ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
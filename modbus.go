@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/simonvetter/modbus"
+)
+
+var defaultModbusURL = "tcp://0.0.0.0:502"
+
+// modbusSink serves the total pressure and the configured masses as IEEE 754 float32 values over Modbus TCP.
+// Each value spans two registers, high word first: registers 0-1 hold the total pressure [Pa] and registers
+// 2+2i and 3+2i hold the partial pressure of the i-th configured mass. The same map is served as holding and input registers
+type modbusSink struct {
+	srv *modbus.ModbusServer
+	sync.RWMutex
+	masses    map[float64]int // mass to value index
+	registers []uint16
+}
+
+var _ Sink = (*modbusSink)(nil)
+
+// newModbusSink creates and starts the Modbus TCP server
+func newModbusSink(config *cfg.Config) (*modbusSink, error) {
+	url := config.ModbusURL
+	if url == "" {
+		url = defaultModbusURL
+	}
+	s := &modbusSink{
+		masses:    make(map[float64]int),
+		registers: make([]uint16, 2*(len(config.ModbusMasses)+1)),
+	}
+	for i, m := range config.ModbusMasses {
+		s.masses[float64(m)] = i + 1
+	}
+	srv, err := modbus.NewServer(&modbus.ServerConfiguration{URL: url, MaxClients: 8}, s)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create Modbus server: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		return nil, fmt.Errorf("Could not start Modbus server: %v", err)
+	}
+	s.srv = srv
+	log.Printf("Modbus server listening on %s", url)
+	return s, nil
+}
+
+// setValue encodes the value at the given value index. Must be called with the lock held
+func (s *modbusSink) setValue(idx int, v float64) {
+	bits := math.Float32bits(float32(v))
+	s.registers[2*idx] = uint16(bits >> 16)
+	s.registers[2*idx+1] = uint16(bits)
+}
+
+// readRegisters returns a copy of the requested register range
+func (s *modbusSink) readRegisters(addr, quantity uint16) ([]uint16, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if int(addr)+int(quantity) > len(s.registers) {
+		return nil, modbus.ErrIllegalDataAddress
+	}
+	res := make([]uint16, quantity)
+	copy(res, s.registers[addr:addr+quantity])
+	return res, nil
+}
+
+// HandleCoils implements the modbus.RequestHandler interface. Coils are not supported
+func (s *modbusSink) HandleCoils(req *modbus.CoilsRequest) ([]bool, error) {
+	return nil, modbus.ErrIllegalFunction
+}
+
+// HandleDiscreteInputs implements the modbus.RequestHandler interface. Discrete inputs are not supported
+func (s *modbusSink) HandleDiscreteInputs(req *modbus.DiscreteInputsRequest) ([]bool, error) {
+	return nil, modbus.ErrIllegalFunction
+}
+
+// HandleHoldingRegisters implements the modbus.RequestHandler interface. Registers are read-only
+func (s *modbusSink) HandleHoldingRegisters(req *modbus.HoldingRegistersRequest) ([]uint16, error) {
+	if req.IsWrite {
+		return nil, modbus.ErrIllegalFunction
+	}
+	return s.readRegisters(req.Addr, req.Quantity)
+}
+
+// HandleInputRegisters implements the modbus.RequestHandler interface
+func (s *modbusSink) HandleInputRegisters(req *modbus.InputRegistersRequest) ([]uint16, error) {
+	return s.readRegisters(req.Addr, req.Quantity)
+}
+
+// Name implements the Sink interface
+func (s *modbusSink) Name() string {
+	return "modbus"
+}
+
+// Open implements the Sink interface. The server is already running
+func (s *modbusSink) Open() error {
+	return nil
+}
+
+// Write updates the registers of the configured masses and the total pressure
+func (s *modbusSink) Write(scan *Scan) error {
+	s.Lock()
+	defer s.Unlock()
+	s.setValue(0, scan.TotalPressure)
+	for _, r := range scan.Readings {
+		if idx, ok := s.masses[r.Mass]; ok {
+			s.setValue(idx, r.Value)
+		}
+	}
+	return nil
+}
+
+// Flush implements the Sink interface
+func (s *modbusSink) Flush() error {
+	return nil
+}
+
+// Close stops the Modbus server
+func (s *modbusSink) Close() error {
+	return s.srv.Stop()
+}
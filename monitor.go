@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+// MonitorSnapshot is the sensor state published in monitor mode
+type MonitorSnapshot struct {
+	Time          time.Time              `json:"time"`
+	Rig           string                 `json:"rig,omitempty"`
+	Serial        string                 `json:"serial,omitempty"`
+	SensorState   map[string]interface{} `json:"sensorState,omitempty"`
+	Info          map[string]interface{} `json:"info,omitempty"`
+	TotalPressure map[string]interface{} `json:"totalPressure,omitempty"`
+	Filament      map[string]interface{} `json:"filament,omitempty"`
+	Errors        []string               `json:"errors,omitempty"` // commands that failed
+}
+
+// monitorFrame wraps a MonitorSnapshot in a frame for Laniakea
+type monitorFrame struct {
+	Schema  string           `json:"schema"`
+	Monitor *MonitorSnapshot `json:"monitor"`
+}
+
+// responseValues returns the fields of a response as plain values
+func responseValues(resp *mks.RGAResponse) map[string]interface{} {
+	values := make(map[string]interface{}, len(resp.Fields))
+	for name, v := range resp.Fields {
+		values[name] = v.Value
+	}
+	return values
+}
+
+// monitorSnapshot queries the informational commands. A failed command is reported in the snapshot instead of
+// failing it
+func (e *MksRgaDatasource) monitorSnapshot() *MonitorSnapshot {
+	snap := &MonitorSnapshot{Time: e.now(), Rig: e.config.RigID, Serial: e.serial}
+	for _, q := range []struct {
+		name string
+		cmd  func() (*mks.RGAResponse, error)
+		dst  *map[string]interface{}
+	}{
+		{"SensorState", e.connection.SensorState, &snap.SensorState},
+		{"Info", e.connection.Info, &snap.Info},
+		{"TotalPressureInfo", e.connection.TotalPressureInfo, &snap.TotalPressure},
+		{"FilamentInfo", e.connection.FilamentInfo, &snap.Filament},
+	} {
+		resp, err := q.cmd()
+		if err != nil {
+			snap.Errors = append(snap.Errors, fmt.Sprintf("%s: %v", q.name, err))
+			continue
+		}
+		*q.dst = responseValues(resp)
+	}
+	return snap
+}
+
+// startMonitoring publishes the sensor state on every polling interval without taking control of the sensor, leaving
+// data acquisition to another client such as Process Eye
+func (e *MksRgaDatasource) startMonitoring(resume bool) (chan *proto.Frame, error) {
+	if err := e.connection.InitMsg(); err != nil {
+		return nil, err
+	}
+	if e.config.SensorSerial != "" {
+		if _, err := e.connection.Select(e.config.SensorSerial); err != nil {
+			return nil, fmt.Errorf("Could not select sensor %s: %v", e.config.SensorSerial, err)
+		}
+	}
+	if err := e.readIdentity(); err != nil {
+		log.Printf("Could not read sensor serial number: %v", err)
+	}
+	pollInterval := e.pollInterval()
+	ticker := time.NewTicker(pollInterval)
+	frameChan := make(chan *proto.Frame)
+	done := make(chan struct{})
+	e.setDone(done)
+	if ok := atomic.CompareAndSwapInt32(&e.recording, 0, 1); !ok {
+		ticker.Stop()
+		return nil, ErrAlreadyRecording
+	}
+	e.setFrameChan(frameChan, resume)
+	e.saveState()
+	log.Println("Monitoring sensor without taking control")
+	e.Add(1)
+	go func() {
+		defer e.connMu.Unlock()
+		defer e.recordingEnded(done)
+		defer e.recoverPanic("monitor", e.recordingPanicked)
+		defer e.Done()
+		defer close(frameChan)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				snap := e.monitorSnapshot()
+				b, err := json.Marshal(&monitorFrame{Schema: frameSchema, Monitor: snap})
+				if err != nil {
+					log.Println(err)
+					return
+				}
+				e.sendFrame(frameChan, &proto.Frame{
+					Source:    pluginName,
+					Type:      "application/json",
+					Timestamp: snap.Time.UnixMilli(),
+					Payload:   b,
+				})
+			case req := <-e.loopChan:
+				req.errChan <- req.fn()
+			case <-e.quitChan:
+				return
+			case <-e.stopping:
+				return
+			}
+		}
+	}()
+	return frameChan, nil
+}
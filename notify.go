@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+var (
+	notifyEventAlarm      = "alarm"
+	notifyEventFilament   = "filament"
+	notifyEventLink       = "link"
+	notifyEventRecording  = "recording"
+	defaultNotifyInterval = 15 * time.Minute
+	notifyQueueSize       = 64
+	// notifyEvents maps the title of the annotations notified to their event
+	notifyEvents = map[string]string{
+		"Alarm raised":     notifyEventAlarm,
+		"Filament failure": notifyEventFilament,
+		"Link down":        notifyEventLink,
+		"Recording failed": notifyEventRecording,
+	}
+)
+
+// emailNotifier emails the recipients when an alarm is raised, the filament fails, the link drops or a recording
+// stops on an error. The first notification is sent right away, the ones following it within Interval are sent
+// together as a digest once it has passed
+type emailNotifier struct {
+	config *cfg.SMTP
+	rig    string
+	events map[string]bool
+	queue  chan *Annotation
+}
+
+var _ Annotator = (*emailNotifier)(nil)
+
+// newEmailNotifier validates the SMTP configuration and starts the sender
+func newEmailNotifier(config *cfg.SMTP, rig string) (*emailNotifier, error) {
+	if config.Addr == "" || config.From == "" || len(config.To) == 0 {
+		return nil, fmt.Errorf("Email notifications need an SMTP address, a sender and recipients")
+	}
+	if _, _, err := net.SplitHostPort(config.Addr); err != nil {
+		return nil, fmt.Errorf("Invalid SMTP address %s: %v", config.Addr, err)
+	}
+	n := &emailNotifier{config: config, rig: rig, events: make(map[string]bool), queue: make(chan *Annotation, notifyQueueSize)}
+	for _, ev := range config.Events {
+		switch ev {
+		case notifyEventAlarm, notifyEventFilament, notifyEventLink, notifyEventRecording:
+			n.events[ev] = true
+		default:
+			return nil, fmt.Errorf("Unknown notification event %s, expected alarm, filament, link or recording", ev)
+		}
+	}
+	go n.run()
+	return n, nil
+}
+
+// Annotate queues the annotation if it is one of the notified events. It never blocks
+func (n *emailNotifier) Annotate(a *Annotation) error {
+	ev, ok := notifyEvents[a.Title]
+	if !ok || (len(n.events) > 0 && !n.events[ev]) {
+		return nil
+	}
+	select {
+	case n.queue <- a:
+		return nil
+	default:
+		return fmt.Errorf("notification queue full")
+	}
+}
+
+// run sends the queued notifications, digesting those arriving within Interval of the last email
+func (n *emailNotifier) run() {
+	interval := time.Duration(n.config.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultNotifyInterval
+	}
+	var (
+		lastSent time.Time
+		pending  []*Annotation
+		timer    <-chan time.Time
+	)
+	for {
+		select {
+		case a := <-n.queue:
+			if timer != nil {
+				pending = append(pending, a)
+				continue
+			}
+			if wait := interval - time.Since(lastSent); wait > 0 {
+				pending = append(pending, a)
+				timer = time.After(wait)
+				continue
+			}
+			n.send([]*Annotation{a})
+			lastSent = time.Now()
+		case <-timer:
+			n.send(pending)
+			pending, timer, lastSent = nil, nil, time.Now()
+		}
+	}
+}
+
+// send emails the notifications, a single one or a digest
+func (n *emailNotifier) send(notifications []*Annotation) {
+	prefix := "[" + pluginName
+	if n.rig != "" {
+		prefix += " " + n.rig
+	}
+	prefix += "] "
+	subject := prefix + fmt.Sprintf("%d notifications", len(notifications))
+	if len(notifications) == 1 {
+		subject = prefix + notifications[0].Title
+		if notifications[0].Text != "" {
+			subject += ": " + notifications[0].Text
+		}
+	}
+	var body strings.Builder
+	for _, a := range notifications {
+		fmt.Fprintf(&body, "%s %s", a.Time.Format(time.RFC3339), a.Title)
+		if a.Text != "" {
+			fmt.Fprintf(&body, ": %s", a.Text)
+		}
+		body.WriteString("\r\n")
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s",
+		n.config.From, strings.Join(n.config.To, ", "), strings.ReplaceAll(subject, "\n", " "), time.Now().Format(time.RFC1123Z), body.String())
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		host, _, _ := net.SplitHostPort(n.config.Addr)
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, host)
+	}
+	// SendMail upgrades to TLS when the server supports STARTTLS
+	if err := smtp.SendMail(n.config.Addr, auth, n.config.From, n.config.To, []byte(msg)); err != nil {
+		log.Printf("Could not email %d notifications: %v", len(notifications), err)
+	}
+}
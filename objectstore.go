@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// objectStore uploads objects to an S3-compatible bucket
+type objectStore struct {
+	client *minio.Client
+	bucket string
+}
+
+// newObjectStore creates the S3 client from the config
+func newObjectStore(config *cfg.Config) (*objectStore, error) {
+	if config.S3Endpoint == "" || config.S3Bucket == "" {
+		return nil, fmt.Errorf("S3 endpoint and bucket cannot be blank")
+	}
+	client, err := minio.New(config.S3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.S3AccessKey, config.S3SecretKey, ""),
+		Secure: config.S3UseSSL,
+		Region: config.S3Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &objectStore{client: client, bucket: config.S3Bucket}, nil
+}
+
+// checkBucket verifies that the bucket exists
+func (o *objectStore) checkBucket() error {
+	ok, err := o.client.BucketExists(context.Background(), o.bucket)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("S3 bucket %s does not exist", o.bucket)
+	}
+	return nil
+}
+
+// put uploads the object under the given key
+func (o *objectStore) put(key string, data []byte, contentType string) error {
+	_, err := o.client.PutObject(context.Background(), o.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
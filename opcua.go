@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/server"
+	"github.com/gopcua/opcua/ua"
+)
+
+var (
+	opcuaNamespace       = "MKS RGA"
+	defaultOPCUAEndpoint = "0.0.0.0"
+	defaultOPCUAPort     = 4840
+)
+
+// opcuaSink exposes the latest partial pressures, total pressure and sensor state as OPC-UA variable nodes.
+// The server runs for the lifetime of the plugin so SCADA clients keep their connection between recordings
+type opcuaSink struct {
+	srv     *server.Server
+	ns      *server.NodeNameSpace
+	objects *server.Node
+	sync.RWMutex
+	latest map[string]float64 // latest value per node name
+	state  string
+}
+
+var _ Sink = (*opcuaSink)(nil)
+
+// opcuaSecurity returns the security options of the server. With a certificate and key only the Basic256Sha256
+// SignAndEncrypt policy is served, unless OPCUAAllowInsecure also enables None. Without them None is the only policy
+func opcuaSecurity(config *cfg.Config) ([]server.Option, error) {
+	if (config.OPCUACertFile == "") != (config.OPCUAKeyFile == "") {
+		return nil, fmt.Errorf("OPCUACertFile and OPCUAKeyFile must be set together")
+	}
+	if config.OPCUACertFile == "" {
+		log.Println("OPC-UA server is unencrypted, set OPCUACertFile and OPCUAKeyFile to secure it")
+		return []server.Option{server.EnableSecurity("None", ua.MessageSecurityModeNone)}, nil
+	}
+	c, err := tls.LoadX509KeyPair(config.OPCUACertFile, config.OPCUAKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load OPC-UA certificate: %v", err)
+	}
+	pk, ok := c.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("OPC-UA private key must be an RSA key")
+	}
+	opts := []server.Option{
+		server.Certificate(c.Certificate[0]),
+		server.PrivateKey(pk),
+		server.EnableSecurity("Basic256Sha256", ua.MessageSecurityModeSignAndEncrypt),
+	}
+	if config.OPCUAAllowInsecure {
+		opts = append(opts, server.EnableSecurity("None", ua.MessageSecurityModeNone))
+	}
+	return opts, nil
+}
+
+// newOpcuaSink creates and starts the OPC-UA server
+func newOpcuaSink(config *cfg.Config) (*opcuaSink, error) {
+	endpoint := config.OPCUAEndpoint
+	if endpoint == "" {
+		endpoint = defaultOPCUAEndpoint
+	}
+	port := config.OPCUAPort
+	if port == 0 {
+		port = defaultOPCUAPort
+	}
+	opts, err := opcuaSecurity(config)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, server.EndPoint(endpoint, port), server.EnableAuthMode(ua.UserTokenTypeAnonymous))
+	s := &opcuaSink{
+		srv:    server.New(opts...),
+		latest: make(map[string]float64),
+		state:  mks.RGA_SENSOR_STATE_NA,
+	}
+	s.ns = server.NewNodeNameSpace(s.srv, opcuaNamespace)
+	s.objects = s.ns.Objects()
+	s.addVariable("TotalPressure")
+	stateNode := s.ns.AddNewVariableStringNode("SensorState", func() *ua.DataValue {
+		s.RLock()
+		defer s.RUnlock()
+		return server.DataValueFromValue(s.state)
+	})
+	s.objects.AddRef(stateNode, id.HasComponent, true)
+	if err := s.srv.Start(context.Background()); err != nil {
+		return nil, fmt.Errorf("Could not start OPC-UA server: %v", err)
+	}
+	log.Printf("OPC-UA server listening on opc.tcp://%s:%d", endpoint, port)
+	return s, nil
+}
+
+// addVariable adds a float variable node reading from the latest values. Must be called with the lock held or before serving
+func (s *opcuaSink) addVariable(name string) {
+	s.latest[name] = 0
+	n := s.ns.AddNewVariableStringNode(name, func() *ua.DataValue {
+		s.RLock()
+		defer s.RUnlock()
+		return server.DataValueFromValue(s.latest[name])
+	})
+	s.objects.AddRef(n, id.HasComponent, true)
+}
+
+// Name implements the Sink interface
+func (s *opcuaSink) Name() string {
+	return "opcua"
+}
+
+// Open implements the Sink interface. The server is already running
+func (s *opcuaSink) Open() error {
+	return nil
+}
+
+// Write updates the node values, creating nodes for readings seen for the first time
+func (s *opcuaSink) Write(scan *Scan) error {
+	s.Lock()
+	var changed []string
+	for _, r := range scan.Readings {
+		name := r.Measurement + ".mass" + formatMass(r.Mass)
+		if _, ok := s.latest[name]; !ok {
+			s.addVariable(name)
+		}
+		s.latest[name] = r.Value
+		changed = append(changed, name)
+	}
+	s.latest["TotalPressure"] = scan.TotalPressure
+	s.state = scan.SensorState
+	s.Unlock()
+	// notify subscribers outside of the lock since value callbacks take the read lock
+	for _, name := range append(changed, "TotalPressure", "SensorState") {
+		s.srv.ChangeNotification(ua.NewStringNodeID(s.ns.ID(), name))
+	}
+	return nil
+}
+
+// Flush implements the Sink interface
+func (s *opcuaSink) Flush() error {
+	return nil
+}
+
+// Close stops the OPC-UA server
+func (s *opcuaSink) Close() error {
+	return s.srv.Close()
+}
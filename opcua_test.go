@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+// opcuaCert writes a self-signed certificate and its RSA key, returning their paths
+func opcuaCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mks-rga-plugin"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// freePort returns a local port nothing listens on
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestOpcuaSecurity(t *testing.T) {
+	certFile, keyFile := opcuaCert(t)
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		insecure bool
+		policies []string
+		err      bool
+	}{
+		{name: "no certificate", policies: []string{"None"}},
+		{name: "certificate", certFile: certFile, keyFile: keyFile, policies: []string{"Basic256Sha256"}},
+		{name: "certificate and insecure", certFile: certFile, keyFile: keyFile, insecure: true, policies: []string{"Basic256Sha256", "None"}},
+		{name: "certificate without key", certFile: certFile, err: true},
+		{name: "key without certificate", keyFile: keyFile, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newOpcuaSink(&cfg.Config{
+				OPCUAEndpoint:      "127.0.0.1",
+				OPCUAPort:          freePort(t),
+				OPCUACertFile:      tt.certFile,
+				OPCUAKeyFile:       tt.keyFile,
+				OPCUAAllowInsecure: tt.insecure,
+			})
+			if (err != nil) != tt.err {
+				t.Fatalf("newOpcuaSink() error = %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			defer s.Close()
+			policies := map[string]bool{}
+			for _, ep := range s.srv.Endpoints() {
+				policies[strings.TrimPrefix(ep.SecurityPolicyURI, "http://opcfoundation.org/UA/SecurityPolicy#")] = true
+			}
+			var got []string
+			for p := range policies {
+				got = append(got, p)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.policies) {
+				t.Errorf("security policies = %v, want %v", got, tt.policies)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/parquet-go/parquet-go"
+)
+
+var defaultParquetBatchScans = 240
+
+// parquetRow is a single reading in the columnar files
+type parquetRow struct {
+	Time        int64   `parquet:"time,timestamp(millisecond)"`
+	Rig         string  `parquet:"rig,dict"`
+	Serial      string  `parquet:"serial,dict"`
+	Measurement string  `parquet:"measurement,dict"`
+	Mass        float64 `parquet:"mass"`
+	Value       float64 `parquet:"value"`
+}
+
+// parquetSink accumulates scans and periodically writes them as Parquet files to a local directory or an S3-compatible bucket
+type parquetSink struct {
+	config     *cfg.Config
+	store      *objectStore
+	batchScans int
+	scans      int
+	rows       []parquetRow
+	pending    *pendingBatches // files not written yet
+}
+
+var _ Sink = (*parquetSink)(nil)
+
+// newParquetSink creates the sink, connecting to the object store if files are uploaded to S3
+func newParquetSink(config *cfg.Config) (*parquetSink, error) {
+	s := &parquetSink{config: config, batchScans: config.ParquetBatchScans, pending: newPendingBatches("parquet", config.ParquetMaxPending, config.SpillDir)}
+	if s.batchScans <= 0 {
+		s.batchScans = defaultParquetBatchScans
+	}
+	if config.ParquetS3 {
+		store, err := newObjectStore(config)
+		if err != nil {
+			return nil, err
+		}
+		s.store = store
+	} else if config.ParquetDir == "" {
+		return nil, fmt.Errorf("ParquetDir cannot be blank when not writing Parquet files to S3")
+	}
+	return s, nil
+}
+
+// Name implements the Sink interface
+func (s *parquetSink) Name() string {
+	return "parquet"
+}
+
+// Open checks that the destination is writable
+func (s *parquetSink) Open() error {
+	if s.store != nil {
+		return s.store.checkBucket()
+	}
+	return os.MkdirAll(s.config.ParquetDir, 0755)
+}
+
+// Write buffers the scan and writes a file once enough scans have accumulated. A file that can't be written is kept
+// pending rather than failing the scan, which is buffered already
+func (s *parquetSink) Write(scan *Scan) error {
+	t := scan.Time.UnixMilli()
+	for _, r := range scan.Readings {
+		s.rows = append(s.rows, parquetRow{Time: t, Rig: scan.Rig, Serial: scan.Serial, Measurement: r.Measurement, Mass: r.Mass, Value: r.Value})
+	}
+	s.scans++
+	if s.scans >= s.batchScans {
+		if err := s.writeFile(); err != nil {
+			log.Printf("Could not write Parquet file, kept pending: %v", err)
+		}
+	}
+	return nil
+}
+
+// writeFile encodes the buffered rows and writes them out along with the pending files
+func (s *parquetSink) writeFile() error {
+	if len(s.rows) == 0 {
+		return s.pending.flush(s.put)
+	}
+	var buf bytes.Buffer
+	w := parquet.NewGenericWriter[parquetRow](&buf)
+	if _, err := w.Write(s.rows); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("mks-%d-%d.parquet", s.rows[0].Time, s.rows[len(s.rows)-1].Time)
+	log.Printf("Encoded %d readings from %d scans to %s", len(s.rows), s.scans, name)
+	b := pendingBatch{name: name, data: buf.Bytes(), scans: s.scans}
+	s.rows = s.rows[:0]
+	s.scans = 0
+	return s.pending.write(b, s.put)
+}
+
+// put writes the file to the bucket or the local directory
+func (s *parquetSink) put(b pendingBatch) error {
+	if s.store != nil {
+		return s.store.put(path.Join(s.config.ParquetPrefix, b.name), b.data, "application/vnd.apache.parquet")
+	}
+	return ioutil.WriteFile(filepath.Join(s.config.ParquetDir, b.name), b.data, 0644)
+}
+
+// Flush writes the remaining buffered scans
+func (s *parquetSink) Flush() error {
+	return s.writeFile()
+}
+
+// Close writes the remaining buffered scans
+func (s *parquetSink) Close() error {
+	return s.writeFile()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+)
+
+// defaultPeakRelativeHeight is the fraction of the highest point of an analog measurement a peak must reach when
+// PeakMinHeight isn't set
+var defaultPeakRelativeHeight = 0.01
+
+// Peak is a peak found in an analog measurement
+type Peak struct {
+	Measurement string  `json:"measurement"`
+	Mass        float64 `json:"mass"`   // centroid of the points above half maximum
+	Height      float64 `json:"height"` // value of the highest point
+	FWHM        float64 `json:"fwhm"`   // full width at half maximum [AMU], interpolated between points
+}
+
+// PeakList is the peaks found in one analog scan
+type PeakList struct {
+	Time     time.Time `json:"time"`
+	Sequence uint64    `json:"sequence"` // sequence number of the data frames of the scan
+	Peaks    []Peak    `json:"peaks"`
+}
+
+// peaksFrame wraps a peak list in a frame for Laniakea
+type peaksFrame struct {
+	Schema string    `json:"schema"`
+	Rig    string    `json:"rig,omitempty"`
+	Run    string    `json:"run,omitempty"`
+	Serial string    `json:"serial,omitempty"`
+	Peaks  *PeakList `json:"peaks"`
+}
+
+// findPeaks returns the peaks of the analog measurements of the scan and whether the scan has analog readings at all
+func findPeaks(readings []Payload, minHeight float64) ([]Peak, bool) {
+	peaks := []Peak{}
+	analog := false
+	for start := 0; start < len(readings); {
+		end := start + 1
+		for end < len(readings) && readings[end].Measurement == readings[start].Measurement {
+			end++
+		}
+		if readings[start].PointsPerPeak > 0 {
+			analog = true
+			peaks = append(peaks, tracePeaks(readings[start:end], minHeight)...)
+		}
+		start = end
+	}
+	return peaks, analog
+}
+
+// tracePeaks finds the local maxima of the trace of one analog measurement reaching minHeight, or
+// defaultPeakRelativeHeight of the trace maximum if minHeight is 0
+func tracePeaks(trace []Payload, minHeight float64) []Peak {
+	if minHeight <= 0 {
+		for _, r := range trace {
+			if r.Value*defaultPeakRelativeHeight > minHeight {
+				minHeight = r.Value * defaultPeakRelativeHeight
+			}
+		}
+		if minHeight <= 0 {
+			return nil
+		}
+	}
+	var peaks []Peak
+	for i, r := range trace {
+		// the first point of a plateau counts as the maximum
+		if r.Value < minHeight || (i > 0 && trace[i-1].Value >= r.Value) || (i < len(trace)-1 && trace[i+1].Value > r.Value) {
+			continue
+		}
+		half := r.Value / 2
+		left, right := i, i
+		for left > 0 && trace[left-1].Value > half {
+			left--
+		}
+		for right < len(trace)-1 && trace[right+1].Value > half {
+			right++
+		}
+		var sum, weighted float64
+		for _, p := range trace[left : right+1] {
+			sum += p.Value
+			weighted += p.Mass * p.Value
+		}
+		lo, hi := trace[left].Mass, trace[right].Mass
+		if left > 0 {
+			lo = crossing(trace[left-1], trace[left], half)
+		}
+		if right < len(trace)-1 {
+			hi = crossing(trace[right+1], trace[right], half)
+		}
+		peaks = append(peaks, Peak{Measurement: r.Measurement, Mass: weighted / sum, Height: r.Value, FWHM: hi - lo})
+	}
+	return peaks
+}
+
+// crossing interpolates the mass at which the trace crosses level between a point below and a point above it
+func crossing(below, above Payload, level float64) float64 {
+	return below.Mass + (level-below.Value)/(above.Value-below.Value)*(above.Mass-below.Mass)
+}
+
+// emitPeaks sends the peaks of an analog scan as a peak-list frame following its data frames
+func (e *MksRgaDatasource) emitPeaks(frameChan chan *proto.Frame, scan *Scan, sequence uint64, peaks []Peak) {
+	b, err := json.Marshal(&peaksFrame{
+		Schema: frameSchema,
+		Rig:    scan.Rig,
+		Run:    scan.Run,
+		Serial: scan.Serial,
+		Peaks:  &PeakList{Time: scan.Time, Sequence: sequence, Peaks: peaks},
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	e.sendFrame(frameChan, &proto.Frame{
+		Source:    pluginName,
+		Type:      "application/json",
+		Timestamp: scan.Time.UnixMilli(),
+		Payload:   b,
+	})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+)
+
+var defaultPipelineBuffer = 16
+
+// Processor transforms a completed scan before it is published. Returning nil drops the scan
+type Processor func(scan *Scan) *Scan
+
+// pipeline carries completed scans from the recording goroutine, which reads the sensor, through the processors to
+// the sinks and Laniakea. The stages are connected by bounded channels so that slow sinks never stall sensor reads
+type pipeline struct {
+	e         *MksRgaDatasource
+	frameChan chan *proto.Frame
+	scans     chan *Scan
+	processed chan *Scan
+	done      chan struct{}
+	sequence  uint64 // data frames published, only used by the publishing stage
+}
+
+// newPipeline starts the processing and publishing stages
+func (e *MksRgaDatasource) newPipeline(frameChan chan *proto.Frame) *pipeline {
+	size := e.config.PipelineBuffer
+	if size <= 0 {
+		size = defaultPipelineBuffer
+	}
+	p := &pipeline{
+		e:         e,
+		frameChan: frameChan,
+		scans:     make(chan *Scan, size),
+		processed: make(chan *Scan, size),
+		done:      make(chan struct{}),
+	}
+	go p.process()
+	go p.publish()
+	return p
+}
+
+// push queues a completed scan without blocking. If the pipeline is full the oldest queued scan is dropped
+func (p *pipeline) push(scan *Scan) {
+	for {
+		select {
+		case p.scans <- scan:
+			return
+		default:
+		}
+		select {
+		case old := <-p.scans:
+			scansDropped.Add(1)
+			log.Println("Pipeline full, dropped the oldest queued scan")
+			p.e.rejects.scans(rejectPipelineFull, "", nil, old)
+		default:
+		}
+	}
+}
+
+// close stops accepting scans and waits for the queued ones to be published
+func (p *pipeline) close() {
+	close(p.scans)
+	<-p.done
+}
+
+// supervise runs the stage until it returns, restarting it if it panics so that the scans queued after the one it
+// panicked on are still published
+func (p *pipeline) supervise(name string, stage func()) {
+	for {
+		panicked := true
+		func() {
+			defer p.e.recoverPanic(name, nil)
+			stage()
+			panicked = false
+		}()
+		if !panicked {
+			return
+		}
+		log.Printf("Restarting %s stage after panic", name)
+	}
+}
+
+// process runs every processor on the scans, in order
+func (p *pipeline) process() {
+	defer close(p.processed)
+	p.supervise("processing", p.processScans)
+}
+
+// processScans is the processing stage
+func (p *pipeline) processScans() {
+	for scan := range p.scans {
+		for _, proc := range p.e.processors {
+			if scan = proc(scan); scan == nil {
+				break
+			}
+		}
+		if scan != nil {
+			p.processed <- scan
+		}
+	}
+}
+
+// publish writes the scans to the sinks and sends them to Laniakea, split in chunks of FrameChunkSize readings and
+// followed by the peaks of analog measurements if AnalogPeaks is set
+func (p *pipeline) publish() {
+	defer close(p.done)
+	p.supervise("publishing", p.publishScans)
+}
+
+// publishScans is the publishing stage
+func (p *pipeline) publishScans() {
+	for scan := range p.processed {
+		p.e.writeSinks(scan)
+		p.sequence++
+		parts, chunks := chunkScan(scan, p.sequence, p.e.config.FrameChunkSize)
+		for i, part := range parts {
+			// chunks are encoded one at a time so a large scan is never held as a single payload
+			frame, err := p.e.encodeDataFrame(part, chunks[i])
+			if err != nil {
+				log.Println(err)
+				break
+			}
+			p.e.sendFrame(p.frameChan, frame)
+		}
+		if p.e.config.AnalogPeaks {
+			if peaks, analog := findPeaks(scan.Readings, p.e.config.PeakMinHeight); analog {
+				p.e.emitPeaks(p.frameChan, scan, p.sequence, peaks)
+			}
+		}
+	}
+}
+
+// encodeDataFrame encodes the scan as JSON or, if FrameEncoding is protobuf, as a mksrga.v1.Scan message. The chunk
+// is nil if the scan is not chunked
+func (e *MksRgaDatasource) encodeDataFrame(scan *Scan, chunk *FrameChunk) (*proto.Frame, error) {
+	if e.config.FrameEncoding == frameEncodingProtobuf {
+		return &proto.Frame{
+			Source:    pluginName,
+			Type:      protobufFrameType,
+			Timestamp: scan.Time.UnixMilli(),
+			Payload:   encodeScanProto(scan, chunk),
+		}, nil
+	}
+	df := Frame{
+		Schema:         frameSchema,
+		Rig:            scan.Rig,
+		Run:            scan.Run,
+		Serial:         scan.Serial,
+		SourceProfile:  scan.SourceProfile,
+		IonizationMode: scan.IonizationMode,
+		Inlet:          scan.Inlet,
+		Digital:        scan.Digital,
+		Chunk:          chunk,
+		Similarity:     scan.Similarity,
+		Clock:          scan.Clock,
+		Flags:          scan.Flags,
+		Data:           scan.Readings,
+	}
+	// transform to json string
+	b, err := json.Marshal(&df)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.Frame{
+		Source:    pluginName,
+		Type:      "application/json",
+		Timestamp: scan.Time.UnixMilli(),
+		Payload:   b,
+	}, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+	bg "github.com/SSSOCPaulCote/blunderguard"
+)
+
+const (
+	checkFilament   = "filament"
+	checkRFTrip     = "rftrip"
+	checkMultiplier = "multiplier"
+	checkPressure   = "pressure"
+)
+
+var (
+	ErrFilamentBadEmission = bg.Error("filament reports bad emission")
+	ErrRFTripped           = bg.Error("RF trip is active")
+	ErrMultiplierLocked    = bg.Error("multiplier is locked")
+	ErrPressureTooHigh     = bg.Error("total pressure is above the maximum start pressure")
+	ErrStartCheckUnread    = bg.Error("could not read the sensor state")
+	// 5e-5 Torr, above which the filament must not be turned on
+	defaultMaxStartPressure = 6.67e-3
+)
+
+// PreconditionError is returned by StartRecord when a health check finds the sensor unsafe to start
+type PreconditionError struct {
+	Check  string // filament, rftrip, multiplier or pressure, the name used in StartCheckOverrides
+	Detail string
+	Err    error // one of ErrFilamentBadEmission, ErrRFTripped, ErrMultiplierLocked, ErrPressureTooHigh or ErrStartCheckUnread
+}
+
+// Error implements the error interface
+func (e *PreconditionError) Error() string {
+	return fmt.Sprintf("Cannot start recording, %v: %s (override with StartCheckOverrides: [%s])", e.Err, e.Detail, e.Check)
+}
+
+// Unwrap returns the failed check's sentinel error
+func (e *PreconditionError) Unwrap() error {
+	return e.Err
+}
+
+// validateStartCheckOverrides checks the names of the overridden start checks
+func validateStartCheckOverrides(overrides []string) error {
+	for _, name := range overrides {
+		switch name {
+		case checkFilament, checkRFTrip, checkMultiplier, checkPressure:
+		default:
+			return fmt.Errorf("Unknown start check %s, expected filament, rftrip, multiplier or pressure", name)
+		}
+	}
+	return nil
+}
+
+// startCheckOverridden reports whether the check is listed in StartCheckOverrides
+func (e *MksRgaDatasource) startCheckOverridden(check string) bool {
+	for _, name := range e.config.StartCheckOverrides {
+		if name == check {
+			return true
+		}
+	}
+	return false
+}
+
+// checkStartPreconditions verifies the filament, RF trip, multiplier and total pressure before a recording starts.
+// A check whose state can't be read fails. Overridden checks are still run and logged but don't prevent the recording
+// from starting
+func (e *MksRgaDatasource) checkStartPreconditions() error {
+	checks := []struct {
+		name string
+		run  func() *PreconditionError
+	}{
+		{checkFilament, e.checkFilament},
+		{checkRFTrip, e.checkRFTrip},
+		{checkMultiplier, e.checkMultiplier},
+		{checkPressure, e.checkPressure},
+	}
+	for _, c := range checks {
+		perr := c.run()
+		if perr == nil {
+			continue
+		}
+		if e.startCheckOverridden(c.name) {
+			log.Printf("Ignoring failed start check: %v", perr)
+			continue
+		}
+		return perr
+	}
+	return nil
+}
+
+// checkFilament fails if the filament reports bad emission
+func (e *MksRgaDatasource) checkFilament() *PreconditionError {
+	resp, err := e.connection.FilamentInfo()
+	if err != nil {
+		return unreadCheck(checkFilament, "FilamentInfo", err)
+	}
+	if state := fmt.Sprint(resp.Fields["SummaryState"].Value); state == mks.RGA_FILAMENT_BAD_EMISSION {
+		return &PreconditionError{Check: checkFilament, Detail: "FilamentInfo reports " + state, Err: ErrFilamentBadEmission}
+	}
+	return nil
+}
+
+// checkRFTrip fails if the RF trip is active
+func (e *MksRgaDatasource) checkRFTrip() *PreconditionError {
+	resp, err := e.connection.RFInfo()
+	if err != nil {
+		return unreadCheck(checkRFTrip, "RFInfo", err)
+	}
+	if tripped, _ := resp.Fields["Tripped"].Value.(bool); tripped {
+		return &PreconditionError{Check: checkRFTrip, Detail: "RFInfo reports Tripped", Err: ErrRFTripped}
+	}
+	return nil
+}
+
+// checkMultiplier fails if the multiplier is locked, reporting the lock reasons
+func (e *MksRgaDatasource) checkMultiplier() *PreconditionError {
+	resp, err := e.connection.MultiplierInfo()
+	if err != nil {
+		return unreadCheck(checkMultiplier, "MultiplierInfo", err)
+	}
+	if locked, _ := resp.Fields["Locked"].Value.(bool); locked {
+		reasons := "no reason reported"
+		if v, ok := resp.Fields["LockReasons"]; ok && v.Value != nil {
+			reasons = fmt.Sprint(v.Value)
+		}
+		return &PreconditionError{Check: checkMultiplier, Detail: reasons, Err: ErrMultiplierLocked}
+	}
+	return nil
+}
+
+// checkPressure fails if the total pressure is above MaxStartPressure. Sensors without a total pressure gauge pass
+func (e *MksRgaDatasource) checkPressure() *PreconditionError {
+	limit := e.config.MaxStartPressure
+	if limit <= 0 {
+		limit = defaultMaxStartPressure
+	}
+	resp, err := e.connection.TotalPressureInfo()
+	if err != nil {
+		return unreadCheck(checkPressure, "TotalPressureInfo", err)
+	}
+	p, ok := resp.Fields["Pressure"].Float()
+	if ok && p > limit {
+		return &PreconditionError{Check: checkPressure, Detail: fmt.Sprintf("%g Pa > %g Pa", p, limit), Err: ErrPressureTooHigh}
+	}
+	return nil
+}
+
+// unreadCheck fails the check whose state couldn't be read by the command
+func unreadCheck(check, command string, err error) *PreconditionError {
+	return &PreconditionError{Check: check, Detail: fmt.Sprintf("%s failed: %v", command, err), Err: ErrStartCheckUnread}
+}
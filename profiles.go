@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+// findSourceProfile returns the configured source profile with the given name
+func (e *MksRgaDatasource) findSourceProfile(name string) (cfg.SourceProfile, bool) {
+	for _, p := range e.config.SourceProfiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return cfg.SourceProfile{}, false
+}
+
+// sourceSettings converts a profile to the settings sent to the sensor
+func sourceSettings(p cfg.SourceProfile) mks.SourceSettings {
+	return mks.SourceSettings{
+		IonEnergy:          p.IonEnergy,
+		Emission:           p.Emission,
+		Extract:            p.Extract,
+		ElectronEnergy:     p.ElectronEnergy,
+		LowMassResolution:  p.LowMassResolution,
+		LowMassAlignment:   p.LowMassAlignment,
+		HighMassAlignment:  p.HighMassAlignment,
+		HighMassResolution: p.HighMassResolution,
+	}
+}
+
+// applySourceProfile applies every parameter of the profile. The settings of the source table are read first so that,
+// if the sensor rejects one of the parameters partway, they are applied again and the source isn't left with a mix of
+// both, whether or not the previous settings came from a profile
+func (e *MksRgaDatasource) applySourceProfile(name string) error {
+	p, ok := e.findSourceProfile(name)
+	if !ok {
+		return ErrUnknownSourceProfile
+	}
+	snapshot, serr := e.connection.ReadSourceSettings(p.SourceIndex)
+	if serr != nil {
+		log.Printf("Could not read the source settings before applying profile %s: %v", p.Name, serr)
+	}
+	if err := e.connection.ApplySourceSettings(p.SourceIndex, sourceSettings(p)); err != nil {
+		if serr == nil {
+			if rerr := e.connection.ApplySourceSettings(p.SourceIndex, snapshot); rerr != nil {
+				log.Printf("Could not restore the source settings: %v", rerr)
+			}
+		}
+		return err
+	}
+	log.Printf("Applied source profile %s", p.Name)
+	e.sourceProfile = p.Name
+	e.annotate("Source profile applied", p.Name, "source")
+	return nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	partialPressureMetric = "mks_rga_partial_pressure_pascals"
+	totalPressureMetric   = "mks_rga_total_pressure_pascals"
+	staleDataMetric       = "mks_rga_stale_data"
+	calibrationMetric     = "mks_rga_calibration_overdue"
+	heartbeatMetric       = "mks_rga_heartbeat_timestamp_seconds"
+	remoteWriteTimeout    = 10 * time.Second
+)
+
+// promLabel is a single Prometheus label
+type promLabel struct {
+	name  string
+	value string
+}
+
+// promSeries is a labelled sample
+type promSeries struct {
+	labels []promLabel // sorted by name, including __name__
+	value  float64
+}
+
+// prometheusSink pushes every scan to a Prometheus remote-write endpoint (Mimir, VictoriaMetrics, ...) and optionally
+// serves the latest values on a /metrics endpoint
+type prometheusSink struct {
+	config *cfg.Config
+	client *http.Client
+	srv    *http.Server
+	sync.RWMutex
+	latest []promSeries
+}
+
+var _ Sink = (*prometheusSink)(nil)
+var _ StatusWriter = (*prometheusSink)(nil)
+
+// newPrometheusSink creates the sink and starts the /metrics listener if configured
+func newPrometheusSink(config *cfg.Config) *prometheusSink {
+	s := &prometheusSink{
+		config: config,
+		client: &http.Client{Timeout: remoteWriteTimeout},
+	}
+	if config.PrometheusMetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", s.serveMetrics)
+		s.srv = &http.Server{Addr: config.PrometheusMetricsAddr, Handler: mux}
+		go func() {
+			if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("Prometheus metrics listener stopped: %v", err)
+			}
+		}()
+	}
+	return s
+}
+
+// name returns the metric name of the series
+func (ts promSeries) name() string {
+	for _, l := range ts.labels {
+		if l.name == "__name__" {
+			return l.value
+		}
+	}
+	return ""
+}
+
+// newSeries returns a series with the configured labels, the metric name and the given extra labels
+func (s *prometheusSink) newSeries(metric string, value float64, extra ...promLabel) promSeries {
+	labels := []promLabel{{name: "__name__", value: metric}}
+	for name, value := range s.config.PrometheusLabels {
+		labels = append(labels, promLabel{name: name, value: value})
+	}
+	labels = append(labels, extra...)
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return promSeries{labels: labels, value: value}
+}
+
+// Name implements the Sink interface
+func (s *prometheusSink) Name() string {
+	return "prometheus"
+}
+
+// Open implements the Sink interface
+func (s *prometheusSink) Open() error {
+	return nil
+}
+
+// Write converts the scan to series, keeps them for /metrics and pushes them to the remote-write endpoint
+func (s *prometheusSink) Write(scan *Scan) error {
+	var id []promLabel
+	if scan.Rig != "" {
+		id = append(id, promLabel{name: "rig", value: scan.Rig})
+	}
+	if scan.Serial != "" {
+		id = append(id, promLabel{name: "serial", value: scan.Serial})
+	}
+	series := []promSeries{s.newSeries(totalPressureMetric, scan.TotalPressure, id...), s.newSeries(staleDataMetric, 0, id...)}
+	for _, r := range scan.Readings {
+		series = append(series, s.newSeries(partialPressureMetric, r.Value, append([]promLabel{
+			{name: "mass", value: formatMass(r.Mass)},
+			{name: "measurement", value: r.Measurement},
+		}, id...)...))
+	}
+	s.Lock()
+	// the calibration gauge is only set when a recording starts
+	for _, ts := range s.latest {
+		if ts.name() == calibrationMetric {
+			series = append(series, ts)
+		}
+	}
+	s.latest = series
+	s.Unlock()
+	if s.config.PrometheusRemoteWriteURL == "" {
+		return nil
+	}
+	return s.remoteWrite(encodeWriteRequest(series, scan.Time.UnixMilli()))
+}
+
+// WriteStatus sets the stale data or calibration overdue gauge and pushes it to the remote-write endpoint
+func (s *prometheusSink) WriteStatus(st *Status) error {
+	var id []promLabel
+	if st.Rig != "" {
+		id = append(id, promLabel{name: "rig", value: st.Rig})
+	}
+	if st.Serial != "" {
+		id = append(id, promLabel{name: "serial", value: st.Serial})
+	}
+	metric, active := staleDataMetric, st.Stale
+	if st.Kind == statusKindCalibration {
+		metric, active = calibrationMetric, st.CalibrationOverdue
+	}
+	var v float64
+	if active {
+		v = 1
+	}
+	if st.Kind == statusKindHeartbeat {
+		metric, v = heartbeatMetric, float64(st.Time.Unix())
+	}
+	series := s.newSeries(metric, v, id...)
+	s.Lock()
+	s.latest = append([]promSeries{series}, s.latest...)
+	for i := 1; i < len(s.latest); i++ {
+		if s.latest[i].name() == metric {
+			s.latest = append(s.latest[:i], s.latest[i+1:]...)
+			break
+		}
+	}
+	s.Unlock()
+	if s.config.PrometheusRemoteWriteURL == "" {
+		return nil
+	}
+	return s.remoteWrite(encodeWriteRequest([]promSeries{series}, st.Time.UnixMilli()))
+}
+
+// remoteWrite posts a snappy compressed write request
+func (s *prometheusSink) remoteWrite(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteWriteTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.PrometheusRemoteWriteURL, bytes.NewReader(snappy.Encode(nil, body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if s.config.PrometheusUsername != "" {
+		req.SetBasicAuth(s.config.PrometheusUsername, s.config.PrometheusPassword)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote write failed with status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// encodeWriteRequest encodes the series as a prometheus.WriteRequest protobuf message with one sample each
+func encodeWriteRequest(series []promSeries, timestamp int64) []byte {
+	var req []byte
+	for _, ts := range series {
+		var tsBytes []byte
+		for _, l := range ts.labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.value)
+			tsBytes = protowire.AppendTag(tsBytes, 1, protowire.BytesType)
+			tsBytes = protowire.AppendBytes(tsBytes, label)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(ts.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(timestamp))
+		tsBytes = protowire.AppendTag(tsBytes, 2, protowire.BytesType)
+		tsBytes = protowire.AppendBytes(tsBytes, sample)
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, tsBytes)
+	}
+	return req
+}
+
+// serveMetrics writes the latest series in the Prometheus text exposition format
+func (s *prometheusSink) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	s.RLock()
+	defer s.RUnlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# TYPE %s gauge\n# TYPE %s gauge\n# TYPE %s gauge\n", totalPressureMetric, partialPressureMetric, staleDataMetric)
+	for _, ts := range s.latest {
+		var (
+			name   string
+			labels []string
+		)
+		for _, l := range ts.labels {
+			if l.name == "__name__" {
+				name = l.value
+				continue
+			}
+			labels = append(labels, fmt.Sprintf("%s=%q", l.name, l.value))
+		}
+		fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(labels, ","), strconv.FormatFloat(ts.value, 'g', -1, 64))
+	}
+}
+
+// Flush implements the Sink interface. Writes are synchronous so there is nothing to flush
+func (s *prometheusSink) Flush() error {
+	return nil
+}
+
+// Close stops the /metrics listener
+func (s *prometheusSink) Close() error {
+	if s.srv != nil {
+		return s.srv.Close()
+	}
+	return nil
+}
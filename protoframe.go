@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	frameEncodingJSON     = "json"
+	frameEncodingProtobuf = "protobuf"
+	protobufFrameType     = "application/x-protobuf"
+	protobufFrameSchema   = "mksrga.v1.Scan"
+)
+
+// validateFrameEncoding checks the configured data frame encoding
+func validateFrameEncoding(encoding string) error {
+	switch encoding {
+	case "", frameEncodingJSON, frameEncodingProtobuf:
+		return nil
+	}
+	return fmt.Errorf("Unknown frame encoding %s, expected json or protobuf", encoding)
+}
+
+// encodeScanProto encodes the scan as a mksrga.v1.Scan message, see schema/scan.proto. The chunk may be nil
+func encodeScanProto(scan *Scan, chunk *FrameChunk) []byte {
+	b := make([]byte, 0, 64+len(scan.Readings)*32)
+	b = appendProtoString(b, 1, protobufFrameSchema)
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(scan.Time.UnixMilli()))
+	b = appendProtoString(b, 3, scan.Rig)
+	b = appendProtoString(b, 4, scan.Run)
+	b = appendProtoString(b, 5, scan.Serial)
+	b = appendProtoString(b, 6, scan.SourceProfile)
+	b = appendProtoString(b, 7, scan.IonizationMode)
+	b = appendProtoString(b, 8, scan.Inlet)
+	// map entries are sorted so the encoding is deterministic
+	names := make([]string, 0, len(scan.Digital))
+	for name := range scan.Digital {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var entry []byte
+		entry = appendProtoString(entry, 1, name)
+		entry = protowire.AppendTag(entry, 2, protowire.VarintType)
+		entry = protowire.AppendVarint(entry, protowire.EncodeBool(scan.Digital[name]))
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	var reading []byte
+	for _, r := range scan.Readings {
+		reading = reading[:0]
+		reading = appendProtoString(reading, 1, r.Measurement)
+		reading = appendProtoDouble(reading, 2, r.Mass)
+		if r.PointsPerPeak != 0 {
+			reading = protowire.AppendTag(reading, 3, protowire.VarintType)
+			reading = protowire.AppendVarint(reading, uint64(int64(r.PointsPerPeak)))
+		}
+		reading = appendProtoDouble(reading, 4, r.Value)
+		if r.Raw != nil {
+			reading = protowire.AppendTag(reading, 5, protowire.Fixed64Type)
+			reading = protowire.AppendFixed64(reading, math.Float64bits(*r.Raw))
+		}
+		for _, flag := range r.Flags {
+			reading = appendProtoString(reading, 6, flag)
+		}
+		b = protowire.AppendTag(b, 10, protowire.BytesType)
+		b = protowire.AppendBytes(b, reading)
+	}
+	b = appendProtoDouble(b, 11, scan.TotalPressure)
+	if chunk != nil {
+		var c []byte
+		c = protowire.AppendTag(c, 1, protowire.VarintType)
+		c = protowire.AppendVarint(c, chunk.Sequence)
+		c = protowire.AppendTag(c, 2, protowire.VarintType)
+		c = protowire.AppendVarint(c, uint64(chunk.Index))
+		c = protowire.AppendTag(c, 3, protowire.VarintType)
+		c = protowire.AppendVarint(c, uint64(chunk.Total))
+		c = protowire.AppendTag(c, 4, protowire.VarintType)
+		c = protowire.AppendVarint(c, uint64(chunk.Offset))
+		c = protowire.AppendTag(c, 5, protowire.VarintType)
+		c = protowire.AppendVarint(c, uint64(chunk.Readings))
+		b = protowire.AppendTag(b, 12, protowire.BytesType)
+		b = protowire.AppendBytes(b, c)
+	}
+	if scan.Similarity != nil {
+		b = protowire.AppendTag(b, 13, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(*scan.Similarity))
+	}
+	if q := scan.Clock; q != nil {
+		var c []byte
+		c = appendProtoString(c, 1, q.Source)
+		c = appendProtoDouble(c, 2, q.Offset)
+		c = appendProtoDouble(c, 3, q.Uncertainty)
+		if q.Stratum != 0 {
+			c = protowire.AppendTag(c, 4, protowire.VarintType)
+			c = protowire.AppendVarint(c, uint64(q.Stratum))
+		}
+		if q.LastSync != nil {
+			c = protowire.AppendTag(c, 5, protowire.VarintType)
+			c = protowire.AppendVarint(c, uint64(q.LastSync.UnixMilli()))
+		}
+		if q.Synced {
+			c = protowire.AppendTag(c, 6, protowire.VarintType)
+			c = protowire.AppendVarint(c, 1)
+		}
+		b = protowire.AppendTag(b, 14, protowire.BytesType)
+		b = protowire.AppendBytes(b, c)
+	}
+	for _, flag := range scan.Flags {
+		b = appendProtoString(b, 15, flag)
+	}
+	return b
+}
+
+// appendProtoString appends a string field, omitted when blank as in proto3
+func appendProtoString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendProtoDouble appends a double field, omitted when 0 as in proto3
+func appendProtoDouble(b []byte, num protowire.Number, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+var (
+	// flags of a scan, they apply to every reading
+	flagFilamentWarmUp = "filamentWarmUp" // the filament was warming up while the scan ran
+	flagReconnected    = "reconnected"    // first scan after the link to the sensor was re-established
+	// flags of a reading
+	flagZeroUncorrected = "zeroUncorrected" // no zero reading was reported for the measurement yet
+	flagSaturated       = "saturated"       // at or above the ceiling of the detector, see saturation.go
+	flagUnderRange      = "underRange"      // below the noise floor of the detector
+	flagInterpolated    = "interpolated"    // averaged over fewer scans than ScansPerTick, some were missing the point
+)
+
+// scanFlags returns the flags of a scan starting now. The reconnected flag is cleared, only the first scan after
+// the link was re-established is flagged
+func (e *MksRgaDatasource) scanFlags() []string {
+	var flags []string
+	if e.filament == mks.RGA_FILAMENT_WARM_UP {
+		flags = append(flags, flagFilamentWarmUp)
+	}
+	if e.reconnected {
+		e.reconnected = false
+		flags = append(flags, flagReconnected)
+	}
+	return flags
+}
+
+// readingFlags returns the flags of a reading of the measurement, whose value is checked against the range of its
+// detector before any calibration or transform
+func (e *MksRgaDatasource) readingFlags(measurement string, r readingRange, value float64) []string {
+	var flags []string
+	if !e.zeroed[measurement] {
+		flags = append(flags, flagZeroUncorrected)
+	}
+	switch {
+	case value >= r.ceiling:
+		flags = append(flags, flagSaturated)
+	case value < r.floor:
+		flags = append(flags, flagUnderRange)
+	}
+	return flags
+}
+
+// hasFlag reports whether the flag is set
+func hasFlag(flags []string, flag string) bool {
+	return slices.Contains(flags, flag)
+}
+
+// addFlag adds the flag unless it is set already
+func addFlag(flags []string, flag string) []string {
+	if hasFlag(flags, flag) {
+		return flags
+	}
+	return append(flags, flag)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	defaultRedisKeyPrefix    = "mks"
+	defaultRedisStreamMaxLen = int64(10000)
+)
+
+// redisSink publishes every scan to a Redis stream and keeps the latest readings in a hash so that local HMI software
+// can subscribe with low latency. Readings are optionally added to RedisTimeSeries keys
+type redisSink struct {
+	client     *redis.Client
+	prefix     string
+	maxLen     int64
+	timeSeries bool
+}
+
+var _ Sink = (*redisSink)(nil)
+
+// newRedisSink creates the Redis client from the config
+func newRedisSink(config *cfg.Config) *redisSink {
+	s := &redisSink{
+		client: redis.NewClient(&redis.Options{
+			Addr:     config.RedisAddr,
+			Password: config.RedisPassword,
+			DB:       config.RedisDB,
+		}),
+		prefix:     config.RedisKeyPrefix,
+		maxLen:     config.RedisStreamMaxLen,
+		timeSeries: config.RedisTimeSeries,
+	}
+	if s.prefix == "" {
+		s.prefix = defaultRedisKeyPrefix
+	}
+	if s.maxLen == 0 {
+		s.maxLen = defaultRedisStreamMaxLen
+	}
+	return s
+}
+
+// Name implements the Sink interface
+func (s *redisSink) Name() string {
+	return "redis"
+}
+
+// Open checks that the Redis server is reachable
+func (s *redisSink) Open() error {
+	return s.client.Ping(context.Background()).Err()
+}
+
+// readingKey returns the field name used for a reading in the stream and latest hash
+func readingKey(r Payload) string {
+	return r.Measurement + ":" + formatMass(r.Mass)
+}
+
+// Write adds the scan to the stream, updates the latest hash and, if enabled, the time series in a single round trip
+func (s *redisSink) Write(scan *Scan) error {
+	ctx := context.Background()
+	ts := scan.Time.UnixMilli()
+	values := map[string]interface{}{"time": ts, "rig": scan.Rig, "serial": scan.Serial}
+	for _, r := range scan.Readings {
+		values[readingKey(r)] = r.Value
+	}
+	pipe := s.client.Pipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.prefix + ":scans",
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: values,
+	})
+	pipe.HSet(ctx, s.prefix+":latest", values)
+	if s.timeSeries {
+		for _, r := range scan.Readings {
+			pipe.Do(ctx, "TS.ADD", s.prefix+":ts:"+readingKey(r), strconv.FormatInt(ts, 10), r.Value, "LABELS", "measurement", r.Measurement, "mass", formatMass(r.Mass), "rig", scan.Rig, "serial", scan.Serial)
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Flush implements the Sink interface. Writes are synchronous so there is nothing to flush
+func (s *redisSink) Flush() error {
+	return nil
+}
+
+// Close implements the Sink interface
+func (s *redisSink) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+var (
+	defaultRejectLogSize = 10 // [MiB]
+	// reasons data is dropped
+	rejectParse            = "parse"            // a message from the RGA could not be parsed, the scan was aborted
+	rejectInvalidReading   = "invalidReading"   // a mass reading had an invalid mass position
+	rejectPipelineFull     = "pipelineFull"     // the oldest queued scan was dropped by the pipeline
+	rejectSinkQueueFull    = "sinkQueueFull"    // the oldest queued scan was dropped by a sink queue
+	rejectSinkFailed       = "sinkFailed"       // a sink failed to write the scans after every retry
+	rejectSinkCircuitOpen  = "sinkCircuitOpen"  // the sink was skipped after failing repeatedly
+	rejectFrameBacklogFull = "frameBacklogFull" // the frame backlog was full while Laniakea wasn't reading it
+	rejectFrameTimeout     = "frameTimeout"     // Laniakea stopped reading before the frame was sent
+)
+
+// rejectLog appends the data dropped by the plugin, with the reason, to a file as JSON lines. The file is rotated to
+// Path.1 when it reaches MaxSize, so the log never holds more than twice MaxSize. A nil rejectLog discards everything
+type rejectLog struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	f       *os.File
+	size    int64
+}
+
+// rejectRecord is a line of the reject log
+type rejectRecord struct {
+	Time   time.Time    `json:"time"`
+	Reason string       `json:"reason"`
+	Sink   string       `json:"sink,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	Raw    string       `json:"raw,omitempty"` // bytes read from the RGA
+	Hex    string       `json:"hex,omitempty"`
+	Scans  []*Scan      `json:"scans,omitempty"`
+	Frame  *proto.Frame `json:"frame,omitempty"`
+}
+
+// newRejectLog opens the reject log for appending
+func newRejectLog(c *cfg.RejectLog) (*rejectLog, error) {
+	size := c.MaxSize
+	if size <= 0 {
+		size = defaultRejectLogSize
+	}
+	l := &rejectLog{path: c.Path, maxSize: int64(size) << 20}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open opens the file and reads its current size
+func (l *rejectLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size = f, info.Size()
+	return nil
+}
+
+// rotate moves the full file to Path.1, replacing the previous one, and starts a new file
+func (l *rejectLog) rotate() error {
+	l.f.Close()
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// write appends the record, timestamped now unless it has a time. Failures are logged, troubleshooting must not stop
+// the acquisition
+func (l *rejectLog) write(r *rejectRecord) {
+	if l == nil {
+		return
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("Could not encode rejected data: %v", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return
+	}
+	if l.size > 0 && l.size+int64(len(b))+1 > l.maxSize {
+		if err := l.rotate(); err != nil {
+			log.Printf("Could not rotate the reject log: %v", err)
+			l.f = nil
+			return
+		}
+	}
+	n, err := l.f.Write(append(b, '\n'))
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("Could not write the reject log: %v", err)
+	}
+}
+
+// scans records scans dropped for the reason, by the sink if any
+func (l *rejectLog) scans(reason, sink string, err error, scans ...*Scan) {
+	r := &rejectRecord{Reason: reason, Sink: sink, Scans: scans}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	l.write(r)
+}
+
+// frame records a frame dropped for the reason
+func (l *rejectLog) frame(reason string, frame *proto.Frame) {
+	l.write(&rejectRecord{Reason: reason, Frame: frame})
+}
+
+// parseFailure records the raw response of a parse failure, if err is one
+func (l *rejectLog) parseFailure(err error) {
+	var perr *mks.ParseError
+	if !errors.As(err, &perr) {
+		return
+	}
+	l.write(&rejectRecord{Reason: rejectParse, Error: perr.Error(), Raw: string(perr.Raw), Hex: hex.EncodeToString(perr.Raw)})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// archiveLine is a line of the JSONL archive: the frame payload of a scan with the time of the scan
+type archiveLine struct {
+	Time time.Time `json:"time"`
+	*Frame
+}
+
+// readCapture calls fn with every scan of a capture file, oldest first. The format follows the extension: .db or
+// .sqlite for the SQLite store, .jsonl or .jsonl.gz for the archive and .parquet for the Parquet sink
+func readCapture(path string, fn func(scan *Scan) error) error {
+	switch {
+	case strings.HasSuffix(path, ".db") || strings.HasSuffix(path, ".sqlite"):
+		return readSQLiteCapture(path, fn)
+	case strings.HasSuffix(path, ".jsonl") || strings.HasSuffix(path, ".jsonl.gz"):
+		return readJSONLCapture(path, fn)
+	case strings.HasSuffix(path, ".parquet"):
+		return readParquetCapture(path, fn)
+	}
+	return fmt.Errorf("Unknown capture format %s, expected .db, .sqlite, .jsonl, .jsonl.gz or .parquet", path)
+}
+
+// readSQLiteCapture reads every scan of an SQLite store
+func readSQLiteCapture(path string, fn func(scan *Scan) error) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	store, err := OpenSQLiteStore(path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	scans, err := store.Scans(time.UnixMilli(math.MinInt64), time.UnixMilli(math.MaxInt64))
+	if err != nil {
+		return err
+	}
+	for _, scan := range scans {
+		if err := fn(scan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readJSONLCapture reads the scans of a JSONL archive, gzipped if it ends in .gz
+func readJSONLCapture(path string, fn func(scan *Scan) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	sc := bufio.NewScanner(r)
+	// analog scans can make long lines
+	sc.Buffer(make([]byte, 64<<10), 64<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := archiveLine{Frame: &Frame{}}
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			return fmt.Errorf("Could not read line %d of %s: %v", n, path, err)
+		}
+		if line.Time.IsZero() {
+			return fmt.Errorf("Line %d of %s has no time, it was archived before scan times were kept", n, path)
+		}
+		scan := &Scan{Time: line.Time, Readings: line.Data, Rig: line.Rig, Serial: line.Serial, Run: line.Run, Inlet: line.Inlet, Digital: line.Digital, Flags: line.Flags}
+		if err := fn(scan); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// readParquetCapture reads a file of the Parquet sink, grouping consecutive readings with the same time into scans
+func readParquetCapture(path string, fn func(scan *Scan) error) error {
+	rows, err := parquet.ReadFile[parquetRow](path)
+	if err != nil {
+		return err
+	}
+	var scan *Scan
+	for _, row := range rows {
+		if scan == nil || row.Time != scan.Time.UnixMilli() || row.Rig != scan.Rig || row.Serial != scan.Serial {
+			if scan != nil {
+				if err := fn(scan); err != nil {
+					return err
+				}
+			}
+			scan = &Scan{Time: time.UnixMilli(row.Time), Rig: row.Rig, Serial: row.Serial, Readings: []Payload{}}
+		}
+		scan.Readings = append(scan.Readings, Payload{Name: "mass " + formatMass(row.Mass), Measurement: row.Measurement, Mass: row.Mass, Value: row.Value})
+	}
+	if scan != nil {
+		return fn(scan)
+	}
+	return nil
+}
+
+// replay pushes the scans of a capture file through the processors to the sinks, without connecting to the sensor.
+// Scans are spaced as they were recorded, divided by speed, or written as fast as possible if speed is 0
+func (e *MksRgaDatasource) replay(path string, speed float64) error {
+	if err := e.openSinks(); err != nil {
+		return err
+	}
+	defer e.closeSinks()
+	defer e.flushSinks()
+	var (
+		first, start time.Time
+		replayed     int
+	)
+	err := readCapture(path, func(scan *Scan) error {
+		if speed > 0 {
+			if first.IsZero() {
+				first, start = scan.Time, time.Now()
+			}
+			time.Sleep(time.Until(start.Add(time.Duration(float64(scan.Time.Sub(first)) / speed))))
+		}
+		for _, proc := range e.processors {
+			if scan = proc(scan); scan == nil {
+				return nil
+			}
+		}
+		e.writeSinks(scan)
+		replayed++
+		return nil
+	})
+	log.Printf("Replayed %d scans from %s", replayed, path)
+	return err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+var (
+	alarmResolutionDrift    = "ResolutionDrift"
+	statusKindResolution    = "resolution"
+	defaultResolutionWindow = 5
+)
+
+// resolutionTracker averages the FWHM and position of the reference peak over the last Window analog scans
+type resolutionTracker struct {
+	fwhm     *smoothTransformer
+	shift    *smoothTransformer
+	baseline float64 // reference FWHM [AMU], learnt from the first full window if ReferenceFWHM isn't set
+}
+
+// validateResolutionMonitor checks the resolution monitor configuration
+func validateResolutionMonitor(m *cfg.ResolutionMonitor) error {
+	if m == nil {
+		return nil
+	}
+	if m.Mass <= 0 {
+		return fmt.Errorf("Resolution monitor needs the mass of its reference peak")
+	}
+	if m.MaxFWHMDrift <= 0 && m.MaxMassDrift <= 0 {
+		return fmt.Errorf("Resolution monitor needs a MaxFWHMDrift or a MaxMassDrift")
+	}
+	if m.ReferenceFWHM < 0 || m.Window < 0 {
+		return fmt.Errorf("Resolution monitor reference FWHM and window cannot be negative")
+	}
+	return nil
+}
+
+// newResolutionTracker returns a tracker averaging over Window scans, 5 if 0
+func newResolutionTracker(m *cfg.ResolutionMonitor) *resolutionTracker {
+	window := m.Window
+	if window <= 0 {
+		window = defaultResolutionWindow
+	}
+	return &resolutionTracker{
+		fwhm:     &smoothTransformer{window: make([]float64, window)},
+		shift:    &smoothTransformer{window: make([]float64, window)},
+		baseline: m.ReferenceFWHM,
+	}
+}
+
+// add adds the reference peak of a scan and returns the averaged FWHM and mass shift, and whether the window is full
+func (t *resolutionTracker) add(fwhm, shift float64) (float64, float64, bool) {
+	fwhm, shift = t.fwhm.Transform(fwhm), t.shift.Transform(shift)
+	return fwhm, shift, t.fwhm.filled == len(t.fwhm.window)
+}
+
+// referencePeak returns the highest peak within half an AMU of the reference mass
+func referencePeak(readings []Payload, m *cfg.ResolutionMonitor) (Peak, bool) {
+	peaks, _ := findPeaks(readings, 0)
+	var ref Peak
+	found := false
+	for _, p := range peaks {
+		if m.Measurement != "" && p.Measurement != m.Measurement {
+			continue
+		}
+		if math.Abs(p.Mass-m.Mass) <= 0.5 && (!found || p.Height > ref.Height) {
+			ref, found = p, true
+		}
+	}
+	return ref, found
+}
+
+// checkResolution tracks the reference peak of analog scans and raises the ResolutionDrift alarm when its averaged
+// FWHM or position drifts beyond the configured thresholds, which means the quadrupole needs re-tuning. Changes are
+// reported as a resolution status
+func (e *MksRgaDatasource) checkResolution(frameChan chan *proto.Frame, scan *Scan) {
+	m := e.config.ResolutionMonitor
+	if m == nil {
+		return
+	}
+	peak, ok := referencePeak(scan.Readings, m)
+	if !ok {
+		return
+	}
+	fwhm, shift, full := e.resolution.add(peak.FWHM, peak.Mass-m.Mass)
+	resolutionFWHM.Set(fwhm)
+	if !full {
+		return
+	}
+	if e.resolution.baseline == 0 {
+		e.resolution.baseline = fwhm
+		log.Printf("Reference FWHM of mass %s: %.3f AMU", formatMass(m.Mass), fwhm)
+		return
+	}
+	var drift []string
+	if m.MaxFWHMDrift > 0 && math.Abs(fwhm-e.resolution.baseline) > m.MaxFWHMDrift {
+		drift = append(drift, fmt.Sprintf("FWHM %.3f AMU, reference %.3f AMU", fwhm, e.resolution.baseline))
+	}
+	if m.MaxMassDrift > 0 && math.Abs(shift) > m.MaxMassDrift {
+		drift = append(drift, fmt.Sprintf("peak at %.3f, %+.3f AMU off", m.Mass+shift, shift))
+	}
+	active := len(drift) > 0
+	if active == e.alarms[alarmResolutionDrift] {
+		return
+	}
+	st := &Status{Time: e.now(), Kind: statusKindResolution, ResolutionDrift: active, Rig: e.config.RigID, Serial: e.serial, Inlet: e.inlet}
+	if active {
+		st.Reason = fmt.Sprintf("mass %s resolution drift: %s", formatMass(m.Mass), strings.Join(drift, ", "))
+		log.Printf("Resolution drift, the quadrupole may need re-tuning: %s", strings.Join(drift, ", "))
+	}
+	e.setAlarm(alarmResolutionDrift, active)
+	e.reportStatus(frameChan, st)
+}
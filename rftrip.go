@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+	bg "github.com/SSSOCPaulCote/blunderguard"
+)
+
+var (
+	alarmRFTrip         = "RFTrip"
+	ErrRFTripNotCleared = bg.Error("RF trip did not clear before RFTripTimeout")
+)
+
+// rfTripped reports whether an RFTripState event or the Tripped field of RFInfo shows an active trip
+func rfTripped(v mks.RGAValue) bool {
+	switch s := v.Value.(type) {
+	case bool:
+		return s
+	case string:
+		return strings.EqualFold(s, "Tripped") || strings.EqualFold(s, "Trip")
+	}
+	return false
+}
+
+// handleRFTrip pauses acquisition when the RF trips. The running scan is stopped so no readings are taken while the
+// RF is off, the alarm is raised and the time of the trip kept for RFTripTimeout
+func (e *MksRgaDatasource) handleRFTrip(state mks.RGAValue) {
+	log.Printf("RF trip: %v", state.Value)
+	e.setAlarm(alarmRFTrip, true)
+	if e.rfTripSince.IsZero() {
+		e.rfTripSince = time.Now()
+	}
+}
+
+// rfTripActive polls RFInfo while the RF trip alarm is raised and clears it once the trip clears, so that the scan
+// resumes on the next tick. It returns ErrRFTripNotCleared once the trip lasted longer than RFTripTimeout
+func (e *MksRgaDatasource) rfTripActive() (bool, error) {
+	if !e.alarms[alarmRFTrip] {
+		return false, nil
+	}
+	resp, err := e.connection.RFInfo()
+	if err != nil {
+		log.Printf("Could not read RF trip state: %v", err)
+	} else if !rfTripped(resp.Fields["Tripped"]) {
+		log.Printf("RF trip cleared after %v, resuming", time.Since(e.rfTripSince).Round(time.Second))
+		e.rfTripSince = time.Time{}
+		e.setAlarm(alarmRFTrip, false)
+		return false, nil
+	}
+	timeout := time.Duration(e.config.RFTripTimeout) * time.Second
+	if timeout > 0 && time.Since(e.rfTripSince) > timeout {
+		return true, fmt.Errorf("%w after %v", ErrRFTripNotCleared, timeout)
+	}
+	return true, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+// setRollover validates and sends the rollover variables and scale factors to the sensor
+func (e *MksRgaDatasource) setRollover(r cfg.Rollover) error {
+	scaleFactors, err := massFactors(r.ScaleFactors)
+	if err != nil {
+		return fmt.Errorf("Invalid rollover scale factors: %v", err)
+	}
+	err = e.connection.SetRollover(mks.RolloverSettings{
+		M1:           r.M1,
+		M2:           r.M2,
+		B1:           r.B1,
+		B2:           r.B2,
+		BP1:          r.BP1,
+		ScaleFactors: scaleFactors,
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Rollover variables set: M1=%d M2=%d B1=%v B2=%v BP1=%v", r.M1, r.M2, r.B1, r.B2, r.BP1)
+	e.annotate("Rollover variables", fmt.Sprintf("M1=%d M2=%d B1=%v B2=%v BP1=%v", r.M1, r.M2, r.B1, r.B2, r.BP1), "rollover")
+	return nil
+}
+
+// setRolloverCorrection enables or disables the rollover correction of a measurement and keeps it in the state
+func (e *MksRgaDatasource) setRolloverCorrection(name string, useCorrection bool) error {
+	idx := -1
+	for i, m := range e.measurements {
+		if m.Name == name {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return ErrUnknownMeasurement
+	}
+	if err := e.connection.SetRolloverCorrection(name, useCorrection); err != nil {
+		return err
+	}
+	e.measurements[idx].RolloverCorrection = useCorrection
+	e.saveState()
+	return nil
+}
+
+// RolloverInfo reads the rollover variables currently used by the sensor
+func (e *MksRgaDatasource) RolloverInfo() (r *mks.RolloverSettings, err error) {
+	err = e.inLoop(func() error {
+		r, err = e.connection.Rollover()
+		return err
+	})
+	return r, err
+}
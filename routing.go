@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+// routingTable holds the names of the sinks receiving the readings of every routed measurement. Measurements without
+// an entry go to every sink
+type routingTable map[string][]string
+
+// newRoutingTable checks the routes and returns their table. Every route must name configured measurements or detector
+// merges, each in a single route, and configured sinks. An Influx bucket requires the route to include the influx sink
+func newRoutingTable(routes []cfg.Route, config *cfg.Config, sinks []Sink) (routingTable, error) {
+	measurements := make(map[string]bool)
+	for _, m := range config.Measurements {
+		measurements[m.Name] = true
+	}
+	for _, m := range config.DetectorMerges {
+		measurements[m.Name] = true
+	}
+	var names []string
+	for _, s := range sinks {
+		names = append(names, s.Name())
+	}
+	table := make(routingTable)
+	for i, r := range routes {
+		if len(r.Measurements) == 0 {
+			return nil, fmt.Errorf("Route %d has no measurements", i)
+		}
+		for _, s := range r.Sinks {
+			if !slices.Contains(names, s) {
+				return nil, fmt.Errorf("Route %d sends to %s, which isn't configured", i, s)
+			}
+		}
+		if r.InfluxBucket != "" && len(r.Sinks) > 0 && !slices.Contains(r.Sinks, "influx") {
+			return nil, fmt.Errorf("Route %d has an Influx bucket but doesn't send to influx", i)
+		}
+		to := r.Sinks
+		if len(to) == 0 {
+			to = names
+		}
+		for _, m := range r.Measurements {
+			if !measurements[m] {
+				return nil, fmt.Errorf("Route %d names unknown measurement %s", i, m)
+			}
+			if _, ok := table[m]; ok {
+				return nil, fmt.Errorf("Measurement %s has several routes", m)
+			}
+			table[m] = to
+		}
+	}
+	return table, nil
+}
+
+// routeScan returns the scan with only the readings routed to the sink, or nil if none is. The scan itself is returned
+// when every reading is
+func (t routingTable) routeScan(scan *Scan, sink string) *Scan {
+	if len(t) == 0 {
+		return scan
+	}
+	var readings []Payload
+	for i, r := range scan.Readings {
+		to, ok := t[r.Measurement]
+		if routed := !ok || slices.Contains(to, sink); routed && readings != nil {
+			readings = append(readings, r)
+		} else if !routed && readings == nil {
+			readings = append(make([]Payload, 0, len(scan.Readings)), scan.Readings[:i]...)
+		}
+	}
+	if readings == nil {
+		return scan
+	}
+	if len(readings) == 0 {
+		return nil
+	}
+	routed := *scan
+	routed.Readings = readings
+	return &routed
+}
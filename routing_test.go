@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+// namedSink is a sink doing nothing but having a name
+type namedSink struct {
+	recordSink
+	name string
+}
+
+func (s *namedSink) Name() string { return s.name }
+
+func TestNewRoutingTable(t *testing.T) {
+	config := &cfg.Config{
+		Measurements:   []cfg.Measurement{{Name: "bar"}, {Name: "faraday"}, {Name: "multiplier"}},
+		DetectorMerges: []cfg.DetectorMerge{{Name: "merged"}},
+	}
+	sinks := []Sink{&namedSink{name: "influx"}, &namedSink{name: "archive"}}
+	tests := []struct {
+		name   string
+		routes []cfg.Route
+		table  routingTable
+		err    bool
+	}{
+		{name: "no routes", table: routingTable{}},
+		{name: "to a sink", routes: []cfg.Route{{Measurements: []string{"bar"}, Sinks: []string{"archive"}}}, table: routingTable{"bar": {"archive"}}},
+		{name: "every sink", routes: []cfg.Route{{Measurements: []string{"merged"}}}, table: routingTable{"merged": {"influx", "archive"}}},
+		{name: "bucket", routes: []cfg.Route{{Measurements: []string{"bar"}, Sinks: []string{"influx"}, InfluxBucket: "fast"}}, table: routingTable{"bar": {"influx"}}},
+		{name: "no measurements", routes: []cfg.Route{{Sinks: []string{"influx"}}}, err: true},
+		{name: "unknown sink", routes: []cfg.Route{{Measurements: []string{"bar"}, Sinks: []string{"redis"}}}, err: true},
+		{name: "bucket without influx", routes: []cfg.Route{{Measurements: []string{"bar"}, Sinks: []string{"archive"}, InfluxBucket: "fast"}}, err: true},
+		{name: "unknown measurement", routes: []cfg.Route{{Measurements: []string{"analog"}}}, err: true},
+		{name: "several routes", routes: []cfg.Route{{Measurements: []string{"bar"}}, {Measurements: []string{"faraday", "bar"}}}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := newRoutingTable(tt.routes, config, sinks)
+			if (err != nil) != tt.err {
+				t.Fatalf("newRoutingTable() error = %v, want error %v", err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(table, tt.table) {
+				t.Errorf("newRoutingTable() = %v, want %v", table, tt.table)
+			}
+		})
+	}
+}
+
+func TestRouteScan(t *testing.T) {
+	scan := &Scan{Run: "r1", Readings: []Payload{
+		{Measurement: "bar", Mass: 1},
+		{Measurement: "faraday", Mass: 28},
+		{Measurement: "bar", Mass: 2},
+	}}
+	tests := []struct {
+		name   string
+		table  routingTable
+		sink   string
+		masses []float64 // nil if the scan isn't sent to the sink
+		same   bool      // the scan itself is returned
+	}{
+		{name: "no table", sink: "influx", masses: []float64{1, 28, 2}, same: true},
+		{name: "every reading routed", table: routingTable{"bar": {"influx"}}, sink: "influx", masses: []float64{1, 28, 2}, same: true},
+		{name: "some routed", table: routingTable{"bar": {"archive"}}, sink: "influx", masses: []float64{28}},
+		{name: "first left out", table: routingTable{"faraday": {"archive"}}, sink: "influx", masses: []float64{1, 2}},
+		{name: "none routed", table: routingTable{"bar": {"archive"}, "faraday": {"archive"}}, sink: "influx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routed := tt.table.routeScan(scan, tt.sink)
+			if tt.masses == nil {
+				if routed != nil {
+					t.Fatalf("routeScan() = %+v, want nil", routed)
+				}
+				return
+			}
+			if routed == nil {
+				t.Fatal("routeScan() = nil")
+			}
+			if (routed == scan) != tt.same {
+				t.Errorf("routeScan() returned the scan itself: %v, want %v", routed == scan, tt.same)
+			}
+			var masses []float64
+			for _, r := range routed.Readings {
+				masses = append(masses, r.Mass)
+			}
+			if !reflect.DeepEqual(masses, tt.masses) {
+				t.Errorf("routeScan() masses = %v, want %v", masses, tt.masses)
+			}
+			if routed.Run != scan.Run {
+				t.Errorf("routeScan() run = %s, want %s", routed.Run, scan.Run)
+			}
+			if len(scan.Readings) != 3 {
+				t.Errorf("routeScan() changed the scan, %d readings left", len(scan.Readings))
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+// RunHeader is a snapshot of the instrument configuration taken when a recording starts, so that every dataset can be
+// traced back to it
+type RunHeader struct {
+	Time          time.Time                      `json:"time"`
+	Rig           string                         `json:"rig,omitempty"`
+	Run           string                         `json:"run,omitempty"`
+	Serial        string                         `json:"serial,omitempty"`
+	Info          map[string]interface{}         `json:"info,omitempty"`
+	EGains        map[string]interface{}         `json:"eGains,omitempty"`
+	Sources       map[string]interface{}         `json:"sources,omitempty"`
+	Detectors     map[int]map[string]interface{} `json:"detectors,omitempty"` // per source index, includes calibration dates
+	Filaments     map[string]interface{}         `json:"filaments,omitempty"`
+	RF            map[string]interface{}         `json:"rf,omitempty"`
+	TotalPressure map[string]interface{}         `json:"totalPressure,omitempty"` // includes the gauge calibration date
+	Errors        []string                       `json:"errors,omitempty"`        // commands that failed
+}
+
+// RunHeaderWriter is implemented by sinks able to store run headers
+type RunHeaderWriter interface {
+	WriteRunHeader(h *RunHeader) error
+}
+
+// runHeaderFrame wraps a RunHeader in a frame for Laniakea
+type runHeaderFrame struct {
+	Schema    string     `json:"schema"`
+	RunHeader *RunHeader `json:"runHeader"`
+}
+
+// readRunHeader queries the instrument configuration. The commands share the connection so they are sent one after
+// the other, and a failed command is reported in the header instead of failing it
+func (e *MksRgaDatasource) readRunHeader() *RunHeader {
+	h := &RunHeader{Time: e.now(), Rig: e.config.RigID, Serial: e.serial, Detectors: make(map[int]map[string]interface{})}
+	for _, q := range []struct {
+		name string
+		cmd  func() (*mks.RGAResponse, error)
+		dst  *map[string]interface{}
+	}{
+		{"Info", e.connection.Info, &h.Info},
+		{"EGains", e.connection.EGains, &h.EGains},
+		{"SourceInfo", e.connection.SourceInfo, &h.Sources},
+		{"FilamentInfo", e.connection.FilamentInfo, &h.Filaments},
+		{"RFInfo", e.connection.RFInfo, &h.RF},
+		{"TotalPressureInfo", e.connection.TotalPressureInfo, &h.TotalPressure},
+	} {
+		resp, err := q.cmd()
+		if err != nil {
+			h.Errors = append(h.Errors, fmt.Sprintf("%s: %v", q.name, err))
+			continue
+		}
+		*q.dst = responseValues(resp)
+	}
+	for _, m := range e.measurements {
+		if _, ok := h.Detectors[m.SourceIndex]; ok {
+			continue
+		}
+		resp, err := e.connection.DetectorInfo(m.SourceIndex)
+		if err != nil {
+			h.Errors = append(h.Errors, fmt.Sprintf("DetectorInfo %d: %v", m.SourceIndex, err))
+			continue
+		}
+		h.Detectors[m.SourceIndex] = responseValues(resp)
+	}
+	return h
+}
+
+// publishRunHeader queues the run header for every sink supporting it and emits it as the first frame of the recording
+func (e *MksRgaDatasource) publishRunHeader(frameChan chan *proto.Frame, h *RunHeader) {
+	for _, q := range e.sinkQueues {
+		if w, ok := q.sink.(RunHeaderWriter); ok {
+			q.call("run header", func() error { return w.WriteRunHeader(h) })
+		}
+	}
+	b, err := json.Marshal(&runHeaderFrame{Schema: frameSchema, RunHeader: h})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	e.sendFrame(frameChan, &proto.Frame{
+		Source:    pluginName,
+		Type:      "application/json",
+		Timestamp: h.Time.UnixMilli(),
+		Payload:   b,
+	})
+}
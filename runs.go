@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+)
+
+var runSummaryFrameTimeout = 5 * time.Second
+
+// Run is a named section of a recording, used to tie datasets to experiments
+type Run struct {
+	ID          string    `json:"id"`
+	Description string    `json:"description,omitempty"`
+	Start       time.Time `json:"start"`
+}
+
+// RunSummary is emitted when a run closes
+type RunSummary struct {
+	Run
+	Rig         string         `json:"rig,omitempty"`
+	Serial      string         `json:"serial,omitempty"`
+	End         time.Time      `json:"end"`
+	Duration    float64        `json:"duration"` // [s]
+	Scans       int            `json:"scans"`
+	Alarms      map[string]int `json:"alarms,omitempty"` // times each alarm was raised
+	MinPressure float64        `json:"minPressure"`      // total pressure [Pa], 0 if never reported
+	MaxPressure float64        `json:"maxPressure"`
+}
+
+// RunSummaryWriter is implemented by sinks able to store run summaries
+type RunSummaryWriter interface {
+	WriteRunSummary(s *RunSummary) error
+}
+
+// runSummaryFrame wraps a RunSummary in a frame for Laniakea
+type runSummaryFrame struct {
+	Schema     string      `json:"schema"`
+	RunSummary *RunSummary `json:"runSummary"`
+}
+
+// openRun starts a new run. A blank ID is generated from the current time
+func (e *MksRgaDatasource) openRun(id, description string) {
+	now := time.Now()
+	if id == "" {
+		id = now.UTC().Format("20060102T150405Z")
+	}
+	e.run = &Run{ID: id, Description: description, Start: now}
+	e.runStats = RunSummary{Run: *e.run, Alarms: make(map[string]int)}
+	log.Printf("Run %s opened", id)
+	e.annotate("Run opened", id+" "+description, "run")
+}
+
+// runID returns the ID of the open run, blank if none
+func (e *MksRgaDatasource) runID() string {
+	if e.run == nil {
+		return ""
+	}
+	return e.run.ID
+}
+
+// countRunScan adds a completed scan to the statistics of the open run
+func (e *MksRgaDatasource) countRunScan(scan *Scan) {
+	if e.run == nil {
+		return
+	}
+	e.runStats.Scans++
+	if p := scan.TotalPressure; p > 0 {
+		if e.runStats.MinPressure == 0 || p < e.runStats.MinPressure {
+			e.runStats.MinPressure = p
+		}
+		if p > e.runStats.MaxPressure {
+			e.runStats.MaxPressure = p
+		}
+	}
+}
+
+// countRunAlarm counts raised alarms in the open run. It is registered as an alarm handler
+func (e *MksRgaDatasource) countRunAlarm(class string, active bool) {
+	if e.run != nil && active {
+		e.runStats.Alarms[class]++
+	}
+}
+
+// closeRun closes the open run, queues its summary for every sink supporting it and emits it as a frame
+func (e *MksRgaDatasource) closeRun(frameChan chan *proto.Frame) {
+	if e.run == nil {
+		return
+	}
+	summary := e.runStats
+	summary.Rig, summary.Serial = e.config.RigID, e.serial
+	summary.End = time.Now()
+	summary.Duration = summary.End.Sub(summary.Start).Seconds()
+	e.run = nil
+	log.Printf("Run %s closed after %d scans", summary.ID, summary.Scans)
+	e.annotate("Run closed", summary.ID, "run")
+	for _, q := range e.sinkQueues {
+		if w, ok := q.sink.(RunSummaryWriter); ok {
+			q.call("run summary", func() error { return w.WriteRunSummary(&summary) })
+		}
+	}
+	b, err := json.Marshal(&runSummaryFrame{Schema: frameSchema, RunSummary: &summary})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	frame := &proto.Frame{
+		Source:    pluginName,
+		Type:      "application/json",
+		Timestamp: summary.End.UnixMilli(),
+		Payload:   b,
+	}
+	// Laniakea may already have stopped reading when the recording ends
+	select {
+	case frameChan <- frame:
+		framesEmitted.Add(1)
+	case <-time.After(runSummaryFrameTimeout):
+		framesDropped.Add(1)
+		e.rejects.frame(rejectFrameTimeout, frame)
+	}
+}
+
+// StartRun closes the open run and opens a new one. A blank ID is generated from the current time
+func (e *MksRgaDatasource) StartRun(id, description string) error {
+	return e.inLoop(func() error {
+		e.closeRun(e.frames())
+		e.openRun(id, description)
+		e.saveState()
+		return nil
+	})
+}
+
+// EndRun closes the open run. Data recorded until the next run isn't tagged with a run
+func (e *MksRgaDatasource) EndRun() error {
+	return e.inLoop(func() error {
+		e.closeRun(e.frames())
+		e.saveState()
+		return nil
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+var (
+	defaultSaturationPressure = 1e-4  // [Pa] ceiling of the multipliers
+	defaultMultiplierFloor    = 1e-12 // [Pa]
+	defaultFaradayFloor       = 1e-9  // [Pa]
+	defaultFaradayCeiling     = 1e-2  // [Pa]
+)
+
+// detectorLimits holds what the sensor reported about its detectors when the recording started
+type detectorLimits struct {
+	eGains    []float64   // electronic gain factors by EGainIndex, nil if EGains failed
+	detectors map[int]int // number of detectors of each source table used by a measurement
+}
+
+// readingRange is the pressure range a measurement reads reliably with its detector and electronic gain [Pa]
+type readingRange struct {
+	floor   float64
+	ceiling float64
+}
+
+// readDetectorLimits reads the electronic gains and the detector table of every source used by a measurement. A
+// failed command is logged, the ranges are then left unscaled and detectors aren't switched
+func (e *MksRgaDatasource) readDetectorLimits() {
+	l := &detectorLimits{detectors: make(map[int]int)}
+	if resp, err := e.connection.EGains(); err != nil {
+		log.Printf("Could not read electronic gains: %v", err)
+	} else {
+		for i := 1; ; i++ {
+			g, ok := resp.Fields[fmt.Sprintf("Value%d", i)].Float()
+			if !ok {
+				break
+			}
+			l.eGains = append(l.eGains, g)
+		}
+	}
+	for _, m := range e.measurements {
+		if _, ok := l.detectors[m.SourceIndex]; ok {
+			continue
+		}
+		resp, err := e.connection.DetectorInfo(m.SourceIndex)
+		if err != nil {
+			log.Printf("Could not read detectors of source %d: %v", m.SourceIndex, err)
+			continue
+		}
+		l.detectors[m.SourceIndex] = resp.Rows
+	}
+	e.limits = l
+}
+
+// saturationPressure returns the default ceiling of the multipliers
+func (e *MksRgaDatasource) saturationPressure() float64 {
+	if e.config.SaturationPressure <= 0 {
+		return defaultSaturationPressure
+	}
+	return e.config.SaturationPressure
+}
+
+// readingRange returns the range of the detector of the measurement. DetectorRanges apply to the lowest electronic
+// gain, a higher gain lowers the floor and the ceiling by its ratio to the lowest one
+func (e *MksRgaDatasource) readingRange(m cfg.Measurement) readingRange {
+	r := readingRange{floor: defaultFaradayFloor, ceiling: defaultFaradayCeiling}
+	if m.DetectorIndex > 0 {
+		r = readingRange{floor: defaultMultiplierFloor, ceiling: e.saturationPressure()}
+	}
+	for _, d := range e.config.DetectorRanges {
+		if d.SourceIndex != m.SourceIndex || d.DetectorIndex != m.DetectorIndex {
+			continue
+		}
+		if d.Floor > 0 {
+			r.floor = d.Floor
+		}
+		if d.Ceiling > 0 {
+			r.ceiling = d.Ceiling
+		}
+	}
+	if l := e.limits; l != nil && m.EGainIndex > 0 && m.EGainIndex < len(l.eGains) && l.eGains[0] > 0 {
+		ratio := l.eGains[m.EGainIndex] / l.eGains[0]
+		r.floor /= ratio
+		r.ceiling /= ratio
+	}
+	return r
+}
+
+// switchGains moves every measurement with a saturated reading to the next lower electronic gain or, at the lowest
+// gain, from a multiplier to the Faraday. A measurement whose readings are all under range moves to the next higher
+// gain or, at the highest gain, from the Faraday to the first multiplier if its source has one. The multiplier
+// voltage isn't ramped, the one set on the sensor is used. Edits apply from the next scan. AutoRange replaces it
+func (e *MksRgaDatasource) switchGains(scan *Scan) {
+	if !e.config.GainSwitching || e.config.AutoRange != nil || e.limits == nil {
+		return
+	}
+	saturated := make(map[string]bool)
+	underRange := make(map[string]bool)
+	for _, r := range scan.Readings {
+		if hasFlag(r.Flags, flagSaturated) {
+			saturated[r.Measurement] = true
+		}
+		if _, ok := underRange[r.Measurement]; !ok {
+			underRange[r.Measurement] = true
+		}
+		if !hasFlag(r.Flags, flagUnderRange) {
+			underRange[r.Measurement] = false
+		}
+	}
+	for _, m := range e.measurements {
+		var edit mks.MeasurementEdit
+		switch {
+		case saturated[m.Name] && m.EGainIndex > 0:
+			edit = mks.EGainIndex(m.EGainIndex - 1)
+		case saturated[m.Name] && m.DetectorIndex > 0:
+			edit = mks.DetectorIndex(0)
+		case underRange[m.Name] && m.EGainIndex < len(e.limits.eGains)-1:
+			edit = mks.EGainIndex(m.EGainIndex + 1)
+		case underRange[m.Name] && m.DetectorIndex == 0 && e.limits.detectors[m.SourceIndex] > 1:
+			edit = mks.DetectorIndex(1)
+		default:
+			continue
+		}
+		if err := e.applyMeasurementEdit(m.Name, []mks.MeasurementEdit{edit}); err != nil {
+			log.Printf("Could not switch the gain of %s: %v", m.Name, err)
+		}
+	}
+}
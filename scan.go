@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+var defaultScanTimeout = 5 * time.Minute
+
+// runScan starts ScansPerTick scans and reads their responses. A scan is complete once the last measurement reaches its
+// end mass, reports as many readings as its mass range holds or the sensor starts another scan. The readings of the
+// scans are averaged into a single scan. The scan is aborted with ScanStop if the recording is stopped, the scan
+// deadline passes, the data goes stale or the RF trips
+func (e *MksRgaDatasource) runScan(frameChan chan *proto.Frame, expectedScan time.Duration) (*Scan, error) {
+	scan := &Scan{Time: e.now(), Clock: e.clockQuality(), Readings: []Payload{}, SensorState: e.sensorState, Rig: e.config.RigID, Serial: e.serial, SourceProfile: e.sourceProfile, IonizationMode: e.ionizationMode, Inlet: e.inlet, Run: e.runID(), Flags: e.scanFlags()}
+	// The scan is complete once the last measurement reaches its end mass or reports every point of its range
+	lastMeasurement := e.measurements[len(e.measurements)-1]
+	lastReadings, expectedReadings := 0, measurementPoints(lastMeasurement)
+	numScans, completed, pending := e.scansPerTick(), 0, 0
+	// the readings sent to the control connection too are discarded once the scan ends, whichever way it does
+	defer e.drainControl()
+	// Start scan
+	_, err := e.session.ScanResume(numScans)
+	if err != nil {
+		return nil, fmt.Errorf("could not resume scan: %w", err)
+	}
+	scanTimeout := time.Duration(e.config.ScanTimeout) * time.Second
+	if scanTimeout <= 0 {
+		scanTimeout = defaultScanTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scanTimeout)
+	stopped := make(chan struct{})
+	watcherDone := make(chan struct{})
+	// the watcher unblocks the pending read by moving the read deadline to now
+	go func() {
+		defer close(watcherDone)
+		select {
+		case <-e.quitChan:
+			close(stopped)
+			cancel()
+		case <-ctx.Done():
+		}
+		e.reader().SetReadDeadline(time.Now())
+	}()
+	defer func() {
+		cancel()
+		<-watcherDone
+		e.reader().SetReadDeadline(time.Time{})
+	}()
+	pointsPerPeak := make(map[string]int, len(e.measurements))
+	ranges := make(map[string]readingRange, len(e.measurements))
+	for _, m := range e.measurements {
+		pointsPerPeak[m.Name] = m.PointsPerPeak
+		ranges[m.Name] = e.readingRange(m)
+	}
+	var (
+		currentMeasurement string
+		restarted          bool
+	)
+	staleAfter := e.staleTimeout(expectedScan)
+	e.reader().SetReadDeadline(time.Now().Add(staleAfter))
+	for {
+		if ctx.Err() != nil {
+			return nil, e.abortScan(stopped)
+		}
+		resp, err := e.reader().ReadResponse()
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			if ctx.Err() != nil {
+				return nil, e.abortScan(stopped)
+			}
+			e.reportStale(frameChan, fmt.Sprintf("no mass reading received for %v", staleAfter))
+			if e.config.StaleDataRestart && !restarted {
+				restarted = true
+				if _, err := e.connection.ScanRestart(); err != nil {
+					log.Printf("Could not restart scan: %v", err)
+				}
+				scan.Readings = scan.Readings[:0]
+				completed, pending, lastReadings = 0, 0, 0
+				e.reader().SetReadDeadline(time.Now().Add(staleAfter))
+				continue
+			}
+			e.stopScan()
+			return nil, ErrStaleData
+		}
+		if err != nil {
+			e.rejects.parseFailure(err)
+			return nil, readError(err)
+		}
+		switch resp.ErrMsg.CommandName {
+		case mks.StartingScan:
+			// a new scan only starts once the previous one is complete
+			if pending > 0 {
+				completed, pending, lastReadings = completed+1, 0, 0
+				if completed == numScans {
+					return e.averageScans(scan, numScans), nil
+				}
+			}
+		case mks.StartingMeasurement:
+			currentMeasurement = resp.Fields["MeasurementName"].Value.(string)
+		case mks.ZeroReading:
+			e.zeroed[currentMeasurement] = true
+		case mks.TotalPressure:
+			scan.TotalPressure, _ = resp.Fields["Value"].Float()
+		case mks.LinkDown:
+			return nil, mks.LinkDownFromResponse(resp)
+		case mks.RFTripState:
+			// the event also reports the trip clearing, which rfTripActive polls for
+			if rfTripped(resp.Fields["State"]) {
+				e.handleRFTrip(resp.Fields["State"])
+				e.stopScan()
+				return nil, ErrRFTripped
+			}
+		case mks.InletChange:
+			// the inlet was switched by the handler. Events queued between scans are read before the first reading
+			if len(scan.Readings) == 0 {
+				scan.Inlet = e.inlet
+			}
+		case mks.MassReading:
+			// analog measurements report fractional positions, barcharts integer ones
+			massPos, ok := resp.Fields["MassPosition"].Float()
+			if !ok {
+				log.Printf("Ignoring reading with invalid mass position %v", resp.Fields["MassPosition"].Value)
+				e.rejects.write(&rejectRecord{Reason: rejectInvalidReading, Error: fmt.Sprintf("invalid mass position %v in %s", resp.Fields["MassPosition"].Value, currentMeasurement)})
+				continue
+			}
+			v, _ := resp.Fields["Value"].Float()
+			ppp := pointsPerPeak[currentMeasurement]
+			flags := e.readingFlags(currentMeasurement, ranges[currentMeasurement], v)
+			scan.Readings = append(scan.Readings, Payload{Name: "mass " + formatMass(massPos), Measurement: currentMeasurement, Mass: massPos, PointsPerPeak: ppp, Value: v, Flags: flags})
+			e.reader().SetReadDeadline(time.Now().Add(staleAfter))
+			pending++
+			if currentMeasurement != lastMeasurement.Name {
+				continue
+			}
+			lastReadings++
+			if reachedEndMass(massPos, lastMeasurement.EndMass, ppp) || lastReadings >= expectedReadings {
+				completed, pending, lastReadings = completed+1, 0, 0
+				if completed == numScans {
+					return e.averageScans(scan, numScans), nil
+				}
+			}
+		}
+	}
+}
+
+// subscribeEvents subscribes the handlers of the events that change the state of the datasource rather than the scan
+// being read, so they are handled whichever loop reads them, e.g. during a degas
+func (e *MksRgaDatasource) subscribeEvents(conn *mks.RGAConnection) {
+	if len(e.config.Inlets) > 0 {
+		conn.OnEvent(mks.InletChange, func(ev mks.Event) { e.handleInletChange(ev.RGAResponse) })
+	}
+	if e.config.ExternalGauge {
+		conn.OnEvent(mks.AnalogInput, func(ev mks.Event) { e.handleAnalogInput(ev.RGAResponse) })
+	}
+	conn.OnEvent(mks.DigitalPortChange, func(ev mks.Event) { e.handleDigitalPortChange(ev.RGAResponse) })
+	conn.OnEvent(mks.FilamentStatus, func(ev mks.Event) { e.handleFilamentStatus(ev.RGAResponse) })
+}
+
+// handleFilamentStatus keeps and annotates the filament status reported by a FilamentStatus event
+func (e *MksRgaDatasource) handleFilamentStatus(resp *mks.RGAResponse) {
+	e.filament = fmt.Sprint(resp.Fields["SummaryState"].Value)
+	e.annotate("Filament status", fmt.Sprintf("filament %v %v", resp.Fields["Filament"].Value, resp.Fields["SummaryState"].Value), "filament")
+	if fmt.Sprint(resp.Fields["SummaryState"].Value) == mks.RGA_FILAMENT_BAD_EMISSION {
+		e.annotate("Filament failure", fmt.Sprintf("filament %v reports %s", resp.Fields["Filament"].Value, mks.RGA_FILAMENT_BAD_EMISSION), "filament")
+	}
+}
+
+// reachedEndMass reports whether the mass position is the last point before the end mass, within half a point
+func reachedEndMass(massPos float64, endMass int, pointsPerPeak int) bool {
+	step := 1.0
+	if pointsPerPeak > 1 {
+		step = 1 / float64(pointsPerPeak)
+	}
+	return massPos >= float64(endMass)-step/2
+}
+
+// measurementPoints returns the number of readings a measurement reports per scan
+func measurementPoints(m cfg.Measurement) int {
+	width := m.EndMass - m.StartMass
+	if m.PointsPerPeak > 1 && m.Type == measurementTypeAnalog {
+		return width*m.PointsPerPeak + 1
+	}
+	return width + 1
+}
+
+// abortScan stops the scan on the sensor and returns why it was aborted
+func (e *MksRgaDatasource) abortScan(stopped chan struct{}) error {
+	e.stopScan()
+	select {
+	case <-stopped:
+		return ErrRecordingStopped
+	default:
+		return ErrScanTimeout
+	}
+}
+
+// stopScan stops the running scan, clearing the read deadline first so the response can be read. ScanStop empties the
+// scan list, so the measurements are added back for the next scan
+func (e *MksRgaDatasource) stopScan() {
+	e.connection.SetReadDeadline(time.Time{})
+	if _, err := e.session.ScanStop(); err != nil {
+		log.Printf("Could not stop scan: %v", err)
+	}
+	e.restoreScan()
+}
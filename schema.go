@@ -0,0 +1,14 @@
+package main
+
+import (
+	_ "embed"
+)
+
+var (
+	// frameSchemaJSON is the JSON Schema of every frame payload. The frame types mirror it and must be updated
+	// together, bumping frameSchemaVersion on incompatible changes
+	//go:embed schema/frame.schema.json
+	frameSchemaJSON    string
+	frameSchemaVersion = "v1"
+	frameSchema        = "https://raw.githubusercontent.com/SSSOC-CAN/mks-rga-plugin/main/schema/frame.schema.json#" + frameSchemaVersion
+)
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	influx "github.com/influxdata/influxdb-client-go/v2"
+)
+
+var (
+	selfTestMeasurement = cfg.Measurement{Name: "SelfTest", Type: measurementTypeBarchart, StartMass: 1, EndMass: 10, FilterMode: "PeakCenter", Accuracy: 3}
+	selfTestScanTimeout = 2 * time.Minute
+)
+
+// selfTestReport lists the outcome of every self-test step
+type selfTestReport struct {
+	w      io.Writer
+	failed bool
+}
+
+// step runs a self-test step and reports its outcome. Later steps are skipped once a step failed
+func (r *selfTestReport) step(name string, fn func() error) {
+	if r.failed {
+		fmt.Fprintf(r.w, "SKIP %s\n", name)
+		return
+	}
+	start := time.Now()
+	if err := fn(); err != nil {
+		r.failed = true
+		fmt.Fprintf(r.w, "FAIL %s: %v\n", name, err)
+		return
+	}
+	fmt.Fprintf(r.w, "OK   %s (%v)\n", name, time.Since(start).Round(time.Millisecond))
+}
+
+// selfTest connects to the RGA, runs one short scan, checks that it encodes into a frame and, if writeInflux is set,
+// writes one point to Influx. It reports every step to w and returns an error if any failed
+func selfTest(config *cfg.Config, w io.Writer, writeInflux bool) error {
+	e := newDatasource(config)
+	r := &selfTestReport{w: w}
+	r.step("connect to the RGA", func() (err error) {
+		e.connection, err = e.dial()
+		return err
+	})
+	if e.connection != nil {
+		defer e.connection.Close()
+	}
+	r.step("take control of the sensor", func() (err error) {
+		e.session, err = e.newSession()
+		return err
+	})
+	if e.session != nil {
+		defer func() {
+			if err := e.session.Close(); err != nil {
+				fmt.Fprintf(w, "WARN could not close session: %v\n", err)
+			}
+		}()
+	}
+	r.step("read sensor identity", e.readIdentity)
+	r.step("add a 1-10 AMU barchart", func() error {
+		e.measurements = []cfg.Measurement{selfTestMeasurement}
+		return addMeasurement(e.session, selfTestMeasurement)
+	})
+	var scan *Scan
+	r.step("run one scan", func() (err error) {
+		config.ScanTimeout = int64(selfTestScanTimeout / time.Second)
+		scan, err = e.runScan(nil, selfTestScanTimeout)
+		if err == nil && len(scan.Readings) == 0 {
+			err = fmt.Errorf("scan returned no readings")
+		}
+		return err
+	})
+	r.step("encode a frame", func() error {
+		b, err := json.Marshal(&Frame{Schema: frameSchema, Rig: config.RigID, Serial: e.serial, Data: scan.Readings})
+		if err != nil {
+			return err
+		}
+		var df Frame
+		if err := json.Unmarshal(b, &df); err != nil {
+			return err
+		}
+		if len(df.Data) != len(scan.Readings) {
+			return fmt.Errorf("frame holds %d readings, expected %d", len(df.Data), len(scan.Readings))
+		}
+		return nil
+	})
+	if writeInflux {
+		r.step("write one point to Influx", func() error {
+			s, err := newInfluxSink(config)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			if err := s.Open(); err != nil {
+				return err
+			}
+			p := influx.NewPoint("selftest", identityTags(scan, map[string]string{}), map[string]interface{}{"readings": len(scan.Readings)}, scan.Time)
+			return s.client.WriteAPIBlocking(config.InfluxOrgName, config.InfluxBucketName).WritePoint(context.Background(), p)
+		})
+	}
+	if r.failed {
+		return fmt.Errorf("self-test failed")
+	}
+	fmt.Fprintln(w, "Self-test passed")
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var (
+	defaultShutdownTimeout     = 30 * time.Second
+	defaultShutdownScanTimeout = 10 * time.Second
+)
+
+// shutdown stops the datasource gracefully: the in-flight scan is given ShutdownScanTimeout to finish before it is
+// aborted, then the recording cleans up (filament, sinks, sensor release). Sinks are closed once the recording is done
+// or ShutdownTimeout passes, whichever comes first
+func (e *MksRgaDatasource) shutdown() {
+	timeout := time.Duration(e.config.ShutdownTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	scanTimeout := time.Duration(e.config.ShutdownScanTimeout) * time.Second
+	if scanTimeout <= 0 {
+		scanTimeout = defaultShutdownScanTimeout
+	}
+	deadline := time.After(timeout)
+	// StopRecord must not send on quitChan once it is closed
+	atomic.StoreInt32(&e.recording, 0)
+	// the recording returns once the in-flight scan completes
+	close(e.stopping)
+	done := make(chan struct{})
+	go func() {
+		e.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(scanTimeout):
+		log.Println("In-flight scan did not finish in time, aborting it")
+	}
+	close(e.quitChan)
+	select {
+	case <-done:
+	case <-deadline:
+		log.Printf("Shutdown did not complete within %v", timeout)
+	}
+	e.releaseHeldSession()
+	e.closeSinks()
+	if e.tunnel != nil {
+		e.tunnel.Close()
+	}
+}
+
+// stoppingNow reports whether shutdown started
+func (e *MksRgaDatasource) stoppingNow() bool {
+	select {
+	case <-e.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// handleSignals stops the datasource gracefully and exits when the host sends SIGTERM or SIGINT
+func (e *MksRgaDatasource) handleSignals() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-sigChan
+		log.Printf("Received %v, shutting down", sig)
+		e.Stop()
+		os.Exit(0)
+	}()
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+var (
+	defaultSinkQueueSize       = 256
+	defaultSinkBatch           = 1
+	defaultSinkBreakerFailures = 5
+	defaultSinkBreakerCooldown = time.Minute
+	sinkRetryDelay             = time.Second
+	sinkScansDropped           = expvar.NewMap("sink_scans_dropped") // per sink, queue full or circuit open
+)
+
+// BatchWriter is implemented by sinks writing several scans at once more efficiently than one at a time
+type BatchWriter interface {
+	WriteBatch(scans []*Scan) error
+}
+
+// sinkQueue feeds the scans and every other call to a sink from its own goroutine, so a slow or failing sink never
+// delays the others or the acquisition. Scans are written in batches of up to Batch, retried Retries times with exponential backoff and,
+// after BreakerFailures batches fail in a row, dropped for BreakerCooldown before the sink is tried again
+type sinkQueue struct {
+	sink      Sink
+	config    cfg.SinkQueue
+	block     bool // wait for room instead of dropping the oldest item, for replays
+	items     chan sinkItem
+	flushes   chan chan error
+	done      chan struct{}
+	mu        sync.Mutex // guards closed against push
+	closed    bool
+	failures  int // batches failed in a row
+	openUntil time.Time
+	rejects   *rejectLog // records the dropped scans, nil if not configured
+}
+
+// sinkItem is a queued scan or, if call is set, another call to the sink such as an annotation, made in order with the
+// scans
+type sinkItem struct {
+	scan *Scan
+	call func() error
+	what string // written by the call, for the log
+}
+
+// newSinkQueues starts a queue per sink, configured by the SinkQueues entry naming it or else the one with no name.
+// Dropped scans are recorded to rejects unless it is nil
+func newSinkQueues(configs []cfg.SinkQueue, sinks []Sink, block bool, rejects *rejectLog) []*sinkQueue {
+	var fallback cfg.SinkQueue
+	for _, c := range configs {
+		if c.Sink == "" {
+			fallback = c
+		}
+	}
+	queues := make([]*sinkQueue, 0, len(sinks))
+	for _, s := range sinks {
+		c := fallback
+		for _, sc := range configs {
+			if sc.Sink == s.Name() {
+				c = sc
+			}
+		}
+		if c.Size <= 0 {
+			c.Size = defaultSinkQueueSize
+		}
+		if c.Batch <= 0 {
+			c.Batch = defaultSinkBatch
+		}
+		if c.BreakerFailures <= 0 {
+			c.BreakerFailures = defaultSinkBreakerFailures
+		}
+		q := &sinkQueue{sink: s, config: c, block: block, rejects: rejects, items: make(chan sinkItem, c.Size), flushes: make(chan chan error), done: make(chan struct{})}
+		go q.run()
+		queues = append(queues, q)
+	}
+	return queues
+}
+
+// push queues the scan. Unless the queue blocks, the oldest queued item is dropped if it is full
+func (q *sinkQueue) push(scan *Scan) {
+	q.enqueue(sinkItem{scan: scan})
+}
+
+// call queues a call to the sink, made once the scans queued before it are written. what describes what the call
+// writes, for the log
+func (q *sinkQueue) call(what string, call func() error) {
+	q.enqueue(sinkItem{call: call, what: what})
+}
+
+// enqueue queues the item. Unless the queue blocks, the oldest queued item is dropped if it is full
+func (q *sinkQueue) enqueue(item sinkItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	if q.block {
+		q.items <- item
+		return
+	}
+	for {
+		select {
+		case q.items <- item:
+			return
+		default:
+		}
+		select {
+		case old := <-q.items:
+			if old.call != nil {
+				log.Printf("%s queue full, dropped the oldest queued %s", q.sink.Name(), old.what)
+				continue
+			}
+			sinkScansDropped.Add(q.sink.Name(), 1)
+			log.Printf("%s queue full, dropped the oldest queued scan", q.sink.Name())
+			q.rejects.scans(rejectSinkQueueFull, q.sink.Name(), nil, old.scan)
+		default:
+		}
+	}
+}
+
+// flush waits for the queued scans to be written and flushes the sink
+func (q *sinkQueue) flush() error {
+	done := make(chan error)
+	select {
+	case q.flushes <- done:
+		return <-done
+	case <-q.done:
+		return nil
+	}
+}
+
+// close writes the queued scans, makes the queued calls and stops the queue. Items queued afterwards are ignored
+func (q *sinkQueue) close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.items)
+	}
+	q.mu.Unlock()
+	<-q.done
+}
+
+// run writes the queued scans in batches and makes the queued calls until the queue closes
+func (q *sinkQueue) run() {
+	defer close(q.done)
+	for {
+		select {
+		case item, ok := <-q.items:
+			if !ok || !q.handle(item) {
+				return
+			}
+		case done := <-q.flushes:
+			open := q.drain()
+			done <- q.sink.Flush()
+			if !open {
+				return
+			}
+		}
+	}
+}
+
+// handle makes the call of the item or writes its scan, batched with the scans queued after it. It returns false if
+// the queue closed
+func (q *sinkQueue) handle(item sinkItem) bool {
+	if item.call != nil {
+		q.exec(item)
+		return true
+	}
+	batch, next, open := q.fill([]*Scan{item.scan})
+	q.write(batch)
+	if next != nil {
+		q.exec(*next)
+	}
+	return open
+}
+
+// fill adds the scans already queued to the batch, up to Batch. It stops at a queued call, returned to be made once
+// the batch is written, and returns false if the queue closed
+func (q *sinkQueue) fill(batch []*Scan) ([]*Scan, *sinkItem, bool) {
+	for len(batch) < q.config.Batch {
+		select {
+		case item, ok := <-q.items:
+			if !ok {
+				return batch, nil, false
+			}
+			if item.call != nil {
+				return batch, &item, true
+			}
+			batch = append(batch, item.scan)
+		default:
+			return batch, nil, true
+		}
+	}
+	return batch, nil, true
+}
+
+// drain writes every queued scan and makes every queued call. It returns false if the queue closed
+func (q *sinkQueue) drain() bool {
+	for {
+		select {
+		case item, ok := <-q.items:
+			if !ok || !q.handle(item) {
+				return false
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// exec makes the call, unless the circuit is open. Calls aren't retried
+func (q *sinkQueue) exec(item sinkItem) {
+	if time.Now().Before(q.openUntil) {
+		return
+	}
+	if err := item.call(); err != nil {
+		log.Printf("Could not write %s to %s: %v", item.what, q.sink.Name(), err)
+	}
+}
+
+// write writes the batch, retrying the scans not written yet, unless the circuit is open
+func (q *sinkQueue) write(batch []*Scan) {
+	if time.Now().Before(q.openUntil) {
+		// not logged, the circuit opening was
+		sinkScansDropped.Add(q.sink.Name(), int64(len(batch)))
+		q.rejects.scans(rejectSinkCircuitOpen, q.sink.Name(), nil, batch...)
+		return
+	}
+	var err error
+	for attempt := 0; attempt <= q.config.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(sinkRetryDelay << (attempt - 1))
+		}
+		var n int
+		n, err = q.writeBatch(batch)
+		if batch = batch[n:]; err == nil {
+			q.failures = 0
+			return
+		}
+	}
+	log.Printf("Could not write scan to %s: %v", q.sink.Name(), err)
+	sinkScansDropped.Add(q.sink.Name(), int64(len(batch)))
+	q.rejects.scans(rejectSinkFailed, q.sink.Name(), err, batch...)
+	if q.failures++; q.failures >= q.config.BreakerFailures {
+		cooldown := time.Duration(q.config.BreakerCooldown) * time.Second
+		if cooldown <= 0 {
+			cooldown = defaultSinkBreakerCooldown
+		}
+		q.openUntil = time.Now().Add(cooldown)
+		log.Printf("%s failed %d times in a row, skipping it for %v", q.sink.Name(), q.failures, cooldown)
+	}
+}
+
+// writeBatch writes the scans at once if the sink supports it, else one at a time. It returns the number written
+func (q *sinkQueue) writeBatch(batch []*Scan) (int, error) {
+	if w, ok := q.sink.(BatchWriter); ok && len(batch) > 1 {
+		if err := w.WriteBatch(batch); err != nil {
+			return 0, err
+		}
+		return len(batch), nil
+	}
+	for i, scan := range batch {
+		if err := q.sink.Write(scan); err != nil {
+			return i, err
+		}
+	}
+	return len(batch), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+// recordSink records the scans written and the calls made, in order
+type recordSink struct {
+	log []string
+}
+
+func (s *recordSink) Name() string { return "record" }
+func (s *recordSink) Open() error  { return nil }
+func (s *recordSink) Flush() error { return nil }
+func (s *recordSink) Close() error { return nil }
+
+func (s *recordSink) Write(scan *Scan) error {
+	s.log = append(s.log, "scan "+scan.Run)
+	return nil
+}
+
+func TestSinkQueueOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		batch int
+	}{
+		{name: "unbatched", batch: 1},
+		{name: "batched", batch: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &recordSink{}
+			q := newSinkQueues([]cfg.SinkQueue{{Batch: tt.batch}}, []Sink{s}, true, nil)[0]
+			call := func(what string) {
+				q.call(what, func() error {
+					s.log = append(s.log, what)
+					return nil
+				})
+			}
+			call("header")
+			q.push(&Scan{Run: "1"})
+			q.push(&Scan{Run: "2"})
+			call("annotation")
+			q.push(&Scan{Run: "3"})
+			call("summary")
+			q.close()
+			want := []string{"header", "scan 1", "scan 2", "annotation", "scan 3", "summary"}
+			if !reflect.DeepEqual(s.log, want) {
+				t.Errorf("sink received %v, want %v", s.log, want)
+			}
+		})
+	}
+}
+
+func TestSinkQueueDropsOldest(t *testing.T) {
+	s := &recordSink{}
+	q := &sinkQueue{sink: s, config: cfg.SinkQueue{Size: 2, Batch: 1}, items: make(chan sinkItem, 2), flushes: make(chan chan error), done: make(chan struct{})}
+	for i := 1; i <= 4; i++ {
+		q.push(&Scan{Run: fmt.Sprint(i)})
+	}
+	go q.run()
+	q.close()
+	want := []string{"scan 3", "scan 4"}
+	if !reflect.DeepEqual(s.log, want) {
+		t.Errorf("sink received %v, want %v", s.log, want)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+// Scan holds every reading of a single scan along with the state of the sensor
+type Scan struct {
+	Time           time.Time
+	Readings       []Payload
+	TotalPressure  float64 // last total pressure reported during the scan [Pa], 0 if none
+	SensorState    string
+	Rig            string          // configured rig identifier, blank if not set
+	Serial         string          // serial number of the sensor
+	SourceProfile  string          // active source profile, blank if none
+	IonizationMode string          // Standard or Soft, blank if never set
+	Run            string          // ID of the open run, blank if none
+	Inlet          string          // name of the active inlet, blank if inlets aren't configured
+	Digital        map[string]bool // state of the configured digital inputs
+	Similarity     *float64        // similarity to the reference spectrum, nil if there is none
+	Clock          *ClockQuality   // quality of the timestamp, nil unless a clock is configured
+	Flags          []string        // quality flags applying to every reading, see quality.go
+}
+
+// Sink is an output receiving every completed scan. Sinks are created when the plugin starts, opened at the beginning
+// of each recording, flushed at the end of each recording and closed when the plugin stops. Every other method is called
+// from the goroutine of the sink queue, in order with the scans
+type Sink interface {
+	Name() string
+	Open() error
+	Write(scan *Scan) error
+	Flush() error
+	Close() error
+}
+
+// newSinks creates every sink enabled in the config
+func newSinks(config *cfg.Config) ([]Sink, error) {
+	var sinks []Sink
+	if config.Influx {
+		s, err := newInfluxSink(config)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if config.Redis {
+		sinks = append(sinks, newRedisSink(config))
+	}
+	if config.OPCUA {
+		s, err := newOpcuaSink(config)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if config.Prometheus {
+		sinks = append(sinks, newPrometheusSink(config))
+	}
+	if config.Modbus {
+		s, err := newModbusSink(config)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if config.Parquet {
+		s, err := newParquetSink(config)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if config.Archive {
+		s, err := newArchiveSink(config)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if config.SQLite {
+		sinks = append(sinks, newSQLiteSink(config))
+	}
+	if len(config.Webhooks) > 0 {
+		s, err := newWebhookSink(config)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if config.StatusPageAddr != "" {
+		s := newStatusPageSink(config)
+		for _, other := range sinks {
+			s.sinks = append(s.sinks, other.Name())
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+// openSinks opens every configured sink
+func (e *MksRgaDatasource) openSinks() error {
+	for _, s := range e.sinks {
+		if err := s.Open(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSinks queues the scan for every sink, with the readings routed to it. A slow or failing sink doesn't prevent
+// the others from receiving the scan
+func (e *MksRgaDatasource) writeSinks(scan *Scan) {
+	for _, q := range e.sinkQueues {
+		if routed := e.routes.routeScan(scan, q.sink.Name()); routed != nil {
+			q.push(routed)
+		}
+	}
+}
+
+// flushSinks waits for the queued scans to be written and flushes every sink, all sinks at once
+func (e *MksRgaDatasource) flushSinks() {
+	var wg sync.WaitGroup
+	for _, q := range e.sinkQueues {
+		wg.Add(1)
+		go func(q *sinkQueue) {
+			defer wg.Done()
+			if err := q.flush(); err != nil {
+				log.Printf("Could not flush %s: %v", q.sink.Name(), err)
+			}
+		}(q)
+	}
+	wg.Wait()
+}
+
+// closeSinks writes the queued scans and closes every sink
+func (e *MksRgaDatasource) closeSinks() {
+	for _, q := range e.sinkQueues {
+		q.close()
+	}
+	for _, s := range e.sinks {
+		if err := s.Close(); err != nil {
+			log.Printf("Could not close %s: %v", s.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	bg "github.com/SSSOCPaulCote/blunderguard"
+	_ "modernc.org/sqlite"
+)
+
+var (
+	ErrSQLiteClosed   = bg.Error("SQLite store is not open")
+	defaultSQLitePath = "mks.db"
+	sqlitePruneEvery  = time.Hour
+	sqliteSchema      = []string{
+		`CREATE TABLE IF NOT EXISTS scans (id INTEGER PRIMARY KEY, time INTEGER NOT NULL, rig TEXT, run TEXT, serial TEXT, inlet TEXT, total_pressure REAL)`,
+		`CREATE INDEX IF NOT EXISTS scans_time ON scans (time)`,
+		`CREATE TABLE IF NOT EXISTS readings (scan_id INTEGER NOT NULL, measurement TEXT, mass REAL, points_per_peak INTEGER, value REAL)`,
+		`CREATE INDEX IF NOT EXISTS readings_scan ON readings (scan_id)`,
+		`CREATE TABLE IF NOT EXISTS events (time INTEGER NOT NULL, title TEXT, text TEXT, tags TEXT)`,
+		`CREATE INDEX IF NOT EXISTS events_time ON events (time)`,
+		`CREATE TABLE IF NOT EXISTS runs (id TEXT PRIMARY KEY, description TEXT, start INTEGER, end INTEGER, header TEXT, summary TEXT)`,
+	}
+)
+
+// SQLiteStore keeps scans, events and run metadata in a local SQLite database, so small deployments get durable
+// history without external infrastructure. It is used as a sink and its query helpers can be used by other tools on
+// the same file. Times are stored as Unix milliseconds. Writes and queries fail with ErrSQLiteClosed while it is closed
+type SQLiteStore struct {
+	path      string
+	retention time.Duration // 0 keeps everything
+	mu        sync.Mutex
+	db        *sql.DB
+	lastPrune time.Time
+}
+
+var (
+	_ Sink             = (*SQLiteStore)(nil)
+	_ BatchWriter      = (*SQLiteStore)(nil)
+	_ Annotator        = (*SQLiteStore)(nil)
+	_ RunHeaderWriter  = (*SQLiteStore)(nil)
+	_ RunSummaryWriter = (*SQLiteStore)(nil)
+)
+
+// newSQLiteSink returns the store configured for the sink, opened when the recording starts
+func newSQLiteSink(config *cfg.Config) *SQLiteStore {
+	s := &SQLiteStore{path: config.SQLitePath, retention: time.Duration(config.SQLiteRetentionDays) * 24 * time.Hour}
+	if s.path == "" {
+		s.path = defaultSQLitePath
+	}
+	return s
+}
+
+// OpenSQLiteStore opens the database at path, creating it if needed, to query it
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	s := &SQLiteStore{path: path}
+	if err := s.Open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Name implements the Sink interface
+func (s *SQLiteStore) Name() string {
+	return "sqlite"
+}
+
+// Open opens the database, creates the tables and applies the retention
+func (s *SQLiteStore) Open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db != nil {
+		return nil
+	}
+	db, err := sql.Open("sqlite", s.path)
+	if err != nil {
+		return err
+	}
+	// a single connection avoids SQLITE_BUSY between the writers of the plugin, WAL lets other processes read
+	db.SetMaxOpenConns(1)
+	for _, stmt := range append([]string{`PRAGMA journal_mode=WAL`}, sqliteSchema...) {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return err
+		}
+	}
+	s.db = db
+	return s.prune(time.Now())
+}
+
+// prune deletes the scans and events older than the retention
+func (s *SQLiteStore) prune(now time.Time) error {
+	s.lastPrune = now
+	if s.retention <= 0 {
+		return nil
+	}
+	cutoff := now.Add(-s.retention).UnixMilli()
+	for _, stmt := range []string{
+		`DELETE FROM readings WHERE scan_id IN (SELECT id FROM scans WHERE time < ?)`,
+		`DELETE FROM scans WHERE time < ?`,
+		`DELETE FROM events WHERE time < ?`,
+		`DELETE FROM runs WHERE end IS NOT NULL AND end < ?`,
+	} {
+		if _, err := s.db.Exec(stmt, cutoff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write stores the scan and its readings in a single transaction
+func (s *SQLiteStore) Write(scan *Scan) error {
+	return s.WriteBatch([]*Scan{scan})
+}
+
+// WriteBatch stores the scans and their readings in a single transaction
+func (s *SQLiteStore) WriteBatch(scans []*Scan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		return ErrSQLiteClosed
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`INSERT INTO readings (scan_id, measurement, mass, points_per_peak, value) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, scan := range scans {
+		res, err := tx.Exec(`INSERT INTO scans (time, rig, run, serial, inlet, total_pressure) VALUES (?, ?, ?, ?, ?, ?)`,
+			scan.Time.UnixMilli(), scan.Rig, scan.Run, scan.Serial, scan.Inlet, scan.TotalPressure)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, r := range scan.Readings {
+			if _, err := stmt.Exec(id, r.Measurement, r.Mass, r.PointsPerPeak, r.Value); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if time.Since(s.lastPrune) > sqlitePruneEvery {
+		return s.prune(time.Now())
+	}
+	return nil
+}
+
+// Annotate implements the Annotator interface
+func (s *SQLiteStore) Annotate(a *Annotation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		// annotations may come before the first recording opens the store
+		return nil
+	}
+	_, err := s.db.Exec(`INSERT INTO events (time, title, text, tags) VALUES (?, ?, ?, ?)`, a.Time.UnixMilli(), a.Title, a.Text, strings.Join(a.Tags, ","))
+	return err
+}
+
+// WriteRunHeader implements the RunHeaderWriter interface
+func (s *SQLiteStore) WriteRunHeader(h *RunHeader) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		return ErrSQLiteClosed
+	}
+	_, err = s.db.Exec(`INSERT INTO runs (id, start, header) VALUES (?, ?, ?) ON CONFLICT (id) DO UPDATE SET header = excluded.header`, h.Run, h.Time.UnixMilli(), string(b))
+	return err
+}
+
+// WriteRunSummary implements the RunSummaryWriter interface
+func (s *SQLiteStore) WriteRunSummary(sum *RunSummary) error {
+	b, err := json.Marshal(sum)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		return ErrSQLiteClosed
+	}
+	_, err = s.db.Exec(`INSERT INTO runs (id, description, start, end, summary) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET description = excluded.description, start = excluded.start, end = excluded.end, summary = excluded.summary`,
+		sum.ID, sum.Description, sum.Start.UnixMilli(), sum.End.UnixMilli(), string(b))
+	return err
+}
+
+// Flush implements the Sink interface, every write is committed right away
+func (s *SQLiteStore) Flush() error {
+	return nil
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	s.db = nil
+	return err
+}
+
+// Scans returns the scans taken in [from, to) with their readings, oldest first
+func (s *SQLiteStore) Scans(from, to time.Time) ([]*Scan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		return nil, ErrSQLiteClosed
+	}
+	rows, err := s.db.Query(`SELECT s.id, s.time, s.rig, s.run, s.serial, s.inlet, s.total_pressure, r.measurement, r.mass, r.points_per_peak, r.value
+		FROM scans s LEFT JOIN readings r ON r.scan_id = s.id WHERE s.time >= ? AND s.time < ? ORDER BY s.time, s.id, r.rowid`,
+		from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var (
+		scans  []*Scan
+		lastID int64 = -1
+	)
+	for rows.Next() {
+		var (
+			id, ms      int64
+			scan        Scan
+			measurement sql.NullString
+			mass, value sql.NullFloat64
+			ppp         sql.NullInt64
+		)
+		if err := rows.Scan(&id, &ms, &scan.Rig, &scan.Run, &scan.Serial, &scan.Inlet, &scan.TotalPressure, &measurement, &mass, &ppp, &value); err != nil {
+			return nil, err
+		}
+		if id != lastID {
+			scan.Time = time.UnixMilli(ms)
+			scan.Readings = []Payload{}
+			scans = append(scans, &scan)
+			lastID = id
+		}
+		if measurement.Valid {
+			last := scans[len(scans)-1]
+			last.Readings = append(last.Readings, Payload{Name: "mass " + formatMass(mass.Float64), Measurement: measurement.String, Mass: mass.Float64, PointsPerPeak: int(ppp.Int64), Value: value.Float64})
+		}
+	}
+	return scans, rows.Err()
+}
+
+// Events returns the annotations recorded in [from, to), oldest first
+func (s *SQLiteStore) Events(from, to time.Time) ([]*Annotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		return nil, ErrSQLiteClosed
+	}
+	rows, err := s.db.Query(`SELECT time, title, text, tags FROM events WHERE time >= ? AND time < ? ORDER BY time`, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []*Annotation
+	for rows.Next() {
+		var (
+			ms   int64
+			a    Annotation
+			tags string
+		)
+		if err := rows.Scan(&ms, &a.Title, &a.Text, &tags); err != nil {
+			return nil, err
+		}
+		a.Time = time.UnixMilli(ms)
+		if tags != "" {
+			a.Tags = strings.Split(tags, ",")
+		}
+		events = append(events, &a)
+	}
+	return events, rows.Err()
+}
+
+// Runs returns the runs started in [from, to), oldest first. Runs still open only have their ID and start set
+func (s *SQLiteStore) Runs(from, to time.Time) ([]*RunSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		return nil, ErrSQLiteClosed
+	}
+	rows, err := s.db.Query(`SELECT id, start, summary FROM runs WHERE start >= ? AND start < ? ORDER BY start`, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var runs []*RunSummary
+	for rows.Next() {
+		var (
+			id      string
+			ms      int64
+			summary sql.NullString
+		)
+		if err := rows.Scan(&id, &ms, &summary); err != nil {
+			return nil, err
+		}
+		run := &RunSummary{Run: Run{ID: id, Start: time.UnixMilli(ms)}}
+		if summary.Valid {
+			if err := json.Unmarshal([]byte(summary.String), run); err != nil {
+				return nil, err
+			}
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStoreClosed(t *testing.T) {
+	s := &SQLiteStore{}
+	now := time.Now()
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{name: "WriteBatch", call: func() error { return s.WriteBatch([]*Scan{{Time: now}}) }},
+		{name: "WriteRunHeader", call: func() error { return s.WriteRunHeader(&RunHeader{Time: now}) }},
+		{name: "WriteRunSummary", call: func() error { return s.WriteRunSummary(&RunSummary{}) }},
+		{name: "Scans", call: func() error { _, err := s.Scans(now, now); return err }},
+		{name: "Events", call: func() error { _, err := s.Events(now, now); return err }},
+		{name: "Runs", call: func() error { _, err := s.Runs(now, now); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, ErrSQLiteClosed) {
+				t.Errorf("%s on a closed store = %v, want ErrSQLiteClosed", tt.name, err)
+			}
+		})
+	}
+	if err := s.Annotate(&Annotation{Time: now}); err != nil {
+		t.Errorf("Annotate on a closed store = %v, want nil", err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/SSSOC-CAN/laniakea-plugin-sdk/proto"
+)
+
+var (
+	defaultStaleDataFactor = 3.0
+	defaultFrameBacklog    = 256
+	statusKindStale        = "stale"
+	statusKindCalibration  = "calibration"
+)
+
+// Status is a datasource status change that isn't tied to a scan
+type Status struct {
+	Time               time.Time `json:"time"`
+	Kind               string    `json:"kind"` // stale, calibration, resolution, fingerprint or heartbeat
+	Stale              bool      `json:"stale"`
+	CalibrationOverdue bool      `json:"calibrationOverdue,omitempty"`
+	ResolutionDrift    bool      `json:"resolutionDrift,omitempty"`
+	CompositionChanged bool      `json:"compositionChanged,omitempty"`
+	Similarity         float64   `json:"similarity,omitempty"` // similarity to the reference spectrum of a fingerprint status
+	Reason             string    `json:"reason"`
+	Rig                string    `json:"rig,omitempty"`
+	Serial             string    `json:"serial,omitempty"`
+	Inlet              string    `json:"inlet,omitempty"`
+	Recording          bool      `json:"recording,omitempty"`     // of a heartbeat status
+	SensorState        string    `json:"sensorState,omitempty"`   // of a heartbeat status
+	TotalPressure      float64   `json:"totalPressure,omitempty"` // [Pa] of a heartbeat status, last known
+	Filament           string    `json:"filament,omitempty"`      // summary state, of a heartbeat status
+}
+
+// StatusWriter is implemented by sinks able to record status changes
+type StatusWriter interface {
+	WriteStatus(st *Status) error
+}
+
+// statusFrame wraps a Status in a frame for Laniakea
+type statusFrame struct {
+	Schema string  `json:"schema"`
+	Status *Status `json:"status"`
+}
+
+// staleTimeout returns how long to wait for a mass reading before the data is considered stale
+func (e *MksRgaDatasource) staleTimeout(expected time.Duration) time.Duration {
+	factor := e.config.StaleDataFactor
+	if factor <= 0 {
+		factor = defaultStaleDataFactor
+	}
+	return time.Duration(factor * float64(expected))
+}
+
+// reportStale emits a stale data status frame, queues the status for every sink supporting it and annotates it
+func (e *MksRgaDatasource) reportStale(frameChan chan *proto.Frame, reason string) {
+	log.Printf("Stale data: %s", reason)
+	e.annotate("Stale data", reason, "stale")
+	e.reportStatus(frameChan, &Status{Time: e.now(), Kind: statusKindStale, Stale: true, Reason: reason, Rig: e.config.RigID, Serial: e.serial, Inlet: e.inlet})
+}
+
+// reportStatus queues the status for every sink supporting it and emits it as a status frame
+func (e *MksRgaDatasource) reportStatus(frameChan chan *proto.Frame, st *Status) {
+	for _, q := range e.sinkQueues {
+		if w, ok := q.sink.(StatusWriter); ok {
+			q.call("status", func() error { return w.WriteStatus(st) })
+		}
+	}
+	b, err := json.Marshal(&statusFrame{Schema: frameSchema, Status: st})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	e.sendFrame(frameChan, &proto.Frame{
+		Source:    pluginName,
+		Type:      "application/json",
+		Timestamp: st.Time.UnixMilli(),
+		Payload:   b,
+	})
+}
+
+// sendFrame sends the frame to Laniakea through the backlog. Frames are dropped when the backlog is full until Laniakea
+// takes over a resumed recording, or if there is no frame channel, as in the self-test
+func (e *MksRgaDatasource) sendFrame(frameChan chan *proto.Frame, frame *proto.Frame) {
+	if frameChan == nil {
+		return
+	}
+	if atomic.LoadInt32(&e.detached) == 1 {
+		select {
+		case frameChan <- frame:
+			framesEmitted.Add(1)
+		default:
+			framesDropped.Add(1)
+			e.rejects.frame(rejectFrameBacklogFull, frame)
+		}
+	} else {
+		frameChan <- frame
+		framesEmitted.Add(1)
+	}
+}
+
+// forwardFrames delivers the frames of the backlog to Laniakea until the backlog closes. Frames sent before Laniakea
+// starts draining the channel wait in the backlog instead of being lost or stalling the recording
+func forwardFrames(backlog <-chan *proto.Frame, out chan<- *proto.Frame) {
+	defer close(out)
+	for frame := range backlog {
+		out <- frame
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+// recordingState is persisted to the state file so that a recording can survive plugin restarts
+type recordingState struct {
+	Recording     bool              `json:"recording"`
+	Measurements  []cfg.Measurement `json:"measurements"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	LastDegas     time.Time         `json:"last_degas"`
+	FilamentHours float64           `json:"filament_hours"` // recording hours since the last degas
+	Run           *Run              `json:"run,omitempty"`
+}
+
+// saveState writes the current recording state to the state file
+func (e *MksRgaDatasource) saveState() {
+	state := recordingState{
+		Recording:     atomic.LoadInt32(&e.recording) == 1,
+		Measurements:  e.measurements,
+		UpdatedAt:     time.Now(),
+		LastDegas:     e.lastDegas,
+		FilamentHours: e.filamentHours,
+		Run:           e.run,
+	}
+	b, err := json.Marshal(&state)
+	if err != nil {
+		log.Printf("Could not encode recording state: %v", err)
+		return
+	}
+	// write to a temporary file first so a crash never leaves a truncated state file behind
+	tmpFile := e.config.StateFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, b, 0644); err != nil {
+		log.Printf("Could not write recording state: %v", err)
+		return
+	}
+	if err := os.Rename(tmpFile, e.config.StateFile); err != nil {
+		log.Printf("Could not write recording state: %v", err)
+	}
+}
+
+// loadState reads the recording state from the state file. A missing file is an empty state
+func loadState(stateFile string) (*recordingState, error) {
+	b, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return &recordingState{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var state recordingState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// resumeRecording restarts the recording described in the state file if the plugin was recording when it stopped.
+// Frames are dropped until Laniakea calls StartRecord but sinks keep receiving data
+func (e *MksRgaDatasource) resumeRecording() error {
+	state, err := loadState(e.config.StateFile)
+	if err != nil {
+		return err
+	}
+	if !state.Recording {
+		return nil
+	}
+	if len(state.Measurements) > 0 {
+		e.config.Measurements = state.Measurements
+	}
+	log.Printf("Resuming recording interrupted at %v", state.UpdatedAt)
+	e.run = state.Run
+	_, err = e.startRecording(true)
+	return err
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+var (
+	//go:embed web/status.html
+	statusPageHTML   []byte
+	statusPageEvents = 20 // most recent events shown
+	// connection states of the status page
+	linkUnknown      = "unknown"
+	linkConnected    = "connected"
+	linkDisconnected = "disconnected"
+	linkDown         = "down"
+)
+
+// statusPageSink serves a status page for technicians without Grafana access: the connection state, the alarms, the
+// recent events and a summary of the configuration on /status.json, the last scan on /scan.json and an HTML page
+// plotting them on /. It only keeps what the datasource reports to every sink, so it never touches the sensor
+type statusPageSink struct {
+	config *cfg.Config
+	srv    *http.Server
+	sinks  []string // names of the other sinks, for the configuration summary
+	sync.RWMutex
+	recording bool
+	link      string
+	lastScan  *Scan
+	status    *Status         // last status reported, e.g. a heartbeat
+	alarms    map[string]bool // alarm classes raised
+	events    []*Annotation   // most recent first
+}
+
+var _ Sink = (*statusPageSink)(nil)
+var _ StatusWriter = (*statusPageSink)(nil)
+var _ AlarmWriter = (*statusPageSink)(nil)
+var _ Annotator = (*statusPageSink)(nil)
+
+// statusPage is the document served on /status.json
+type statusPage struct {
+	Time      time.Time        `json:"time"`
+	Recording bool             `json:"recording"`
+	Link      string           `json:"link"` // unknown, connected, disconnected or down
+	LastScan  *time.Time       `json:"lastScan,omitempty"`
+	Status    *Status          `json:"status,omitempty"`
+	Alarms    []string         `json:"alarms"`
+	Events    []*Annotation    `json:"events"`
+	Config    statusPageConfig `json:"config"`
+	Stats     map[string]int64 `json:"stats"` // counters of the debug vars, e.g. frames dropped
+}
+
+// statusPageConfig is the summary of the configuration shown on the status page. Credentials are left out
+type statusPageConfig struct {
+	Rig             string            `json:"rig,omitempty"`
+	RGAAddr         string            `json:"rgaAddr"`
+	RGASerial       string            `json:"rgaSerial,omitempty"`
+	PollingInterval int64             `json:"pollingInterval"`
+	ScansPerTick    int               `json:"scansPerTick,omitempty"`
+	Measurements    []cfg.Measurement `json:"measurements"`
+	Sinks           []string          `json:"sinks"`
+}
+
+// scanPlot is the document served on /scan.json, one series of mass and value pairs per measurement
+type scanPlot struct {
+	Time          time.Time        `json:"time"`
+	Run           string           `json:"run,omitempty"`
+	TotalPressure float64          `json:"totalPressure"`
+	Flags         []string         `json:"flags,omitempty"`
+	Series        []scanPlotSeries `json:"series"`
+}
+
+// scanPlotSeries are the readings of a measurement
+type scanPlotSeries struct {
+	Measurement string       `json:"measurement"`
+	Points      [][2]float64 `json:"points"` // mass, value [Pa]
+}
+
+// newStatusPageSink creates the sink and starts serving the status page
+func newStatusPageSink(config *cfg.Config) *statusPageSink {
+	s := &statusPageSink{config: config, link: linkUnknown, alarms: make(map[string]bool)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.servePage)
+	mux.HandleFunc("/status.json", s.serveStatus)
+	mux.HandleFunc("/scan.json", s.serveScan)
+	s.srv = &http.Server{Addr: config.StatusPageAddr, Handler: mux}
+	go func() {
+		log.Printf("Status page listening on %s", config.StatusPageAddr)
+		if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Status page stopped: %v", err)
+		}
+	}()
+	return s
+}
+
+// Name implements the Sink interface
+func (s *statusPageSink) Name() string {
+	return "statuspage"
+}
+
+// Open implements the Sink interface
+func (s *statusPageSink) Open() error {
+	return nil
+}
+
+// Write keeps the scan for /scan.json
+func (s *statusPageSink) Write(scan *Scan) error {
+	s.Lock()
+	s.lastScan, s.link = scan, linkConnected
+	s.Unlock()
+	return nil
+}
+
+// WriteStatus keeps the status. A heartbeat also tells whether the sensor is connected between recordings
+func (s *statusPageSink) WriteStatus(st *Status) error {
+	s.Lock()
+	defer s.Unlock()
+	s.status = st
+	if st.Kind == statusKindHeartbeat {
+		s.recording = st.Recording
+		if st.Reason == heartbeatNotConnected {
+			s.link = linkDisconnected
+		} else if s.link != linkDown {
+			s.link = linkConnected
+		}
+	}
+	return nil
+}
+
+// WriteAlarm keeps the alarm state
+func (s *statusPageSink) WriteAlarm(a *AlarmEvent) error {
+	s.Lock()
+	s.alarms[a.Class] = a.Active
+	s.Unlock()
+	return nil
+}
+
+// Annotate keeps the event and follows the recording and link state changes
+func (s *statusPageSink) Annotate(a *Annotation) error {
+	s.Lock()
+	defer s.Unlock()
+	switch a.Title {
+	case "Recording started":
+		s.recording = true
+	case "Recording stopped", "Recording failed":
+		s.recording = false
+	case "Link down":
+		s.link = linkDown
+	case "Link re-established":
+		s.link = linkConnected
+	}
+	s.events = append([]*Annotation{a}, s.events...)
+	if len(s.events) > statusPageEvents {
+		s.events = s.events[:statusPageEvents]
+	}
+	return nil
+}
+
+// Flush implements the Sink interface
+func (s *statusPageSink) Flush() error {
+	return nil
+}
+
+// Close stops serving the status page
+func (s *statusPageSink) Close() error {
+	return s.srv.Close()
+}
+
+// servePage serves the embedded HTML page
+func (s *statusPageSink) servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(statusPageHTML)
+}
+
+// serveStatus serves the connection state, alarms, events and configuration summary
+func (s *statusPageSink) serveStatus(w http.ResponseWriter, r *http.Request) {
+	s.RLock()
+	page := &statusPage{
+		Time:      time.Now(),
+		Recording: s.recording,
+		Link:      s.link,
+		Status:    s.status,
+		Alarms:    []string{},
+		Events:    append([]*Annotation{}, s.events...),
+		Config: statusPageConfig{
+			Rig:             s.config.RigID,
+			RGAAddr:         s.config.RGAAddr,
+			RGASerial:       s.config.RGASerial,
+			PollingInterval: s.config.PollingInterval,
+			ScansPerTick:    s.config.ScansPerTick,
+			Measurements:    s.config.Measurements,
+			Sinks:           s.sinks,
+		},
+		Stats: map[string]int64{
+			"scans_completed":     scansCompleted.Value(),
+			"scans_dropped":       scansDropped.Value(),
+			"frames_dropped":      framesDropped.Value(),
+			"links_reestablished": linksReestablished.Value(),
+		},
+	}
+	if s.lastScan != nil {
+		page.LastScan = &s.lastScan.Time
+	}
+	for class, active := range s.alarms {
+		if active {
+			page.Alarms = append(page.Alarms, class)
+		}
+	}
+	s.RUnlock()
+	sort.Strings(page.Alarms)
+	writeJSON(w, page)
+}
+
+// serveScan serves the last scan as one series per measurement, 404 before the first scan
+func (s *statusPageSink) serveScan(w http.ResponseWriter, r *http.Request) {
+	s.RLock()
+	scan := s.lastScan
+	s.RUnlock()
+	if scan == nil {
+		http.Error(w, "no scan yet", http.StatusNotFound)
+		return
+	}
+	plot := &scanPlot{Time: scan.Time, Run: scan.Run, TotalPressure: scan.TotalPressure, Flags: scan.Flags, Series: []scanPlotSeries{}}
+	index := make(map[string]int)
+	for _, r := range scan.Readings {
+		i, ok := index[r.Measurement]
+		if !ok {
+			i = len(plot.Series)
+			index[r.Measurement] = i
+			plot.Series = append(plot.Series, scanPlotSeries{Measurement: r.Measurement})
+		}
+		plot.Series[i].Points = append(plot.Series[i].Points, [2]float64{r.Mass, r.Value})
+	}
+	writeJSON(w, plot)
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Could not write status page response: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+// streamDrainWait is how long the control connection must stay quiet for the readings sent to it to be drained
+var streamDrainWait = 50 * time.Millisecond
+
+// openStream opens the second connection the asynchronous readings are read from when DualConnection is set. It
+// selects the sensor but never takes control, so commands and their replies stay on the control connection
+func (e *MksRgaDatasource) openStream() error {
+	if !e.config.DualConnection {
+		return nil
+	}
+	e.closeStream()
+	conn, err := e.connect()
+	if err != nil {
+		return fmt.Errorf("Could not open event stream connection: %v", err)
+	}
+	if err := conn.InitMsg(); err != nil {
+		conn.Close()
+		return fmt.Errorf("Could not initialize event stream connection: %v", err)
+	}
+	if e.serial != "" {
+		if _, err := conn.Select(e.serial); err != nil {
+			conn.Close()
+			return fmt.Errorf("Could not select sensor %s on event stream connection: %v", e.serial, err)
+		}
+	}
+	e.stream = conn
+	return nil
+}
+
+// closeStream closes the event stream connection, if open
+func (e *MksRgaDatasource) closeStream() {
+	if e.stream == nil {
+		return
+	}
+	if err := e.stream.Close(); err != nil {
+		log.Printf("Could not close event stream connection: %v", err)
+	}
+	e.stream = nil
+}
+
+// reader returns the connection asynchronous readings are read from
+func (e *MksRgaDatasource) reader() *mks.RGAConnection {
+	if e.stream != nil {
+		return e.stream
+	}
+	return e.connection
+}
+
+// drainControl discards the readings of the last scan the sensor also sent to the control connection when
+// DualConnection is set, since they are read from the event stream connection
+func (e *MksRgaDatasource) drainControl() {
+	if e.stream == nil {
+		return
+	}
+	if _, err := e.connection.Drain(streamDrainWait); err != nil {
+		log.Printf("Could not drain the control connection: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"time"
+)
+
+var defaultSummaryInterval = 5 * time.Minute
+
+// readingStats aggregates the readings of one mass over a summary window
+type readingStats struct {
+	Measurement string
+	Mass        float64
+	Min         float64
+	Max         float64
+	Sum         float64
+	Count       int64
+}
+
+// Mean returns the average of the aggregated readings
+func (r *readingStats) Mean() float64 {
+	return r.Sum / float64(r.Count)
+}
+
+// scanSummary aggregates scans into fixed windows
+type scanSummary struct {
+	interval time.Duration
+	start    time.Time
+	last     *Scan
+	order    []string
+	stats    map[string]*readingStats
+}
+
+// newScanSummary returns an aggregator for windows of the given length [s], 5 minutes if 0
+func newScanSummary(interval int64) *scanSummary {
+	s := &scanSummary{interval: time.Duration(interval) * time.Second}
+	if s.interval <= 0 {
+		s.interval = defaultSummaryInterval
+	}
+	return s
+}
+
+// add aggregates the scan and reports whether the current window is complete
+func (s *scanSummary) add(scan *Scan) bool {
+	if s.stats == nil {
+		s.stats = make(map[string]*readingStats)
+		s.start = scan.Time
+	}
+	for _, r := range scan.Readings {
+		k := readingKey(r)
+		st, ok := s.stats[k]
+		if !ok {
+			st = &readingStats{Measurement: r.Measurement, Mass: r.Mass, Min: r.Value, Max: r.Value}
+			s.stats[k] = st
+			s.order = append(s.order, k)
+		}
+		if r.Value < st.Min {
+			st.Min = r.Value
+		}
+		if r.Value > st.Max {
+			st.Max = r.Value
+		}
+		st.Sum += r.Value
+		st.Count++
+	}
+	s.last = scan
+	return scan.Time.Sub(s.start) >= s.interval
+}
+
+// drain returns the start of the window, the last scan added and the aggregated readings, then starts a new window
+func (s *scanSummary) drain() (time.Time, *Scan, []*readingStats) {
+	stats := make([]*readingStats, 0, len(s.order))
+	for _, k := range s.order {
+		stats = append(stats, s.stats[k])
+	}
+	start, last := s.start, s.last
+	s.stats, s.order, s.last = nil, nil, nil
+	return start, last, stats
+}
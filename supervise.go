@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+var panicRestartDelay = 5 * time.Second
+
+// recoverPanic recovers a panicking goroutine, logs the stack and marks the datasource unhealthy before calling onPanic.
+// It must be deferred first so that it runs after the other deferred cleanups
+func (e *MksRgaDatasource) recoverPanic(name string, onPanic func()) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.Printf("Recovered from panic in %s goroutine: %v\n%s", name, r, debug.Stack())
+	atomic.StoreInt32(&e.unhealthy, 1)
+	e.annotate("Panic recovered", fmt.Sprintf("%s: %v", name, r), "panic")
+	if onPanic != nil {
+		onPanic()
+	}
+}
+
+// Healthy reports whether every goroutine of the datasource has run without panicking
+func (e *MksRgaDatasource) Healthy() bool {
+	return atomic.LoadInt32(&e.unhealthy) == 0
+}
+
+// recordingPanicked resets the recording flag and, if configured, resumes the recording after a short delay
+func (e *MksRgaDatasource) recordingPanicked() {
+	atomic.StoreInt32(&e.recording, 0)
+	if !e.config.RestartOnPanic {
+		return
+	}
+	go func() {
+		time.Sleep(panicRestartDelay)
+		log.Println("Restarting recording after panic")
+		if err := e.resumeRecording(); err != nil {
+			log.Printf("Could not restart recording: %v", err)
+			return
+		}
+		atomic.StoreInt32(&e.unhealthy, 0)
+	}()
+}
+
+// recordingEnded resets the recording flag if the recording returned on its own, after an error, so that it can be
+// started again, then closes done to release a StopRecord that raced with the error
+func (e *MksRgaDatasource) recordingEnded(done chan struct{}) {
+	if atomic.CompareAndSwapInt32(&e.recording, 1, 0) {
+		e.saveState()
+	}
+	close(done)
+}
+
+// recordingFailed logs and annotates the error stopping the recording
+func (e *MksRgaDatasource) recordingFailed(err error) {
+	log.Printf("Recording stopped: %v", err)
+	e.annotate("Recording failed", err.Error(), "recording")
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+// channelTotalPressure selects the total pressure in a transform
+const channelTotalPressure = "total"
+
+// Transformer transforms the successive values of a channel. A transformer is created per reading position, so it may
+// keep state between scans, like a smoothing window
+type Transformer interface {
+	Transform(v float64) float64
+}
+
+// TransformerFactory creates a transformer from its configuration
+type TransformerFactory func(step cfg.TransformStep) (Transformer, error)
+
+// transformers maps the transform types usable in Transforms to their factory
+var transformers = map[string]TransformerFactory{
+	"unit":   newUnitTransformer,
+	"factor": newFactorTransformer,
+	"smooth": newSmoothTransformer,
+	"log10":  newLog10Transformer,
+	"clamp":  newClampTransformer,
+}
+
+// RegisterTransformer makes a transform type available to Transforms. It must be called before the plugin starts
+func RegisterTransformer(name string, f TransformerFactory) {
+	transformers[name] = f
+}
+
+// TransformFunc adapts a stateless function to the Transformer interface
+type TransformFunc func(v float64) float64
+
+// Transform implements the Transformer interface
+func (f TransformFunc) Transform(v float64) float64 {
+	return f(v)
+}
+
+// pascalsPer is the number of pascals in each unit readings can be converted to
+var pascalsPer = map[string]float64{
+	"Pa":   1,
+	"mbar": 100,
+	"Torr": 101325.0 / 760,
+	"psi":  6894.757,
+}
+
+// newUnitTransformer converts pressures in pascals to Unit
+func newUnitTransformer(step cfg.TransformStep) (Transformer, error) {
+	pa, ok := pascalsPer[step.Unit]
+	if !ok {
+		return nil, fmt.Errorf("Unknown unit %s, expected Pa, mbar, Torr or psi", step.Unit)
+	}
+	return TransformFunc(func(v float64) float64 { return v / pa }), nil
+}
+
+// newFactorTransformer multiplies values by Factor
+func newFactorTransformer(step cfg.TransformStep) (Transformer, error) {
+	if step.Factor == 0 {
+		return nil, fmt.Errorf("Factor transform needs a non-zero factor")
+	}
+	return TransformFunc(func(v float64) float64 { return v * step.Factor }), nil
+}
+
+// smoothTransformer is the moving average of the last Window values
+type smoothTransformer struct {
+	window []float64
+	next   int
+	filled int
+	sum    float64
+}
+
+// newSmoothTransformer averages the last Window values
+func newSmoothTransformer(step cfg.TransformStep) (Transformer, error) {
+	if step.Window < 1 {
+		return nil, fmt.Errorf("Smooth transform needs a window of at least 1, got %d", step.Window)
+	}
+	return &smoothTransformer{window: make([]float64, step.Window)}, nil
+}
+
+// Transform implements the Transformer interface
+func (s *smoothTransformer) Transform(v float64) float64 {
+	s.sum += v - s.window[s.next]
+	s.window[s.next] = v
+	s.next = (s.next + 1) % len(s.window)
+	if s.filled < len(s.window) {
+		s.filled++
+	}
+	return s.sum / float64(s.filled)
+}
+
+// newLog10Transformer takes the decimal logarithm. Values below Min, 1e-16 if not set, are raised to it first so that
+// zero and negative readings stay finite
+func newLog10Transformer(step cfg.TransformStep) (Transformer, error) {
+	floor := 1e-16
+	if step.Min != nil {
+		if *step.Min <= 0 {
+			return nil, fmt.Errorf("Log10 transform needs a positive minimum, got %v", *step.Min)
+		}
+		floor = *step.Min
+	}
+	return TransformFunc(func(v float64) float64 { return math.Log10(math.Max(v, floor)) }), nil
+}
+
+// newClampTransformer limits values to [Min, Max], either bound being optional
+func newClampTransformer(step cfg.TransformStep) (Transformer, error) {
+	if step.Min == nil && step.Max == nil {
+		return nil, fmt.Errorf("Clamp transform needs a minimum or a maximum")
+	}
+	if step.Min != nil && step.Max != nil && *step.Min > *step.Max {
+		return nil, fmt.Errorf("Clamp transform minimum %v is above its maximum %v", *step.Min, *step.Max)
+	}
+	return TransformFunc(func(v float64) float64 {
+		if step.Min != nil && v < *step.Min {
+			return *step.Min
+		}
+		if step.Max != nil && v > *step.Max {
+			return *step.Max
+		}
+		return v
+	}), nil
+}
+
+// transformChain applies the configured transforms to the readings of the scans. Transformers are created per
+// position on first use so that stateful transforms don't mix channels
+type transformChain struct {
+	transforms []cfg.Transform
+	chains     map[string][]Transformer // per transform index and reading position
+}
+
+// newTransformChain validates the transforms by building each step once
+func newTransformChain(transforms []cfg.Transform) (*transformChain, error) {
+	for _, t := range transforms {
+		if t.Channel == "" {
+			return nil, fmt.Errorf("Transform channel cannot be blank")
+		}
+		if _, err := buildTransformers(t.Steps); err != nil {
+			return nil, fmt.Errorf("Invalid transform for channel %s: %v", t.Channel, err)
+		}
+	}
+	return &transformChain{transforms: transforms, chains: make(map[string][]Transformer)}, nil
+}
+
+// buildTransformers creates a transformer for every step
+func buildTransformers(steps []cfg.TransformStep) ([]Transformer, error) {
+	chain := make([]Transformer, 0, len(steps))
+	for _, step := range steps {
+		factory, ok := transformers[step.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown transform type %s", step.Type)
+		}
+		t, err := factory(step)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, t)
+	}
+	return chain, nil
+}
+
+// channelMatches reports whether the channel selects the reading: * selects every reading, a number the readings of
+// that mass and anything else the readings of the measurement with that name
+func channelMatches(channel string, r Payload) bool {
+	if channel == "*" {
+		return true
+	}
+	if mass, err := strconv.Atoi(channel); err == nil {
+		return int(math.Round(r.Mass)) == mass
+	}
+	return channel == r.Measurement
+}
+
+// apply runs the value through the chain of the transform for the given position
+func (c *transformChain) apply(i int, position string, v float64) float64 {
+	key := strconv.Itoa(i) + "/" + position
+	chain, ok := c.chains[key]
+	if !ok {
+		// the steps were validated when the chain was created
+		chain, _ = buildTransformers(c.transforms[i].Steps)
+		c.chains[key] = chain
+	}
+	for _, t := range chain {
+		v = t.Transform(v)
+	}
+	return v
+}
+
+// transform is the processor applying every transform, in order, to the readings and total pressure they select
+func (c *transformChain) transform(scan *Scan) *Scan {
+	for i, t := range c.transforms {
+		if t.Channel == channelTotalPressure {
+			scan.TotalPressure = c.apply(i, channelTotalPressure, scan.TotalPressure)
+			continue
+		}
+		for j, r := range scan.Readings {
+			if channelMatches(t.Channel, r) {
+				scan.Readings[j].Value = c.apply(i, r.Measurement+" "+formatMass(r.Mass), r.Value)
+			}
+		}
+	}
+	return scan
+}
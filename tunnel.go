@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/net/proxy"
+)
+
+var (
+	proxyTypeSOCKS5  = "socks5"
+	proxyTypeSSH     = "ssh"
+	proxyDialTimeout = 10 * time.Second
+)
+
+// tunnel forwards connections accepted on a local port to the RGA through a SOCKS5 proxy or an SSH jump host. The
+// connection to the RGA stays a plain local TCP connection, so read deadlines and the protocol client are unchanged
+type tunnel struct {
+	config    *cfg.Proxy
+	mu        sync.Mutex
+	sshClient *ssh.Client             // SSH connection to the jump host, redialled after it fails
+	listeners map[string]net.Listener // local listener per remote address
+}
+
+// validateProxy checks the proxy configuration
+func validateProxy(p *cfg.Proxy) error {
+	if p == nil {
+		return nil
+	}
+	if p.Addr == "" {
+		return fmt.Errorf("Proxy address cannot be blank")
+	}
+	switch p.Type {
+	case proxyTypeSOCKS5:
+	case proxyTypeSSH:
+		if p.Username == "" || (p.Password == "" && p.KeyFile == "") {
+			return fmt.Errorf("SSH proxy needs a username and a password or key file")
+		}
+		if p.KnownHostsFile == "" {
+			return fmt.Errorf("SSH proxy needs a known hosts file to verify %s", p.Addr)
+		}
+	default:
+		return fmt.Errorf("Unknown proxy type %s, expected socks5 or ssh", p.Type)
+	}
+	return nil
+}
+
+// newTunnel returns a tunnel through the configured proxy
+func newTunnel(p *cfg.Proxy) *tunnel {
+	return &tunnel{config: p, listeners: make(map[string]net.Listener)}
+}
+
+// localAddr returns the local address forwarded to the remote address, starting the forwarder on first use
+func (t *tunnel) localAddr(remote string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if l, ok := t.listeners[remote]; ok {
+		return l.Addr().String(), nil
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	t.listeners[remote] = l
+	go t.forward(l, remote)
+	return l.Addr().String(), nil
+}
+
+// forward copies every accepted connection to and from the remote address until the listener closes
+func (t *tunnel) forward(l net.Listener, remote string) {
+	for {
+		local, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go t.pipe(local, remote)
+	}
+}
+
+// pipe copies the local connection to and from the remote address until either side closes
+func (t *tunnel) pipe(local net.Conn, remote string) {
+	defer local.Close()
+	conn, err := t.dial(remote)
+	if err != nil {
+		log.Printf("Could not reach %s through %s proxy %s: %v", remote, t.config.Type, t.config.Addr, err)
+		return
+	}
+	defer conn.Close()
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(conn, local); done <- struct{}{} }()
+	go func() { io.Copy(local, conn); done <- struct{}{} }()
+	// either side closing ends the tunnelled connection
+	<-done
+}
+
+// dialOnce returns a local TCP connection forwarded to the remote address by a listener accepting only this one, so
+// probing many addresses doesn't leave a forwarder behind for each
+func (t *tunnel) dialOnce(ctx context.Context, remote string) (*net.TCPConn, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer l.Close()
+		local, err := l.Accept()
+		if err != nil {
+			return
+		}
+		t.pipe(local, remote)
+	}()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", l.Addr().String())
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return conn.(*net.TCPConn), nil
+}
+
+// dial connects to the remote address through the proxy
+func (t *tunnel) dial(remote string) (net.Conn, error) {
+	if t.config.Type == proxyTypeSOCKS5 {
+		var auth *proxy.Auth
+		if t.config.Username != "" {
+			auth = &proxy.Auth{User: t.config.Username, Password: t.config.Password}
+		}
+		d, err := proxy.SOCKS5("tcp", t.config.Addr, auth, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+		return d.Dial("tcp", remote)
+	}
+	client, err := t.ssh()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial("tcp", remote)
+	if err != nil {
+		// the jump host may have dropped the connection, it is redialled on the next attempt
+		t.mu.Lock()
+		if t.sshClient == client {
+			client.Close()
+			t.sshClient = nil
+		}
+		t.mu.Unlock()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// ssh returns the SSH connection to the jump host, connecting if needed
+func (t *tunnel) ssh() (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sshClient != nil {
+		return t.sshClient, nil
+	}
+	hostKeys, err := knownhosts.New(t.config.KnownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read known hosts: %v", err)
+	}
+	var auth []ssh.AuthMethod
+	if t.config.KeyFile != "" {
+		key, err := os.ReadFile(t.config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read SSH key: %v", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse SSH key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if t.config.Password != "" {
+		auth = append(auth, ssh.Password(t.config.Password))
+	}
+	client, err := ssh.Dial("tcp", t.config.Addr, &ssh.ClientConfig{
+		User:            t.config.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         proxyDialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.sshClient = client
+	return client, nil
+}
+
+// Close stops the forwarders and closes the SSH connection
+func (t *tunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for remote, l := range t.listeners {
+		l.Close()
+		delete(t.listeners, remote)
+	}
+	if t.sshClient != nil {
+		err := t.sshClient.Close()
+		t.sshClient = nil
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/mks"
+)
+
+var (
+	defaultWarmUpTimeout   = 2 * time.Minute
+	defaultWarmUpSettle    = 10 * time.Second
+	defaultWarmUpTolerance = 0.02
+)
+
+// warmUpFilament turns the filament on if TurnOn is set and waits for it to be ON with a stable emission before the
+// recording collects data. Every state change is annotated and the progress logged on every query
+func (e *MksRgaDatasource) warmUpFilament(session *mks.Session) error {
+	w := e.config.FilamentWarmUp
+	if w == nil {
+		return nil
+	}
+	if w.TurnOn {
+		if _, err := session.FilamentControl(mks.RGA_ON); err != nil {
+			return fmt.Errorf("Could not turn the filament on: %v", err)
+		}
+		e.annotate("Filament on", "", "filament")
+	}
+	timeout := time.Duration(w.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultWarmUpTimeout
+	}
+	settle := time.Duration(w.Settle) * time.Second
+	if settle <= 0 {
+		settle = defaultWarmUpSettle
+	}
+	tolerance := w.Tolerance
+	if tolerance <= 0 {
+		tolerance = defaultWarmUpTolerance
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var last string
+	err := session.WaitFilamentReady(ctx, mks.FilamentWarmUp{Settle: settle, Tolerance: tolerance, Progress: func(state string, emission float64, waited time.Duration) {
+		log.Printf("Filament %s, emission %v, waited %v", state, emission, waited.Round(time.Second))
+		if state != last {
+			last = state
+			e.annotate("Filament "+state, fmt.Sprintf("after %v of warm-up", waited.Round(time.Second)), "filament")
+		}
+	}})
+	if err != nil {
+		return err
+	}
+	e.filament = mks.RGA_FILAMENT_ON
+	e.annotate("Filament ready", "emission stable", "filament")
+	return nil
+}
+
+// warmingUp reports whether a FilamentStatus event showed the filament warming up again during the recording. Scans
+// are skipped until it reports ON, their readings wouldn't be valid. Events are only read during scans, so the state is
+// polled with FilamentInfo meanwhile. Scans resume anyway after the warm-up timeout, so a missed state can't stall the
+// recording
+func (e *MksRgaDatasource) warmingUp() bool {
+	if e.config.FilamentWarmUp == nil || e.filament != mks.RGA_FILAMENT_WARM_UP {
+		e.warmUpSince = time.Time{}
+		return false
+	}
+	if e.warmUpSince.IsZero() {
+		e.warmUpSince = time.Now()
+	}
+	resp, err := e.connection.FilamentInfo()
+	if err != nil {
+		log.Printf("Could not read the filament state: %v", err)
+	} else if state := fmt.Sprint(resp.Fields["SummaryState"].Value); state != e.filament {
+		e.filament = state
+		e.annotate("Filament status", "filament "+state, "filament")
+	}
+	if e.filament != mks.RGA_FILAMENT_WARM_UP {
+		e.warmUpSince = time.Time{}
+		return false
+	}
+	timeout := time.Duration(e.config.FilamentWarmUp.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultWarmUpTimeout
+	}
+	if waited := time.Since(e.warmUpSince); waited > timeout {
+		log.Printf("Filament still warming up after %v, resuming scans", waited.Round(time.Second))
+		e.filament, e.warmUpSince = "", time.Time{}
+		return false
+	}
+	return true
+}
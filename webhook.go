@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+var (
+	webhookEventScan      = "scan"
+	webhookEventAlarm     = "alarm"
+	webhookQueueSize      = 64
+	webhookTimeout        = 10 * time.Second
+	webhookRetryDelay     = time.Second
+	defaultWebhookRetries = 3
+)
+
+// WebhookEvent is the data the payload template of a webhook is executed with. Without a template it is posted as JSON
+type WebhookEvent struct {
+	Event         string             `json:"event"` // scan or alarm
+	Time          time.Time          `json:"time"`
+	Rig           string             `json:"rig,omitempty"`
+	Run           string             `json:"run,omitempty"`
+	Serial        string             `json:"serial,omitempty"`
+	Readings      map[string]float64 `json:"readings,omitempty"` // scan readings per measurement:mass
+	TotalPressure float64            `json:"totalPressure,omitempty"`
+	Alarm         string             `json:"alarm,omitempty"`
+	Active        bool               `json:"active"` // whether the alarm was raised or cleared
+}
+
+// webhook posts the events it subscribed to to a URL from its own goroutine, so slow endpoints never delay scans
+type webhook struct {
+	config   cfg.Webhook
+	tmpl     *template.Template // nil to post the event as JSON
+	events   map[string]bool
+	queue    chan *WebhookEvent
+	mu       sync.Mutex // guards closed against enqueue
+	closed   bool
+	lastScan time.Time
+}
+
+// webhookSink posts scan summaries and alarm events to user-defined URLs, e.g. Slack, PagerDuty or a LIMS
+type webhookSink struct {
+	hooks  []*webhook
+	client *http.Client
+	wg     sync.WaitGroup
+}
+
+var (
+	_ Sink        = (*webhookSink)(nil)
+	_ AlarmWriter = (*webhookSink)(nil)
+)
+
+// newWebhookSink parses the payload templates and starts a sender per webhook
+func newWebhookSink(config *cfg.Config) (*webhookSink, error) {
+	s := &webhookSink{client: &http.Client{Timeout: webhookTimeout}}
+	for i, c := range config.Webhooks {
+		if c.URL == "" {
+			return nil, fmt.Errorf("Webhook %d URL cannot be blank", i)
+		}
+		h := &webhook{config: c, events: make(map[string]bool), queue: make(chan *WebhookEvent, webhookQueueSize)}
+		if len(c.Events) == 0 {
+			h.events[webhookEventScan], h.events[webhookEventAlarm] = true, true
+		}
+		for _, ev := range c.Events {
+			if ev != webhookEventScan && ev != webhookEventAlarm {
+				return nil, fmt.Errorf("Unknown webhook event %s, expected scan or alarm", ev)
+			}
+			h.events[ev] = true
+		}
+		if c.Template != "" {
+			tmpl, err := template.New(c.URL).Funcs(template.FuncMap{"json": webhookJSON}).Parse(c.Template)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid webhook template for %s: %v", c.URL, err)
+			}
+			h.tmpl = tmpl
+		}
+		s.hooks = append(s.hooks, h)
+	}
+	for _, h := range s.hooks {
+		s.wg.Add(1)
+		go s.send(h)
+	}
+	return s, nil
+}
+
+// webhookJSON is the json template function, encoding a value as JSON so it can be embedded in a payload
+func webhookJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// Name implements the Sink interface
+func (s *webhookSink) Name() string {
+	return "webhook"
+}
+
+// Open implements the Sink interface, the senders run for the lifetime of the plugin
+func (s *webhookSink) Open() error {
+	return nil
+}
+
+// Write queues a summary of the scan for every webhook subscribed to scans, at most once per ScanInterval
+func (s *webhookSink) Write(scan *Scan) error {
+	var ev *WebhookEvent
+	for _, h := range s.hooks {
+		if !h.events[webhookEventScan] || scan.Time.Sub(h.lastScan) < time.Duration(h.config.ScanInterval)*time.Second {
+			continue
+		}
+		if ev == nil {
+			ev = &WebhookEvent{Event: webhookEventScan, Time: scan.Time, Rig: scan.Rig, Run: scan.Run, Serial: scan.Serial, TotalPressure: scan.TotalPressure, Readings: make(map[string]float64, len(scan.Readings))}
+			for _, r := range scan.Readings {
+				ev.Readings[readingKey(r)] = r.Value
+			}
+		}
+		h.lastScan = scan.Time
+		h.enqueue(ev)
+	}
+	return nil
+}
+
+// WriteAlarm implements the AlarmWriter interface
+func (s *webhookSink) WriteAlarm(a *AlarmEvent) error {
+	ev := &WebhookEvent{Event: webhookEventAlarm, Time: a.Time, Rig: a.Rig, Run: a.Run, Serial: a.Serial, Alarm: a.Class, Active: a.Active}
+	for _, h := range s.hooks {
+		if h.events[webhookEventAlarm] {
+			h.enqueue(ev)
+		}
+	}
+	return nil
+}
+
+// enqueue queues the event without blocking, dropping it if the endpoint is too far behind. Events queued once the
+// sink is closed are ignored
+func (h *webhook) enqueue(ev *WebhookEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	select {
+	case h.queue <- ev:
+	default:
+		log.Printf("Webhook %s queue full, dropped %s event", h.config.URL, ev.Event)
+	}
+}
+
+// send posts the queued events of the webhook until its queue closes
+func (s *webhookSink) send(h *webhook) {
+	defer s.wg.Done()
+	for ev := range h.queue {
+		if err := s.post(h, ev); err != nil {
+			log.Printf("Could not post %s event to webhook %s: %v", ev.Event, h.config.URL, err)
+		}
+	}
+}
+
+// post renders the payload and posts it, retrying with exponential backoff on network errors, 429 and 5xx responses
+func (s *webhookSink) post(h *webhook, ev *WebhookEvent) error {
+	var body bytes.Buffer
+	if h.tmpl != nil {
+		if err := h.tmpl.Execute(&body, ev); err != nil {
+			return err
+		}
+	} else if err := json.NewEncoder(&body).Encode(ev); err != nil {
+		return err
+	}
+	retries := h.config.Retries
+	if retries == 0 {
+		retries = defaultWebhookRetries
+	}
+	contentType := h.config.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(webhookRetryDelay << (attempt - 1))
+		}
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodPost, h.config.URL, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType)
+		for k, v := range h.config.Headers {
+			req.Header.Set(k, v)
+		}
+		var resp *http.Response
+		resp, err = s.client.Do(req)
+		if err != nil {
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode/100 == 2:
+			return nil
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5:
+			err = fmt.Errorf("webhook returned %s", resp.Status)
+		default:
+			return fmt.Errorf("webhook rejected the event: %s", resp.Status)
+		}
+	}
+	return err
+}
+
+// Flush implements the Sink interface, events are posted as soon as possible
+func (s *webhookSink) Flush() error {
+	return nil
+}
+
+// Close stops the senders once the queued events are posted
+func (s *webhookSink) Close() error {
+	for _, h := range s.hooks {
+		h.mu.Lock()
+		if !h.closed {
+			h.closed = true
+			close(h.queue)
+		}
+		h.mu.Unlock()
+	}
+	s.wg.Wait()
+	return nil
+}
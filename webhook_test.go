@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SSSOC-CAN/mks-rga-plugin/cfg"
+)
+
+func TestWebhookSinkWriteAfterClose(t *testing.T) {
+	s, err := newWebhookSink(&cfg.Config{Webhooks: []cfg.Webhook{{URL: "http://127.0.0.1:1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(&Scan{Time: time.Now()}); err != nil {
+		t.Errorf("Write() after Close() error = %v", err)
+	}
+	if err := s.WriteAlarm(&AlarmEvent{Time: time.Now(), Class: "pressure", Active: true}); err != nil {
+		t.Errorf("WriteAlarm() after Close() error = %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}